@@ -0,0 +1,188 @@
+import { Alerter } from "/static/js/alert.min.js";
+
+const CHUNK_SIZE = 5 * 1024 * 1024;
+
+export function attachUploadListeners() {
+   const zone = document.querySelector("#uploadZone");
+
+   if (!zone || zone.dataset.attached === "true") {
+      return;
+   }
+
+   zone.dataset.attached = "true";
+
+   const filesInput = document.querySelector("#uploadFiles");
+   const folderInput = document.querySelector("#uploadFolder");
+
+   document.querySelector("#chooseFiles").addEventListener("click", () => filesInput.click());
+   document.querySelector("#chooseFolder").addEventListener("click", () => folderInput.click());
+
+   filesInput.addEventListener("change", () => {
+      uploadAll(zone, Array.from(filesInput.files).map(file => ({ file, path: file.name })));
+   });
+
+   folderInput.addEventListener("change", () => {
+      uploadAll(zone, Array.from(folderInput.files).map(file => ({ file, path: file.webkitRelativePath || file.name })));
+   });
+
+   zone.addEventListener("dragover", (e) => {
+      e.preventDefault();
+      zone.classList.add("dragging");
+   });
+
+   zone.addEventListener("dragleave", () => {
+      zone.classList.remove("dragging");
+   });
+
+   zone.addEventListener("drop", async (e) => {
+      e.preventDefault();
+      zone.classList.remove("dragging");
+
+      // Entries must be collected before the first await, as the browser
+      // clears the data transfer once the event handler yields.
+      const entries = Array.from(e.dataTransfer.items)
+         .map(item => item.webkitGetAsEntry ? item.webkitGetAsEntry() : null)
+         .filter(entry => entry !== null);
+
+      if (entries.length === 0) {
+         uploadAll(zone, Array.from(e.dataTransfer.files).map(file => ({ file, path: file.name })));
+         return;
+      }
+
+      const files = [];
+
+      for (const entry of entries) {
+         files.push(...await readEntry(entry, ""));
+      }
+
+      uploadAll(zone, files);
+   });
+}
+
+/*
+ * readEntry walks a dropped file system entry, returning every file along
+ * with its path relative to the drop.
+ */
+async function readEntry(entry, prefix) {
+   if (entry.isFile) {
+      const file = await new Promise((resolve, reject) => entry.file(resolve, reject));
+      return [{ file, path: prefix + entry.name }];
+   }
+
+   const reader = entry.createReader();
+   const result = [];
+   let batch = [];
+
+   // readEntries returns directory contents in batches until it returns none
+   do {
+      batch = await new Promise((resolve, reject) => reader.readEntries(resolve, reject));
+
+      for (const child of batch) {
+         result.push(...await readEntry(child, `${prefix}${entry.name}/`));
+      }
+   } while (batch.length > 0);
+
+   return result;
+}
+
+async function uploadAll(zone, files) {
+   if (files.length === 0) {
+      return;
+   }
+
+   const alerter = new Alerter({ duration: 940000 });
+   const root = zone.dataset.root;
+   const overwrite = document.querySelector("#uploadOverwrite").checked;
+   const progress = document.querySelector("#uploadProgress");
+   const progressBar = document.querySelector("#uploadProgressBar");
+   const status = document.querySelector("#uploadStatus");
+
+   const totalBytes = files.reduce((sum, f) => sum + f.file.size, 0);
+   let completedBytes = 0;
+   let failures = 0;
+
+   progress.hidden = false;
+
+   for (const [index, { file, path }] of files.entries()) {
+      status.textContent = `Uploading ${path} (${index + 1} of ${files.length})`;
+
+      const onProgress = (loaded) => {
+         progressBar.value = totalBytes === 0 ? 100 : ((completedBytes + loaded) / totalBytes) * 100;
+      };
+
+      try {
+         if (file.size > CHUNK_SIZE) {
+            await uploadChunked(root, path, file, overwrite, onProgress);
+         } else {
+            await uploadMultipart(root, path, file, overwrite, onProgress);
+         }
+      } catch (err) {
+         failures++;
+         alerter.error(`Failed to upload ${path}: ${err.message}`);
+      }
+
+      completedBytes += file.size;
+      onProgress(0);
+   }
+
+   if (failures === 0) {
+      window.location.reload();
+      return;
+   }
+
+   status.textContent = `${files.length - failures} of ${files.length} files uploaded`;
+}
+
+function uploadMultipart(root, path, file, overwrite, onProgress) {
+   const params = new URLSearchParams();
+   params.append("root", root);
+   params.append("path", path);
+   params.append("overwrite", overwrite);
+
+   const body = new FormData();
+   body.append("file", file, file.name);
+
+   return send(`/uploads?${params}`, body, onProgress);
+}
+
+async function uploadChunked(root, path, file, overwrite, onProgress) {
+   const uploadID = crypto.randomUUID();
+
+   for (let offset = 0; offset < file.size; offset += CHUNK_SIZE) {
+      const params = new URLSearchParams();
+      params.append("root", root);
+      params.append("path", path);
+      params.append("uploadid", uploadID);
+      params.append("offset", offset);
+      params.append("total", file.size);
+      params.append("overwrite", overwrite);
+
+      const chunk = file.slice(offset, offset + CHUNK_SIZE);
+      await send(`/uploads/chunk?${params}`, chunk, (loaded) => onProgress(offset + loaded));
+   }
+}
+
+/*
+ * send posts a body with XMLHttpRequest, as fetch does not report upload
+ * progress.
+ */
+function send(url, body, onProgress) {
+   return new Promise((resolve, reject) => {
+      const xhr = new XMLHttpRequest();
+      xhr.open("POST", url);
+
+      xhr.upload.addEventListener("progress", (e) => onProgress(e.loaded));
+
+      xhr.addEventListener("load", () => {
+         if (xhr.status >= 200 && xhr.status < 300) {
+            resolve(xhr.responseText);
+            return;
+         }
+
+         reject(new Error(xhr.responseText.trim() || `HTTP ${xhr.status}`));
+      });
+
+      xhr.addEventListener("error", () => reject(new Error("network error")));
+      xhr.send(body);
+   });
+}
@@ -1,74 +1,98 @@
 import { Dialog } from "/static/js/dialog.min.js";
 import { Confirmer } from "/static/js/confirm.min.js";
 import { Alerter } from "/static/js/alert.min.js";
+import { attachUploadListeners } from "/static/js/pages/home-upload.js";
 
 document.addEventListener('DOMContentLoaded', () => {
    attachDeleteClickListeners();
    attachPreviewClickListeners();
+   attachUploadListeners();
+   attachFileActionListeners();
+   attachSelectionListeners();
+   attachDetailsListeners();
+   attachCompareListeners();
 
+   // The upload area is replaced with the listing, and marks itself once
+   // it has its listeners. Everything else is delegated from the body, so
+   // it keeps working through any swap without being bound twice.
    document.body.addEventListener("htmx:afterSettle", () => {
-      attachDeleteClickListeners();
-      attachPreviewClickListeners();
+      attachUploadListeners();
    });
 });
 
+/*
+ * attachDeleteClickListeners moves a file or folder to the trash once the
+ * user confirms.
+ */
 function attachDeleteClickListeners() {
-   document.querySelectorAll(".deleteLink").forEach(link => {
-      link.addEventListener("click", async (e) => {
-         const confirmer = new Confirmer();
-         const alerter = new Alerter({ duration: 940000 });
+   document.body.addEventListener("click", async (e) => {
+      const link = e.target.closest(".deleteLink");
 
-         const el = e.target.parentElement;
-         const root = el.dataset.root;
-         const name = el.dataset.name;
-         const isDir = el.dataset.isdir === "true";
+      if (!link) {
+         return;
+      }
 
-         const choice = await confirmer.yesNo(`Are you sure you want to delete ${name}?`);
+      const confirmer = new Confirmer();
+      const alerter = new Alerter({ duration: 940000 });
 
-         console.log(choice);
+      const root = link.dataset.root;
+      const name = link.dataset.name;
+      const isDir = link.dataset.isdir === "true";
 
-         if (!choice) {
-            return;
-         }
+      const choice = await confirmer.yesNo(`Move ${name} to the trash?`);
 
-         const options = {
-            method: "DELETE",
-         };
+      if (!choice) {
+         return;
+      }
 
-         const params = new URLSearchParams();
-         params.append("root", root);
-         params.append("name", name);
-         params.append("isdir", isDir);
+      const options = {
+         method: "DELETE",
+      };
 
-         const response = await fetch(`/uploads?${params}`, options);
-         const result = await response.text();
+      const params = new URLSearchParams();
+      params.append("root", root);
+      params.append("name", name);
+      params.append("isdir", isDir);
 
-         if (!response.ok) {
-            alerter.error(`Failed to delete file: ${result}`);
-            return;
-         }
+      const response = await fetch(`/uploads?${params}`, options);
+      const result = await response.text();
+
+      if (!response.ok) {
+         alerter.error(`Failed to delete file: ${result}`);
+         return;
+      }
 
-         window.location.reload();
-      });
+      window.location.reload();
    });
 }
 
 function attachPreviewClickListeners() {
-   document.querySelectorAll(".fileLink").forEach(link => {
-      link.addEventListener("click", async (e) => {
-         const el = e.target;
-         document.querySelector("#previewBody").innerHTML = await getPreviewContent(el);
-         document.querySelector("#previewWindow").show();
-      });
+   document.body.addEventListener("click", async (e) => {
+      const link = e.target.closest(".fileLink");
+
+      if (!link) {
+         return;
+      }
+
+      const previewBody = document.querySelector("#previewBody");
+
+      previewBody.innerHTML = await getPreviewContent(link);
+      htmx.process(previewBody);
+      document.querySelector("#previewWindow").show();
    });
 }
 
 async function getPreviewContent(el) {
-   const root = el.dataset.root;
-   const ext = el.dataset.ext;
-   const name = el.dataset.name;
+   const params = new URLSearchParams();
+   params.append("root", el.dataset.root);
+   params.append("ext", el.dataset.ext);
+   params.append("filename", el.dataset.name);
 
-   const response = await fetch(`/preview?root=${root}&ext=${ext}&filename=${name}`);
+   if (el.dataset.view) {
+      params.append("view", el.dataset.view);
+   }
+
+   const response = await fetch(`/preview?${params}`);
 
    if (!response.ok) {
       alert(`Failed to load preview: ${response.status}`);
@@ -79,3 +103,269 @@ async function getPreviewContent(el) {
    return result;
 }
 
+/*
+ * attachDetailsListeners opens the details drawer when its content loads,
+ * closes it from its close button, and compares a file with one of its
+ * old versions. All are delegated from the body, as the drawer is replaced
+ * whenever the listing is.
+ */
+function attachDetailsListeners() {
+   document.body.addEventListener("htmx:afterSwap", (e) => {
+      if (e.detail.target.id === "detailsDrawer") {
+         e.detail.target.hidden = false;
+      }
+   });
+
+   document.body.addEventListener("click", (e) => {
+      if (e.target.closest("#closeDetails")) {
+         document.querySelector("#detailsDrawer").hidden = true;
+      }
+
+      const versionLink = e.target.closest(".compareVersion");
+
+      if (versionLink) {
+         // Keep the click from reaching the dialog's outside-click handler
+         e.stopPropagation();
+
+         const params = new URLSearchParams();
+         params.append("left", versionLink.dataset.path);
+         params.append("leftversion", versionLink.dataset.version);
+         params.append("right", versionLink.dataset.path);
+
+         showComparison(params);
+      }
+   });
+}
+
+/*
+ * attachCompareListeners compares the two selected files in the preview
+ * dialog. With one file selected it asks for the other, so a file can be
+ * compared with one in another folder.
+ */
+function attachCompareListeners() {
+   document.body.addEventListener("click", async (e) => {
+      const compareButton = e.target.closest("#compareButton");
+
+      if (!compareButton) {
+         return;
+      }
+
+      // Keep the click from reaching the dialog's outside-click handler
+      e.stopPropagation();
+
+      const root = compareButton.dataset.root;
+      const selected = Array.from(document.querySelectorAll(".selectFile"))
+         .filter(cb => cb.checked)
+         .map(cb => joinPath(root, cb.value));
+
+      if (selected.length === 1) {
+         const other = await promptDialog(`Compare ${selected[0]}`, "File to compare with, relative to your home folder", joinPath(root, "/"));
+
+         if (!other) {
+            return;
+         }
+
+         selected.push(other);
+      }
+
+      if (selected.length !== 2) {
+         return;
+      }
+
+      const params = new URLSearchParams();
+      params.append("left", selected[0]);
+      params.append("right", selected[1]);
+
+      await showComparison(params);
+   });
+}
+
+/*
+ * showComparison shows the comparison of two files, or a file and one of
+ * its old versions, in the preview dialog.
+ */
+async function showComparison(params) {
+   const previewBody = document.querySelector("#previewBody");
+   const response = await fetch(`/compare?${params}`);
+
+   if (!response.ok) {
+      const alerter = new Alerter({ duration: 940000 });
+      alerter.error(`Failed to compare files: ${await response.text()}`);
+      return;
+   }
+
+   previewBody.innerHTML = await response.text();
+   htmx.process(previewBody);
+   document.querySelector("#previewWindow").show();
+}
+
+/*
+ * attachSelectionListeners enables the archive and compare buttons to
+ * match the selected files. The listing is looked up on each change, as
+ * it is replaced when the user browses.
+ */
+function attachSelectionListeners() {
+   const updateButtons = () => {
+      const checked = Array.from(document.querySelectorAll(".selectFile")).filter(cb => cb.checked).length;
+      const archiveButton = document.querySelector("#archiveButton");
+      const compareButton = document.querySelector("#compareButton");
+
+      if (archiveButton) {
+         archiveButton.disabled = checked === 0;
+      }
+
+      if (compareButton) {
+         compareButton.disabled = checked === 0 || checked > 2;
+      }
+   };
+
+   document.body.addEventListener("change", (e) => {
+      if (e.target.id === "selectAll") {
+         document.querySelectorAll(".selectFile").forEach(cb => cb.checked = e.target.checked);
+         updateButtons();
+         return;
+      }
+
+      if (e.target.classList.contains("selectFile")) {
+         updateButtons();
+      }
+   });
+}
+
+function attachFileActionListeners() {
+   document.body.addEventListener("click", async (e) => {
+      const link = e.target.closest(".fileActionLink");
+
+      if (link) {
+         // Keep the click from reaching the dialog's outside-click handler
+         e.stopPropagation();
+         await fileAction(link);
+         return;
+      }
+
+      const newFolderLink = e.target.closest("#newFolderLink");
+
+      if (newFolderLink) {
+         e.stopPropagation();
+         await newFolder(newFolderLink);
+      }
+   });
+}
+
+/*
+ * fileAction renames, moves, or copies the file or folder of an action
+ * link, asking for the new name or destination folder first.
+ */
+async function fileAction(link) {
+   const root = link.dataset.root;
+   const name = link.dataset.name;
+   const action = link.dataset.action;
+   let destination = "";
+
+   switch (action) {
+      case "rename": {
+         const newName = await promptDialog(`Rename ${name}`, "New name", name);
+
+         if (!newName || newName === name) {
+            return;
+         }
+
+         destination = joinPath(root, newName);
+         break;
+      }
+
+      case "move":
+      case "copy": {
+         const verb = action === "move" ? "Move" : "Copy";
+         const folder = await promptDialog(`${verb} ${name}`, "Destination folder, relative to your home folder", root || "/");
+
+         if (folder === null) {
+            return;
+         }
+
+         destination = joinPath(folder, name);
+
+         if (action === "copy" && destination === joinPath(root, name)) {
+            destination = joinPath(folder, `Copy of ${name}`);
+         }
+         break;
+      }
+   }
+
+   const confirmer = new Confirmer();
+   const choice = await confirmer.yesNo(`${action[0].toUpperCase()}${action.slice(1)} ${joinPath(root, name)} to ${destination}?`);
+
+   if (!choice) {
+      return;
+   }
+
+   const params = new URLSearchParams();
+   params.append("root", root);
+   params.append("name", name);
+   params.append("destination", destination);
+
+   const endpoint = action === "copy" ? "/files/copy" : "/files/move";
+   await postAction(`${endpoint}?${params}`, `Failed to ${action} ${name}`);
+}
+
+async function newFolder(newFolderLink) {
+   const name = await promptDialog("New Folder", "Folder name", "");
+
+   if (!name) {
+      return;
+   }
+
+   const params = new URLSearchParams();
+   params.append("root", newFolderLink.dataset.root);
+   params.append("name", name);
+
+   await postAction(`/folders?${params}`, `Failed to create ${name}`);
+}
+
+async function postAction(url, failureMessage) {
+   const alerter = new Alerter({ duration: 940000 });
+   const response = await fetch(url, { method: "POST" });
+   const result = await response.text();
+
+   if (!response.ok) {
+      alerter.error(`${failureMessage}: ${result}`);
+      return;
+   }
+
+   window.location.reload();
+}
+
+/*
+ * promptDialog shows the action dialog with a single text input. It resolves
+ * to the trimmed value, or null when cancelled.
+ */
+function promptDialog(title, label, value) {
+   const dialog = document.querySelector("#actionDialog");
+   const form = document.querySelector("#actionForm");
+   const input = document.querySelector("#actionInput");
+
+   document.querySelector("#actionTitle").textContent = title;
+   document.querySelector("#actionLabel").textContent = label;
+   input.value = value;
+
+   return new Promise(resolve => {
+      form.onsubmit = (e) => {
+         e.preventDefault();
+         dialog.hide();
+         resolve(input.value.trim());
+      };
+
+      document.querySelector("#actionCancel").onclick = () => {
+         dialog.hide();
+         resolve(null);
+      };
+
+      dialog.show();
+      input.focus();
+      input.select();
+   });
+}
+
+function joinPath(...parts) {
+   return parts.filter(p => p).join("/").replace(/\/+/g, "/");
+}
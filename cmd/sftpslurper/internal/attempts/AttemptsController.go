@@ -0,0 +1,103 @@
+package attempts
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/adampresley/adamgokit/httphelpers"
+	"github.com/adampresley/adamgokit/rendering"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/authlog"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/configuration"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/viewmodels"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/webauth"
+)
+
+type AttemptsHandlers interface {
+	AttemptsPage(w http.ResponseWriter, r *http.Request)
+	UnlockUser(w http.ResponseWriter, r *http.Request)
+}
+
+type AttemptsControllerConfig struct {
+	Config   *configuration.Config
+	Renderer rendering.TemplateRenderer
+	AuthLog  *authlog.AttemptLog
+	Guard    *authlog.Guard
+}
+
+type AttemptsController struct {
+	config   *configuration.Config
+	renderer rendering.TemplateRenderer
+	authLog  *authlog.AttemptLog
+	guard    *authlog.Guard
+}
+
+func NewAttemptsController(config AttemptsControllerConfig) AttemptsController {
+	return AttemptsController{
+		config:   config.Config,
+		renderer: config.Renderer,
+		authLog:  config.AuthLog,
+		guard:    config.Guard,
+	}
+}
+
+/*
+GET /auth-attempts?filteruser={filteruser}&result={result}
+*/
+func (c AttemptsController) AttemptsPage(w http.ResponseWriter, r *http.Request) {
+	c.renderAttemptsPage(w, r, "", false)
+}
+
+/*
+DELETE /auth-attempts/lockouts?user={user}
+*/
+func (c AttemptsController) UnlockUser(w http.ResponseWriter, r *http.Request) {
+	user := strings.TrimSpace(httphelpers.GetFromRequest[string](r, "user"))
+
+	if user == "" {
+		c.renderAttemptsPage(w, r, "No user provided", true)
+		return
+	}
+
+	slog.Info("unlocking user", "user", user)
+	c.guard.Unlock(user)
+
+	c.renderAttemptsPage(w, r, fmt.Sprintf("Unlocked %s", user), false)
+}
+
+func (c AttemptsController) renderAttemptsPage(w http.ResponseWriter, r *http.Request, message string, isError bool) {
+	pageName := "pages/auth-attempts"
+
+	viewData := viewmodels.AuthAttemptsPage{
+		BaseViewModel: viewmodels.BaseViewModel{
+			Version:            c.config.Version,
+			Message:            message,
+			IsError:            isError,
+			IsHtmx:             httphelpers.IsHtmx(r),
+			Viewer:             webauth.ViewerFromRequest(r),
+			JavascriptIncludes: []rendering.JavascriptInclude{},
+		},
+		Attempts:     []viewmodels.AuthAttempt{},
+		LockedUsers:  []viewmodels.LockedUser{},
+		FilterUser:   strings.TrimSpace(httphelpers.GetFromRequest[string](r, "filteruser")),
+		FilterResult: strings.TrimSpace(httphelpers.GetFromRequest[string](r, "result")),
+		Results: []string{
+			authlog.ResultSuccess,
+			authlog.ResultPartial,
+			authlog.ResultFailure,
+			authlog.ResultLocked,
+			authlog.ResultRateLimited,
+		},
+	}
+
+	for _, a := range c.authLog.Recent(viewData.FilterUser, viewData.FilterResult) {
+		viewData.Attempts = append(viewData.Attempts, viewmodels.NewAuthAttempt(a))
+	}
+
+	for _, l := range c.guard.LockedUsers() {
+		viewData.LockedUsers = append(viewData.LockedUsers, viewmodels.NewLockedUser(l))
+	}
+
+	c.renderer.Render(pageName, viewData, w)
+}
@@ -0,0 +1,351 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Protocols
+const (
+	ProtocolSftp string = "sftp"
+	ProtocolHttp string = "http"
+
+	// ProtocolSystem is for operations the server does on its own
+	ProtocolSystem string = "system"
+)
+
+// Results
+const (
+	ResultOK    string = "ok"
+	ResultError string = "error"
+)
+
+/*
+Record is a single file operation in the audit trail.
+*/
+type Record struct {
+	Time       time.Time `json:"time"`
+	SessionID  string    `json:"sessionID,omitempty"`
+	User       string    `json:"user,omitempty"`
+	RemoteAddr string    `json:"remoteAddr,omitempty"`
+	Protocol   string    `json:"protocol"`
+	Operation  string    `json:"operation"`
+	Path       string    `json:"path"`
+	Target     string    `json:"target,omitempty"`
+	Bytes      int64     `json:"bytes"`
+	DurationMs int64     `json:"durationMs"`
+	Result     string    `json:"result"`
+	Error      string    `json:"error,omitempty"`
+}
+
+/*
+Finish fills in the duration and result of a record from an operation
+that started at the given time.
+*/
+func (r *Record) Finish(started time.Time, err error) {
+	r.DurationMs = time.Since(started).Milliseconds()
+	r.Result = ResultOK
+
+	if err != nil {
+		r.Result = ResultError
+		r.Error = err.Error()
+	}
+}
+
+type LoggerConfig struct {
+	// FileName is the JSON Lines file to write to. When empty auditing is disabled.
+	FileName string
+
+	// MaxSizeMB is the size a file may grow to before it is rotated
+	MaxSizeMB int
+
+	// MaxFiles is the number of rotated files to keep
+	MaxFiles int
+}
+
+/*
+Logger writes audit records as JSON Lines to a file. When the file grows
+past the configured size it is rotated to file.1, file.1 to file.2, and so
+on. The oldest file is removed.
+*/
+type Logger struct {
+	mu sync.Mutex
+
+	fileName string
+	maxSize  int64
+	maxFiles int
+	file     *os.File
+	size     int64
+}
+
+func NewLogger(config LoggerConfig) (*Logger, error) {
+	var (
+		err error
+	)
+
+	if config.MaxSizeMB <= 0 {
+		config.MaxSizeMB = 10
+	}
+
+	if config.MaxFiles <= 0 {
+		config.MaxFiles = 5
+	}
+
+	result := &Logger{
+		fileName: config.FileName,
+		maxSize:  int64(config.MaxSizeMB) * 1024 * 1024,
+		maxFiles: config.MaxFiles,
+	}
+
+	if result.fileName == "" {
+		return result, nil
+	}
+
+	if err = result.open(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+/*
+Enabled returns true when records are being written to a file.
+*/
+func (l *Logger) Enabled() bool {
+	return l.fileName != ""
+}
+
+/*
+Log writes a record to the audit file.
+*/
+func (l *Logger) Log(record Record) {
+	if record.Time.IsZero() {
+		record.Time = time.Now()
+	}
+
+	slog.Debug("audit", "protocol", record.Protocol, "operation", record.Operation, "path", record.Path, "result", record.Result, "error", record.Error)
+
+	if !l.Enabled() {
+		return
+	}
+
+	b, err := json.Marshal(record)
+
+	if err != nil {
+		slog.Error("error marshaling audit record", "error", err)
+		return
+	}
+
+	b = append(b, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.size+int64(len(b)) > l.maxSize {
+		if err = l.rotate(); err != nil {
+			slog.Error("error rotating audit log", "error", err)
+		}
+	}
+
+	n, err := l.file.Write(b)
+	l.size += int64(n)
+
+	if err != nil {
+		slog.Error("error writing audit record", "error", err)
+	}
+}
+
+/*
+Query returns all records matching the filter across the current and
+rotated files, newest first. The files are opened while holding the lock,
+so a rotation can't rename them in between, and read after it is released,
+so writers aren't held up by a long query.
+*/
+func (l *Logger) Query(filter Filter) ([]Record, error) {
+	result := []Record{}
+
+	if !l.Enabled() {
+		return result, nil
+	}
+
+	files, err := l.openAll()
+
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+
+	if err != nil {
+		return result, err
+	}
+
+	for _, f := range files {
+		records, err := readRecords(f, filter)
+
+		if err != nil {
+			return result, err
+		}
+
+		result = append(result, records...)
+	}
+
+	slices.Reverse(result)
+	return result, nil
+}
+
+// openAll opens the rotated files that exist, oldest first
+func (l *Logger) openAll() ([]*os.File, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	result := []*os.File{}
+
+	for index := l.maxFiles; index >= 0; index-- {
+		fileName := l.rotatedName(index)
+		f, err := os.Open(fileName)
+
+		if os.IsNotExist(err) {
+			continue
+		}
+
+		if err != nil {
+			return result, fmt.Errorf("error opening audit file %s: %w", fileName, err)
+		}
+
+		result = append(result, f)
+	}
+
+	return result, nil
+}
+
+/*
+Close closes the current audit file.
+*/
+func (l *Logger) Close() error {
+	if l.file == nil {
+		return nil
+	}
+
+	return l.file.Close()
+}
+
+func (l *Logger) open() error {
+	var (
+		err  error
+		info os.FileInfo
+	)
+
+	if l.file, err = os.OpenFile(l.fileName, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644); err != nil {
+		return fmt.Errorf("error opening audit log file: %w", err)
+	}
+
+	if info, err = l.file.Stat(); err != nil {
+		return fmt.Errorf("error reading audit log file info: %w", err)
+	}
+
+	l.size = info.Size()
+	return nil
+}
+
+func (l *Logger) rotate() error {
+	if err := l.file.Close(); err != nil {
+		return err
+	}
+
+	_ = os.Remove(l.rotatedName(l.maxFiles))
+
+	for index := l.maxFiles - 1; index >= 0; index-- {
+		if err := os.Rename(l.rotatedName(index), l.rotatedName(index+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return l.open()
+}
+
+func (l *Logger) rotatedName(index int) string {
+	if index == 0 {
+		return l.fileName
+	}
+
+	return fmt.Sprintf("%s.%d", l.fileName, index)
+}
+
+// readRecords reads the records in an audit file that match the filter
+func readRecords(f *os.File, filter Filter) ([]Record, error) {
+	result := []Record{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		record := Record{}
+
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			continue
+		}
+
+		if filter.Matches(record) {
+			result = append(result, record)
+		}
+	}
+
+	return result, scanner.Err()
+}
+
+/*
+Filter narrows down audit records. Empty values match everything. User,
+Operation and Path are case-insensitive substring matches.
+*/
+type Filter struct {
+	User      string
+	Operation string
+	Path      string
+	Protocol  string
+	Result    string
+	Since     time.Time
+	Until     time.Time
+}
+
+func (f Filter) Matches(r Record) bool {
+	if f.User != "" && !containsFold(r.User, f.User) {
+		return false
+	}
+
+	if f.Operation != "" && !containsFold(r.Operation, f.Operation) {
+		return false
+	}
+
+	if f.Path != "" && !containsFold(r.Path, f.Path) && !containsFold(r.Target, f.Path) {
+		return false
+	}
+
+	if f.Protocol != "" && r.Protocol != f.Protocol {
+		return false
+	}
+
+	if f.Result != "" && r.Result != f.Result {
+		return false
+	}
+
+	if !f.Since.IsZero() && r.Time.Before(f.Since) {
+		return false
+	}
+
+	if !f.Until.IsZero() && r.Time.After(f.Until) {
+		return false
+	}
+
+	return true
+}
+
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
@@ -0,0 +1,65 @@
+package audit
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestQueryAcrossRotatedFiles(t *testing.T) {
+	logger, err := NewLogger(LoggerConfig{FileName: filepath.Join(t.TempDir(), "audit.jsonl"), MaxFiles: 3})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		_ = logger.Close()
+	})
+
+	// Rotate after every couple of records
+	logger.maxSize = 200
+	started := time.Now()
+
+	for index := 0; index < 6; index++ {
+		logger.Log(Record{Time: started.Add(time.Duration(index) * time.Second), User: "partner", Operation: "upload", Path: fmt.Sprintf("/file-%d.csv", index)})
+	}
+
+	records, err := logger.Query(Filter{})
+
+	if err != nil {
+		t.Fatalf("Query error = %v", err)
+	}
+
+	if len(records) == 0 || records[0].Path != "/file-5.csv" {
+		t.Fatalf("Query = %v, want the newest record first", records)
+	}
+
+	for index := 1; index < len(records); index++ {
+		if records[index].Time.After(records[index-1].Time) {
+			t.Errorf("record %d is newer than the one before it", index)
+		}
+	}
+
+	// Queries run while records are written and files rotated
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+
+		for index := 0; index < 50; index++ {
+			logger.Log(Record{User: "partner", Operation: "read", Path: "/file-0.csv"})
+		}
+	}()
+
+	for index := 0; index < 20; index++ {
+		if _, err = logger.Query(Filter{Operation: "read"}); err != nil {
+			t.Errorf("Query while writing error = %v", err)
+		}
+	}
+
+	wg.Wait()
+}
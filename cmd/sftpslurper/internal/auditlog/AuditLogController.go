@@ -0,0 +1,174 @@
+package auditlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/adampresley/adamgokit/httphelpers"
+	"github.com/adampresley/adamgokit/rendering"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/audit"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/configuration"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/viewmodels"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/webauth"
+)
+
+const (
+	maxRecordsOnPage = 500
+)
+
+type AuditLogHandlers interface {
+	AuditLogPage(w http.ResponseWriter, r *http.Request)
+	DownloadAuditLog(w http.ResponseWriter, r *http.Request)
+}
+
+type AuditLogControllerConfig struct {
+	Config   *configuration.Config
+	Renderer rendering.TemplateRenderer
+	AuditLog *audit.Logger
+}
+
+type AuditLogController struct {
+	config   *configuration.Config
+	renderer rendering.TemplateRenderer
+	auditLog *audit.Logger
+}
+
+func NewAuditLogController(config AuditLogControllerConfig) AuditLogController {
+	return AuditLogController{
+		config:   config.Config,
+		renderer: config.Renderer,
+		auditLog: config.AuditLog,
+	}
+}
+
+/*
+GET /audit-log?user={user}&operation={operation}&path={path}&protocol={protocol}&result={result}&since={since}&until={until}
+*/
+func (c AuditLogController) AuditLogPage(w http.ResponseWriter, r *http.Request) {
+	var (
+		err     error
+		records []audit.Record
+	)
+
+	pageName := "pages/audit-log"
+
+	viewData := viewmodels.AuditLogPage{
+		BaseViewModel: viewmodels.BaseViewModel{
+			Version:            c.config.Version,
+			Message:            "",
+			IsHtmx:             httphelpers.IsHtmx(r),
+			Viewer:             webauth.ViewerFromRequest(r),
+			JavascriptIncludes: []rendering.JavascriptInclude{},
+		},
+		Enabled:     c.auditLog.Enabled(),
+		Records:     []viewmodels.AuditRecord{},
+		Filter:      c.getFilterViewModel(r),
+		DownloadURL: template.URL("/audit-log/download?" + r.URL.RawQuery),
+	}
+
+	if records, err = c.auditLog.Query(c.getFilter(r)); err != nil {
+		slog.Error("error querying audit log", "error", err)
+		viewData.Message = "Unexpected error reading the audit log"
+		viewData.IsError = true
+
+		c.renderer.Render(pageName, viewData, w)
+		return
+	}
+
+	viewData.TotalMatches = len(records)
+
+	if len(records) > maxRecordsOnPage {
+		records = records[:maxRecordsOnPage]
+		viewData.IsWarning = true
+		viewData.Message = fmt.Sprintf("Showing the newest %d of %d matching records. Download to see them all.", maxRecordsOnPage, viewData.TotalMatches)
+	}
+
+	for _, record := range records {
+		viewData.Records = append(viewData.Records, viewmodels.NewAuditRecord(record))
+	}
+
+	c.renderer.Render(pageName, viewData, w)
+}
+
+/*
+GET /audit-log/download?user={user}&operation={operation}&path={path}&protocol={protocol}&result={result}&since={since}&until={until}
+*/
+func (c AuditLogController) DownloadAuditLog(w http.ResponseWriter, r *http.Request) {
+	records, err := c.auditLog.Query(c.getFilter(r))
+
+	if err != nil {
+		slog.Error("error querying audit log for download", "error", err)
+		http.Error(w, "Error reading the audit log", http.StatusInternalServerError)
+		return
+	}
+
+	fileName := fmt.Sprintf("audit-%s.jsonl", time.Now().Format("20060102-150405"))
+	w.Header().Set("Content-Disposition", "attachment; filename="+fileName)
+	w.Header().Set("Content-Type", "application/x-ndjson")
+
+	// Records are returned newest first. Files are easier to read oldest first.
+	encoder := json.NewEncoder(w)
+
+	for index := len(records) - 1; index >= 0; index-- {
+		if err = encoder.Encode(records[index]); err != nil {
+			slog.Error("error writing audit log download", "error", err)
+			return
+		}
+	}
+}
+
+func (c AuditLogController) getFilter(r *http.Request) audit.Filter {
+	return audit.Filter{
+		User:      strings.TrimSpace(httphelpers.GetFromRequest[string](r, "user")),
+		Operation: strings.TrimSpace(httphelpers.GetFromRequest[string](r, "operation")),
+		Path:      strings.TrimSpace(httphelpers.GetFromRequest[string](r, "path")),
+		Protocol:  strings.TrimSpace(httphelpers.GetFromRequest[string](r, "protocol")),
+		Result:    strings.TrimSpace(httphelpers.GetFromRequest[string](r, "result")),
+		Since:     parseFilterTime(httphelpers.GetFromRequest[string](r, "since"), false),
+		Until:     parseFilterTime(httphelpers.GetFromRequest[string](r, "until"), true),
+	}
+}
+
+func (c AuditLogController) getFilterViewModel(r *http.Request) viewmodels.AuditFilter {
+	return viewmodels.AuditFilter{
+		User:      strings.TrimSpace(httphelpers.GetFromRequest[string](r, "user")),
+		Operation: strings.TrimSpace(httphelpers.GetFromRequest[string](r, "operation")),
+		Path:      strings.TrimSpace(httphelpers.GetFromRequest[string](r, "path")),
+		Protocol:  strings.TrimSpace(httphelpers.GetFromRequest[string](r, "protocol")),
+		Result:    strings.TrimSpace(httphelpers.GetFromRequest[string](r, "result")),
+		Since:     strings.TrimSpace(httphelpers.GetFromRequest[string](r, "since")),
+		Until:     strings.TrimSpace(httphelpers.GetFromRequest[string](r, "until")),
+	}
+}
+
+/*
+parseFilterTime accepts the formats sent by date and datetime-local inputs.
+A date alone is the start of that day, or its end when endOfDay is true,
+so an "until" date includes the whole day.
+*/
+func parseFilterTime(value string, endOfDay bool) time.Time {
+	value = strings.TrimSpace(value)
+
+	for _, layout := range []string{"2006-01-02T15:04", "2006-01-02T15:04:05"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t
+		}
+	}
+
+	t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+
+	if err != nil {
+		return time.Time{}
+	}
+
+	if endOfDay {
+		return t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+
+	return t
+}
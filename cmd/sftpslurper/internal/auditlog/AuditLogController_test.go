@@ -0,0 +1,30 @@
+package auditlog
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseFilterTime(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		endOfDay bool
+		want     time.Time
+	}{
+		{name: "date", value: "2025-06-30", want: time.Date(2025, 6, 30, 0, 0, 0, 0, time.Local)},
+		{name: "date as the end of the day", value: "2025-06-30", endOfDay: true, want: time.Date(2025, 6, 30, 23, 59, 59, 999999999, time.Local)},
+		{name: "date and time", value: "2025-06-30T14:05", endOfDay: true, want: time.Date(2025, 6, 30, 14, 5, 0, 0, time.Local)},
+		{name: "date and time with seconds", value: " 2025-06-30T14:05:09 ", want: time.Date(2025, 6, 30, 14, 5, 9, 0, time.Local)},
+		{name: "blank", value: "", endOfDay: true},
+		{name: "invalid", value: "yesterday"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseFilterTime(tt.value, tt.endOfDay); !got.Equal(tt.want) {
+				t.Errorf("parseFilterTime(%q, %v) = %v, want %v", tt.value, tt.endOfDay, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package authlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Attempt results
+const (
+	ResultSuccess     string = "success"
+	ResultPartial     string = "partial"
+	ResultFailure     string = "failure"
+	ResultLocked      string = "locked"
+	ResultRateLimited string = "rate-limited"
+)
+
+/*
+Attempt is a single authentication attempt against the SFTP server.
+*/
+type Attempt struct {
+	Time          time.Time `json:"time"`
+	User          string    `json:"user"`
+	Method        string    `json:"method"`
+	RemoteIP      string    `json:"remoteIP"`
+	ClientVersion string    `json:"clientVersion"`
+	Result        string    `json:"result"`
+	Reason        string    `json:"reason,omitempty"`
+}
+
+type AttemptLogConfig struct {
+	// Size is how many attempts to keep in memory
+	Size int
+
+	// FileName is an optional JSON Lines file that every attempt is appended to
+	FileName string
+}
+
+/*
+AttemptLog keeps the most recent authentication attempts in a ring buffer,
+and optionally appends every attempt to a JSON Lines file.
+*/
+type AttemptLog struct {
+	mu sync.Mutex
+
+	entries []Attempt
+	next    int
+	full    bool
+	file    *os.File
+}
+
+func NewAttemptLog(config AttemptLogConfig) (*AttemptLog, error) {
+	var (
+		err error
+	)
+
+	if config.Size <= 0 {
+		config.Size = 500
+	}
+
+	result := &AttemptLog{
+		entries: make([]Attempt, config.Size),
+	}
+
+	if config.FileName != "" {
+		if result.file, err = os.OpenFile(config.FileName, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644); err != nil {
+			return nil, fmt.Errorf("error opening auth log file: %w", err)
+		}
+	}
+
+	return result, nil
+}
+
+/*
+Record adds an attempt to the log.
+*/
+func (l *AttemptLog) Record(attempt Attempt) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.entries[l.next] = attempt
+	l.next = (l.next + 1) % len(l.entries)
+
+	if l.next == 0 {
+		l.full = true
+	}
+
+	slog.Info("authentication attempt", "user", attempt.User, "method", attempt.Method, "remoteIP", attempt.RemoteIP, "result", attempt.Result, "reason", attempt.Reason)
+
+	if l.file == nil {
+		return
+	}
+
+	b, err := json.Marshal(attempt)
+
+	if err != nil {
+		slog.Error("error marshaling auth attempt", "error", err)
+		return
+	}
+
+	if _, err = l.file.Write(append(b, '\n')); err != nil {
+		slog.Error("error writing auth attempt to file", "error", err)
+	}
+}
+
+/*
+Recent returns attempts in the buffer, newest first. Empty filter values
+match everything. The user filter is a case-insensitive substring match.
+*/
+func (l *AttemptLog) Recent(user, result string) []Attempt {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	count := l.next
+
+	if l.full {
+		count = len(l.entries)
+	}
+
+	attempts := make([]Attempt, 0, count)
+	user = strings.ToLower(user)
+
+	for i := 1; i <= count; i++ {
+		index := (l.next - i + len(l.entries)) % len(l.entries)
+		attempt := l.entries[index]
+
+		if user != "" && !strings.Contains(strings.ToLower(attempt.User), user) {
+			continue
+		}
+
+		if result != "" && attempt.Result != result {
+			continue
+		}
+
+		attempts = append(attempts, attempt)
+	}
+
+	return attempts
+}
+
+/*
+Close closes the JSON Lines file, if there is one.
+*/
+func (l *AttemptLog) Close() error {
+	if l.file == nil {
+		return nil
+	}
+
+	return l.file.Close()
+}
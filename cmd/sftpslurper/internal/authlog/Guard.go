@@ -0,0 +1,211 @@
+package authlog
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+var (
+	ErrLocked      = errors.New("account is locked")
+	ErrRateLimited = errors.New("too many attempts from this address")
+)
+
+type GuardConfig struct {
+	// LockoutThreshold is the number of consecutive failures that lock an
+	// account. Zero disables lockout.
+	LockoutThreshold int
+
+	// LockoutDuration is how long an account stays locked.
+	LockoutDuration time.Duration
+
+	// RateLimit is the maximum number of attempts allowed from a single IP
+	// address per minute. Zero disables rate limiting.
+	RateLimit int
+}
+
+/*
+LockedUser describes an account that is currently locked out.
+*/
+type LockedUser struct {
+	User        string
+	Failures    int
+	LockedUntil time.Time
+}
+
+/*
+Guard simulates account lockout and per-IP rate limiting, so we can see
+how clients behave when a server starts refusing them.
+*/
+type Guard struct {
+	mu sync.Mutex
+
+	config      GuardConfig
+	failures    map[string]failureCount
+	lockedUntil map[string]time.Time
+	attempts    map[string][]time.Time
+	pruned      time.Time
+}
+
+// failureCount is a user's consecutive failed attempts, and when the last was
+type failureCount struct {
+	count int
+	last  time.Time
+}
+
+func NewGuard(config GuardConfig) *Guard {
+	if config.LockoutDuration <= 0 {
+		config.LockoutDuration = 15 * time.Minute
+	}
+
+	return &Guard{
+		config:      config,
+		failures:    map[string]failureCount{},
+		lockedUntil: map[string]time.Time{},
+		attempts:    map[string][]time.Time{},
+	}
+}
+
+/*
+Check is called before verifying credentials. It returns ErrLocked or
+ErrRateLimited when the attempt should be refused outright.
+*/
+func (g *Guard) Check(user, ip string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now()
+	g.prune(now)
+
+	if g.config.RateLimit > 0 {
+		windowStart := now.Add(-time.Minute)
+		recent := slices.DeleteFunc(g.attempts[ip], func(t time.Time) bool {
+			return t.Before(windowStart)
+		})
+
+		recent = append(recent, now)
+		g.attempts[ip] = recent
+
+		if len(recent) > g.config.RateLimit {
+			return fmt.Errorf("%w (%d in the last minute)", ErrRateLimited, len(recent))
+		}
+	}
+
+	if until, ok := g.lockedUntil[user]; ok {
+		if now.Before(until) {
+			return fmt.Errorf("%w until %s", ErrLocked, until.Format("2006-01-02 15:04:05"))
+		}
+
+		delete(g.lockedUntil, user)
+		delete(g.failures, user)
+	}
+
+	return nil
+}
+
+/*
+prune forgets addresses with no attempts in the last minute, expired
+lockouts, and failure counts with no failure for as long as a lockout
+lasts, at most once a minute. Without it every address that ever
+connected, and every user name ever tried, would be kept.
+*/
+func (g *Guard) prune(now time.Time) {
+	if now.Sub(g.pruned) < time.Minute {
+		return
+	}
+
+	g.pruned = now
+	windowStart := now.Add(-time.Minute)
+
+	for ip, attempts := range g.attempts {
+		if len(attempts) == 0 || attempts[len(attempts)-1].Before(windowStart) {
+			delete(g.attempts, ip)
+		}
+	}
+
+	for user, until := range g.lockedUntil {
+		if !now.Before(until) {
+			delete(g.lockedUntil, user)
+			delete(g.failures, user)
+		}
+	}
+
+	for user, failed := range g.failures {
+		if _, locked := g.lockedUntil[user]; !locked && now.Sub(failed.last) >= g.config.LockoutDuration {
+			delete(g.failures, user)
+		}
+	}
+}
+
+/*
+RecordFailure counts a failed attempt for a user, locking the account
+once the threshold is reached.
+*/
+func (g *Guard) RecordFailure(user string) {
+	if g.config.LockoutThreshold <= 0 {
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now()
+	failed := g.failures[user]
+	failed.count++
+	failed.last = now
+	g.failures[user] = failed
+
+	if failed.count >= g.config.LockoutThreshold {
+		g.lockedUntil[user] = now.Add(g.config.LockoutDuration)
+	}
+}
+
+/*
+RecordSuccess resets the failure count for a user.
+*/
+func (g *Guard) RecordSuccess(user string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	delete(g.failures, user)
+}
+
+/*
+Unlock clears a user's lockout and failure count.
+*/
+func (g *Guard) Unlock(user string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	delete(g.failures, user)
+	delete(g.lockedUntil, user)
+}
+
+/*
+LockedUsers returns all accounts that are currently locked.
+*/
+func (g *Guard) LockedUsers() []LockedUser {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now()
+	result := []LockedUser{}
+
+	for user, until := range g.lockedUntil {
+		if now.Before(until) {
+			result = append(result, LockedUser{
+				User:        user,
+				Failures:    g.failures[user].count,
+				LockedUntil: until,
+			})
+		}
+	}
+
+	slices.SortFunc(result, func(a, b LockedUser) int {
+		return a.LockedUntil.Compare(b.LockedUntil)
+	})
+
+	return result
+}
@@ -0,0 +1,136 @@
+package authlog
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestGuardLockout(t *testing.T) {
+	tests := []struct {
+		name      string
+		threshold int
+		failures  int
+		succeed   bool
+		wantErr   error
+	}{
+		{name: "under the threshold", threshold: 3, failures: 2},
+		{name: "at the threshold", threshold: 3, failures: 3, wantErr: ErrLocked},
+		{name: "past the threshold", threshold: 3, failures: 5, wantErr: ErrLocked},
+		{name: "success resets the count", threshold: 3, failures: 2, succeed: true},
+		{name: "lockout disabled", threshold: 0, failures: 10},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			guard := NewGuard(GuardConfig{LockoutThreshold: tt.threshold})
+
+			for index := 0; index < tt.failures; index++ {
+				guard.RecordFailure("alice")
+			}
+
+			if tt.succeed {
+				guard.RecordSuccess("alice")
+				guard.RecordFailure("alice")
+			}
+
+			if err := guard.Check("alice", "10.0.0.1"); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Check = %v, want %v", err, tt.wantErr)
+			}
+
+			if err := guard.Check("bob", "10.0.0.1"); err != nil {
+				t.Errorf("Check for another user = %v, want nil", err)
+			}
+		})
+	}
+}
+
+func TestGuardLockoutExpires(t *testing.T) {
+	guard := NewGuard(GuardConfig{LockoutThreshold: 1, LockoutDuration: 20 * time.Millisecond})
+	guard.RecordFailure("alice")
+
+	if err := guard.Check("alice", "10.0.0.1"); !errors.Is(err, ErrLocked) {
+		t.Fatalf("Check = %v, want %v", err, ErrLocked)
+	}
+
+	if locked := guard.LockedUsers(); len(locked) != 1 || locked[0].User != "alice" {
+		t.Errorf("LockedUsers = %v, want alice", locked)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+
+	if err := guard.Check("alice", "10.0.0.1"); err != nil {
+		t.Errorf("Check after the lockout expired = %v, want nil", err)
+	}
+
+	if locked := guard.LockedUsers(); len(locked) != 0 {
+		t.Errorf("LockedUsers after the lockout expired = %v, want none", locked)
+	}
+
+	guard.RecordFailure("alice")
+	guard.Unlock("alice")
+
+	if err := guard.Check("alice", "10.0.0.1"); err != nil {
+		t.Errorf("Check after unlocking = %v, want nil", err)
+	}
+}
+
+func TestGuardRateLimit(t *testing.T) {
+	guard := NewGuard(GuardConfig{RateLimit: 2})
+
+	for attempt := 1; attempt <= 3; attempt++ {
+		err := guard.Check("alice", "10.0.0.1")
+
+		if attempt <= 2 && err != nil {
+			t.Errorf("attempt %d = %v, want nil", attempt, err)
+		}
+
+		if attempt == 3 && !errors.Is(err, ErrRateLimited) {
+			t.Errorf("attempt %d = %v, want %v", attempt, err, ErrRateLimited)
+		}
+	}
+
+	if err := guard.Check("alice", "10.0.0.2"); err != nil {
+		t.Errorf("Check from another address = %v, want nil", err)
+	}
+}
+
+func TestGuardPrunesIdleAddresses(t *testing.T) {
+	guard := NewGuard(GuardConfig{RateLimit: 5})
+	_ = guard.Check("alice", "10.0.0.1")
+
+	// Age the attempt past the window, and let the next check prune
+	guard.attempts["10.0.0.1"][0] = time.Now().Add(-2 * time.Minute)
+	guard.pruned = time.Time{}
+	_ = guard.Check("alice", "10.0.0.2")
+
+	if _, ok := guard.attempts["10.0.0.1"]; ok {
+		t.Error("idle address was kept")
+	}
+
+	if _, ok := guard.attempts["10.0.0.2"]; !ok {
+		t.Error("active address was pruned")
+	}
+}
+
+func TestGuardPrunesOldFailures(t *testing.T) {
+	guard := NewGuard(GuardConfig{LockoutThreshold: 3, LockoutDuration: time.Minute})
+	guard.RecordFailure("random-name")
+	guard.RecordFailure("alice")
+
+	// Age the first failure past the lockout duration, and let the next
+	// check prune
+	failed := guard.failures["random-name"]
+	failed.last = time.Now().Add(-2 * time.Minute)
+	guard.failures["random-name"] = failed
+	guard.pruned = time.Time{}
+	_ = guard.Check("alice", "10.0.0.1")
+
+	if _, ok := guard.failures["random-name"]; ok {
+		t.Error("old failure count was kept")
+	}
+
+	if guard.failures["alice"].count != 1 {
+		t.Errorf("recent failure count = %d, want 1", guard.failures["alice"].count)
+	}
+}
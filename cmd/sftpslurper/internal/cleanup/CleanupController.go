@@ -0,0 +1,111 @@
+package cleanup
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/adampresley/adamgokit/httphelpers"
+	"github.com/adampresley/adamgokit/rendering"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/audit"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/configuration"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/retention"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/viewmodels"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/webauth"
+	"github.com/dustin/go-humanize"
+)
+
+type CleanupHandlers interface {
+	CleanupPage(w http.ResponseWriter, r *http.Request)
+	RunCleanup(w http.ResponseWriter, r *http.Request)
+}
+
+type CleanupControllerConfig struct {
+	Config   *configuration.Config
+	Renderer rendering.TemplateRenderer
+	Janitor  *retention.Janitor
+}
+
+type CleanupController struct {
+	config   *configuration.Config
+	renderer rendering.TemplateRenderer
+	janitor  *retention.Janitor
+}
+
+func NewCleanupController(config CleanupControllerConfig) CleanupController {
+	return CleanupController{
+		config:   config.Config,
+		renderer: config.Renderer,
+		janitor:  config.Janitor,
+	}
+}
+
+/*
+GET /cleanup
+
+Shows the retention rules and a dry run of the files they would purge now.
+*/
+func (c CleanupController) CleanupPage(w http.ResponseWriter, r *http.Request) {
+	c.renderCleanupPage(w, r, "", false)
+}
+
+/*
+POST /cleanup
+
+Purges the files the retention rules select now, rather than waiting for
+the schedule.
+*/
+func (c CleanupController) RunCleanup(w http.ResponseWriter, r *http.Request) {
+	purged, err := c.janitor.Purge(webauth.ViewerFromRequest(r).Name, audit.ProtocolHttp)
+
+	if err != nil {
+		slog.Error("error applying retention rules", "error", err)
+		c.renderCleanupPage(w, r, fmt.Sprintf("Unable to purge files: %v", err), true)
+		return
+	}
+
+	slog.Info("purged files by retention rules", "count", len(purged), "size", retention.TotalSize(purged))
+	c.renderCleanupPage(w, r, fmt.Sprintf("Purged %d files (%s)", len(purged), humanize.Bytes(uint64(retention.TotalSize(purged)))), false)
+}
+
+func (c CleanupController) renderCleanupPage(w http.ResponseWriter, r *http.Request, message string, isError bool) {
+	pageName := "pages/cleanup"
+
+	viewData := viewmodels.CleanupPage{
+		BaseViewModel: viewmodels.BaseViewModel{
+			Version:            c.config.Version,
+			Message:            message,
+			IsError:            isError,
+			IsHtmx:             httphelpers.IsHtmx(r),
+			Viewer:             webauth.ViewerFromRequest(r),
+			JavascriptIncludes: []rendering.JavascriptInclude{},
+		},
+		Rules:      c.janitor.Rules(),
+		Candidates: []viewmodels.CleanupCandidate{},
+	}
+
+	if interval := c.janitor.Interval(); interval > 0 {
+		viewData.Interval = fmt.Sprintf("%d minutes", int(interval.Minutes()))
+	}
+
+	candidates, err := c.janitor.Plan()
+
+	if err != nil {
+		slog.Error("error planning cleanup", "error", err)
+		viewData.Message = "Unexpected error reading the upload folder"
+		viewData.IsError = true
+	}
+
+	for _, candidate := range candidates {
+		viewData.Candidates = append(viewData.Candidates, viewmodels.CleanupCandidate{
+			Rule:    candidate.Rule,
+			Path:    candidate.Path,
+			Size:    humanize.Bytes(uint64(candidate.Size)),
+			ModTime: candidate.ModTime.Format("2006-01-02 15:04:05"),
+			Reason:  candidate.Reason,
+		})
+	}
+
+	viewData.TotalSize = humanize.Bytes(uint64(retention.TotalSize(candidates)))
+	c.renderer.Render(pageName, viewData, w)
+}
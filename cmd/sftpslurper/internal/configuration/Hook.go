@@ -0,0 +1,142 @@
+package configuration
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strings"
+)
+
+// Hook actions
+const (
+	HookActionUnzip    = "unzip"
+	HookActionDecrypt  = "decrypt"
+	HookActionValidate = "validate"
+	HookActionMove     = "move"
+	HookActionCommand  = "command"
+)
+
+var (
+	hookActions = []string{HookActionUnzip, HookActionDecrypt, HookActionValidate, HookActionMove, HookActionCommand}
+)
+
+/*
+Hook is a step run on a file once its upload completes. Path is a glob
+relative to the upload folder, where ** matches any number of folders,
+and a blank path matches every upload. The hooks that match an upload run
+in the order they are listed, and a hook that fails stops the rest.
+
+Unzip extracts a zip file into Folder, or into a folder named after the
+file beside it. Decrypt decrypts an OpenPGP file into Folder, or beside
+it, named without its extension, and the hooks after it see the decrypted
+file. Validate checks the file against the validation rules that match
+it, and fails when a check does. Move moves the file into Folder. Command runs a program
+with its arguments, where {file} is replaced by the file's full path and
+{path} by its path relative to the upload folder. Commands are stopped
+after TimeoutSeconds, or a minute when it is zero.
+
+	[
+	  {
+	    "name": "extract",
+	    "path": "partner/*.zip",
+	    "action": "unzip"
+	  },
+	  {
+	    "name": "decrypt",
+	    "path": "orders/*.xml.pgp",
+	    "action": "decrypt"
+	  },
+	  {
+	    "name": "check orders",
+	    "path": "orders/*.xml.pgp",
+	    "action": "validate"
+	  },
+	  {
+	    "name": "notify",
+	    "path": "orders/*.xml.pgp",
+	    "action": "command",
+	    "command": ["notify-orders", "{file}"]
+	  },
+	  {
+	    "name": "file it",
+	    "path": "orders/*.xml.pgp",
+	    "action": "move",
+	    "folder": "inbox/processed"
+	  }
+	]
+*/
+type Hook struct {
+	Name           string   `json:"name"`
+	Path           string   `json:"path"`
+	Action         string   `json:"action"`
+	Folder         string   `json:"folder"`
+	Command        []string `json:"command"`
+	TimeoutSeconds int      `json:"timeoutSeconds"`
+}
+
+/*
+LoadHooks reads the hooks file. A blank file name means there are no
+hooks.
+*/
+func LoadHooks(fileName string) ([]Hook, error) {
+	var (
+		err   error
+		b     []byte
+		hooks []Hook
+	)
+
+	if fileName == "" {
+		return nil, nil
+	}
+
+	if b, err = os.ReadFile(fileName); err != nil {
+		return nil, fmt.Errorf("error reading hooks file: %w", err)
+	}
+
+	if err = json.Unmarshal(b, &hooks); err != nil {
+		return nil, fmt.Errorf("error parsing hooks file: %w", err)
+	}
+
+	for index, hook := range hooks {
+		if strings.TrimSpace(hook.Name) == "" {
+			hooks[index].Name = fmt.Sprintf("%s %d", hook.Action, index+1)
+		}
+
+		name := hooks[index].Name
+		hooks[index].Path = strings.Trim(path.Clean("/"+strings.TrimSpace(hook.Path)), "/")
+
+		if _, err = path.Match(hooks[index].Path, ""); err != nil {
+			return nil, fmt.Errorf("hook '%s' has an invalid path: %w", name, err)
+		}
+
+		if !slices.Contains(hookActions, hook.Action) {
+			return nil, fmt.Errorf("hook '%s' has unknown action '%s'", name, hook.Action)
+		}
+
+		if hook.Folder != "" {
+			if hooks[index].Folder, err = CleanHome(hook.Folder); err != nil {
+				return nil, fmt.Errorf("hook '%s' has an invalid folder: %w", name, err)
+			}
+
+			if IsSystemPath(hooks[index].Folder) {
+				return nil, fmt.Errorf("hook '%s' can't use the system folder", name)
+			}
+		}
+
+		if hook.Action == HookActionMove && hooks[index].Folder == "" {
+			return nil, fmt.Errorf("hook '%s' needs a folder to move files to", name)
+		}
+
+		if hook.Action == HookActionCommand && len(hook.Command) == 0 {
+			return nil, fmt.Errorf("hook '%s' needs a command to run", name)
+		}
+
+		if hook.TimeoutSeconds < 0 {
+			return nil, fmt.Errorf("hook '%s' has a negative timeout", name)
+		}
+	}
+
+	return hooks, nil
+}
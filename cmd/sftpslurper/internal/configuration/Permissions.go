@@ -0,0 +1,46 @@
+package configuration
+
+import (
+	"slices"
+)
+
+// Permissions a user may have over their home folder, as used in the
+// permissions list of the users file.
+const (
+	PermissionList   string = "list"
+	PermissionRead   string = "read"
+	PermissionWrite  string = "write"
+	PermissionDelete string = "delete"
+	PermissionRename string = "rename"
+)
+
+// AllPermissions are what a user with no permissions list may do.
+var AllPermissions = []string{
+	PermissionList,
+	PermissionRead,
+	PermissionWrite,
+	PermissionDelete,
+	PermissionRename,
+}
+
+// IsPermission returns true for the names of permissions.
+func IsPermission(permission string) bool {
+	return slices.Contains(AllPermissions, permission)
+}
+
+/*
+EffectivePermissions returns what the user may do in their home folder.
+Users without a permissions list may do everything.
+*/
+func (u User) EffectivePermissions() []string {
+	if len(u.Permissions) == 0 {
+		return slices.Clone(AllPermissions)
+	}
+
+	return u.Permissions
+}
+
+// Can returns true when the user has the given permission.
+func (u User) Can(permission string) bool {
+	return slices.Contains(u.EffectivePermissions(), permission)
+}
@@ -0,0 +1,94 @@
+package configuration
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strings"
+)
+
+/*
+RetentionRule says which uploaded files are purged by the cleanup janitor.
+Path is a glob relative to the upload folder, where ** matches any number
+of folders. User limits the rule to that SFTP user's home folder. A rule
+with neither applies to every file.
+
+A file the rule applies to is purged when it is older than MaxAgeDays, when
+it isn't one of the KeepNewest newest files, or when the newer files
+already add up to MaxSizeMB. Zero turns a limit off.
+
+	[
+	  {
+	    "name": "old reports",
+	    "path": "reports/**",
+	    "maxAgeDays": 30
+	  },
+	  {
+	    "name": "partner drop box",
+	    "user": "partner",
+	    "keepNewest": 100,
+	    "maxSizeMB": 500
+	  }
+	]
+*/
+type RetentionRule struct {
+	Name       string `json:"name"`
+	Path       string `json:"path"`
+	User       string `json:"user"`
+	MaxAgeDays int    `json:"maxAgeDays"`
+	KeepNewest int    `json:"keepNewest"`
+	MaxSizeMB  int    `json:"maxSizeMB"`
+}
+
+/*
+LoadRetentionRules reads the retention rules file. A blank file name means
+there are no rules, and nothing is purged.
+*/
+func LoadRetentionRules(fileName string, users []User) ([]RetentionRule, error) {
+	var (
+		err   error
+		b     []byte
+		rules []RetentionRule
+	)
+
+	if fileName == "" {
+		return nil, nil
+	}
+
+	if b, err = os.ReadFile(fileName); err != nil {
+		return nil, fmt.Errorf("error reading retention rules file: %w", err)
+	}
+
+	if err = json.Unmarshal(b, &rules); err != nil {
+		return nil, fmt.Errorf("error parsing retention rules file: %w", err)
+	}
+
+	for index, rule := range rules {
+		if strings.TrimSpace(rule.Name) == "" {
+			rules[index].Name = fmt.Sprintf("rule %d", index+1)
+		}
+
+		name := rules[index].Name
+		rules[index].Path = strings.Trim(path.Clean("/"+strings.TrimSpace(rule.Path)), "/")
+
+		if _, err = path.Match(rules[index].Path, ""); err != nil {
+			return nil, fmt.Errorf("retention rule '%s' has an invalid path: %w", name, err)
+		}
+
+		if rule.User != "" && !slices.ContainsFunc(users, func(u User) bool { return u.Name == rule.User }) {
+			return nil, fmt.Errorf("retention rule '%s' has unknown user '%s'", name, rule.User)
+		}
+
+		if rule.MaxAgeDays < 0 || rule.KeepNewest < 0 || rule.MaxSizeMB < 0 {
+			return nil, fmt.Errorf("retention rule '%s' has a negative limit", name)
+		}
+
+		if rule.MaxAgeDays == 0 && rule.KeepNewest == 0 && rule.MaxSizeMB == 0 {
+			return nil, fmt.Errorf("retention rule '%s' needs maxAgeDays, keepNewest, or maxSizeMB", name)
+		}
+	}
+
+	return rules, nil
+}
@@ -1,5 +1,238 @@
 package configuration
 
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
 const (
 	UploadFolder = "./uploads"
+
+	// SystemFolderName is a hidden folder inside the upload folder where
+	// the server keeps its own data, such as partially uploaded files.
+	// It is never shown to or writable by clients.
+	SystemFolderName = ".slurper"
 )
+
+/*
+SystemPath returns an absolute path inside the system folder, creating
+the parent directory if needed.
+*/
+func SystemPath(parts ...string) (string, error) {
+	uploadFolderAbs, _ := filepath.Abs(UploadFolder)
+	result := filepath.Join(append([]string{uploadFolderAbs, SystemFolderName}, parts...)...)
+
+	if err := os.MkdirAll(filepath.Dir(result), 0755); err != nil {
+		return "", err
+	}
+
+	return result, nil
+}
+
+/*
+RelativeUploadPath returns a full path as a slash-separated path relative
+to the upload folder. It fails for the upload folder itself, and for
+anything outside it.
+*/
+func RelativeUploadPath(fullPath string) (string, error) {
+	uploadFolderAbs, _ := filepath.Abs(UploadFolder)
+	relativePath, err := filepath.Rel(uploadFolderAbs, fullPath)
+
+	if err != nil || relativePath == "." || relativePath == ".." || strings.HasPrefix(relativePath, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is not in the upload folder", fullPath)
+	}
+
+	return filepath.ToSlash(relativePath), nil
+}
+
+// UploadFullPath returns the full path of a path relative to the upload folder
+func UploadFullPath(relativePath string) string {
+	uploadFolderAbs, _ := filepath.Abs(UploadFolder)
+	return filepath.Join(uploadFolderAbs, filepath.FromSlash(relativePath))
+}
+
+/*
+StatusFile returns where the system folder keeps a JSON record about an
+uploaded file, such as the last hooks run on it. Each kind of record has
+its own folder, and the file is named after the upload's path relative to
+the upload folder, as in hooks/reports/june.csv.json.
+*/
+func StatusFile(folder, relativePath string) string {
+	uploadFolderAbs, _ := filepath.Abs(UploadFolder)
+	return filepath.Join(uploadFolderAbs, SystemFolderName, folder, filepath.FromSlash(relativePath)+".json")
+}
+
+/*
+LoadStatus reads the record kept in folder about an uploaded file into
+result. It returns false when there is none.
+*/
+func LoadStatus(folder, relativePath string, result any) (bool, error) {
+	b, err := os.ReadFile(StatusFile(folder, relativePath))
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	return true, json.Unmarshal(b, result)
+}
+
+// SaveStatus keeps a record in folder about an uploaded file
+func SaveStatus(folder, relativePath string, status any) error {
+	fileName := StatusFile(folder, relativePath)
+
+	if err := os.MkdirAll(filepath.Dir(fileName), 0755); err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(status)
+
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(fileName, b, 0644)
+}
+
+/*
+RemoveStatus removes the record kept in folder about an uploaded file, if
+any, and the folders it leaves empty.
+*/
+func RemoveStatus(folder, relativePath string) error {
+	fileName := StatusFile(folder, relativePath)
+
+	if err := os.Remove(fileName); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	uploadFolderAbs, _ := filepath.Abs(UploadFolder)
+	RemoveEmptyFolders(filepath.Dir(fileName), filepath.Join(uploadFolderAbs, SystemFolderName, folder))
+	return nil
+}
+
+/*
+RemoveEmptyFolders removes folder and its parents while they are empty,
+stopping at root, which is kept.
+*/
+func RemoveEmptyFolders(folder, root string) {
+	for folder != root && strings.HasPrefix(folder, root+string(filepath.Separator)) {
+		if os.Remove(folder) != nil {
+			return
+		}
+
+		folder = filepath.Dir(folder)
+	}
+}
+
+/*
+MoveStatus moves the record kept in folder about an uploaded file that was
+moved to toPath, or the records about every file in a moved folder. It
+does nothing when there are none.
+*/
+func MoveStatus(folder, fromPath, toPath string) error {
+	info, err := os.Stat(UploadFullPath(toPath))
+
+	if err != nil {
+		return err
+	}
+
+	from := StatusFile(folder, fromPath)
+	to := StatusFile(folder, toPath)
+
+	if info.IsDir() {
+		from = strings.TrimSuffix(from, ".json")
+		to = strings.TrimSuffix(to, ".json")
+	}
+
+	if _, err = os.Stat(from); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	// Records left at the new path by something deleted are out of date
+	if err = os.RemoveAll(to); err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+		return err
+	}
+
+	return os.Rename(from, to)
+}
+
+/*
+IsSystemPath returns true if a path relative to the upload folder points
+into the system folder.
+*/
+func IsSystemPath(relativePath string) bool {
+	cleaned := strings.TrimPrefix(filepath.ToSlash(filepath.Clean("/"+relativePath)), "/")
+	return cleaned == SystemFolderName || strings.HasPrefix(cleaned, SystemFolderName+"/")
+}
+
+/*
+CleanHome checks a user's home folder and returns it as a slash-separated
+path relative to the upload folder, without leading or trailing slashes.
+A blank home is the upload folder itself.
+*/
+func CleanHome(home string) (string, error) {
+	home = strings.Trim(filepath.ToSlash(strings.TrimSpace(home)), "/")
+
+	if home == "" {
+		return "", nil
+	}
+
+	for _, part := range strings.Split(home, "/") {
+		if part == ".." {
+			return "", fmt.Errorf("%s leaves the upload folder", home)
+		}
+	}
+
+	if IsSystemPath(home) {
+		return "", fmt.Errorf("%s is in the system folder", home)
+	}
+
+	return strings.TrimPrefix(filepath.ToSlash(filepath.Clean("/"+home)), "/"), nil
+}
+
+/*
+MatchGlob matches a slash-separated path against a glob, segment by
+segment. A ** segment matches any number of folders, including none.
+*/
+func MatchGlob(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	if len(pattern) == 0 {
+		return len(name) == 0
+	}
+
+	if pattern[0] == "**" {
+		for index := 0; index <= len(name); index++ {
+			if matchSegments(pattern[1:], name[index:]) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	if len(name) == 0 {
+		return false
+	}
+
+	if ok, _ := path.Match(pattern[0], name[0]); !ok {
+		return false
+	}
+
+	return matchSegments(pattern[1:], name[1:])
+}
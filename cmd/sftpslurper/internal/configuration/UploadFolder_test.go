@@ -0,0 +1,57 @@
+package configuration
+
+import "testing"
+
+func TestIsSystemPath(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		want bool
+	}{
+		{name: "system folder", path: ".slurper", want: true},
+		{name: "inside the system folder", path: ".slurper/trash/abc", want: true},
+		{name: "leading slash", path: "/.slurper/partial", want: true},
+		{name: "dot segments", path: "reports/../.slurper", want: true},
+		{name: "upload folder", path: "", want: false},
+		{name: "regular folder", path: "reports/june.csv", want: false},
+		{name: "similar name", path: ".slurper-old/file.txt", want: false},
+		{name: "nested folder of the same name", path: "reports/.slurper", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsSystemPath(tt.path); got != tt.want {
+				t.Errorf("IsSystemPath(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		path    string
+		want    bool
+	}{
+		{name: "exact", pattern: "orders/june.csv", path: "orders/june.csv", want: true},
+		{name: "star in a segment", pattern: "orders/*.csv", path: "orders/june.csv", want: true},
+		{name: "star doesn't cross folders", pattern: "orders/*.csv", path: "orders/2025/june.csv", want: false},
+		{name: "double star matches no folders", pattern: "orders/**/*.csv", path: "orders/june.csv", want: true},
+		{name: "double star matches many folders", pattern: "orders/**/*.csv", path: "orders/2025/06/june.csv", want: true},
+		{name: "leading double star", pattern: "**/*.zip", path: "partner/in/drop.zip", want: true},
+		{name: "trailing double star", pattern: "partner/**", path: "partner/in/drop.zip", want: true},
+		{name: "wrong extension", pattern: "**/*.zip", path: "partner/in/drop.csv", want: false},
+		{name: "too few segments", pattern: "orders/*/*.csv", path: "orders/june.csv", want: false},
+		{name: "question mark", pattern: "log-?.txt", path: "log-1.txt", want: true},
+		{name: "character class", pattern: "log-[0-9].txt", path: "log-a.txt", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MatchGlob(tt.pattern, tt.path); got != tt.want {
+				t.Errorf("MatchGlob(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+			}
+		})
+	}
+}
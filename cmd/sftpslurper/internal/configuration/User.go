@@ -1,6 +1,123 @@
 package configuration
 
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
 const (
 	SftpUserName string = "user"
 	SftpPassword string = "password"
 )
+
+/*
+User is an account that may log into the SFTP server. Users are loaded
+from the JSON file named by the USERS_FILE setting. When no file is
+provided a single user is created from SftpUserName and SftpPassword.
+
+AuthChain lists the authentication methods that must all succeed, in
+order, for the user to log in. For example, ["publickey", "password"]
+requires a key and then a password. When AuthChain is empty any single
+configured method is accepted.
+
+Home is a folder inside the upload folder that the user is placed in and
+can't leave. When blank they see the whole upload folder. Permissions
+limits what they may do there: list, read, write, delete, and rename.
+When empty they may do everything.
+
+Role is the user's role in the web interface when it uses the SFTP users
+to log in. Users without one get the WEB_DEFAULT_ROLE setting.
+*/
+type User struct {
+	Name                string   `json:"name"`
+	Password            string   `json:"password"`
+	PublicKeys          []string `json:"publicKeys"`
+	TotpSecret          string   `json:"totpSecret"`
+	KeyboardInteractive []Prompt `json:"keyboardInteractive"`
+	AuthChain           []string `json:"authChain"`
+	Home                string   `json:"home"`
+	Permissions         []string `json:"permissions"`
+	Role                string   `json:"role"`
+}
+
+/*
+Prompt is a single question asked during keyboard-interactive
+authentication. When Totp is true the answer is checked against
+the user's TotpSecret instead of Answer.
+*/
+type Prompt struct {
+	Question string `json:"question"`
+	Answer   string `json:"answer"`
+	Echo     bool   `json:"echo"`
+	Totp     bool   `json:"totp"`
+}
+
+// Authentication method names, as used by SSH and in AuthChain.
+const (
+	AuthMethodPassword            string = "password"
+	AuthMethodPublicKey           string = "publickey"
+	AuthMethodKeyboardInteractive string = "keyboard-interactive"
+)
+
+/*
+LoadUsers reads users from a JSON file. If fileName is empty the default
+user is returned.
+*/
+func LoadUsers(fileName string) ([]User, error) {
+	var (
+		err   error
+		b     []byte
+		users []User
+	)
+
+	if fileName == "" {
+		return []User{DefaultUser()}, nil
+	}
+
+	if b, err = os.ReadFile(fileName); err != nil {
+		return nil, fmt.Errorf("error reading users file: %w", err)
+	}
+
+	if err = json.Unmarshal(b, &users); err != nil {
+		return nil, fmt.Errorf("error parsing users file: %w", err)
+	}
+
+	for index, u := range users {
+		if strings.TrimSpace(u.Name) == "" {
+			return nil, fmt.Errorf("users file contains a user with no name")
+		}
+
+		if users[index].Home, err = CleanHome(u.Home); err != nil {
+			return nil, fmt.Errorf("user '%s' has an invalid home: %w", u.Name, err)
+		}
+
+		for _, permission := range u.Permissions {
+			if !IsPermission(permission) {
+				return nil, fmt.Errorf("user '%s' has unknown permission '%s'", u.Name, permission)
+			}
+		}
+
+		if u.Role != "" && !IsRole(u.Role) {
+			return nil, fmt.Errorf("user '%s' has unknown role '%s'", u.Name, u.Role)
+		}
+
+		for _, method := range u.AuthChain {
+			if method != AuthMethodPassword && method != AuthMethodPublicKey && method != AuthMethodKeyboardInteractive {
+				return nil, fmt.Errorf("user '%s' has unknown auth method '%s' in authChain", u.Name, method)
+			}
+		}
+	}
+
+	return users, nil
+}
+
+// DefaultUser returns the built-in user, who is an admin of the web interface.
+func DefaultUser() User {
+	return User{
+		Name:     SftpUserName,
+		Password: SftpPassword,
+		Role:     RoleAdmin,
+	}
+}
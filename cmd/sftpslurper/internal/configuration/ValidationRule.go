@@ -0,0 +1,128 @@
+package configuration
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+/*
+ValidationRule is a set of checks run on a file once its upload completes.
+Path is a glob relative to the upload folder, where ** matches any number
+of folders, and a blank path matches every upload. Every rule that matches
+an upload is checked, and every check in a rule is run.
+
+FileName is a regular expression the file's name must match. MaxSizeMB is
+the largest the file may be, where zero turns the limit off. Csv checks
+the file is CSV with the given number of columns on every row, and a first
+row that matches Header. JsonSchema is a JSON Schema file the file must
+be valid against, and Xml checks the file is well-formed XML.
+
+	[
+	  {
+	    "name": "partner orders",
+	    "path": "partner/orders/*",
+	    "fileName": "^orders_[0-9]{8}\\.csv$",
+	    "maxSizeMB": 50,
+	    "csv": {
+	      "columns": 4,
+	      "header": ["id", "date", "sku", "quantity"]
+	    }
+	  },
+	  {
+	    "name": "invoices",
+	    "path": "partner/invoices/*.json",
+	    "jsonSchema": "schemas/invoice.json"
+	  }
+	]
+*/
+type ValidationRule struct {
+	Name       string     `json:"name"`
+	Path       string     `json:"path"`
+	FileName   string     `json:"fileName"`
+	MaxSizeMB  int        `json:"maxSizeMB"`
+	Csv        *CsvFormat `json:"csv"`
+	JsonSchema string     `json:"jsonSchema"`
+	Xml        bool       `json:"xml"`
+}
+
+/*
+CsvFormat describes the CSV files a validation rule expects. Columns is
+the number of fields on every row, and zero allows any number as long as
+every row has the same. Header is the first row, compared without regard
+to case. Delimiter is a single character, and a comma when blank.
+*/
+type CsvFormat struct {
+	Columns   int      `json:"columns"`
+	Header    []string `json:"header"`
+	Delimiter string   `json:"delimiter"`
+}
+
+/*
+LoadValidationRules reads the validation rules file. A blank file name
+means there are no rules, and uploads aren't checked.
+*/
+func LoadValidationRules(fileName string) ([]ValidationRule, error) {
+	var (
+		err   error
+		b     []byte
+		rules []ValidationRule
+	)
+
+	if fileName == "" {
+		return nil, nil
+	}
+
+	if b, err = os.ReadFile(fileName); err != nil {
+		return nil, fmt.Errorf("error reading validation rules file: %w", err)
+	}
+
+	if err = json.Unmarshal(b, &rules); err != nil {
+		return nil, fmt.Errorf("error parsing validation rules file: %w", err)
+	}
+
+	for index, rule := range rules {
+		if strings.TrimSpace(rule.Name) == "" {
+			rules[index].Name = fmt.Sprintf("rule %d", index+1)
+		}
+
+		name := rules[index].Name
+		rules[index].Path = strings.Trim(path.Clean("/"+strings.TrimSpace(rule.Path)), "/")
+
+		if _, err = path.Match(rules[index].Path, ""); err != nil {
+			return nil, fmt.Errorf("validation rule '%s' has an invalid path: %w", name, err)
+		}
+
+		if _, err = regexp.Compile(rule.FileName); err != nil {
+			return nil, fmt.Errorf("validation rule '%s' has an invalid file name pattern: %w", name, err)
+		}
+
+		if rule.MaxSizeMB < 0 {
+			return nil, fmt.Errorf("validation rule '%s' has a negative size limit", name)
+		}
+
+		if rule.Csv != nil {
+			if rule.Csv.Columns < 0 {
+				return nil, fmt.Errorf("validation rule '%s' has a negative column count", name)
+			}
+
+			if rule.Csv.Columns > 0 && len(rule.Csv.Header) > 0 && rule.Csv.Columns != len(rule.Csv.Header) {
+				return nil, fmt.Errorf("validation rule '%s' has a header of %d columns, but expects %d", name, len(rule.Csv.Header), rule.Csv.Columns)
+			}
+
+			if rule.Csv.Delimiter != "" && utf8.RuneCountInString(rule.Csv.Delimiter) != 1 {
+				return nil, fmt.Errorf("validation rule '%s' has a delimiter that isn't a single character", name)
+			}
+		}
+
+		if rule.FileName == "" && rule.MaxSizeMB == 0 && rule.Csv == nil && rule.JsonSchema == "" && !rule.Xml {
+			return nil, fmt.Errorf("validation rule '%s' needs fileName, maxSizeMB, csv, jsonSchema, or xml", name)
+		}
+	}
+
+	return rules, nil
+}
@@ -0,0 +1,137 @@
+package configuration
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Ways to log into the web interface, as used by the WEB_AUTH setting.
+const (
+	WebAuthNone  string = ""
+	WebAuthLocal string = "local"
+	WebAuthSftp  string = "sftp"
+)
+
+/*
+Roles in the web interface. Viewers see their home folder and may do what
+their permissions allow. Admins see the whole upload folder, may switch to
+the view of any SFTP user, and see the audit log and authentication
+attempts.
+*/
+const (
+	RoleViewer string = "viewer"
+	RoleAdmin  string = "admin"
+)
+
+// viewerPermissions are given to local viewers with no permissions list.
+var viewerPermissions = []string{PermissionList, PermissionRead}
+
+/*
+WebUser is an account that may log into the web interface. With WEB_AUTH
+set to "local" they are read from the JSON file named by WEB_USERS_FILE.
+With "sftp" they are the SFTP users that have a password, and keep the
+home folder and permissions they have over SFTP.
+*/
+type WebUser struct {
+	Name        string   `json:"name"`
+	Password    string   `json:"password"`
+	Role        string   `json:"role"`
+	Home        string   `json:"home"`
+	Permissions []string `json:"permissions"`
+}
+
+/*
+LoadWebUsers returns the users who may log into the web interface, or nil
+when no login is required.
+*/
+func LoadWebUsers(config *Config) ([]WebUser, error) {
+	var (
+		err   error
+		b     []byte
+		users []WebUser
+	)
+
+	if !IsRole(config.WebDefaultRole) {
+		return nil, fmt.Errorf("unknown web default role '%s'", config.WebDefaultRole)
+	}
+
+	switch config.WebAuth {
+	case WebAuthNone:
+		return nil, nil
+
+	case WebAuthSftp:
+		for _, u := range config.Users {
+			if u.Password == "" {
+				continue
+			}
+
+			users = append(users, WebUser{
+				Name:        u.Name,
+				Password:    u.Password,
+				Role:        u.Role,
+				Home:        u.Home,
+				Permissions: u.EffectivePermissions(),
+			})
+		}
+
+	case WebAuthLocal:
+		if config.WebUsersFile == "" {
+			return nil, fmt.Errorf("webauth is 'local' but no web users file is set")
+		}
+
+		if b, err = os.ReadFile(config.WebUsersFile); err != nil {
+			return nil, fmt.Errorf("error reading web users file: %w", err)
+		}
+
+		if err = json.Unmarshal(b, &users); err != nil {
+			return nil, fmt.Errorf("error parsing web users file: %w", err)
+		}
+
+	default:
+		return nil, fmt.Errorf("unknown webauth '%s'", config.WebAuth)
+	}
+
+	for index, u := range users {
+		if strings.TrimSpace(u.Name) == "" || u.Password == "" {
+			return nil, fmt.Errorf("web users must have a name and a password")
+		}
+
+		if u.Role == "" {
+			users[index].Role = config.WebDefaultRole
+		} else if !IsRole(u.Role) {
+			return nil, fmt.Errorf("web user '%s' has unknown role '%s'", u.Name, u.Role)
+		}
+
+		if users[index].Home, err = CleanHome(u.Home); err != nil {
+			return nil, fmt.Errorf("web user '%s' has an invalid home: %w", u.Name, err)
+		}
+
+		for _, permission := range u.Permissions {
+			if !IsPermission(permission) {
+				return nil, fmt.Errorf("web user '%s' has unknown permission '%s'", u.Name, permission)
+			}
+		}
+
+		switch {
+		case users[index].Role == RoleAdmin:
+			users[index].Home = ""
+			users[index].Permissions = AllPermissions
+
+		case len(u.Permissions) == 0:
+			users[index].Permissions = viewerPermissions
+		}
+	}
+
+	if len(users) == 0 {
+		return nil, fmt.Errorf("webauth is '%s' but there are no users with a password", config.WebAuth)
+	}
+
+	return users, nil
+}
+
+// IsRole returns true for the names of web interface roles.
+func IsRole(role string) bool {
+	return role == RoleViewer || role == RoleAdmin
+}
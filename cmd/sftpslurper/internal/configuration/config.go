@@ -1,7 +1,10 @@
 package configuration
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"strings"
@@ -13,41 +16,276 @@ type Config struct {
 	LogLevel string `flag:"loglevel" env:"LOG_LEVEL" default:"debug" description:"The log level to use. Valid values are 'debug', 'info', 'warn', and 'error'"`
 	Host     string `flag:"h" env:"HOST" default:"localhost:8080" description:"The address and port to bind the HTTP server to"`
 	SftpHost string `flag:"sftph" env:"SFTP_HOST" default:"localhost:2200" description:"Address to listen on for the SFTP server"`
-	Version  string
+
+	SshProfile           string `flag:"sshprofile" env:"SSH_PROFILE" default:"compatible" description:"SSH algorithm profile. Valid values are 'compatible', 'modern', 'openssh-default', 'legacy-2010', and 'fips-like'"`
+	SshCiphers           string `flag:"sshciphers" env:"SSH_CIPHERS" default:"" description:"Comma-separated list of ciphers. Overrides the profile"`
+	SshKeyExchanges      string `flag:"sshkex" env:"SSH_KEX" default:"" description:"Comma-separated list of key exchange algorithms. Overrides the profile"`
+	SshMACs              string `flag:"sshmacs" env:"SSH_MACS" default:"" description:"Comma-separated list of MAC algorithms. Overrides the profile"`
+	SshHostKeyAlgorithms string `flag:"sshhostkeys" env:"SSH_HOST_KEY_ALGORITHMS" default:"" description:"Comma-separated list of host key algorithms. Overrides the profile"`
+
+	SshServerPreset  string `flag:"sshpreset" env:"SSH_SERVER_PRESET" default:"" description:"Mimic a vendor's server identification. Valid values are 'golang', 'openssh-ubuntu', 'openssh-legacy', 'proftpd', 'serv-u', and 'goanywhere'"`
+	SshServerVersion string `flag:"sshversion" env:"SSH_SERVER_VERSION" default:"" description:"SSH identification string to announce. Must start with 'SSH-2.0-'. Overrides the preset"`
+	SshBanner        string `flag:"sshbanner" env:"SSH_BANNER" default:"" description:"Banner message shown to clients before login. Use \\n for line breaks"`
+	SshBannerFile    string `flag:"sshbannerfile" env:"SSH_BANNER_FILE" default:"" description:"Path to a file containing the pre-login banner. Overrides the banner message"`
+
+	UsersFile string `flag:"usersfile" env:"USERS_FILE" default:"" description:"Path to a JSON file of SFTP users. When blank the default user is used"`
+
+	AuthLogSize          int    `flag:"authlogsize" env:"AUTH_LOG_SIZE" default:"500" description:"Number of authentication attempts to keep in memory"`
+	AuthLogFile          string `flag:"authlogfile" env:"AUTH_LOG_FILE" default:"" description:"Optional JSON Lines file to append every authentication attempt to"`
+	AuthLockoutThreshold int    `flag:"authlockout" env:"AUTH_LOCKOUT_THRESHOLD" default:"0" description:"Consecutive failures before an account is locked. 0 disables lockout"`
+	AuthLockoutMinutes   int    `flag:"authlockoutminutes" env:"AUTH_LOCKOUT_MINUTES" default:"15" description:"How long a locked account stays locked, in minutes"`
+	AuthRateLimit        int    `flag:"authratelimit" env:"AUTH_RATE_LIMIT" default:"0" description:"Maximum authentication attempts per IP address per minute. 0 disables rate limiting"`
+
+	AuditLogFile      string `flag:"auditlogfile" env:"AUDIT_LOG_FILE" default:"./audit.jsonl" description:"JSON Lines file to record every file operation to. Leave blank to disable"`
+	AuditLogMaxSizeMB int    `flag:"auditlogmaxsize" env:"AUDIT_LOG_MAX_SIZE_MB" default:"10" description:"Size in megabytes at which the audit log file is rotated"`
+	AuditLogMaxFiles  int    `flag:"auditlogmaxfiles" env:"AUDIT_LOG_MAX_FILES" default:"5" description:"Number of rotated audit log files to keep"`
+
+	CollisionPolicy string `flag:"collisionpolicy" env:"COLLISION_POLICY" default:"overwrite" description:"What happens when an upload's file name is taken. Valid values are 'overwrite', 'version' (overwrite and keep old copies), 'timestamp', and 'counter' (save the upload with a timestamp or counter suffix)"`
+	VersionsToKeep  int    `flag:"versionstokeep" env:"VERSIONS_TO_KEEP" default:"5" description:"Number of old copies of each file kept when the collision policy is 'version'"`
+
+	TrashMaxAgeDays int `flag:"trashdays" env:"TRASH_MAX_AGE_DAYS" default:"30" description:"Days deleted files stay in the trash before they are purged. 0 keeps them until purged by hand"`
+
+	HooksFile string `flag:"hooksfile" env:"HOOKS_FILE" default:"" description:"Path to a JSON file of hooks to run on files once their upload completes"`
+
+	ValidationFile string `flag:"validationfile" env:"VALIDATION_FILE" default:"" description:"Path to a JSON file of validation rules to check files against once their upload completes"`
+
+	RetentionFile            string `flag:"retentionfile" env:"RETENTION_FILE" default:"" description:"Path to a JSON file of retention rules for purging old uploads. When blank nothing is purged"`
+	RetentionIntervalMinutes int    `flag:"retentioninterval" env:"RETENTION_INTERVAL_MINUTES" default:"60" description:"How often the retention rules are applied, in minutes"`
+
+	PgpKeyring    string `flag:"pgpkeyring" env:"PGP_KEYRING" default:"" description:"Path to an OpenPGP keyring used to decrypt uploaded .pgp, .gpg, and .asc files and check their signatures"`
+	PgpPassphrase string `flag:"pgppassphrase" env:"PGP_PASSPHRASE" default:"" description:"Passphrase for the private keys in the keyring"`
+	PgpEncryptTo  string `flag:"pgpencryptto" env:"PGP_ENCRYPT_TO" default:"" description:"Key ID, fingerprint, or email of a key in the keyring that files read over SFTP are encrypted to. When blank files are read as they are"`
+
+	WebAuth          string `flag:"webauth" env:"WEB_AUTH" default:"" description:"Require a login for the web interface. Valid values are '' (no login), 'local' (users from the web users file), and 'sftp' (the SFTP users)"`
+	WebUsersFile     string `flag:"webusersfile" env:"WEB_USERS_FILE" default:"" description:"Path to a JSON file of web users, each with a name, password, and role. Used when webauth is 'local'"`
+	WebDefaultRole   string `flag:"webdefaultrole" env:"WEB_DEFAULT_ROLE" default:"viewer" description:"Web role of SFTP users that don't have one when webauth is 'sftp'. Valid values are 'viewer' and 'admin'"`
+	WebSessionHours  int    `flag:"websessionhours" env:"WEB_SESSION_HOURS" default:"12" description:"How long a web login lasts, in hours"`
+	WebSessionSecret string `flag:"websessionsecret" env:"WEB_SESSION_SECRET" default:"" description:"Key used to sign web session cookies. When blank a key is generated and kept in the system folder"`
+
+	TlsCertFile   string `flag:"tlscert" env:"TLS_CERT_FILE" default:"" description:"PEM certificate file. When set with tlskey the web interface is served over HTTPS"`
+	TlsKeyFile    string `flag:"tlskey" env:"TLS_KEY_FILE" default:"" description:"PEM private key file for the certificate in tlscert"`
+	TlsSelfSigned bool   `flag:"tlsselfsigned" env:"TLS_SELF_SIGNED" default:"false" description:"Serve the web interface over HTTPS with a generated self-signed certificate when tlscert is blank"`
+	TlsHosts      string `flag:"tlshosts" env:"TLS_HOSTS" default:"" description:"Comma-separated extra host names and IP addresses for the self-signed certificate"`
+
+	SecretsDir string `flag:"secretsdir" env:"SECRETS_DIR" default:"./secrets" description:"Folder for the generated session key and self-signed certificate. It must be outside the upload folder"`
+
+	Version        string
+	Users          []User
+	WebUsers       []WebUser
+	RetentionRules []RetentionRule
+	Hooks          []Hook
+	Validation     []ValidationRule
 }
 
 func LoadConfig(version string) Config {
+	var (
+		err error
+	)
+
 	config := Config{}
 	configinator.Behold(&config)
 
+	if config.Users, err = LoadUsers(config.UsersFile); err != nil {
+		slog.Error("error loading users", "error", err, "file", config.UsersFile)
+		os.Exit(1)
+	}
+
+	if config.WebUsers, err = LoadWebUsers(&config); err != nil {
+		slog.Error("error loading web users", "error", err, "file", config.WebUsersFile)
+		os.Exit(1)
+	}
+
+	if config.RetentionRules, err = LoadRetentionRules(config.RetentionFile, config.Users); err != nil {
+		slog.Error("error loading retention rules", "error", err, "file", config.RetentionFile)
+		os.Exit(1)
+	}
+
+	if config.Hooks, err = LoadHooks(config.HooksFile); err != nil {
+		slog.Error("error loading hooks", "error", err, "file", config.HooksFile)
+		os.Exit(1)
+	}
+
+	if config.Validation, err = LoadValidationRules(config.ValidationFile); err != nil {
+		slog.Error("error loading validation rules", "error", err, "file", config.ValidationFile)
+		os.Exit(1)
+	}
+
+	if err = config.checkSecretsDir(); err != nil {
+		slog.Error("invalid secrets folder", "error", err, "folder", config.SecretsDir)
+		os.Exit(1)
+	}
+
 	config.Version = version
 	return config
 }
 
+/*
+SecretPath returns an absolute path inside the secrets folder, creating
+the parent directory if needed. Secrets are kept out of the upload folder,
+so no client can reach them.
+*/
+func (c *Config) SecretPath(parts ...string) (string, error) {
+	secretsAbs, err := filepath.Abs(c.SecretsDir)
+
+	if err != nil {
+		return "", err
+	}
+
+	result := filepath.Join(append([]string{secretsAbs}, parts...)...)
+
+	if err := os.MkdirAll(filepath.Dir(result), 0700); err != nil {
+		return "", err
+	}
+
+	return result, nil
+}
+
+// checkSecretsDir refuses a secrets folder inside the upload folder
+func (c *Config) checkSecretsDir() error {
+	if strings.TrimSpace(c.SecretsDir) == "" {
+		return fmt.Errorf("secretsdir can't be blank")
+	}
+
+	uploadFolderReal, err := realPath(UploadFolder)
+
+	if err != nil {
+		return err
+	}
+
+	secretsReal, err := realPath(c.SecretsDir)
+
+	if err != nil {
+		return err
+	}
+
+	if isInside(uploadFolderReal, secretsReal) {
+		return fmt.Errorf("%s is inside the upload folder", c.SecretsDir)
+	}
+
+	return nil
+}
+
 // SanitizePath ensures that a given path cannot traverse outside the upload folder.
 // It returns a safe, absolute path within the upload folder, or an empty string if the path
 // would escape the upload folder boundary.
 func (c *Config) SanitizePath(requestedPath string) (string, error) {
+	return c.SanitizeHomePath("", requestedPath)
+}
+
+// SanitizeHomePath is SanitizePath for a user placed in a home folder inside the upload
+// folder, as returned by CleanHome. The requested path is relative to the home folder and
+// cannot traverse outside it. The home folder is created if it doesn't exist.
+func (c *Config) SanitizeHomePath(home, requestedPath string) (string, error) {
 	uploadFolderAbs, _ := filepath.Abs(UploadFolder)
+	homeAbs := filepath.Join(uploadFolderAbs, filepath.FromSlash(home))
 
-	// Ensure the upload folder exists
-	if _, err := os.Stat(uploadFolderAbs); os.IsNotExist(err) {
-		if err := os.MkdirAll(uploadFolderAbs, 0755); err != nil {
+	// Ensure the home folder exists
+	if _, err := os.Stat(homeAbs); os.IsNotExist(err) {
+		if err := os.MkdirAll(homeAbs, 0755); err != nil {
 			return "", err
 		}
 	}
 
-	// Join the requested path with the upload folder
+	// Join the requested path with the home folder
 	// This handles both absolute and relative paths
-	targetPath := filepath.Join(uploadFolderAbs, filepath.Clean(requestedPath))
+	targetPath := filepath.Join(homeAbs, filepath.Clean(requestedPath))
 
 	// Clean the path to resolve any ".." or "." components
 	targetPath = filepath.Clean(targetPath)
 
-	// Ensure the target path is still within the upload folder
-	if !strings.HasPrefix(targetPath, uploadFolderAbs) {
+	// Ensure the target path is still within the home folder
+	if targetPath != homeAbs && !strings.HasPrefix(targetPath, homeAbs+string(filepath.Separator)) {
 		return "", fmt.Errorf("Invalid path traversal attempt: %s", requestedPath)
 	}
 
+	// The system folder is off limits to clients
+	if IsSystemPath(filepath.Join(home, requestedPath)) {
+		return "", fmt.Errorf("Invalid path into the system folder: %s", requestedPath)
+	}
+
+	// Links can't lead out of the home folder or into the system folder
+	if err := CheckRealPath(homeAbs, targetPath); err != nil {
+		return "", err
+	}
+
 	return targetPath, nil
 }
+
+/*
+CheckRealPath refuses a path in a home folder when resolving its symlinks
+leads outside the home folder, or into the system folder.
+*/
+func CheckRealPath(homeAbs, targetPath string) error {
+	homeReal, err := realPath(homeAbs)
+
+	if err != nil {
+		return err
+	}
+
+	targetReal, err := realPath(targetPath)
+
+	if err != nil {
+		return err
+	}
+
+	if !isInside(homeReal, targetReal) {
+		return fmt.Errorf("Invalid path through a link out of the home folder: %s", targetPath)
+	}
+
+	uploadFolderReal, err := realPath(UploadFolder)
+
+	if err != nil {
+		return err
+	}
+
+	if relativePath, err := filepath.Rel(uploadFolderReal, targetReal); err == nil && IsSystemPath(relativePath) {
+		return fmt.Errorf("Invalid path through a link into the system folder: %s", targetPath)
+	}
+
+	return nil
+}
+
+/*
+realPath returns the absolute path with its symlinks resolved. A path that
+doesn't exist yet is resolved through its nearest parent that does. A
+broken link is refused, as creating a file through it would follow it.
+*/
+func realPath(p string) (string, error) {
+	p, err := filepath.Abs(p)
+
+	if err != nil {
+		return "", err
+	}
+
+	rest := []string{}
+
+	for {
+		resolved, err := filepath.EvalSymlinks(p)
+
+		if err == nil {
+			return filepath.Join(append([]string{resolved}, rest...)...), nil
+		}
+
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+
+		if _, lstatErr := os.Lstat(p); lstatErr == nil {
+			return "", fmt.Errorf("%s is a broken link", p)
+		}
+
+		parent := filepath.Dir(p)
+
+		if parent == p {
+			return "", err
+		}
+
+		rest = append([]string{filepath.Base(p)}, rest...)
+		p = parent
+	}
+}
+
+// isInside returns true if path is folder or anything in it
+func isInside(folder, path string) bool {
+	return path == folder || strings.HasPrefix(path, folder+string(filepath.Separator))
+}
@@ -0,0 +1,88 @@
+package configuration
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSanitizeHomePath(t *testing.T) {
+	chdirTemp(t)
+
+	if err := os.MkdirAll(filepath.Join(UploadFolder, "alice", "reports"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.MkdirAll(filepath.Join(UploadFolder, "bob"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Symlink("../bob", filepath.Join(UploadFolder, "alice", "to-bob")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Symlink("reports", filepath.Join(UploadFolder, "alice", "to-reports")); err != nil {
+		t.Fatal(err)
+	}
+
+	uploadFolderAbs, _ := filepath.Abs(UploadFolder)
+	config := &Config{}
+
+	tests := []struct {
+		name    string
+		home    string
+		path    string
+		want    string
+		wantErr bool
+	}{
+		{name: "upload folder", home: "", path: "", want: ""},
+		{name: "file in the upload folder", home: "", path: "/june.csv", want: "june.csv"},
+		{name: "home folder", home: "alice", path: "/", want: "alice"},
+		{name: "file in the home", home: "alice", path: "reports/june.csv", want: "alice/reports/june.csv"},
+		{name: "dot segments that stay inside", home: "alice", path: "reports/../june.csv", want: "alice/june.csv"},
+		{name: "absolute path is relative to the home", home: "alice", path: "/../../etc/passwd", want: "alice/etc/passwd"},
+		{name: "link inside the home", home: "alice", path: "to-reports/june.csv", want: "alice/to-reports/june.csv"},
+		{name: "system folder", home: "", path: ".slurper/web-session.key", wantErr: true},
+		{name: "system folder through dot segments", home: "", path: "reports/../.slurper", wantErr: true},
+		{name: "link to another home", home: "alice", path: "to-bob/secret.txt", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := config.SanitizeHomePath(tt.home, tt.path)
+
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("SanitizeHomePath(%q, %q) = %q, want an error", tt.home, tt.path, got)
+				}
+
+				return
+			}
+
+			want := filepath.Join(uploadFolderAbs, filepath.FromSlash(tt.want))
+
+			if err != nil || got != want {
+				t.Errorf("SanitizeHomePath(%q, %q) = %q, %v, want %q", tt.home, tt.path, got, err, want)
+			}
+		})
+	}
+}
+
+// chdirTemp runs a test from an empty folder, as the upload folder is relative
+func chdirTemp(t *testing.T) {
+	t.Helper()
+
+	wd, err := os.Getwd()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		_ = os.Chdir(wd)
+	})
+}
@@ -0,0 +1,151 @@
+package details
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/configuration"
+)
+
+/*
+Checksums are the digests of a file as it was when they were computed.
+Size and ModTime tell whether a cached copy still applies.
+*/
+type Checksums struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+	MD5     string    `json:"md5"`
+	SHA1    string    `json:"sha1"`
+	SHA256  string    `json:"sha256"`
+}
+
+/*
+FileChecksums returns the MD5, SHA-1, and SHA-256 of a file, reading it
+once for all three. Results are cached in the system folder and reused
+until the file's size or modification time changes. The second return
+value is true when the cached copy was used.
+*/
+func FileChecksums(fileName string, info os.FileInfo) (Checksums, bool, error) {
+	cachePath, err := checksumCachePath(fileName)
+
+	if err != nil {
+		return Checksums{}, false, err
+	}
+
+	if cached, ok := readCachedChecksums(cachePath); ok && cached.Size == info.Size() && cached.ModTime.Equal(info.ModTime()) {
+		return cached, true, nil
+	}
+
+	result, err := computeChecksums(fileName)
+
+	if err != nil {
+		return result, false, err
+	}
+
+	// The file changed while it was being read, so don't cache a digest
+	// that matches neither version
+	if result.Size != info.Size() {
+		return result, false, nil
+	}
+
+	result.ModTime = info.ModTime()
+
+	if err = writeCachedChecksums(cachePath, result); err != nil {
+		slog.Warn("error caching checksums", "error", err, "path", fileName)
+	}
+
+	return result, false, nil
+}
+
+func computeChecksums(fileName string) (Checksums, error) {
+	result := Checksums{}
+	f, err := os.Open(fileName)
+
+	if err != nil {
+		return result, err
+	}
+
+	defer f.Close()
+
+	md5Hash := md5.New()
+	sha1Hash := sha1.New()
+	sha256Hash := sha256.New()
+
+	if result.Size, err = io.Copy(io.MultiWriter(md5Hash, sha1Hash, sha256Hash), f); err != nil {
+		return result, err
+	}
+
+	result.MD5 = hex.EncodeToString(md5Hash.Sum(nil))
+	result.SHA1 = hex.EncodeToString(sha1Hash.Sum(nil))
+	result.SHA256 = hex.EncodeToString(sha256Hash.Sum(nil))
+
+	return result, nil
+}
+
+/*
+checksumCachePath names the cache file after the file's path, so a file
+that changes replaces its old entry instead of leaving it behind.
+*/
+func checksumCachePath(fileName string) (string, error) {
+	sum := sha256.Sum256([]byte(fileName))
+	key := hex.EncodeToString(sum[:])
+
+	return configuration.SystemPath("checksums", key[:2], key+".json")
+}
+
+func readCachedChecksums(cachePath string) (Checksums, bool) {
+	result := Checksums{}
+	b, err := os.ReadFile(cachePath)
+
+	if err != nil {
+		return result, false
+	}
+
+	if err = json.Unmarshal(b, &result); err != nil {
+		return result, false
+	}
+
+	return result, true
+}
+
+/*
+writeCachedChecksums saves checksums through a temporary file, so a
+concurrent reader never sees half of one.
+*/
+func writeCachedChecksums(cachePath string, checksums Checksums) error {
+	b, err := json.Marshal(checksums)
+
+	if err != nil {
+		return err
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(cachePath), "checksums-*")
+
+	if err != nil {
+		return err
+	}
+
+	_, err = temp.Write(b)
+
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = os.Rename(temp.Name(), cachePath)
+	}
+
+	if err != nil {
+		_ = os.Remove(temp.Name())
+	}
+
+	return err
+}
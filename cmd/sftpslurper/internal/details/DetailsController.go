@@ -0,0 +1,367 @@
+package details
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/adampresley/adamgokit/httphelpers"
+	"github.com/adampresley/adamgokit/rendering"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/audit"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/configuration"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/hooks"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/pgp"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/preview"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/versioning"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/viewmodels"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/webauth"
+	"github.com/dustin/go-humanize"
+)
+
+type DetailsHandlers interface {
+	FileDetails(w http.ResponseWriter, r *http.Request)
+	FileChecksums(w http.ResponseWriter, r *http.Request)
+	FilePgp(w http.ResponseWriter, r *http.Request)
+}
+
+type DetailsControllerConfig struct {
+	Config   *configuration.Config
+	Renderer rendering.TemplateRenderer
+	AuditLog *audit.Logger
+	Versions *versioning.Store
+	Hooks    *hooks.Runner
+	Keyring  *pgp.Keyring
+}
+
+type DetailsController struct {
+	config   *configuration.Config
+	renderer rendering.TemplateRenderer
+	auditLog *audit.Logger
+	versions *versioning.Store
+	hooks    *hooks.Runner
+	keyring  *pgp.Keyring
+}
+
+func NewDetailsController(config DetailsControllerConfig) DetailsController {
+	return DetailsController{
+		config:   config.Config,
+		renderer: config.Renderer,
+		auditLog: config.AuditLog,
+		versions: config.Versions,
+		hooks:    config.Hooks,
+		keyring:  config.Keyring,
+	}
+}
+
+/*
+GET /files/details?path={path}
+
+Renders the details drawer for a file or folder, with any old copies of a
+file kept by the collision policy and the last run of its upload hooks.
+Checksums and OpenPGP details are left to FileChecksums and FilePgp, which
+the drawer calls once it opens.
+*/
+func (c DetailsController) FileDetails(w http.ResponseWriter, r *http.Request) {
+	var (
+		err  error
+		info os.FileInfo
+	)
+
+	pageName := "pages/file-details"
+	filePath := "/" + strings.Trim(filepath.ToSlash(strings.TrimSpace(httphelpers.GetFromRequest[string](r, "path"))), "/")
+
+	viewData := viewmodels.FileDetails{
+		BaseViewModel: viewmodels.BaseViewModel{
+			Version:            c.config.Version,
+			Message:            "",
+			IsHtmx:             httphelpers.IsHtmx(r),
+			Viewer:             webauth.ViewerFromRequest(r),
+			JavascriptIncludes: []rendering.JavascriptInclude{},
+		},
+		Path:         filePath,
+		Name:         filepath.Base(filePath),
+		AuditEnabled: c.auditLog.Enabled(),
+	}
+
+	cleanPath, err := webauth.SanitizePath(r, c.config, filePath)
+
+	if err == nil {
+		info, err = os.Stat(cleanPath)
+	}
+
+	if err != nil {
+		slog.Error("error reading file details", "error", err, "path", filePath)
+		viewData.Message = "File not found"
+		viewData.IsError = true
+
+		c.renderer.Render(pageName, viewData, w)
+		return
+	}
+
+	viewData.IsDir = info.IsDir()
+	viewData.IsPgp = !info.IsDir() && pgp.IsPgpFile(info.Name())
+	viewData.Size = info.Size()
+	viewData.SizeLabel = fmt.Sprintf("%d bytes", info.Size())
+	viewData.ModTime = info.ModTime()
+	viewData.Permissions = fmt.Sprintf("%s (%04o)", info.Mode().String(), info.Mode().Perm())
+	viewData.ExtensionType = mime.TypeByExtension(filepath.Ext(info.Name()))
+
+	if !info.IsDir() {
+		summary, err := preview.SummarizeFile(cleanPath)
+
+		if err != nil {
+			slog.Error("error summarizing file", "error", err, "path", cleanPath)
+			viewData.Message = "Unable to read the file's contents"
+			viewData.IsWarning = true
+		} else {
+			viewData.ContentType = summary.ContentType
+			viewData.LineEndings = summary.LineEndings()
+			viewData.Encoding = summary.Encoding()
+			viewData.Truncated = summary.Truncated
+		}
+
+		if viewData.Versions, err = c.fileVersions(filePath, cleanPath); err != nil {
+			slog.Error("error listing file versions", "error", err, "path", cleanPath)
+		}
+
+		if viewData.Hooks, err = c.hookRun(cleanPath); err != nil {
+			slog.Error("error reading hook run", "error", err, "path", cleanPath)
+		}
+	}
+
+	if viewData.Origin, err = c.origin(webauth.UploadPath(r, filePath)); err != nil {
+		slog.Error("error reading audit log for file details", "error", err, "path", filePath)
+	}
+
+	c.renderer.Render(pageName, viewData, w)
+}
+
+/*
+GET /files/checksums?path={path}
+*/
+func (c DetailsController) FileChecksums(w http.ResponseWriter, r *http.Request) {
+	pageName := "pages/file-checksums"
+	filePath := strings.TrimSpace(httphelpers.GetFromRequest[string](r, "path"))
+
+	viewData := viewmodels.FileChecksums{
+		BaseViewModel: viewmodels.BaseViewModel{
+			Version:            c.config.Version,
+			Message:            "",
+			IsHtmx:             httphelpers.IsHtmx(r),
+			Viewer:             webauth.ViewerFromRequest(r),
+			JavascriptIncludes: []rendering.JavascriptInclude{},
+		},
+	}
+
+	cleanPath, err := webauth.SanitizePath(r, c.config, filePath)
+
+	if err != nil {
+		slog.Error("invalid checksum path", "error", err, "path", filePath)
+		viewData.Message = "Invalid file path"
+		viewData.IsError = true
+
+		c.renderer.Render(pageName, viewData, w)
+		return
+	}
+
+	info, err := os.Stat(cleanPath)
+
+	if err != nil || !info.Mode().IsRegular() {
+		viewData.Message = "Checksums are only available for files"
+		viewData.IsError = true
+
+		c.renderer.Render(pageName, viewData, w)
+		return
+	}
+
+	checksums, cached, err := FileChecksums(cleanPath, info)
+
+	if err != nil {
+		slog.Error("error computing checksums", "error", err, "path", cleanPath)
+		viewData.Message = "Unable to compute checksums"
+		viewData.IsError = true
+
+		c.renderer.Render(pageName, viewData, w)
+		return
+	}
+
+	slog.Info("file checksums", "path", cleanPath, "cached", cached)
+
+	viewData.MD5 = checksums.MD5
+	viewData.SHA1 = checksums.SHA1
+	viewData.SHA256 = checksums.SHA256
+	viewData.Cached = cached
+
+	c.renderer.Render(pageName, viewData, w)
+}
+
+/*
+GET /files/pgp?path={path}
+
+Describes an OpenPGP file. Messages are decrypted to check their signature,
+and detached signatures are checked against the file they sign.
+*/
+func (c DetailsController) FilePgp(w http.ResponseWriter, r *http.Request) {
+	pageName := "pages/file-pgp"
+	filePath := strings.TrimSpace(httphelpers.GetFromRequest[string](r, "path"))
+
+	viewData := viewmodels.FilePgp{
+		BaseViewModel: viewmodels.BaseViewModel{
+			Version:            c.config.Version,
+			Message:            "",
+			IsHtmx:             httphelpers.IsHtmx(r),
+			Viewer:             webauth.ViewerFromRequest(r),
+			JavascriptIncludes: []rendering.JavascriptInclude{},
+		},
+		Path:       filePath,
+		Recipients: []viewmodels.PgpRecipient{},
+	}
+
+	cleanPath, err := webauth.SanitizePath(r, c.config, filePath)
+
+	if err != nil {
+		slog.Error("invalid OpenPGP path", "error", err, "path", filePath)
+		viewData.Message = "Invalid file path"
+		viewData.IsError = true
+
+		c.renderer.Render(pageName, viewData, w)
+		return
+	}
+
+	details, err := c.keyring.Inspect(cleanPath)
+
+	switch {
+	case errors.Is(err, pgp.ErrNoKey):
+		viewData.Message = "No key in the keyring can decrypt this file"
+		viewData.IsWarning = true
+
+	case err != nil:
+		slog.Error("error reading OpenPGP file", "error", err, "path", cleanPath)
+		viewData.Message = fmt.Sprintf("Unable to read the file: %v", err)
+		viewData.IsError = true
+
+		c.renderer.Render(pageName, viewData, w)
+		return
+	}
+
+	slog.Info("OpenPGP details", "path", cleanPath, "kind", details.Kind, "signature", details.Signature.Status)
+
+	viewData.Kind = details.Kind
+	viewData.Armored = details.Armored
+	viewData.Encrypted = details.Encrypted
+	viewData.FileName = details.FileName
+	viewData.Signed = details.Signed
+	viewData.Keys = details.Keys
+	viewData.CanDecrypt = err == nil && details.Kind != pgp.KindSignature && details.Kind != pgp.KindKey
+
+	viewData.Signature = viewmodels.PgpSignature{
+		Status: details.Signature.Status,
+		Signer: details.Signature.Signer,
+		KeyID:  details.Signature.KeyID,
+		Error:  details.Signature.Error,
+	}
+
+	if viewData.CanDecrypt {
+		viewData.Size = fmt.Sprintf("%d bytes", details.Size)
+	}
+
+	for _, id := range details.Recipients {
+		viewData.Recipients = append(viewData.Recipients, viewmodels.PgpRecipient{
+			KeyID:     pgp.KeyID(id),
+			InKeyring: c.keyring.HasKey(id),
+		})
+	}
+
+	c.renderer.Render(pageName, viewData, w)
+}
+
+/*
+origin finds the newest successful audit record that wrote filePath, either
+by uploading or creating it or by renaming or copying something to it. It
+returns nil when there is no such record, such as when auditing is off or
+the file was placed in the upload folder directly.
+*/
+func (c DetailsController) origin(filePath string) (*viewmodels.FileOrigin, error) {
+	records, err := c.auditLog.Query(audit.Filter{Path: filePath, Result: audit.ResultOK})
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, record := range records {
+		switch {
+		case (record.Operation == "write" || record.Operation == "upload" || record.Operation == "mkdir") && record.Path == filePath:
+			return newFileOrigin(record, ""), nil
+
+		case (record.Operation == "rename" || record.Operation == "copy") && record.Target == filePath:
+			return newFileOrigin(record, record.Path), nil
+		}
+	}
+
+	return nil, nil
+}
+
+func (c DetailsController) fileVersions(filePath, cleanPath string) ([]viewmodels.FileVersion, error) {
+	versions, err := c.versions.List(cleanPath)
+	result := make([]viewmodels.FileVersion, 0, len(versions))
+
+	for _, version := range versions {
+		result = append(result, viewmodels.FileVersion{
+			Path:    filePath,
+			ID:      version.ID,
+			Size:    humanize.IBytes(uint64(version.Size)),
+			ModTime: version.ModTime,
+			SavedAt: version.SavedAt,
+		})
+	}
+
+	return result, err
+}
+
+func (c DetailsController) hookRun(cleanPath string) (*viewmodels.HookRun, error) {
+	run, err := c.hooks.Status(cleanPath)
+
+	if run == nil || err != nil {
+		return nil, err
+	}
+
+	result := &viewmodels.HookRun{
+		Status:   run.Status,
+		User:     run.User,
+		Started:  run.Started,
+		Finished: run.Finished,
+		Results:  make([]viewmodels.HookResult, 0, len(run.Results)),
+	}
+
+	for _, hookResult := range run.Results {
+		result.Results = append(result.Results, viewmodels.HookResult{
+			Hook:     hookResult.Hook,
+			Action:   hookResult.Action,
+			Path:     "/" + hookResult.Path,
+			ExitCode: hookResult.ExitCode,
+			Output:   hookResult.Output,
+			Error:    hookResult.Error,
+			Duration: (time.Duration(hookResult.DurationMs) * time.Millisecond).String(),
+		})
+	}
+
+	return result, nil
+}
+
+func newFileOrigin(record audit.Record, source string) *viewmodels.FileOrigin {
+	return &viewmodels.FileOrigin{
+		Operation:  record.Operation,
+		Protocol:   record.Protocol,
+		User:       record.User,
+		SessionID:  record.SessionID,
+		RemoteAddr: record.RemoteAddr,
+		Time:       record.Time,
+		Source:     source,
+	}
+}
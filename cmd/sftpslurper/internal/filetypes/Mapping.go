@@ -9,6 +9,10 @@ var (
 		".webp": "icon-image",
 		".bmp":  "icon-image",
 		".pdf":  "icon-pdf",
+		".mp4":  "icon-video",
+		".m4v":  "icon-video",
+		".mov":  "icon-video",
+		".webm": "icon-video",
 		".m3a":  "icon-music",
 		".mp3":  "icon-music",
 		".wav":  "icon-music",
@@ -22,5 +26,17 @@ var (
 		".doc":  "icon-word",
 		".docx": "icon-word",
 		".txt":  "icon-text",
+		".json": "icon-text",
+		".xml":  "icon-text",
+		".yaml": "icon-text",
+		".yml":  "icon-text",
+		".log":  "icon-text",
+		".edi":  "icon-text",
+		".x12":  "icon-text",
+		".zip":  "icon-archive",
+		".tar":  "icon-archive",
+		".gz":   "icon-archive",
+		".tgz":  "icon-archive",
+		".7z":   "icon-archive",
 	}
 )
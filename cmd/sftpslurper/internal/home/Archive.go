@@ -0,0 +1,281 @@
+package home
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/configuration"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/webauth"
+)
+
+const (
+	ArchiveFormatZip   = "zip"
+	ArchiveFormatTarGz = "tar.gz"
+)
+
+/*
+GET /archive?root={root}&name={name}&name={name}&format={format}
+
+Streams a zip or tar.gz of the selected files and folders in root straight
+to the response. Nothing is staged on disk, so archives of any size start
+downloading immediately. Entries are named relative to root.
+*/
+func (c HomeController) DownloadArchive(w http.ResponseWriter, r *http.Request) {
+	var (
+		err     error
+		written int64
+		sources []string
+	)
+
+	started := time.Now()
+	query := r.URL.Query()
+	root := strings.TrimSpace(query.Get("root"))
+	names := query["name"]
+	format := strings.ToLower(strings.TrimSpace(query.Get("format")))
+
+	defer func() {
+		c.audit(r, "archive", root, strings.Join(names, ","), written, started, err)
+	}()
+
+	if format == "" {
+		format = ArchiveFormatZip
+	}
+
+	if format != ArchiveFormatZip && format != ArchiveFormatTarGz {
+		err = fmt.Errorf("unsupported archive format '%s'", format)
+		http.Error(w, "Format must be zip or tar.gz", http.StatusBadRequest)
+		return
+	}
+
+	if len(names) == 0 {
+		err = fmt.Errorf("nothing selected")
+		http.Error(w, "Nothing selected to download", http.StatusBadRequest)
+		return
+	}
+
+	cleanRoot, err := webauth.SanitizePath(r, c.config, root)
+
+	if err != nil {
+		slog.Error("invalid archive root", "error", err, "root", root)
+		http.Error(w, "Invalid root path", http.StatusBadRequest)
+		return
+	}
+
+	// Validate everything before the first byte is written, as the status
+	// can't change once streaming starts.
+	for _, name := range names {
+		var cleanPath string
+
+		if strings.TrimSpace(name) == "" {
+			err = fmt.Errorf("blank name in selection")
+			http.Error(w, "Invalid selection", http.StatusBadRequest)
+			return
+		}
+
+		if cleanPath, err = webauth.SanitizePath(r, c.config, filepath.Join(root, name)); err == nil {
+			_, err = os.Stat(cleanPath)
+		}
+
+		if err != nil {
+			slog.Error("invalid archive selection", "error", err, "root", root, "name", name)
+			http.Error(w, fmt.Sprintf("Cannot download %s", name), http.StatusBadRequest)
+			return
+		}
+
+		sources = append(sources, cleanPath)
+	}
+
+	archiveName := archiveFileName(root, names, format)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", archiveName))
+
+	if format == ArchiveFormatZip {
+		w.Header().Set("Content-Type", "application/zip")
+		written, err = writeZip(w, cleanRoot, sources)
+	} else {
+		w.Header().Set("Content-Type", "application/gzip")
+		written, err = writeTarGz(w, cleanRoot, sources)
+	}
+
+	if err != nil {
+		slog.Error("error streaming archive", "error", err, "root", cleanRoot, "format", format)
+		return
+	}
+
+	slog.Info("streamed archive", "root", cleanRoot, "format", format, "entries", len(sources), "bytes", written)
+}
+
+/*
+archiveFileName names the download after the single selected item, or the
+folder being browsed when several items are selected.
+*/
+func archiveFileName(root string, names []string, format string) string {
+	base := "uploads"
+
+	if trimmed := strings.Trim(filepath.ToSlash(root), "/"); trimmed != "" {
+		base = filepath.Base(trimmed)
+	}
+
+	if len(names) == 1 {
+		if name := filepath.Base(filepath.Clean(names[0])); name != "." && name != "/" {
+			base = name
+		}
+	}
+
+	return base + "." + format
+}
+
+/*
+walkSelection calls fn for every file and folder under each source. The
+name passed to fn is the slash-separated path relative to root. The system
+folder is never included.
+*/
+func walkSelection(root string, sources []string, fn func(path, name string, info fs.FileInfo) error) error {
+	uploadFolderAbs, _ := filepath.Abs(configuration.UploadFolder)
+
+	for _, source := range sources {
+		err := filepath.WalkDir(source, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if relativeToUploads, relErr := filepath.Rel(uploadFolderAbs, path); relErr == nil && configuration.IsSystemPath(relativeToUploads) {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+
+				return nil
+			}
+
+			name, err := filepath.Rel(root, path)
+
+			if err != nil || name == "." {
+				return err
+			}
+
+			info, err := d.Info()
+
+			if err != nil {
+				return err
+			}
+
+			return fn(path, filepath.ToSlash(name), info)
+		})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeZip(w io.Writer, root string, sources []string) (int64, error) {
+	var (
+		written int64
+	)
+
+	zw := zip.NewWriter(w)
+
+	err := walkSelection(root, sources, func(path, name string, info fs.FileInfo) error {
+		if !info.IsDir() && !info.Mode().IsRegular() {
+			return nil
+		}
+
+		header, err := zip.FileInfoHeader(info)
+
+		if err != nil {
+			return err
+		}
+
+		header.Name = name
+
+		if info.IsDir() {
+			header.Name += "/"
+			_, err = zw.CreateHeader(header)
+			return err
+		}
+
+		header.Method = zip.Deflate
+		entry, err := zw.CreateHeader(header)
+
+		if err != nil {
+			return err
+		}
+
+		n, err := copyFileTo(entry, path)
+		written += n
+		return err
+	})
+
+	if closeErr := zw.Close(); err == nil {
+		err = closeErr
+	}
+
+	return written, err
+}
+
+func writeTarGz(w io.Writer, root string, sources []string) (int64, error) {
+	var (
+		written int64
+	)
+
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+
+	err := walkSelection(root, sources, func(path, name string, info fs.FileInfo) error {
+		if !info.IsDir() && !info.Mode().IsRegular() {
+			return nil
+		}
+
+		header, err := tar.FileInfoHeader(info, "")
+
+		if err != nil {
+			return err
+		}
+
+		header.Name = name
+
+		if info.IsDir() {
+			header.Name += "/"
+		}
+
+		if err = tw.WriteHeader(header); err != nil || info.IsDir() {
+			return err
+		}
+
+		n, err := copyFileTo(tw, path)
+		written += n
+		return err
+	})
+
+	if closeErr := tw.Close(); err == nil {
+		err = closeErr
+	}
+
+	if closeErr := gw.Close(); err == nil {
+		err = closeErr
+	}
+
+	return written, err
+}
+
+func copyFileTo(w io.Writer, path string) (int64, error) {
+	f, err := os.Open(path)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer f.Close()
+	return io.Copy(w, f)
+}
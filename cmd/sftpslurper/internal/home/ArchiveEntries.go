@@ -0,0 +1,287 @@
+package home
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adampresley/adamgokit/httphelpers"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/preview"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/webauth"
+	"github.com/dustin/go-humanize"
+)
+
+/*
+GET /archive/entry?root={root}&filename={filename}&entry={entry}
+
+Streams a single entry out of an archive without extracting it to disk.
+Images and audio are served inline so they can be previewed, everything
+else is sent as an attachment.
+*/
+func (c HomeController) DownloadArchiveEntry(w http.ResponseWriter, r *http.Request) {
+	var (
+		err     error
+		written int64
+	)
+
+	started := time.Now()
+	root := strings.TrimSpace(httphelpers.GetFromRequest[string](r, "root"))
+	fileName := httphelpers.GetFromRequest[string](r, "filename")
+	entryName := httphelpers.GetFromRequest[string](r, "entry")
+	fullPath := filepath.Join(root, fileName)
+
+	defer func() {
+		c.audit(r, "download", fullPath, path.Join(filepath.ToSlash(fullPath), entryName), written, started, err)
+	}()
+
+	p, err := webauth.SanitizePath(r, c.config, fullPath)
+
+	if err != nil {
+		slog.Error("invalid archive path", "error", err, "path", fullPath)
+		http.Error(w, "Invalid file path", http.StatusBadRequest)
+		return
+	}
+
+	err = preview.ReadArchiveEntry(p, entryName, func(entry preview.ArchiveEntry, entryReader io.Reader) error {
+		ext := strings.ToLower(strings.TrimPrefix(path.Ext(entry.Name), "."))
+		disposition := "attachment"
+		contentType := mime.TypeByExtension("." + ext)
+
+		if _, ok := inlineMedia[ext]; ok {
+			disposition = "inline"
+		}
+
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf("%s; filename=%q", disposition, path.Base(entry.Name)))
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+
+		var copyErr error
+		written, copyErr = io.Copy(w, entryReader)
+		return copyErr
+	})
+
+	if err != nil {
+		// Once bytes have been written the status can't change
+		if written == 0 {
+			w.Header().Del("Content-Disposition")
+			c.archiveEntryError(w, err, p, entryName)
+			return
+		}
+
+		slog.Error("error streaming archive entry", "error", err, "path", p, "entry", entryName, "bytes", written)
+		return
+	}
+
+	slog.Info("streamed archive entry", "path", p, "entry", entryName, "bytes", written)
+}
+
+/*
+previewArchive lists the entries of a zip, tar, tar.gz, 7z, or gzip file.
+*/
+func (c HomeController) previewArchive(w http.ResponseWriter, r *http.Request, root, fileName string) {
+	p, err := webauth.SanitizePath(r, c.config, filepath.Join(root, fileName))
+
+	if err != nil {
+		slog.Error("invalid preview path", "error", err, "root", root, "file", fileName)
+		http.Error(w, "Invalid file path", http.StatusBadRequest)
+		return
+	}
+
+	listing, err := preview.ListArchive(p)
+
+	if err != nil {
+		slog.Error("error reading archive", "error", err, "path", p)
+		httphelpers.TextOK(w, fmt.Sprintf(`<article class="error">Unable to read %s: %s</article>`, html.EscapeString(fileName), html.EscapeString(err.Error())))
+		return
+	}
+
+	slog.Info("rendering archive preview", "path", p, "format", listing.Format, "entries", listing.Total)
+
+	hidden := map[string]string{
+		"root":     root,
+		"filename": fileName,
+	}
+
+	if err = listing.Render(w, hidden); err != nil {
+		slog.Error("error rendering archive preview", "error", err, "path", p)
+	}
+}
+
+/*
+previewArchiveEntry previews one entry inside an archive. Images and audio
+are streamed by DownloadArchiveEntry. Anything else is read into memory,
+up to preview.MaxEntryPreviewSize, and shown as text or a hex dump.
+*/
+func (c HomeController) previewArchiveEntry(w http.ResponseWriter, r *http.Request, root, fileName, entryName string) {
+	var (
+		content []byte
+		size    int64
+	)
+
+	p, err := webauth.SanitizePath(r, c.config, filepath.Join(root, fileName))
+
+	if err != nil {
+		slog.Error("invalid preview path", "error", err, "root", root, "file", fileName)
+		http.Error(w, "Invalid file path", http.StatusBadRequest)
+		return
+	}
+
+	values := url.Values{}
+	values.Set("root", root)
+	values.Set("filename", fileName)
+	values.Set("entry", entryName)
+
+	view := httphelpers.GetFromRequest[string](r, "view")
+	ext := strings.ToLower(strings.TrimPrefix(path.Ext(entryName), "."))
+	src := html.EscapeString("/archive/entry?" + values.Encode())
+	offset := preview.ParseOffset(httphelpers.GetFromRequest[string](r, "offset"))
+
+	if markup, ok := mediaMarkup(ext, src, entryName); ok && view != "hex" {
+		httphelpers.TextOK(w, c.archiveEntryHeader(root, fileName, entryName, src, -1, 0)+markup)
+		return
+	}
+
+	err = preview.ReadArchiveEntry(p, entryName, func(entry preview.ArchiveEntry, entryReader io.Reader) error {
+		var readErr error
+
+		size = entry.Size
+		content, readErr = io.ReadAll(io.LimitReader(entryReader, preview.MaxEntryPreviewSize))
+		return readErr
+	})
+
+	if err != nil {
+		c.archiveEntryError(w, err, p, entryName)
+		return
+	}
+
+	slog.Info("rendering archive entry preview", "path", p, "entry", entryName, "view", view, "offset", offset)
+
+	sb := strings.Builder{}
+
+	// Load more and paging requests replace part of the preview, so only
+	// the first page carries the header
+	if offset == 0 {
+		sb.WriteString(c.archiveEntryHeader(root, fileName, entryName, src, size, len(content)))
+	}
+
+	hidden := map[string]string{
+		"root":     root,
+		"filename": fileName,
+		"entry":    entryName,
+		"view":     "hex",
+	}
+
+	if err = renderBuffered(&sb, content, ext, view == "hex", offset, values, hidden); err != nil {
+		slog.Error("error rendering archive entry preview", "error", err, "path", p, "entry", entryName)
+		http.Error(w, "Error reading archive entry", http.StatusInternalServerError)
+		return
+	}
+
+	httphelpers.TextOK(w, sb.String())
+}
+
+/*
+renderBuffered renders content held in memory, such as an archive entry
+or a decrypted file, as highlighted text or as a hex dump. Content that
+isn't a known text format is sniffed, and hexView forces a hex dump.
+values locate the content for load more requests, and hidden is passed
+to the hex dump for its paging.
+*/
+func renderBuffered(sb *strings.Builder, content []byte, ext string, hexView bool, offset int64, values url.Values, hidden map[string]string) error {
+	format, isText := preview.TextFormat(ext)
+
+	if !hexView && !isText {
+		// Sniff content we don't know by its extension
+		if contentType := http.DetectContentType(content); strings.HasPrefix(contentType, "text/plain") {
+			format, isText = preview.FormatText, true
+		}
+	}
+
+	reader := bytes.NewReader(content)
+
+	if hexView || !isText {
+		dump, err := preview.ReadHexDumpAt(reader, reader.Size(), offset)
+
+		if err != nil {
+			return err
+		}
+
+		return dump.Render(sb, hidden)
+	}
+
+	chunk, err := preview.RenderTextAt(reader, reader.Size(), format, offset)
+
+	if err != nil {
+		return err
+	}
+
+	sb.WriteString(fmt.Sprintf(`<pre class="hl hl-%s">%s</pre>`, format, chunk.Markup))
+
+	if chunk.Next > 0 {
+		values.Set("offset", strconv.FormatInt(chunk.Next, 10))
+
+		sb.WriteString(fmt.Sprintf(
+			`<button class="outline" hx-get="%s" hx-target="this" hx-swap="outerHTML">Load more</button>`,
+			html.EscapeString("/preview?"+values.Encode()),
+		))
+	}
+
+	return nil
+}
+
+/*
+archiveEntryHeader names the entry being previewed, with links to download
+it and to return to the archive listing. size is -1 when it isn't known
+yet, and buffered is how much of the entry was read for the preview.
+*/
+func (c HomeController) archiveEntryHeader(root, fileName, entryName, src string, size int64, buffered int) string {
+	values := url.Values{}
+	values.Set("root", root)
+	values.Set("filename", fileName)
+
+	details := ""
+
+	if size >= 0 {
+		details = " &middot; " + html.EscapeString(humanize.Bytes(uint64(size)))
+	}
+
+	if size > int64(buffered) && buffered >= preview.MaxEntryPreviewSize {
+		details += fmt.Sprintf(" &middot; previewing the first %s", html.EscapeString(humanize.Bytes(preview.MaxEntryPreviewSize)))
+	}
+
+	return fmt.Sprintf(
+		`<p><small><a hx-get="%s" hx-target="#archivePreview" hx-swap="outerHTML">&laquo; %s</a> / %s%s &middot; <a href="%s" download>Download</a></small></p>`,
+		html.EscapeString("/preview?"+values.Encode()),
+		html.EscapeString(fileName),
+		html.EscapeString(entryName),
+		details,
+		src,
+	)
+}
+
+func (c HomeController) archiveEntryError(w http.ResponseWriter, err error, archivePath, entryName string) {
+	if errors.Is(err, fs.ErrNotExist) {
+		slog.Error("archive entry not found", "path", archivePath, "entry", entryName)
+		http.Error(w, "Entry not found in archive", http.StatusNotFound)
+		return
+	}
+
+	slog.Error("error reading archive entry", "error", err, "path", archivePath, "entry", entryName)
+	http.Error(w, fmt.Sprintf("Error reading %s: %v", entryName, err), http.StatusInternalServerError)
+}
@@ -0,0 +1,142 @@
+package home
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/adampresley/adamgokit/httphelpers"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/preview"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/versioning"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/webauth"
+	"github.com/dustin/go-humanize"
+)
+
+/*
+GET /compare?left={left}&leftversion={leftversion}&right={right}&mode={mode}
+
+Compares two uploaded files in the preview dialog. CSV and TSV files are
+compared cell by cell, other text line by line, and anything else byte by
+byte, unless mode picks one. Text that is too large or too different to
+diff falls back to comparing bytes. When leftversion is set the left side
+is that old copy of the left file.
+*/
+func (c HomeController) CompareFiles(w http.ResponseWriter, r *http.Request) {
+	var (
+		err error
+	)
+
+	leftPath := strings.TrimSpace(httphelpers.GetFromRequest[string](r, "left"))
+	leftVersion := httphelpers.GetFromRequest[string](r, "leftversion")
+	rightPath := strings.TrimSpace(httphelpers.GetFromRequest[string](r, "right"))
+	mode := httphelpers.GetFromRequest[string](r, "mode")
+
+	paths := []string{leftPath, rightPath}
+	cleanPaths := make([]string, len(paths))
+	contentTypes := make([]string, len(paths))
+	labels := []string{leftPath, rightPath}
+
+	for index, filePath := range paths {
+		if index == 0 && leftVersion != "" {
+			var version versioning.Version
+
+			if cleanPaths[index], version, err = c.versionPath(r, filePath, leftVersion); err != nil {
+				slog.Error("invalid compare version", "error", err, "path", filePath, "id", leftVersion)
+				http.Error(w, "Invalid file version", http.StatusBadRequest)
+				return
+			}
+
+			labels[index] = fmt.Sprintf("%s (replaced %s)", filePath, version.SavedAt.Format("2006-01-02 15:04:05"))
+		} else if cleanPaths[index], err = webauth.SanitizePath(r, c.config, filePath); err != nil || filePath == "" {
+			slog.Error("invalid compare path", "error", err, "path", filePath)
+			http.Error(w, "Invalid file path", http.StatusBadRequest)
+			return
+		}
+
+		if info, statErr := os.Stat(cleanPaths[index]); statErr != nil || !info.Mode().IsRegular() {
+			httphelpers.TextOK(w, fmt.Sprintf(`<article class="error">%s is not a file that can be compared</article>`, html.EscapeString(filePath)))
+			return
+		}
+
+		if contentTypes[index], err = preview.SniffContentType(cleanPaths[index]); err != nil {
+			slog.Error("error reading file to compare", "error", err, "path", cleanPaths[index])
+			http.Error(w, "Error reading file", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	leftExt := strings.TrimPrefix(filepath.Ext(leftPath), ".")
+	rightExt := strings.TrimPrefix(filepath.Ext(rightPath), ".")
+
+	if mode != preview.DiffModeLines && mode != preview.DiffModeTable && mode != preview.DiffModeBytes {
+		mode = preview.DiffMode(leftExt, rightExt, contentTypes[0], contentTypes[1])
+	}
+
+	diff := preview.Diff{
+		Mode:  mode,
+		Left:  labels[0],
+		Right: labels[1],
+	}
+
+	switch mode {
+	case preview.DiffModeLines:
+		var text preview.TextDiff
+
+		if text, err = preview.DiffText(cleanPaths[0], cleanPaths[1]); err == nil {
+			diff.Text = &text
+		}
+
+	case preview.DiffModeTable:
+		var table preview.TableDiff
+
+		if table, err = preview.DiffTables(cleanPaths[0], cleanPaths[1], leftExt, rightExt); err == nil {
+			diff.Table = &table
+		}
+	}
+
+	switch {
+	case errors.Is(err, preview.ErrDiffTooLarge):
+		diff.Notice = fmt.Sprintf("Files over %s are too large to compare line by line, so they are compared byte by byte instead.", humanize.IBytes(preview.MaxDiffSize))
+	case errors.Is(err, preview.ErrDiffTooDifferent):
+		diff.Notice = "The files have too many differences to compare line by line, so they are compared byte by byte instead."
+	}
+
+	if diff.Notice != "" {
+		diff.Mode = preview.DiffModeBytes
+		err = nil
+	}
+
+	if err == nil && diff.Text == nil && diff.Table == nil {
+		var bytes preview.ByteDiff
+
+		if bytes, err = preview.DiffBytes(cleanPaths[0], cleanPaths[1]); err == nil {
+			diff.Bytes = &bytes
+		}
+	}
+
+	if err != nil {
+		slog.Error("error comparing files", "error", err, "left", cleanPaths[0], "right", cleanPaths[1], "mode", mode)
+		httphelpers.TextOK(w, fmt.Sprintf(`<article class="error">Unable to compare the files: %s</article>`, html.EscapeString(err.Error())))
+		return
+	}
+
+	slog.Info("comparing files", "left", cleanPaths[0], "right", cleanPaths[1], "mode", diff.Mode)
+
+	hidden := map[string]string{
+		"left":  leftPath,
+		"right": rightPath,
+	}
+
+	if leftVersion != "" {
+		hidden["leftversion"] = leftVersion
+	}
+
+	if err = diff.Render(w, hidden); err != nil {
+		slog.Error("error rendering comparison", "error", err, "left", cleanPaths[0], "right", cleanPaths[1])
+	}
+}
@@ -0,0 +1,296 @@
+package home
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/adampresley/adamgokit/httphelpers"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/pgp"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/preview"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/webauth"
+	"github.com/dustin/go-humanize"
+)
+
+/*
+GET /decrypt?path={path}
+
+Streams the decrypted content of an encrypted or signed file. Images and
+audio are served inline so they can be previewed, everything else is sent
+as an attachment named after the file stored in the message. The
+signature can only be checked once everything has been sent, so a bad
+signature is recorded in the audit log.
+*/
+func (c HomeController) DownloadDecrypted(w http.ResponseWriter, r *http.Request) {
+	var (
+		err     error
+		written int64
+	)
+
+	started := time.Now()
+	filePath := strings.TrimSpace(httphelpers.GetFromRequest[string](r, "path"))
+
+	defer func() {
+		c.audit(r, "download-decrypted", filePath, "", written, started, err)
+	}()
+
+	p, err := webauth.SanitizePath(r, c.config, filePath)
+
+	if err != nil {
+		slog.Error("invalid decrypt path", "error", err, "path", filePath)
+		http.Error(w, "Invalid file path", http.StatusBadRequest)
+		return
+	}
+
+	message, err := c.keyring.Open(p)
+
+	if err != nil {
+		c.decryptError(w, err, p)
+		return
+	}
+
+	defer message.Close()
+
+	name := decryptedName(filepath.Base(p), message.FileName)
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(name), "."))
+	disposition := "attachment"
+	contentType := mime.TypeByExtension("." + ext)
+
+	if _, ok := inlineMedia[ext]; ok {
+		disposition = "inline"
+	}
+
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("%s; filename=%q", disposition, name))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	if written, err = io.Copy(w, message); err != nil {
+		slog.Error("error streaming decrypted file", "error", err, "path", p, "bytes", written)
+		return
+	}
+
+	if message.Signature.Status == pgp.SignatureInvalid {
+		err = fmt.Errorf("invalid signature: %s", message.Signature.Error)
+		slog.Warn("decrypted file has an invalid signature", "path", p, "error", message.Signature.Error)
+	}
+
+	slog.Info("streamed decrypted file", "path", p, "bytes", written, "signature", message.Signature.Status)
+}
+
+/*
+previewPgp previews the content of an encrypted or signed file. The whole
+file is read so its signature can be checked, but only the first
+preview.MaxEntryPreviewSize is kept. Detached signatures and keys have no
+content, so they are described instead.
+*/
+func (c HomeController) previewPgp(w http.ResponseWriter, r *http.Request, root, fileName string) {
+	var (
+		content []byte
+	)
+
+	p, err := webauth.SanitizePath(r, c.config, filepath.Join(root, fileName))
+
+	if err != nil {
+		slog.Error("invalid preview path", "error", err, "root", root, "file", fileName)
+		http.Error(w, "Invalid file path", http.StatusBadRequest)
+		return
+	}
+
+	values := url.Values{}
+	values.Set("root", root)
+	values.Set("filename", fileName)
+
+	download := url.Values{}
+	download.Set("path", filepath.ToSlash(filepath.Join(root, fileName)))
+
+	view := httphelpers.GetFromRequest[string](r, "view")
+	src := html.EscapeString("/decrypt?" + download.Encode())
+	offset := preview.ParseOffset(httphelpers.GetFromRequest[string](r, "offset"))
+
+	message, err := c.keyring.Open(p)
+
+	if errors.Is(err, pgp.ErrNotMessage) {
+		c.previewPgpDetails(w, p, fileName)
+		return
+	}
+
+	if err == nil {
+		defer message.Close()
+
+		if content, err = io.ReadAll(io.LimitReader(message, preview.MaxEntryPreviewSize)); err == nil {
+			_, err = io.Copy(io.Discard, message)
+		}
+	}
+
+	if err != nil {
+		slog.Error("error decrypting file for preview", "error", err, "path", p)
+		httphelpers.TextOK(w, fmt.Sprintf(`<article class="error">Unable to decrypt %s: %s</article>`, html.EscapeString(fileName), html.EscapeString(err.Error())))
+		return
+	}
+
+	slog.Info("rendering decrypted preview", "path", p, "signature", message.Signature.Status, "view", view, "offset", offset)
+
+	name := decryptedName(fileName, message.FileName)
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(name), "."))
+	sb := strings.Builder{}
+
+	if offset == 0 {
+		sb.WriteString(pgpHeader(message.Details, name, src, len(content)))
+	}
+
+	if markup, ok := mediaMarkup(ext, src, name); ok && view != "decrypted-hex" {
+		sb.WriteString(markup)
+		httphelpers.TextOK(w, sb.String())
+		return
+	}
+
+	hidden := map[string]string{
+		"root":     root,
+		"filename": fileName,
+		"view":     "decrypted-hex",
+	}
+
+	if err = renderBuffered(&sb, content, ext, view == "decrypted-hex", offset, values, hidden); err != nil {
+		slog.Error("error rendering decrypted preview", "error", err, "path", p)
+		http.Error(w, "Error rendering decrypted file", http.StatusInternalServerError)
+		return
+	}
+
+	httphelpers.TextOK(w, sb.String())
+}
+
+/*
+previewPgpDetails describes a detached signature or a key block, followed
+by its armored text.
+*/
+func (c HomeController) previewPgpDetails(w http.ResponseWriter, p, fileName string) {
+	details, err := c.keyring.Inspect(p)
+
+	if err != nil {
+		slog.Error("error reading OpenPGP file", "error", err, "path", p)
+		httphelpers.TextOK(w, fmt.Sprintf(`<article class="error">Unable to read %s: %s</article>`, html.EscapeString(fileName), html.EscapeString(err.Error())))
+		return
+	}
+
+	chunk, err := preview.RenderText(p, preview.FormatText, 0)
+
+	if err != nil {
+		slog.Error("error reading file", "error", err, "path", p)
+		http.Error(w, "Error reading file", http.StatusInternalServerError)
+		return
+	}
+
+	sb := strings.Builder{}
+
+	switch details.Kind {
+	case pgp.KindSignature:
+		sb.WriteString(fmt.Sprintf(
+			`<p><small>Detached signature for <code>%s</code> &middot; %s</small></p>`,
+			html.EscapeString(details.Signed),
+			signatureMarkup(details.Signature),
+		))
+
+	case pgp.KindKey:
+		sb.WriteString(`<p><small>Keys</small></p><ul>`)
+
+		for _, key := range details.Keys {
+			sb.WriteString(fmt.Sprintf(`<li><code>%s</code></li>`, html.EscapeString(key)))
+		}
+
+		sb.WriteString(`</ul>`)
+	}
+
+	sb.WriteString(fmt.Sprintf(`<pre class="hl hl-%s">%s</pre>`, preview.FormatText, chunk.Markup))
+	httphelpers.TextOK(w, sb.String())
+}
+
+/*
+pgpHeader names decrypted content, with its size, its signature, and a
+link to download it. src must already be escaped, and buffered is how
+much of the content was kept for the preview.
+*/
+func pgpHeader(details pgp.Details, name, src string, buffered int) string {
+	action := "Signed content"
+
+	if details.Encrypted {
+		action = "Decrypted"
+	}
+
+	extra := ""
+
+	if details.Size > int64(buffered) {
+		extra = fmt.Sprintf(" &middot; previewing the first %s", html.EscapeString(humanize.Bytes(uint64(buffered))))
+	}
+
+	return fmt.Sprintf(
+		`<p><small>%s <code>%s</code> &middot; %s &middot; %s%s &middot; <a href="%s" download>Download decrypted</a></small></p>`,
+		action,
+		html.EscapeString(name),
+		html.EscapeString(humanize.Bytes(uint64(details.Size))),
+		signatureMarkup(details.Signature),
+		extra,
+		src,
+	)
+}
+
+// signatureMarkup describes the result of checking a signature
+func signatureMarkup(signature pgp.Signature) string {
+	switch signature.Status {
+	case pgp.SignatureValid:
+		return fmt.Sprintf(`<span class="badge badge-valid">valid signature</span> by %s`, html.EscapeString(signature.Signer))
+
+	case pgp.SignatureInvalid:
+		return fmt.Sprintf(
+			`<span class="badge badge-invalid" title="%s">invalid signature</span> from key %s`,
+			html.EscapeString(signature.Error),
+			html.EscapeString(signature.KeyID),
+		)
+
+	case pgp.SignatureUnknownKey:
+		return fmt.Sprintf(`<span class="badge badge-unknown-key">unknown key</span> signed by key %s, which isn't in the keyring`, html.EscapeString(signature.KeyID))
+
+	default:
+		return "not signed"
+	}
+}
+
+/*
+decryptedName names decrypted content after the file name stored in the
+message, or else the encrypted file's name without its extension.
+*/
+func decryptedName(fileName, stored string) string {
+	if stored != "" && stored != "_CONSOLE" {
+		return stored
+	}
+
+	return strings.TrimSuffix(fileName, filepath.Ext(fileName))
+}
+
+func (c HomeController) decryptError(w http.ResponseWriter, err error, p string) {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		slog.Error("file to decrypt not found", "path", p)
+		http.Error(w, "File not found", http.StatusNotFound)
+
+	case errors.Is(err, pgp.ErrNoKey), errors.Is(err, pgp.ErrNotMessage):
+		slog.Error("unable to decrypt file", "error", err, "path", p)
+		http.Error(w, fmt.Sprintf("Unable to decrypt: %v", err), http.StatusUnprocessableEntity)
+
+	default:
+		slog.Error("error decrypting file", "error", err, "path", p)
+		http.Error(w, "Error decrypting file", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,282 @@
+package home
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/adampresley/adamgokit/httphelpers"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/webauth"
+)
+
+/*
+POST /files/move?root={root}&name={name}&destination={destination}
+
+Moves or renames the file or folder name in root. destination is the new
+path relative to the viewer's home folder, including the new name.
+Renaming is a move within the same folder. Old copies, the last hooks run,
+and the validation report move along with the file.
+*/
+func (c HomeController) MoveFile(w http.ResponseWriter, r *http.Request) {
+	var (
+		err                         error
+		sourcePath, destinationPath string
+	)
+
+	started := time.Now()
+	root := strings.TrimSpace(httphelpers.GetFromRequest[string](r, "root"))
+	name := httphelpers.GetFromRequest[string](r, "name")
+	destination := strings.TrimSpace(httphelpers.GetFromRequest[string](r, "destination"))
+	fullPath := filepath.Join(root, name)
+
+	defer func() {
+		c.audit(r, "rename", fullPath, destination, 0, started, err)
+	}()
+
+	if sourcePath, destinationPath, err = c.sourceAndDestination(r, fullPath, destination); err != nil {
+		c.fileActionError(w, err, "move", fullPath, destination)
+		return
+	}
+
+	if err = os.MkdirAll(filepath.Dir(destinationPath), 0755); err == nil {
+		err = os.Rename(sourcePath, destinationPath)
+	}
+
+	if err != nil {
+		slog.Error("error moving file", "error", err, "source", sourcePath, "destination", destinationPath)
+		http.Error(w, fmt.Sprintf("Error moving %s: %v", name, err), http.StatusInternalServerError)
+		return
+	}
+
+	if err := c.versions.Moved(sourcePath, destinationPath); err != nil {
+		slog.Error("error moving old copies", "error", err, "source", sourcePath, "destination", destinationPath)
+	}
+
+	c.hooks.Moved(sourcePath, destinationPath)
+
+	slog.Info("moved file", "source", sourcePath, "destination", destinationPath)
+	httphelpers.TextOK(w, fmt.Sprintf("Moved %s to %s", name, destination))
+}
+
+/*
+POST /files/copy?root={root}&name={name}&destination={destination}
+
+Copies the file or folder name in root to destination, which is a path
+relative to the viewer's home folder including the name of the copy. Folders are
+copied recursively.
+*/
+func (c HomeController) CopyFile(w http.ResponseWriter, r *http.Request) {
+	var (
+		err                         error
+		sourcePath, destinationPath string
+		copied                      int64
+	)
+
+	started := time.Now()
+	root := strings.TrimSpace(httphelpers.GetFromRequest[string](r, "root"))
+	name := httphelpers.GetFromRequest[string](r, "name")
+	destination := strings.TrimSpace(httphelpers.GetFromRequest[string](r, "destination"))
+	fullPath := filepath.Join(root, name)
+
+	defer func() {
+		c.audit(r, "copy", fullPath, destination, copied, started, err)
+	}()
+
+	if sourcePath, destinationPath, err = c.sourceAndDestination(r, fullPath, destination); err != nil {
+		c.fileActionError(w, err, "copy", fullPath, destination)
+		return
+	}
+
+	if copied, err = copyPath(sourcePath, destinationPath); err != nil {
+		slog.Error("error copying file", "error", err, "source", sourcePath, "destination", destinationPath)
+		http.Error(w, fmt.Sprintf("Error copying %s: %v", name, err), http.StatusInternalServerError)
+		return
+	}
+
+	slog.Info("copied file", "source", sourcePath, "destination", destinationPath, "bytes", copied)
+	httphelpers.TextOK(w, fmt.Sprintf("Copied %s to %s", name, destination))
+}
+
+/*
+POST /folders?root={root}&name={name}
+*/
+func (c HomeController) CreateFolder(w http.ResponseWriter, r *http.Request) {
+	var (
+		err       error
+		cleanPath string
+	)
+
+	started := time.Now()
+	root := strings.TrimSpace(httphelpers.GetFromRequest[string](r, "root"))
+	name := strings.TrimSpace(httphelpers.GetFromRequest[string](r, "name"))
+	fullPath := filepath.Join(root, name)
+
+	defer func() {
+		c.audit(r, "mkdir", fullPath, "", 0, started, err)
+	}()
+
+	if name == "" {
+		err = fmt.Errorf("no folder name provided")
+		http.Error(w, "No folder name provided", http.StatusBadRequest)
+		return
+	}
+
+	if cleanPath, err = webauth.SanitizePath(r, c.config, fullPath); err != nil {
+		slog.Error("invalid folder path", "error", err, "path", fullPath)
+		http.Error(w, "Invalid folder path", http.StatusBadRequest)
+		return
+	}
+
+	if err = os.Mkdir(cleanPath, 0755); err != nil {
+		if errors.Is(err, fs.ErrExist) {
+			http.Error(w, fmt.Sprintf("%s already exists", name), http.StatusConflict)
+			return
+		}
+
+		slog.Error("error creating folder", "error", err, "path", cleanPath)
+		http.Error(w, fmt.Sprintf("Error creating %s: %v", name, err), http.StatusInternalServerError)
+		return
+	}
+
+	slog.Info("created folder", "path", cleanPath)
+	httphelpers.TextOK(w, fmt.Sprintf("Created %s", name))
+}
+
+/*
+sourceAndDestination sanitizes both sides of a move or copy. The source
+must exist, the destination must not, and a folder cannot be placed
+inside itself.
+*/
+func (c HomeController) sourceAndDestination(r *http.Request, source, destination string) (string, string, error) {
+	if strings.TrimSpace(source) == "" || destination == "" {
+		return "", "", fmt.Errorf("a source and destination are required")
+	}
+
+	sourcePath, err := webauth.SanitizePath(r, c.config, source)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	destinationPath, err := webauth.SanitizePath(r, c.config, destination)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	uploadFolderAbs, _ := webauth.SanitizePath(r, c.config, "")
+
+	if sourcePath == uploadFolderAbs || destinationPath == uploadFolderAbs {
+		return "", "", fmt.Errorf("the upload folder itself cannot be moved or replaced")
+	}
+
+	if _, err = os.Stat(sourcePath); err != nil {
+		return "", "", err
+	}
+
+	if _, err = os.Lstat(destinationPath); err == nil {
+		return "", "", errFileExists
+	}
+
+	if destinationPath == sourcePath || strings.HasPrefix(destinationPath, sourcePath+string(filepath.Separator)) {
+		return "", "", fmt.Errorf("cannot place %s inside itself", source)
+	}
+
+	return sourcePath, destinationPath, nil
+}
+
+func (c HomeController) fileActionError(w http.ResponseWriter, err error, action, source, destination string) {
+	switch {
+	case errors.Is(err, errFileExists):
+		slog.Info(action+" refused, destination exists", "source", source, "destination", destination)
+		http.Error(w, fmt.Sprintf("%s already exists", destination), http.StatusConflict)
+
+	case errors.Is(err, fs.ErrNotExist):
+		slog.Error(action+" source not found", "source", source)
+		http.Error(w, "File or directory not found", http.StatusNotFound)
+
+	default:
+		slog.Error("invalid "+action+" request", "error", err, "source", source, "destination", destination)
+		http.Error(w, fmt.Sprintf("Cannot %s: %v", action, err), http.StatusBadRequest)
+	}
+}
+
+/*
+copyPath copies a file, or a folder and everything in it, returning the
+number of bytes copied. Existing files are never overwritten.
+*/
+func copyPath(source, destination string) (int64, error) {
+	var (
+		copied int64
+	)
+
+	err := filepath.WalkDir(source, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relativePath, err := filepath.Rel(source, path)
+
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(destination, relativePath)
+		info, err := d.Info()
+
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm()|0700)
+
+		case info.Mode().IsRegular():
+			written, err := copyFile(path, target, info.Mode().Perm())
+			copied += written
+			return err
+
+		default:
+			slog.Warn("skipping non-regular file during copy", "path", path)
+			return nil
+		}
+	})
+
+	return copied, err
+}
+
+func copyFile(source, destination string, perm fs.FileMode) (int64, error) {
+	in, err := os.Open(source)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer in.Close()
+
+	if err = os.MkdirAll(filepath.Dir(destination), 0755); err != nil {
+		return 0, err
+	}
+
+	out, err := os.OpenFile(destination, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+
+	if err != nil {
+		return 0, err
+	}
+
+	written, err := io.Copy(out, in)
+
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+
+	return written, err
+}
@@ -2,44 +2,112 @@ package home
 
 import (
 	"fmt"
+	"html"
 	"log/slog"
 	"mime"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/adampresley/adamgokit/httphelpers"
 	"github.com/adampresley/adamgokit/rendering"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/audit"
 	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/configuration"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/hooks"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/pgp"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/preview"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/trashbin"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/validation"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/versioning"
 	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/viewmodels"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/webauth"
 )
 
 type HomeHandlers interface {
 	HomePage(w http.ResponseWriter, r *http.Request)
 	AboutPage(w http.ResponseWriter, r *http.Request)
 	PreviewContent(w http.ResponseWriter, r *http.Request)
+	CompareFiles(w http.ResponseWriter, r *http.Request)
 	ServeFile(w http.ResponseWriter, r *http.Request)
 	DeleteFile(w http.ResponseWriter, r *http.Request)
+	UploadFile(w http.ResponseWriter, r *http.Request)
+	UploadChunk(w http.ResponseWriter, r *http.Request)
+	MoveFile(w http.ResponseWriter, r *http.Request)
+	CopyFile(w http.ResponseWriter, r *http.Request)
+	CreateFolder(w http.ResponseWriter, r *http.Request)
+	DownloadArchive(w http.ResponseWriter, r *http.Request)
+	DownloadArchiveEntry(w http.ResponseWriter, r *http.Request)
+	ServeThumbnail(w http.ResponseWriter, r *http.Request)
+	DownloadVersion(w http.ResponseWriter, r *http.Request)
+	DownloadDecrypted(w http.ResponseWriter, r *http.Request)
 }
 
+var (
+	// inlineMedia maps the extensions previewed with an img, audio, or
+	// video tag to the tag used
+	inlineMedia = map[string]string{
+		"png":  "img",
+		"jpeg": "img",
+		"jpg":  "img",
+		"webp": "img",
+		"gif":  "img",
+		"bmp":  "img",
+		"m3a":  "audio",
+		"m4a":  "audio",
+		"mp3":  "audio",
+		"wav":  "audio",
+		"ogg":  "audio",
+		"oga":  "audio",
+		"flac": "audio",
+		"mp4":  "video",
+		"m4v":  "video",
+		"mov":  "video",
+		"webm": "video",
+	}
+)
+
 type HomeControllerConfig struct {
-	Config   *configuration.Config
-	Renderer rendering.TemplateRenderer
+	Config    *configuration.Config
+	Renderer  rendering.TemplateRenderer
+	AuditLog  *audit.Logger
+	Trash     *trashbin.Bin
+	Versions  *versioning.Store
+	Hooks     *hooks.Runner
+	Keyring   *pgp.Keyring
+	Validator *validation.Validator
 }
 
 type HomeController struct {
-	config   *configuration.Config
-	renderer rendering.TemplateRenderer
+	config    *configuration.Config
+	renderer  rendering.TemplateRenderer
+	auditLog  *audit.Logger
+	trash     *trashbin.Bin
+	versions  *versioning.Store
+	hooks     *hooks.Runner
+	keyring   *pgp.Keyring
+	validator *validation.Validator
 }
 
 func NewHomeController(config HomeControllerConfig) HomeController {
 	return HomeController{
-		config:   config.Config,
-		renderer: config.Renderer,
+		config:    config.Config,
+		renderer:  config.Renderer,
+		auditLog:  config.AuditLog,
+		trash:     config.Trash,
+		versions:  config.Versions,
+		hooks:     config.Hooks,
+		keyring:   config.Keyring,
+		validator: config.Validator,
 	}
 }
 
+/*
+GET /?root={root}&sort={sort}&dir={dir}&filter={filter}&since={since}&until={until}&page={page}&pagesize={pagesize}
+*/
 func (c HomeController) HomePage(w http.ResponseWriter, r *http.Request) {
 	var (
 		err       error
@@ -54,6 +122,7 @@ func (c HomeController) HomePage(w http.ResponseWriter, r *http.Request) {
 			Version: c.config.Version,
 			Message: "",
 			IsHtmx:  httphelpers.IsHtmx(r),
+			Viewer:  webauth.ViewerFromRequest(r),
 			JavascriptIncludes: []rendering.JavascriptInclude{
 				{
 					Type: "module",
@@ -66,7 +135,7 @@ func (c HomeController) HomePage(w http.ResponseWriter, r *http.Request) {
 		Parent: "",
 	}
 
-	if cleanRoot, err = c.config.SanitizePath(viewData.Root); err != nil {
+	if cleanRoot, err = webauth.SanitizePath(r, c.config, viewData.Root); err != nil {
 		slog.Error("error determining root path", "error", err, "root", viewData.Root)
 		viewData.Message = "Invalid root path"
 		viewData.IsError = true
@@ -92,8 +161,25 @@ func (c HomeController) HomePage(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	list := newListing(r)
+	viewData.Query = list.query
+
+	if err = list.validate(); err != nil {
+		viewData.Message = err.Error()
+		viewData.IsError = true
+
+		c.renderer.Render(pageName, viewData, w)
+		return
+	}
+
+	matches := make([]os.FileInfo, 0, len(osFiles))
+
 	for _, f := range osFiles {
-		newFile, err := viewmodels.NewFileFromOS(f, viewData.Root)
+		if configuration.IsSystemPath(filepath.Join(viewData.Viewer.Home, viewData.Root, f.Name())) {
+			continue
+		}
+
+		info, err := f.Info()
 
 		if err != nil {
 			slog.Error("error reading file info", "error", err, "root", cleanRoot, "file", f.Name())
@@ -104,29 +190,108 @@ func (c HomeController) HomePage(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		viewData.Files = append(viewData.Files, newFile)
+		if list.matches(info) {
+			matches = append(matches, info)
+		}
+	}
+
+	list.sort(matches)
+	pageFiles, totalPages := list.page(matches)
+
+	viewData.Query = list.query
+	viewData.TotalFiles = len(matches)
+	viewData.TotalPages = totalPages
+
+	for _, info := range pageFiles {
+		file := viewmodels.NewFileFromInfo(info, viewData.Root)
+
+		if !info.IsDir() {
+			file.HookStatus = c.hookStatus(filepath.Join(cleanRoot, info.Name()))
+			file.Validation = c.validationStatus(filepath.Join(cleanRoot, info.Name()))
+		}
+
+		viewData.Files = append(viewData.Files, file)
 	}
 
-	slog.Info("rendering home page", "root", cleanRoot)
+	slog.Info("rendering home page", "root", cleanRoot, "files", viewData.TotalFiles, "page", viewData.Query.Page)
 	c.renderer.Render(pageName, viewData, w)
 }
 
+// hookStatus returns the status of the last hooks run on a file, if any
+func (c HomeController) hookStatus(fullPath string) string {
+	run, err := c.hooks.Status(fullPath)
+
+	if err != nil {
+		slog.Error("error reading hook status", "error", err, "path", fullPath)
+		return ""
+	}
+
+	if run == nil {
+		return ""
+	}
+
+	return run.Status
+}
+
+/*
+validationStatus returns the last validation report of a file, with the
+errors of the checks that failed, or nil if it hasn't been checked.
+*/
+func (c HomeController) validationStatus(fullPath string) *viewmodels.FileValidation {
+	report, err := c.validator.Status(fullPath)
+
+	if err != nil {
+		slog.Error("error reading validation report", "error", err, "path", fullPath)
+		return nil
+	}
+
+	if report == nil {
+		return nil
+	}
+
+	result := &viewmodels.FileValidation{
+		Status:  report.Status,
+		Checked: report.Checked,
+		Checks:  len(report.Results),
+		Errors:  []string{},
+	}
+
+	for _, check := range report.Results {
+		for _, message := range check.Errors {
+			result.Errors = append(result.Errors, fmt.Sprintf("%s, %s: %s", check.Rule, check.Check, message))
+		}
+	}
+
+	return result
+}
+
 /*
 GET /uploads?path={path}
 */
 func (c HomeController) ServeFile(w http.ResponseWriter, r *http.Request) {
+	var (
+		err      error
+		fileSize int64
+	)
+
+	started := time.Now()
 	filePath := strings.TrimSpace(httphelpers.GetFromRequest[string](r, "path"))
 
+	defer func() {
+		c.audit(r, "download", filePath, "", fileSize, started, err)
+	}()
+
 	slog.Info("serving file", "path", filePath)
 
 	if filePath == "" {
 		slog.Error("no file path provided")
+		err = fmt.Errorf("no file path provided")
 		http.Error(w, "No file path provided", http.StatusBadRequest)
 		return
 	}
 
 	// Sanitize and validate the path
-	cleanPath, err := c.config.SanitizePath(filePath)
+	cleanPath, err := webauth.SanitizePath(r, c.config, filePath)
 	if err != nil {
 		slog.Error("invalid file path", "error", err, "path", filePath)
 		http.Error(w, "Invalid file path", http.StatusBadRequest)
@@ -150,6 +315,7 @@ func (c HomeController) ServeFile(w http.ResponseWriter, r *http.Request) {
 	// Ensure it's a file, not a directory
 	if fileInfo.IsDir() {
 		slog.Error("cannot serve a directory", "path", cleanPath)
+		err = fmt.Errorf("cannot download a directory")
 		http.Error(w, "Cannot download a directory", http.StatusBadRequest)
 		return
 	}
@@ -180,13 +346,14 @@ func (c HomeController) ServeFile(w http.ResponseWriter, r *http.Request) {
 
 	// Log the download
 	slog.Info("serving file", "path", cleanPath, "size", fileInfo.Size())
+	fileSize = fileInfo.Size()
 
 	// Serve the file
 	http.ServeContent(w, r, fileName, fileInfo.ModTime(), file)
 }
 
 /*
-GET /preview?ext={ext}&filename={filename}&root={root}
+GET /preview?ext={ext}&filename={filename}&root={root}&offset={offset}&entry={entry}
 */
 func (c HomeController) PreviewContent(w http.ResponseWriter, r *http.Request) {
 	ext := strings.ToLower(httphelpers.GetFromRequest[string](r, "ext"))
@@ -194,38 +361,255 @@ func (c HomeController) PreviewContent(w http.ResponseWriter, r *http.Request) {
 	root := strings.TrimSpace(httphelpers.GetFromRequest[string](r, "root"))
 
 	markup := ""
+	src := html.EscapeString("/uploads?path=" + url.QueryEscape(filepath.ToSlash(filepath.Join(root, fileName))))
+
+	if entry := httphelpers.GetFromRequest[string](r, "entry"); entry != "" {
+		c.previewArchiveEntry(w, r, root, fileName, entry)
+		return
+	}
+
+	if httphelpers.GetFromRequest[string](r, "view") == "hex" {
+		c.previewHex(w, r, root, fileName)
+		return
+	}
+
+	if pgp.IsPgpFile(fileName) {
+		c.previewPgp(w, r, root, fileName)
+		return
+	}
+
+	if format, ok := preview.TextFormat(ext); ok {
+		c.previewText(w, r, root, fileName, ext, format)
+		return
+	}
+
+	if _, ok := preview.ArchiveFormat(fileName); ok {
+		c.previewArchive(w, r, root, fileName)
+		return
+	}
+
+	if markup, ok := mediaMarkup(ext, src, fileName); ok {
+		httphelpers.TextOK(w, markup)
+		return
+	}
 
 	switch ext {
-	case "png", "jpeg", "jpg", "webp":
-		markup = fmt.Sprintf(`<img src="/uploads?path=%s/%s" alt="%s" />`, root, fileName, fileName)
-	case "m3a", "mp3", "wav", "ogg", "oga", "flac":
-		markup = fmt.Sprintf(`<audio controls><source src="/uploads?path=%s/%s" type="%s" /></audio>`, root, fileName, ext)
-	case "csv", "tsv", "pdf", "xls", "xlsx", "doc", "docx":
+	case "csv", "tsv", "xlsx":
+		c.previewTable(w, r, root, fileName, ext)
+		return
+	case "xls":
+		markup = fmt.Sprintf(`<article class="warning">Legacy .xls workbooks can't be previewed. <a href="%s">Download %s</a> instead.</article>`, src, html.EscapeString(fileName))
+	case "pdf", "doc", "docx":
 		c.ServeFile(w, r)
-	case "txt":
-		p := filepath.Join(root, fileName)
-		p, _ = c.config.SanitizePath(p)
-		slog.Info("rendering text preview", "path", p)
-		textContent, err := os.ReadFile(p)
+	default:
+		c.previewSniffed(w, r, root, fileName, src)
+		return
+	}
 
-		if err != nil {
-			slog.Error("error reading file", "error", err, "path", root, "file", fileName)
-			http.Error(w, "Error reading file", http.StatusInternalServerError)
-			return
-		}
+	httphelpers.TextOK(w, markup)
+}
+
+/*
+mediaMarkup returns an img, audio, or video tag for extensions the
+browser can show itself. src must already be escaped. Videos are left
+for the browser to sniff, as a type it doesn't recognize, such as
+video/quicktime, would stop it trying to play the file at all.
+*/
+func mediaMarkup(ext, src, name string) (string, bool) {
+	switch inlineMedia[ext] {
+	case "img":
+		return fmt.Sprintf(`<img src="%s" alt="%s" />`, src, html.EscapeString(name)), true
+	case "audio":
+		return fmt.Sprintf(`<audio controls><source src="%s" type="%s" /></audio>`, src, html.EscapeString(mime.TypeByExtension("."+ext))), true
+	case "video":
+		return fmt.Sprintf(`<video controls preload="metadata" src="%s"></video>`, src), true
+	}
 
-		markup = fmt.Sprintf(`<pre>%s</pre>`, strings.ReplaceAll(string(textContent), "\n", "<br>"))
+	return "", false
+}
+
+/*
+previewText renders a chunk of a text file, escaped and highlighted. When
+more of the file remains, a button loads the next chunk in place.
+*/
+func (c HomeController) previewText(w http.ResponseWriter, r *http.Request, root, fileName, ext, format string) {
+	offset, _ := strconv.ParseInt(httphelpers.GetFromRequest[string](r, "offset"), 10, 64)
+	p, err := webauth.SanitizePath(r, c.config, filepath.Join(root, fileName))
+
+	if err != nil {
+		slog.Error("invalid preview path", "error", err, "root", root, "file", fileName)
+		http.Error(w, "Invalid file path", http.StatusBadRequest)
+		return
+	}
+
+	slog.Info("rendering text preview", "path", p, "format", format, "offset", offset)
+	chunk, err := preview.RenderText(p, format, offset)
+
+	if err != nil {
+		slog.Error("error reading file", "error", err, "path", root, "file", fileName)
+		http.Error(w, "Error reading file", http.StatusInternalServerError)
+		return
+	}
+
+	sb := strings.Builder{}
+
+	if offset == 0 {
+		sb.WriteString(fmt.Sprintf(`<p><small>%s</small></p>`, html.EscapeString(chunk.Header())))
+	}
+
+	sb.WriteString(fmt.Sprintf(`<pre class="hl hl-%s">%s</pre>`, format, chunk.Markup))
+
+	if chunk.Next > 0 {
+		values := url.Values{}
+		values.Set("root", root)
+		values.Set("filename", fileName)
+		values.Set("ext", ext)
+		values.Set("offset", strconv.FormatInt(chunk.Next, 10))
+
+		sb.WriteString(fmt.Sprintf(
+			`<button class="outline" hx-get="%s" hx-target="this" hx-swap="outerHTML">Load more</button>`,
+			html.EscapeString("/preview?"+values.Encode()),
+		))
+	}
+
+	httphelpers.TextOK(w, sb.String())
+}
+
+/*
+previewSniffed previews a file whose extension we don't know by looking
+at its content. Images, audio, video, and text get their usual previews
+and anything else is shown as a hex dump.
+*/
+func (c HomeController) previewSniffed(w http.ResponseWriter, r *http.Request, root, fileName, src string) {
+	p, err := webauth.SanitizePath(r, c.config, filepath.Join(root, fileName))
+
+	if err != nil {
+		slog.Error("invalid preview path", "error", err, "root", root, "file", fileName)
+		http.Error(w, "Invalid file path", http.StatusBadRequest)
+		return
+	}
+
+	contentType, err := preview.SniffContentType(p)
+
+	if err != nil {
+		slog.Error("error reading file", "error", err, "path", p)
+		http.Error(w, "Error reading file", http.StatusInternalServerError)
+		return
+	}
+
+	slog.Info("sniffed file type for preview", "path", p, "contentType", contentType)
+
+	switch {
+	case strings.HasPrefix(contentType, "image/"):
+		httphelpers.TextOK(w, fmt.Sprintf(`<img src="%s" alt="%s" />`, src, html.EscapeString(fileName)))
+	case strings.HasPrefix(contentType, "audio/"):
+		httphelpers.TextOK(w, fmt.Sprintf(`<audio controls><source src="%s" type="%s" /></audio>`, src, html.EscapeString(contentType)))
+	case strings.HasPrefix(contentType, "video/"):
+		httphelpers.TextOK(w, fmt.Sprintf(`<video controls preload="metadata" src="%s"></video>`, src))
+	case strings.HasPrefix(contentType, "text/plain"):
+		c.previewText(w, r, root, fileName, "", preview.FormatText)
 	default:
-		c.ServeFile(w, r)
+		c.previewHex(w, r, root, fileName)
 	}
+}
 
-	httphelpers.TextOK(w, markup)
+/*
+previewHex renders a page of a hex and ASCII dump with a summary of the
+file's encoding.
+*/
+func (c HomeController) previewHex(w http.ResponseWriter, r *http.Request, root, fileName string) {
+	p, err := webauth.SanitizePath(r, c.config, filepath.Join(root, fileName))
+
+	if err != nil {
+		slog.Error("invalid preview path", "error", err, "root", root, "file", fileName)
+		http.Error(w, "Invalid file path", http.StatusBadRequest)
+		return
+	}
+
+	offset := preview.ParseOffset(httphelpers.GetFromRequest[string](r, "offset"))
+	dump, err := preview.ReadHexDump(p, offset)
+
+	if err != nil {
+		slog.Error("error reading hex preview", "error", err, "path", p)
+		http.Error(w, "Error reading file", http.StatusInternalServerError)
+		return
+	}
+
+	slog.Info("rendering hex preview", "path", p, "offset", dump.Offset)
+
+	hidden := map[string]string{
+		"root":     root,
+		"filename": fileName,
+		"view":     "hex",
+	}
+
+	if err = dump.Render(w, hidden); err != nil {
+		slog.Error("error rendering hex preview", "error", err, "path", p)
+	}
+}
+
+/*
+previewTable renders one page of a delimited file or Excel sheet as a
+table.
+*/
+func (c HomeController) previewTable(w http.ResponseWriter, r *http.Request, root, fileName, ext string) {
+	var (
+		table preview.Table
+	)
+
+	p, err := webauth.SanitizePath(r, c.config, filepath.Join(root, fileName))
+
+	if err != nil {
+		slog.Error("invalid preview path", "error", err, "root", root, "file", fileName)
+		http.Error(w, "Invalid file path", http.StatusBadRequest)
+		return
+	}
+
+	page, _ := strconv.Atoi(httphelpers.GetFromRequest[string](r, "page"))
+
+	options := preview.TableOptions{
+		Delimiter: httphelpers.GetFromRequest[string](r, "delimiter"),
+		Header:    httphelpers.GetFromRequest[string](r, "header"),
+		Sheet:     httphelpers.GetFromRequest[string](r, "sheet"),
+		Page:      page,
+	}
+
+	if ext == "xlsx" {
+		table, err = preview.ReadXlsx(p, options)
+	} else {
+		table, err = preview.ReadDelimited(p, ext, options)
+	}
+
+	if err != nil {
+		slog.Error("error reading table preview", "error", err, "path", p)
+		httphelpers.TextOK(w, fmt.Sprintf(`<article class="error">Unable to preview %s: %s</article>`, html.EscapeString(fileName), html.EscapeString(err.Error())))
+		return
+	}
+
+	slog.Info("rendering table preview", "path", p, "rows", table.RowCount, "page", table.Page)
+
+	hidden := map[string]string{
+		"root":     root,
+		"filename": fileName,
+		"ext":      ext,
+	}
+
+	if err = table.Render(w, hidden); err != nil {
+		slog.Error("error rendering table preview", "error", err, "path", p)
+	}
 }
 
 /*
 DELETE /uploads?root={root}&filename={filename}&isdir={isdir}
+
+Moves the file or folder to the trash, from where it can be restored.
 */
 func (c HomeController) DeleteFile(w http.ResponseWriter, r *http.Request) {
+	var (
+		deleteErr error
+	)
+
+	started := time.Now()
 	root := strings.TrimSpace(httphelpers.GetFromRequest[string](r, "root"))
 	filename := httphelpers.GetFromRequest[string](r, "name")
 	isdir := httphelpers.GetFromRequest[bool](r, "isdir")
@@ -233,19 +617,36 @@ func (c HomeController) DeleteFile(w http.ResponseWriter, r *http.Request) {
 	// Construct the full path
 	fullPath := filepath.Join(root, filename)
 
+	defer func() {
+		c.audit(r, "delete", fullPath, "", 0, started, deleteErr)
+	}()
+
 	// Sanitize and validate the path
-	cleanPath, err := c.config.SanitizePath(fullPath)
+	cleanPath, err := webauth.SanitizePath(r, c.config, fullPath)
 	if err != nil {
+		deleteErr = err
 		slog.Error("invalid file path for deletion", "error", err, "path", fullPath)
 		http.Error(w, "Invalid file path", http.StatusBadRequest)
 		return
 	}
 
+	// A blank name or "/" is the home folder itself, which can't be trashed
+	homeAbs, _ := webauth.SanitizePath(r, c.config, "")
+
+	if strings.TrimSpace(filename) == "" || cleanPath == homeAbs {
+		deleteErr = fmt.Errorf("the home folder itself cannot be deleted")
+		slog.Error("refusing to delete the home folder", "path", fullPath)
+		http.Error(w, "The home folder itself cannot be deleted", http.StatusBadRequest)
+		return
+	}
+
 	slog.Info("attempting to delete", "path", cleanPath, "isDirectory", isdir, "fullpath", fullPath)
 
 	// Check if file/directory exists
 	_, err = os.Stat(cleanPath)
 	if err != nil {
+		deleteErr = err
+
 		if os.IsNotExist(err) {
 			slog.Error("file or directory not found for deletion", "path", cleanPath)
 			http.Error(w, "File or directory not found", http.StatusNotFound)
@@ -257,15 +658,9 @@ func (c HomeController) DeleteFile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Delete the file or directory
-	var deleteErr error
-	if isdir {
-		slog.Info("deleting directory", "path", cleanPath)
-		deleteErr = os.RemoveAll(cleanPath)
-	} else {
-		slog.Info("deleting file", "path", cleanPath)
-		deleteErr = os.Remove(cleanPath)
-	}
+	// Move the file or directory to the trash
+	slog.Info("deleting", "path", cleanPath, "isDirectory", isdir)
+	_, deleteErr = c.trash.Move(cleanPath, webauth.UploadPath(r, fullPath), webauth.ViewerFromRequest(r).Name, audit.ProtocolHttp)
 
 	if deleteErr != nil {
 		slog.Error("error deleting file or directory", "error", deleteErr, "path", cleanPath, "isDirectory", isdir)
@@ -275,7 +670,7 @@ func (c HomeController) DeleteFile(w http.ResponseWriter, r *http.Request) {
 
 	// Return success response
 	w.WriteHeader(http.StatusOK)
-	httphelpers.TextOK(w, fmt.Sprintf("Successfully deleted %s", filename))
+	httphelpers.TextOK(w, fmt.Sprintf("Moved %s to the trash", filename))
 }
 
 func (c HomeController) AboutPage(w http.ResponseWriter, r *http.Request) {
@@ -286,9 +681,34 @@ func (c HomeController) AboutPage(w http.ResponseWriter, r *http.Request) {
 			Version:            c.config.Version,
 			Message:            "",
 			IsHtmx:             httphelpers.IsHtmx(r),
+			Viewer:             webauth.ViewerFromRequest(r),
 			JavascriptIncludes: []rendering.JavascriptInclude{},
 		},
 	}
 
 	c.renderer.Render(pageName, viewData, w)
 }
+
+/*
+audit records a file operation performed through the web interface. Paths
+are recorded from the root of the upload folder, as they are for SFTP.
+*/
+func (c HomeController) audit(r *http.Request, operation, path, target string, bytes int64, started time.Time, err error) {
+	record := audit.Record{
+		Time:       started,
+		RemoteAddr: r.RemoteAddr,
+		User:       webauth.ViewerFromRequest(r).Name,
+		Protocol:   audit.ProtocolHttp,
+		Operation:  operation,
+		Path:       webauth.UploadPath(r, path),
+		Target:     target,
+		Bytes:      bytes,
+	}
+
+	if target != "" {
+		record.Target = webauth.UploadPath(r, target)
+	}
+
+	record.Finish(started, err)
+	c.auditLog.Log(record)
+}
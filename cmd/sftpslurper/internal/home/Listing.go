@@ -0,0 +1,168 @@
+package home
+
+import (
+	"cmp"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adampresley/adamgokit/httphelpers"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/viewmodels"
+)
+
+const (
+	SortByName = "name"
+	SortByDate = "date"
+	SortBySize = "size"
+
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+/*
+listing filters, sorts, and pages the entries of a folder. Folders are
+always listed before files.
+*/
+type listing struct {
+	query viewmodels.ListingQuery
+	since time.Time
+	until time.Time
+	glob  bool
+}
+
+func newListing(r *http.Request) listing {
+	query := viewmodels.ListingQuery{
+		Sort:      strings.ToLower(strings.TrimSpace(httphelpers.GetFromRequest[string](r, "sort"))),
+		Direction: strings.ToLower(strings.TrimSpace(httphelpers.GetFromRequest[string](r, "dir"))),
+		Filter:    strings.TrimSpace(httphelpers.GetFromRequest[string](r, "filter")),
+		Since:     strings.TrimSpace(httphelpers.GetFromRequest[string](r, "since")),
+		Until:     strings.TrimSpace(httphelpers.GetFromRequest[string](r, "until")),
+	}
+
+	query.Page, _ = strconv.Atoi(httphelpers.GetFromRequest[string](r, "page"))
+	query.PageSize, _ = strconv.Atoi(httphelpers.GetFromRequest[string](r, "pagesize"))
+
+	if query.Sort != SortByDate && query.Sort != SortBySize {
+		query.Sort = SortByName
+	}
+
+	if query.Direction != "desc" {
+		query.Direction = "asc"
+	}
+
+	if query.PageSize <= 0 {
+		query.PageSize = defaultPageSize
+	}
+
+	query.PageSize = min(query.PageSize, maxPageSize)
+	query.Page = max(query.Page, 1)
+
+	result := listing{
+		query: query,
+		glob:  strings.ContainsAny(query.Filter, "*?["),
+	}
+
+	if t, err := time.ParseInLocation("2006-01-02", query.Since, time.Local); err == nil {
+		result.since = t
+	}
+
+	// until includes the whole day
+	if t, err := time.ParseInLocation("2006-01-02", query.Until, time.Local); err == nil {
+		result.until = t.AddDate(0, 0, 1)
+	}
+
+	return result
+}
+
+/*
+validate reports a filter that can never match, such as a malformed glob.
+*/
+func (l listing) validate() error {
+	if l.glob {
+		if _, err := path.Match(l.query.Filter, ""); err != nil {
+			return fmt.Errorf("invalid filter pattern '%s'", l.query.Filter)
+		}
+	}
+
+	return nil
+}
+
+/*
+matches returns true if a file passes the name filter and date range. A
+filter containing *, ?, or [ is matched as a glob, otherwise as a
+substring. Both ignore case.
+*/
+func (l listing) matches(info os.FileInfo) bool {
+	if l.query.Filter != "" {
+		name := strings.ToLower(info.Name())
+		filter := strings.ToLower(l.query.Filter)
+
+		if l.glob {
+			if ok, _ := path.Match(filter, name); !ok {
+				return false
+			}
+		} else if !strings.Contains(name, filter) {
+			return false
+		}
+	}
+
+	if !l.since.IsZero() && info.ModTime().Before(l.since) {
+		return false
+	}
+
+	if !l.until.IsZero() && !info.ModTime().Before(l.until) {
+		return false
+	}
+
+	return true
+}
+
+func (l listing) sort(files []os.FileInfo) {
+	slices.SortStableFunc(files, func(a, b os.FileInfo) int {
+		if a.IsDir() != b.IsDir() {
+			if a.IsDir() {
+				return -1
+			}
+
+			return 1
+		}
+
+		var result int
+
+		switch l.query.Sort {
+		case SortByDate:
+			result = a.ModTime().Compare(b.ModTime())
+		case SortBySize:
+			result = cmp.Compare(a.Size(), b.Size())
+		}
+
+		if result == 0 {
+			result = cmp.Compare(strings.ToLower(a.Name()), strings.ToLower(b.Name()))
+		}
+
+		if l.query.Direction == "desc" {
+			return -result
+		}
+
+		return result
+	})
+}
+
+/*
+page returns the files on the requested page and the total page count. A
+page past the end is clamped to the last page.
+*/
+func (l *listing) page(files []os.FileInfo) ([]os.FileInfo, int) {
+	totalPages := max((len(files)+l.query.PageSize-1)/l.query.PageSize, 1)
+	l.query.Page = min(l.query.Page, totalPages)
+
+	start := (l.query.Page - 1) * l.query.PageSize
+	end := min(start+l.query.PageSize, len(files))
+
+	return files[start:end], totalPages
+}
@@ -0,0 +1,118 @@
+package home
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/adampresley/adamgokit/httphelpers"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/configuration"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/preview"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/webauth"
+)
+
+/*
+GET /thumbnails?path={path}
+
+Serves a small JPEG of an image for the directory listing. Thumbnails are
+made on first request and cached in the system folder. Thumbnails are not
+audited, as they are requested every time a folder of images is listed.
+*/
+func (c HomeController) ServeThumbnail(w http.ResponseWriter, r *http.Request) {
+	filePath := strings.TrimSpace(httphelpers.GetFromRequest[string](r, "path"))
+	ext := strings.TrimPrefix(filepath.Ext(filePath), ".")
+
+	if !preview.CanThumbnail(ext) {
+		http.Error(w, "Thumbnails are only available for images", http.StatusBadRequest)
+		return
+	}
+
+	cleanPath, err := webauth.SanitizePath(r, c.config, filePath)
+
+	if err != nil {
+		slog.Error("invalid thumbnail path", "error", err, "path", filePath)
+		http.Error(w, "Invalid file path", http.StatusBadRequest)
+		return
+	}
+
+	info, err := os.Stat(cleanPath)
+
+	if err != nil || !info.Mode().IsRegular() {
+		http.Error(w, "File not found", http.StatusNotFound)
+		return
+	}
+
+	thumbnailPath, err := c.thumbnail(cleanPath, info)
+
+	if err != nil {
+		slog.Error("error making thumbnail", "error", err, "path", cleanPath)
+		http.Error(w, "Cannot make a thumbnail of this image", http.StatusUnprocessableEntity)
+		return
+	}
+
+	f, err := os.Open(thumbnailPath)
+
+	if err != nil {
+		slog.Error("error opening thumbnail", "error", err, "path", thumbnailPath)
+		http.Error(w, "Error opening thumbnail", http.StatusInternalServerError)
+		return
+	}
+
+	defer f.Close()
+
+	// The listing adds the file's modification time to the URL, so a
+	// changed image is fetched again
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	http.ServeContent(w, r, filepath.Base(thumbnailPath), info.ModTime(), f)
+}
+
+/*
+thumbnail returns the cached thumbnail of an image, making it first if
+needed. The cache key includes the file's path, size, and modification
+time, so a replaced image gets a new thumbnail.
+*/
+func (c HomeController) thumbnail(cleanPath string, info os.FileInfo) (string, error) {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%d|%d", cleanPath, info.Size(), info.ModTime().UnixNano())))
+	key := hex.EncodeToString(sum[:])
+	thumbnailPath, err := configuration.SystemPath("thumbnails", key[:2], key+".jpg")
+
+	if err != nil {
+		return "", err
+	}
+
+	if _, err = os.Stat(thumbnailPath); err == nil {
+		return thumbnailPath, nil
+	}
+
+	// Write to a temporary file and rename it into place, so a request
+	// racing this one never serves a half written thumbnail
+	temp, err := os.CreateTemp(filepath.Dir(thumbnailPath), "thumbnail-*")
+
+	if err != nil {
+		return "", err
+	}
+
+	err = preview.RenderThumbnail(cleanPath, temp)
+
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = os.Rename(temp.Name(), thumbnailPath)
+	}
+
+	if err != nil {
+		_ = os.Remove(temp.Name())
+		return "", err
+	}
+
+	slog.Info("created thumbnail", "path", cleanPath, "thumbnail", thumbnailPath)
+	return thumbnailPath, nil
+}
@@ -0,0 +1,425 @@
+package home
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adampresley/adamgokit/httphelpers"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/configuration"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/webauth"
+)
+
+const (
+	// partialMaxAge is how long a partial upload may go without a chunk
+	// being written before it is treated as abandoned
+	partialMaxAge = 6 * time.Hour
+
+	// partialPurgeInterval is how often abandoned partial uploads are purged
+	partialPurgeInterval = time.Hour
+)
+
+var (
+	errFileExists = errors.New("file already exists")
+
+	validUploadID = regexp.MustCompile(`^[a-zA-Z0-9-]{8,64}$`)
+)
+
+/*
+POST /uploads?root={root}&path={path}&overwrite={overwrite}
+
+Accepts a multipart form with a single "file" part. path is the file's
+path relative to root, which lets folder uploads recreate their structure.
+When path is blank the part's file name is used. An upload to a taken name
+follows the collision policy, unless overwrite asks to replace the file.
+*/
+func (c HomeController) UploadFile(w http.ResponseWriter, r *http.Request) {
+	var (
+		err         error
+		reader      *multipart.Reader
+		part        *multipart.Part
+		destination string
+		written     int64
+	)
+
+	// Parameters are read from the query string only. Reading form values
+	// would make net/http buffer the whole multipart body first.
+	started := time.Now()
+	query := r.URL.Query()
+	root := strings.TrimSpace(query.Get("root"))
+	relativePath := strings.TrimSpace(query.Get("path"))
+	overwrite := query.Get("overwrite") == "true"
+
+	defer func() {
+		c.audit(r, "upload", filepath.Join(root, relativePath), "", written, started, err)
+	}()
+
+	if reader, err = r.MultipartReader(); err != nil {
+		slog.Error("error reading multipart upload", "error", err)
+		http.Error(w, "Invalid upload request", http.StatusBadRequest)
+		return
+	}
+
+	for {
+		if part, err = reader.NextPart(); err != nil {
+			slog.Error("no file in multipart upload", "error", err)
+			http.Error(w, "No file provided", http.StatusBadRequest)
+			return
+		}
+
+		if part.FormName() == "file" {
+			break
+		}
+	}
+
+	defer part.Close()
+
+	if relativePath == "" {
+		relativePath = part.FileName()
+	}
+
+	if destination, err = c.uploadDestination(r, root, relativePath, overwrite); err != nil {
+		c.uploadError(w, err, root, relativePath)
+		return
+	}
+
+	partialPath, err := partialUploadPath(r, fmt.Sprintf("%d", time.Now().UnixNano()))
+
+	if err != nil {
+		slog.Error("error creating partial upload path", "error", err)
+		http.Error(w, "Error saving upload", http.StatusInternalServerError)
+		return
+	}
+
+	if written, err = writeNewFile(partialPath, part); err != nil {
+		_ = os.Remove(partialPath)
+		slog.Error("error writing upload", "error", err, "path", partialPath)
+		http.Error(w, "Error saving upload", http.StatusInternalServerError)
+		return
+	}
+
+	savedPath, err := c.completeUpload(partialPath, destination, overwrite)
+
+	if err != nil {
+		_ = os.Remove(partialPath)
+		slog.Error("error completing upload", "error", err, "destination", destination)
+		http.Error(w, "Error saving upload", http.StatusInternalServerError)
+		return
+	}
+
+	c.hooks.Uploaded(savedPath, webauth.ViewerFromRequest(r).Name)
+	message := fmt.Sprintf("Uploaded %s", relativePath)
+
+	if savedPath != destination {
+		relativePath = filepath.Join(filepath.Dir(relativePath), filepath.Base(savedPath))
+		message += fmt.Sprintf(" as %s", relativePath)
+	}
+
+	slog.Info("file uploaded", "path", savedPath, "size", written)
+	httphelpers.TextOK(w, message)
+}
+
+/*
+POST /uploads/chunk?root={root}&path={path}&uploadid={uploadid}&offset={offset}&total={total}&overwrite={overwrite}
+
+Accepts one chunk of a large file as the raw request body. Chunks are
+written into a partial file in the system folder at the given offset. Once
+the partial file reaches the total size it is moved into place. Sending a
+large file in chunks keeps each request well under the server timeouts.
+*/
+func (c HomeController) UploadChunk(w http.ResponseWriter, r *http.Request) {
+	var (
+		err         error
+		destination string
+		partialPath string
+		file        *os.File
+		info        os.FileInfo
+		written     int64
+		completed   bool
+	)
+
+	started := time.Now()
+	query := r.URL.Query()
+	root := strings.TrimSpace(query.Get("root"))
+	relativePath := strings.TrimSpace(query.Get("path"))
+	uploadID := query.Get("uploadid")
+	overwrite := query.Get("overwrite") == "true"
+	offset, offsetErr := strconv.ParseInt(query.Get("offset"), 10, 64)
+	total, totalErr := strconv.ParseInt(query.Get("total"), 10, 64)
+
+	// Chunks that fail and the completed upload are audited. Chunks that
+	// are only written to the partial file aren't.
+	defer func() {
+		if err != nil || completed {
+			c.audit(r, "upload", filepath.Join(root, relativePath), "", written, started, err)
+		}
+	}()
+
+	if !validUploadID.MatchString(uploadID) || offsetErr != nil || totalErr != nil || offset < 0 || total < 0 || relativePath == "" {
+		err = fmt.Errorf("invalid chunk request")
+		http.Error(w, "Invalid chunk request", http.StatusBadRequest)
+		return
+	}
+
+	if destination, err = c.uploadDestination(r, root, relativePath, overwrite); err != nil {
+		c.uploadError(w, err, root, relativePath)
+		return
+	}
+
+	if partialPath, err = partialUploadPath(r, uploadID); err != nil {
+		slog.Error("error creating partial upload path", "error", err)
+		http.Error(w, "Error saving upload", http.StatusInternalServerError)
+		return
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE
+
+	if offset == 0 {
+		flags |= os.O_TRUNC
+	}
+
+	if file, err = os.OpenFile(partialPath, flags, 0644); err != nil {
+		slog.Error("error opening partial upload", "error", err, "path", partialPath)
+		http.Error(w, "Error saving upload", http.StatusInternalServerError)
+		return
+	}
+
+	if _, err = file.Seek(offset, io.SeekStart); err == nil {
+		written, err = io.Copy(file, r.Body)
+	}
+
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		slog.Error("error writing upload chunk", "error", err, "path", partialPath, "offset", offset)
+		http.Error(w, "Error saving upload", http.StatusInternalServerError)
+		return
+	}
+
+	if info, err = os.Stat(partialPath); err != nil {
+		slog.Error("error reading partial upload", "error", err, "path", partialPath)
+		http.Error(w, "Error saving upload", http.StatusInternalServerError)
+		return
+	}
+
+	if info.Size() < total {
+		httphelpers.TextOK(w, fmt.Sprintf("%d", info.Size()))
+		return
+	}
+
+	completed = true
+	written = info.Size()
+	savedPath, err := c.completeUpload(partialPath, destination, overwrite)
+
+	if err == nil {
+		relativePath = filepath.Join(filepath.Dir(relativePath), filepath.Base(savedPath))
+	}
+
+	if err != nil {
+		_ = os.Remove(partialPath)
+		slog.Error("error completing chunked upload", "error", err, "destination", destination)
+		http.Error(w, "Error saving upload", http.StatusInternalServerError)
+		return
+	}
+
+	c.hooks.Uploaded(savedPath, webauth.ViewerFromRequest(r).Name)
+	slog.Info("file uploaded in chunks", "path", savedPath, "size", info.Size())
+	httphelpers.TextOK(w, fmt.Sprintf("%d", info.Size()))
+}
+
+/*
+uploadDestination returns the sanitized destination for an upload. Unless
+overwrite is true or the collision policy renames uploads, an existing
+file is reported with errFileExists.
+*/
+func (c HomeController) uploadDestination(r *http.Request, root, relativePath string, overwrite bool) (string, error) {
+	if relativePath == "" {
+		return "", fmt.Errorf("no file path provided")
+	}
+
+	destination, err := webauth.SanitizePath(r, c.config, filepath.Join(root, relativePath))
+
+	if err != nil {
+		return "", err
+	}
+
+	info, err := os.Stat(destination)
+
+	if err == nil {
+		if info.IsDir() {
+			return "", fmt.Errorf("%s is a directory", relativePath)
+		}
+
+		if !overwrite && !c.versions.Renames() {
+			return "", errFileExists
+		}
+	}
+
+	return destination, nil
+}
+
+/*
+completeUpload moves a fully received file from the system folder into its
+destination, creating any missing directories, and returns where it was
+saved. Replacing a file keeps the old copy when the collision policy is
+"version". Otherwise the policy picks the name when the destination is
+taken.
+*/
+func (c HomeController) completeUpload(partialPath, destination string, overwrite bool) (string, error) {
+	var (
+		err       error
+		savedPath = destination
+	)
+
+	if err = os.MkdirAll(filepath.Dir(destination), 0755); err != nil {
+		return "", err
+	}
+
+	if overwrite {
+		err = c.versions.SaveVersion(destination)
+	} else {
+		savedPath, err = c.versions.Prepare(destination)
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return savedPath, os.Rename(partialPath, savedPath)
+}
+
+func (c HomeController) uploadError(w http.ResponseWriter, err error, root, relativePath string) {
+	if errors.Is(err, errFileExists) {
+		slog.Info("upload refused, file exists", "root", root, "path", relativePath)
+		http.Error(w, fmt.Sprintf("%s already exists", relativePath), http.StatusConflict)
+		return
+	}
+
+	slog.Error("invalid upload path", "error", err, "root", root, "path", relativePath)
+	http.Error(w, "Invalid upload path", http.StatusBadRequest)
+}
+
+/*
+partialUploadPath returns where an upload is received before it is moved
+into place. Each user has their own folder of partial uploads, so one
+user can't add chunks to another's upload by guessing its ID.
+*/
+func partialUploadPath(r *http.Request, uploadID string) (string, error) {
+	user := "user-" + hex.EncodeToString([]byte(webauth.ViewerFromRequest(r).Name))
+	return configuration.SystemPath("partial", user, uploadID)
+}
+
+/*
+PurgePartialUploads removes partial web uploads that haven't been written
+to since before, which were abandoned by a browser that went away
+mid-upload, and the folders of users left with none.
+*/
+func PurgePartialUploads(before time.Time) (int, error) {
+	folder := configuration.UploadFullPath(path.Join(configuration.SystemFolderName, "partial"))
+	users, err := os.ReadDir(folder)
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+
+	for _, user := range users {
+		if !user.IsDir() {
+			continue
+		}
+
+		userFolder := filepath.Join(folder, user.Name())
+		entries, err := os.ReadDir(userFolder)
+
+		if err != nil {
+			return purged, err
+		}
+
+		kept := 0
+
+		for _, entry := range entries {
+			info, err := entry.Info()
+
+			if err != nil || !info.Mode().IsRegular() || !info.ModTime().Before(before) {
+				kept++
+				continue
+			}
+
+			if err = os.Remove(filepath.Join(userFolder, entry.Name())); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return purged, err
+			}
+
+			purged++
+		}
+
+		if kept == 0 {
+			// An upload may have started since, which keeps the folder
+			_ = os.Remove(userFolder)
+		}
+	}
+
+	return purged, nil
+}
+
+/*
+StartPartialPurger purges partial uploads abandoned for longer than
+partialMaxAge every hour, until ctx is cancelled.
+*/
+func StartPartialPurger(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(partialPurgeInterval)
+		defer ticker.Stop()
+
+		for {
+			purged, err := PurgePartialUploads(time.Now().Add(-partialMaxAge))
+
+			if err != nil {
+				slog.Error("error purging partial uploads", "error", err)
+			} else if purged > 0 {
+				slog.Info("purged abandoned partial uploads", "count", purged, "maxAge", partialMaxAge)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func writeNewFile(path string, src io.Reader) (int64, error) {
+	f, err := os.Create(path)
+
+	if err != nil {
+		return 0, err
+	}
+
+	written, err := io.Copy(f, src)
+
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	return written, err
+}
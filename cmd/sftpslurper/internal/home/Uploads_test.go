@@ -0,0 +1,62 @@
+package home
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPurgePartialUploads(t *testing.T) {
+	wd, err := os.Getwd()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		_ = os.Chdir(wd)
+	})
+
+	old := time.Now().Add(-7 * time.Hour)
+	files := []struct {
+		path    string
+		modTime time.Time
+	}{
+		{path: "uploads/.slurper/partial/user-616c696365/abandoned-upload", modTime: old},
+		{path: "uploads/.slurper/partial/user-626f62/abandoned-upload", modTime: old},
+		{path: "uploads/.slurper/partial/user-626f62/current-upload", modTime: time.Now()},
+	}
+
+	for _, file := range files {
+		if err = os.MkdirAll(filepath.Dir(file.path), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err = os.WriteFile(file.path, []byte("chunk"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if err = os.Chtimes(file.path, file.modTime, file.modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	purged, err := PurgePartialUploads(time.Now().Add(-partialMaxAge))
+
+	if err != nil || purged != 2 {
+		t.Fatalf("PurgePartialUploads = %d, %v, want 2", purged, err)
+	}
+
+	if _, err = os.Stat(files[2].path); err != nil {
+		t.Errorf("current upload was purged: %v", err)
+	}
+
+	if _, err = os.Stat(filepath.Dir(files[0].path)); !os.IsNotExist(err) {
+		t.Errorf("empty user folder was kept: %v", err)
+	}
+}
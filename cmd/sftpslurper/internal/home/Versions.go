@@ -0,0 +1,95 @@
+package home
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/adampresley/adamgokit/httphelpers"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/versioning"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/webauth"
+)
+
+/*
+GET /versions?path={path}&id={id}
+
+Downloads an old copy of a file. The download is named after the file
+with the time it was replaced, such as report.2025-01-02-150405.csv.
+*/
+func (c HomeController) DownloadVersion(w http.ResponseWriter, r *http.Request) {
+	var (
+		err      error
+		fileSize int64
+	)
+
+	started := time.Now()
+	filePath := strings.TrimSpace(httphelpers.GetFromRequest[string](r, "path"))
+	id := httphelpers.GetFromRequest[string](r, "id")
+
+	defer func() {
+		c.audit(r, "download-version", filePath, "", fileSize, started, err)
+	}()
+
+	versionPath, version, err := c.versionPath(r, filePath, id)
+
+	if errors.Is(err, versioning.ErrNotFound) {
+		http.Error(w, "Version not found", http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		slog.Error("invalid version path", "error", err, "path", filePath, "id", id)
+		http.Error(w, "Invalid file path", http.StatusBadRequest)
+		return
+	}
+
+	file, err := os.Open(versionPath)
+
+	if err != nil {
+		slog.Error("error opening version", "error", err, "path", versionPath)
+		http.Error(w, "Error opening file", http.StatusInternalServerError)
+		return
+	}
+
+	defer file.Close()
+
+	ext := filepath.Ext(filePath)
+	fileName := fmt.Sprintf("%s.%s%s", strings.TrimSuffix(filepath.Base(filePath), ext), version.SavedAt.Format("2006-01-02-150405"), ext)
+	contentType := "application/octet-stream"
+
+	if mimeType := mime.TypeByExtension(strings.ToLower(ext)); mimeType != "" {
+		contentType = mimeType
+	}
+
+	w.Header().Set("Content-Disposition", "attachment; filename="+fileName)
+	w.Header().Set("Content-Type", contentType)
+
+	slog.Info("serving file version", "path", filePath, "id", id, "size", version.Size)
+	fileSize = version.Size
+
+	http.ServeContent(w, r, fileName, version.ModTime, file)
+}
+
+/*
+versionPath returns where the old copy of a file with the given id is
+kept, after checking the file's path.
+*/
+func (c HomeController) versionPath(r *http.Request, filePath, id string) (string, versioning.Version, error) {
+	if filePath == "" {
+		return "", versioning.Version{}, fmt.Errorf("no file path provided")
+	}
+
+	cleanPath, err := webauth.SanitizePath(r, c.config, filePath)
+
+	if err != nil {
+		return "", versioning.Version{}, err
+	}
+
+	return c.versions.Path(cleanPath, id)
+}
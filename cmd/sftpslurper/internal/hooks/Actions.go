@@ -0,0 +1,375 @@
+package hooks
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/configuration"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/pgp"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/validation"
+)
+
+const (
+	// defaultTimeout is how long a command may run when its hook doesn't say
+	defaultTimeout = time.Minute
+
+	// maxOutput is how much of a command's output is kept
+	maxOutput = 64 * 1024
+
+	// maxUnzipEntries is how many entries an archive may have to be extracted
+	maxUnzipEntries = 10000
+
+	// maxUnzipSize is how much an archive may extract to, in bytes
+	maxUnzipSize = 4 << 30
+)
+
+/*
+unzip extracts a zip file into the hook's folder, or into a folder named
+after the file beside it. Entries that would land outside that folder are
+refused, and entries whose name is taken are saved under a free name.
+Archives with too many entries or that extract to too much are refused
+before anything is extracted, and extraction stops if the entries turn
+out larger than their headers said.
+*/
+func (r *Runner) unzip(hook configuration.Hook, fullPath string) (string, error) {
+	destination := strings.TrimSuffix(fullPath, filepath.Ext(fullPath))
+
+	if hook.Folder != "" {
+		destination = configuration.UploadFullPath(hook.Folder)
+	}
+
+	folder, err := configuration.RelativeUploadPath(destination)
+
+	if err != nil {
+		return "", err
+	}
+
+	if configuration.IsSystemPath(folder) {
+		return "", fmt.Errorf("can't extract into the system folder")
+	}
+
+	archive, err := zip.OpenReader(fullPath)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer archive.Close()
+
+	if len(archive.File) > maxUnzipEntries {
+		return "", fmt.Errorf("archive has %d entries, more than the %d allowed", len(archive.File), maxUnzipEntries)
+	}
+
+	remaining := int64(maxUnzipSize)
+
+	for _, entry := range archive.File {
+		if entry.UncompressedSize64 > uint64(remaining) {
+			return "", fmt.Errorf("archive extracts to more than the %d bytes allowed", int64(maxUnzipSize))
+		}
+
+		remaining -= int64(entry.UncompressedSize64)
+	}
+
+	extracted := 0
+	remaining = maxUnzipSize
+
+	for _, entry := range archive.File {
+		target := filepath.Join(destination, filepath.FromSlash(entry.Name))
+
+		if !strings.HasPrefix(target, destination+string(filepath.Separator)) {
+			return "", fmt.Errorf("entry %s is outside the archive folder", entry.Name)
+		}
+
+		if entry.FileInfo().IsDir() {
+			if err = os.MkdirAll(target, 0755); err != nil {
+				return "", err
+			}
+
+			continue
+		}
+
+		if !entry.Mode().IsRegular() {
+			continue
+		}
+
+		written, err := r.extractEntry(entry, target, remaining)
+
+		if err != nil {
+			return "", fmt.Errorf("error extracting %s: %w", entry.Name, err)
+		}
+
+		remaining -= written
+
+		extracted++
+	}
+
+	return fmt.Sprintf("Extracted %d files to /%s", extracted, folder), nil
+}
+
+/*
+extractEntry writes an archive entry to target, refusing to write more
+than limit bytes. It returns how many bytes were written.
+*/
+func (r *Runner) extractEntry(entry *zip.File, target string, limit int64) (int64, error) {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return 0, err
+	}
+
+	target, err := r.versions.Prepare(target)
+
+	if err != nil {
+		return 0, err
+	}
+
+	src, err := entry.Open()
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer src.Close()
+
+	dst, err := os.Create(target)
+
+	if err != nil {
+		return 0, err
+	}
+
+	written, err := io.Copy(dst, io.LimitReader(src, limit+1))
+
+	if err == nil && written > limit {
+		err = fmt.Errorf("archive extracts to more than the %d bytes allowed", int64(maxUnzipSize))
+	}
+
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		_ = os.Remove(target)
+	}
+
+	return written, err
+}
+
+/*
+decrypt decrypts an OpenPGP file into the hook's folder, or beside it,
+named without its extension. A file of the same name there is handled by
+the collision policy. The decrypted file is removed when the message is
+damaged or its signature is invalid. It returns the decrypted file's path.
+*/
+func (r *Runner) decrypt(hook configuration.Hook, fullPath string) (string, string, int, error) {
+	folder := filepath.Dir(fullPath)
+
+	if hook.Folder != "" {
+		folder = configuration.UploadFullPath(hook.Folder)
+	}
+
+	relativeFolder, err := configuration.RelativeUploadPath(folder)
+
+	if err == nil && configuration.IsSystemPath(relativeFolder) {
+		return fullPath, "", 0, fmt.Errorf("can't decrypt into the system folder")
+	}
+
+	message, err := r.keyring.Open(fullPath)
+
+	if err != nil {
+		return fullPath, "", 0, err
+	}
+
+	defer message.Close()
+
+	if err = os.MkdirAll(folder, 0755); err != nil {
+		return fullPath, "", 0, err
+	}
+
+	name := filepath.Base(fullPath)
+	target, err := r.versions.Prepare(filepath.Join(folder, strings.TrimSuffix(name, filepath.Ext(name))))
+
+	if err != nil {
+		return fullPath, "", 0, err
+	}
+
+	dst, err := os.Create(target)
+
+	if err != nil {
+		return fullPath, "", 0, err
+	}
+
+	_, err = io.Copy(dst, message)
+
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == nil && message.Signature.Status == pgp.SignatureInvalid {
+		err = fmt.Errorf("invalid signature: %s", message.Signature.Error)
+	}
+
+	if err != nil {
+		_ = os.Remove(target)
+		return fullPath, "", 0, err
+	}
+
+	relativePath, _ := configuration.RelativeUploadPath(target)
+	return target, fmt.Sprintf("Decrypted to /%s, signature %s", relativePath, message.Signature.Status), 0, nil
+}
+
+/*
+validate checks a file against the validation rules that match it, and
+fails when any check does.
+*/
+func (r *Runner) validate(fullPath, user string) (string, error) {
+	if r.validator == nil {
+		return "", fmt.Errorf("validation isn't set up")
+	}
+
+	report := r.validator.Uploaded(fullPath, user)
+
+	if report == nil {
+		return "No validation rules match", nil
+	}
+
+	sb := strings.Builder{}
+	failed := 0
+
+	for _, result := range report.Results {
+		if len(result.Errors) == 0 {
+			continue
+		}
+
+		failed++
+		fmt.Fprintf(&sb, "%s, %s:\n", result.Rule, result.Check)
+
+		for _, message := range result.Errors {
+			fmt.Fprintf(&sb, "  %s\n", message)
+		}
+	}
+
+	if report.Status == validation.StatusFailed {
+		return sb.String(), fmt.Errorf("failed %d of %d checks", failed, len(report.Results))
+	}
+
+	return fmt.Sprintf("Passed %d checks", len(report.Results)), nil
+}
+
+/*
+move moves a file into the hook's folder, along with its validation
+report. A file of the same name there is handled by the collision policy.
+*/
+func (r *Runner) move(hook configuration.Hook, fullPath string) (string, string, int, error) {
+	if configuration.IsSystemPath(hook.Folder) {
+		return fullPath, "", 0, fmt.Errorf("can't move into the system folder")
+	}
+
+	folder := configuration.UploadFullPath(hook.Folder)
+
+	if err := os.MkdirAll(folder, 0755); err != nil {
+		return fullPath, "", 0, err
+	}
+
+	target, err := r.versions.Prepare(filepath.Join(folder, filepath.Base(fullPath)))
+
+	if err != nil {
+		return fullPath, "", 0, err
+	}
+
+	if err = os.Rename(fullPath, target); err != nil {
+		return fullPath, "", 0, err
+	}
+
+	if r.validator != nil {
+		r.validator.Moved(fullPath, target)
+	}
+
+	relativePath, _ := configuration.RelativeUploadPath(target)
+	return target, fmt.Sprintf("Moved to /%s", relativePath), 0, nil
+}
+
+/*
+runCommand runs a hook's command on a file, from the file's folder. The
+file is also passed in the SLURPER_FILE, SLURPER_PATH, and SLURPER_USER
+environment variables. It returns the combined output and exit code.
+*/
+func runCommand(hook configuration.Hook, fullPath, user string) (string, int, error) {
+	relativePath, _ := configuration.RelativeUploadPath(fullPath)
+	replacer := strings.NewReplacer("{file}", fullPath, "{path}", "/"+relativePath)
+	args := make([]string, len(hook.Command))
+
+	for index, arg := range hook.Command {
+		args[index] = replacer.Replace(arg)
+	}
+
+	timeout := defaultTimeout
+
+	if hook.TimeoutSeconds > 0 {
+		timeout = time.Duration(hook.TimeoutSeconds) * time.Second
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	output := &limitedBuffer{limit: maxOutput}
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Dir = filepath.Dir(fullPath)
+	cmd.Stdout = output
+	cmd.Stderr = output
+	cmd.Env = append(os.Environ(),
+		"SLURPER_FILE="+fullPath,
+		"SLURPER_PATH=/"+relativePath,
+		"SLURPER_USER="+user,
+	)
+
+	err := cmd.Run()
+	exitCode := 0
+
+	var exitErr *exec.ExitError
+
+	if errors.As(err, &exitErr) {
+		exitCode = exitErr.ExitCode()
+	}
+
+	if ctx.Err() != nil {
+		err = fmt.Errorf("stopped after %s", timeout)
+	}
+
+	return output.String(), exitCode, err
+}
+
+/*
+limitedBuffer keeps the first limit bytes written to it, and notes when
+more was thrown away.
+*/
+type limitedBuffer struct {
+	buffer    bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.buffer.Len(); room < len(p) {
+		b.buffer.Write(p[:max(room, 0)])
+		b.truncated = true
+		return len(p), nil
+	}
+
+	return b.buffer.Write(p)
+}
+
+func (b *limitedBuffer) String() string {
+	if b.truncated {
+		return b.buffer.String() + "\n[output truncated]"
+	}
+
+	return b.buffer.String()
+}
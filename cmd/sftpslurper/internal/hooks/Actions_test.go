@@ -0,0 +1,164 @@
+package hooks
+
+import (
+	"archive/zip"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/configuration"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/versioning"
+)
+
+func TestUnzip(t *testing.T) {
+	wd, err := os.Getwd()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		_ = os.Chdir(wd)
+	})
+
+	store, err := versioning.NewStore(versioning.StoreConfig{Policy: versioning.PolicyCounter})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runner := &Runner{config: &configuration.Config{}, versions: store}
+
+	tests := []struct {
+		name    string
+		write   func(w *zip.Writer) error
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "files",
+			write: func(w *zip.Writer) error {
+				return addFiles(w, "june.csv", "reports/july.csv")
+			},
+			want: []string{"june.csv", "reports/july.csv"},
+		},
+		{
+			name: "outside the folder",
+			write: func(w *zip.Writer) error {
+				return addFiles(w, "../escape.csv")
+			},
+			wantErr: "outside the archive folder",
+		},
+		{
+			name: "too many entries",
+			write: func(w *zip.Writer) error {
+				names := make([]string, maxUnzipEntries+1)
+
+				for index := range names {
+					names[index] = fmt.Sprintf("file-%d.txt", index)
+				}
+
+				return addFiles(w, names...)
+			},
+			wantErr: "entries",
+		},
+		{
+			name: "too large",
+			write: func(w *zip.Writer) error {
+				entry, err := w.CreateRaw(&zip.FileHeader{
+					Name:               "huge.bin",
+					Method:             zip.Store,
+					CompressedSize64:   1,
+					UncompressedSize64: maxUnzipSize + 1,
+				})
+
+				if err != nil {
+					return err
+				}
+
+				_, err = entry.Write([]byte{0})
+				return err
+			},
+			wantErr: "bytes allowed",
+		},
+	}
+
+	for index, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fullPath, _ := filepath.Abs(filepath.Join(configuration.UploadFolder, fmt.Sprintf("archive-%d.zip", index)))
+
+			if err := writeZip(fullPath, tt.write); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := runner.unzip(configuration.Hook{}, fullPath)
+			folder := strings.TrimSuffix(fullPath, ".zip")
+
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("unzip error = %v, want one about %q", err, tt.wantErr)
+				}
+
+				if entries, _ := os.ReadDir(folder); len(entries) != 0 {
+					t.Errorf("%d entries were extracted from a refused archive", len(entries))
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unzip error = %v", err)
+			}
+
+			for _, name := range tt.want {
+				if _, err := os.Stat(filepath.Join(folder, filepath.FromSlash(name))); err != nil {
+					t.Errorf("%s wasn't extracted: %v", name, err)
+				}
+			}
+		})
+	}
+}
+
+func writeZip(fullPath string, write func(w *zip.Writer) error) error {
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.Create(fullPath)
+
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	w := zip.NewWriter(f)
+
+	if err = write(w); err != nil {
+		return err
+	}
+
+	return w.Close()
+}
+
+func addFiles(w *zip.Writer, names ...string) error {
+	for _, name := range names {
+		entry, err := w.Create(name)
+
+		if err != nil {
+			return err
+		}
+
+		if _, err = entry.Write([]byte("id,total\n")); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,354 @@
+package hooks
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/audit"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/configuration"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/pgp"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/validation"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/versioning"
+)
+
+const (
+	// statusFolder is where runs are kept in the system folder
+	statusFolder = "hooks"
+
+	// workers is how many uploads are checked and hooked at once
+	workers = 4
+
+	// queueSize is how many uploads may wait for a worker before the
+	// uploads that complete next wait for room in the queue
+	queueSize = 1000
+)
+
+// Run statuses
+const (
+	StatusRunning = "running"
+	StatusOK      = "ok"
+	StatusFailed  = "failed"
+)
+
+type RunnerConfig struct {
+	Config   *configuration.Config
+	AuditLog *audit.Logger
+
+	// Versions picks a free name when a hook moves or extracts a file
+	// onto one that is taken
+	Versions *versioning.Store
+
+	// Validator checks each upload before its hooks run, and for the
+	// validate action
+	Validator *validation.Validator
+
+	// Keyring decrypts files for the decrypt action
+	Keyring *pgp.Keyring
+}
+
+/*
+Run is the hooks run on one upload. Path is where the upload was written,
+relative to the upload folder. A hook that moves the file changes where
+it ends up, so each result has the path the file had after it.
+*/
+type Run struct {
+	Path     string    `json:"path"`
+	User     string    `json:"user"`
+	Status   string    `json:"status"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+	Results  []Result  `json:"results"`
+}
+
+/*
+Result is the outcome of one hook. ExitCode is only set by commands, and
+Output holds what the hook printed or did.
+*/
+type Result struct {
+	Hook       string `json:"hook"`
+	Action     string `json:"action"`
+	Path       string `json:"path"`
+	ExitCode   int    `json:"exitCode"`
+	Output     string `json:"output"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"durationMs"`
+}
+
+/*
+Runner runs the configured hooks on files once their upload completes.
+Each upload is checked against the validation rules first, so the checks
+see the file as it was written, then handed to the hooks. When a validate
+hook matches the upload the check is left to it instead, so the file is
+checked once, at that point in the hooks. Both run in the background on a
+few workers, so a slow check or hook doesn't hold up the client and a
+burst of uploads doesn't start a process for each. The last run for each
+file is kept in the system folder at hooks/{path}.json, so it can be shown
+next to the file.
+*/
+type Runner struct {
+	config    *configuration.Config
+	auditLog  *audit.Logger
+	versions  *versioning.Store
+	validator *validation.Validator
+	keyring   *pgp.Keyring
+	queue     chan job
+}
+
+// job is an upload waiting for a worker
+type job struct {
+	fullPath string
+	run      Run
+	hooks    []configuration.Hook
+}
+
+func NewRunner(config RunnerConfig) *Runner {
+	result := &Runner{
+		config:    config.Config,
+		auditLog:  config.AuditLog,
+		versions:  config.Versions,
+		validator: config.Validator,
+		keyring:   config.Keyring,
+		queue:     make(chan job, queueSize),
+	}
+
+	for index := 0; index < workers; index++ {
+		go result.work()
+	}
+
+	return result
+}
+
+/*
+Uploaded queues a file whose upload just completed to be checked, and to
+run the hooks that match it.
+*/
+func (r *Runner) Uploaded(fullPath, user string) {
+	relativePath, err := configuration.RelativeUploadPath(fullPath)
+
+	if err != nil {
+		slog.Error("upload is outside the upload folder", "error", err, "path", fullPath)
+		return
+	}
+
+	hooks := r.matching(relativePath)
+
+	run := Run{
+		Path:    relativePath,
+		User:    user,
+		Status:  StatusRunning,
+		Started: time.Now(),
+		Results: []Result{},
+	}
+
+	if len(hooks) > 0 {
+		if err = configuration.SaveStatus(statusFolder, relativePath, run); err != nil {
+			slog.Error("error saving hook run", "error", err, "path", relativePath)
+		}
+	}
+
+	r.queue <- job{fullPath: fullPath, run: run, hooks: hooks}
+}
+
+/*
+Status returns the last hooks run on the file at fullPath, or nil if no
+hooks have run on it.
+*/
+func (r *Runner) Status(fullPath string) (*Run, error) {
+	relativePath, err := configuration.RelativeUploadPath(fullPath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Run{}
+	found, err := configuration.LoadStatus(statusFolder, relativePath, result)
+
+	if !found {
+		return nil, err
+	}
+
+	return result, err
+}
+
+/*
+Moved moves the last hooks run and validation report of a file that was
+moved, or those of every file in a moved folder, so they stay next to the
+files.
+*/
+func (r *Runner) Moved(fromPath, toPath string) {
+	from, err := configuration.RelativeUploadPath(fromPath)
+
+	if err != nil {
+		return
+	}
+
+	to, err := configuration.RelativeUploadPath(toPath)
+
+	if err != nil {
+		return
+	}
+
+	if err = configuration.MoveStatus(statusFolder, from, to); err != nil {
+		slog.Error("error moving hook run", "error", err, "path", from, "target", to)
+	}
+
+	if r.validator != nil {
+		r.validator.Moved(fromPath, toPath)
+	}
+}
+
+/*
+Removed removes the last hooks run and validation report of a file that
+was deleted.
+*/
+func (r *Runner) Removed(fullPath string) {
+	relativePath, err := configuration.RelativeUploadPath(fullPath)
+
+	if err != nil {
+		return
+	}
+
+	if err = configuration.RemoveStatus(statusFolder, relativePath); err != nil {
+		slog.Error("error removing hook run", "error", err, "path", relativePath)
+	}
+
+	if r.validator != nil {
+		r.validator.Removed(fullPath)
+	}
+}
+
+// work runs queued uploads until the process ends
+func (r *Runner) work() {
+	for next := range r.queue {
+		r.run(next.fullPath, next.run, next.hooks)
+	}
+}
+
+/*
+run checks an upload, then runs its hooks in order, stopping at the first
+that fails. The check is skipped when a validate hook will do it.
+*/
+func (r *Runner) run(fullPath string, run Run, hooks []configuration.Hook) {
+	validates := slices.ContainsFunc(hooks, func(hook configuration.Hook) bool {
+		return hook.Action == configuration.HookActionValidate
+	})
+
+	if r.validator != nil && !validates {
+		r.validator.Uploaded(fullPath, run.User)
+	}
+
+	if len(hooks) == 0 {
+		return
+	}
+
+	currentPath := fullPath
+	run.Status = StatusOK
+
+	for _, hook := range hooks {
+		started := time.Now()
+		fromPath, _ := configuration.RelativeUploadPath(currentPath)
+		nextPath, output, exitCode, err := r.runHook(hook, currentPath, run.User)
+
+		result := Result{
+			Hook:       hook.Name,
+			Action:     hook.Action,
+			ExitCode:   exitCode,
+			Output:     output,
+			DurationMs: time.Since(started).Milliseconds(),
+		}
+
+		record := audit.Record{
+			Time:      started,
+			User:      run.User,
+			Protocol:  audit.ProtocolSystem,
+			Operation: "hook-" + hook.Action,
+			Path:      "/" + fromPath,
+		}
+
+		currentPath = nextPath
+		result.Path, _ = configuration.RelativeUploadPath(currentPath)
+
+		if result.Path != fromPath {
+			record.Target = "/" + result.Path
+		}
+
+		record.Finish(started, err)
+		r.auditLog.Log(record)
+
+		if err != nil {
+			result.Error = err.Error()
+			run.Status = StatusFailed
+		}
+
+		run.Results = append(run.Results, result)
+
+		if err != nil {
+			slog.Error("upload hook failed", "error", err, "hook", hook.Name, "path", record.Path)
+			break
+		}
+
+		slog.Info("upload hook ran", "hook", hook.Name, "path", record.Path)
+	}
+
+	run.Finished = time.Now()
+	finalPath, _ := configuration.RelativeUploadPath(currentPath)
+
+	// A moved upload takes its run along, and one that was decrypted
+	// shows the run on both files
+	if finalPath != run.Path {
+		if _, err := os.Stat(fullPath); err == nil {
+			_ = configuration.SaveStatus(statusFolder, run.Path, run)
+		} else {
+			_ = configuration.RemoveStatus(statusFolder, run.Path)
+		}
+	}
+
+	if err := configuration.SaveStatus(statusFolder, finalPath, run); err != nil {
+		slog.Error("error saving hook run", "error", err, "path", finalPath)
+	}
+}
+
+/*
+runHook runs one hook on the file at fullPath. It returns where the file
+is afterwards, what the hook printed or did, and a command's exit code.
+*/
+func (r *Runner) runHook(hook configuration.Hook, fullPath, user string) (string, string, int, error) {
+	switch hook.Action {
+	case configuration.HookActionUnzip:
+		output, err := r.unzip(hook, fullPath)
+		return fullPath, output, 0, err
+
+	case configuration.HookActionDecrypt:
+		return r.decrypt(hook, fullPath)
+
+	case configuration.HookActionValidate:
+		output, err := r.validate(fullPath, user)
+		return fullPath, output, 0, err
+
+	case configuration.HookActionMove:
+		return r.move(hook, fullPath)
+
+	case configuration.HookActionCommand:
+		output, exitCode, err := runCommand(hook, fullPath, user)
+		return fullPath, output, exitCode, err
+
+	default:
+		return fullPath, "", 0, fmt.Errorf("unknown hook action '%s'", hook.Action)
+	}
+}
+
+// matching returns the hooks whose path matches an upload
+func (r *Runner) matching(relativePath string) []configuration.Hook {
+	result := []configuration.Hook{}
+
+	for _, hook := range r.config.Hooks {
+		if hook.Path == "" || configuration.MatchGlob(hook.Path, relativePath) {
+			result = append(result, hook)
+		}
+	}
+
+	return result
+}
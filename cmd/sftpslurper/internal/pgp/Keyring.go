@@ -0,0 +1,451 @@
+package pgp
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/configuration"
+)
+
+const (
+	// copyMaxIdle is how long an encrypted copy is kept after it was last used
+	copyMaxIdle = time.Hour
+)
+
+var (
+	// extensions are the file extensions treated as OpenPGP data
+	extensions = map[string]bool{
+		".pgp": true,
+		".gpg": true,
+		".asc": true,
+	}
+)
+
+type KeyringConfig struct {
+	// FileName is a keyring of public and private keys, armored or
+	// binary. An armored file may hold several key blocks, such as the
+	// output of gpg --export and gpg --export-secret-keys one after the
+	// other. When blank the keyring is empty.
+	FileName string
+
+	// Passphrase unlocks private keys protected by one
+	Passphrase string
+
+	// EncryptTo picks the key files read over SFTP are encrypted to, by
+	// key ID, fingerprint, or part of a user ID such as an email address.
+	// When blank files are read as they are.
+	EncryptTo string
+}
+
+/*
+Keyring holds the keys used to decrypt uploaded files and verify their
+signatures, and the key files are encrypted to when read over SFTP.
+*/
+type Keyring struct {
+	entities  openpgp.EntityList
+	recipient *openpgp.Entity
+
+	mutex  sync.Mutex
+	copies map[string]*encryptedCopy
+	swept  time.Time
+}
+
+/*
+encryptedCopy is a file encrypted to the recipient, made from the version
+of the source file with the given size and modification time.
+*/
+type encryptedCopy struct {
+	path          string
+	size          int64
+	sourceSize    int64
+	sourceModTime time.Time
+	used          time.Time
+}
+
+func NewKeyring(config KeyringConfig) (*Keyring, error) {
+	var (
+		err error
+	)
+
+	result := &Keyring{
+		entities: openpgp.EntityList{},
+		copies:   map[string]*encryptedCopy{},
+	}
+
+	// Encrypted copies left behind by a server that didn't shut down
+	// cleanly are never read again
+	if err = os.RemoveAll(readsFolder()); err != nil {
+		slog.Error("error removing leftover encrypted copies", "error", err)
+	}
+
+	if config.FileName == "" {
+		if config.EncryptTo != "" {
+			return nil, fmt.Errorf("a keyring is needed to encrypt files to '%s'", config.EncryptTo)
+		}
+
+		return result, nil
+	}
+
+	if result.entities, err = readKeyring(config.FileName); err != nil {
+		return nil, fmt.Errorf("error reading keyring %s: %w", config.FileName, err)
+	}
+
+	for _, entity := range result.entities {
+		if err = unlock(entity, config.Passphrase); err != nil {
+			return nil, err
+		}
+	}
+
+	if config.EncryptTo != "" {
+		if result.recipient = result.find(config.EncryptTo); result.recipient == nil {
+			return nil, fmt.Errorf("no key in the keyring matches '%s'", config.EncryptTo)
+		}
+
+		if _, ok := result.recipient.EncryptionKey(time.Now()); !ok {
+			return nil, fmt.Errorf("key %s can't be used for encryption", KeyID(result.recipient.PrimaryKey.KeyId))
+		}
+	}
+
+	return result, nil
+}
+
+// IsPgpFile returns true if a file name has an OpenPGP extension.
+func IsPgpFile(name string) bool {
+	return extensions[strings.ToLower(filepath.Ext(name))]
+}
+
+// KeyID formats a key ID the way gpg shows long key IDs.
+func KeyID(id uint64) string {
+	return fmt.Sprintf("%016X", id)
+}
+
+// Count returns the number of keys in the keyring.
+func (k *Keyring) Count() int {
+	return len(k.entities)
+}
+
+// Recipient returns the user ID of the key files read over SFTP are
+// encrypted to, or blank if they aren't encrypted.
+func (k *Keyring) Recipient() string {
+	if k.recipient == nil {
+		return ""
+	}
+
+	return userID(k.recipient)
+}
+
+/*
+HasKey returns true if the keyring has the private key with the given ID,
+so it can decrypt files encrypted to it.
+*/
+func (k *Keyring) HasKey(id uint64) bool {
+	for _, key := range k.entities.KeysById(id) {
+		if key.PrivateKey != nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+EncryptsReads returns true if files read over SFTP are encrypted. Files
+that are already OpenPGP data are left alone.
+*/
+func (k *Keyring) EncryptsReads(name string) bool {
+	return k.recipient != nil && !IsPgpFile(name)
+}
+
+/*
+EncryptedSize returns the size of a file once encrypted to the recipient,
+which is what OpenEncrypted serves. The encrypted copy is made if needed.
+*/
+func (k *Keyring) EncryptedSize(fullPath string) (int64, error) {
+	encrypted, err := k.encryptedCopy(fullPath)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return encrypted.size, nil
+}
+
+/*
+OpenEncrypted opens a copy of a file encrypted to the recipient. The copy
+is kept in the system folder while the file is unchanged, so every stat
+and read of the file sees the same encrypted bytes. Copies unused for an
+hour are removed. The caller closes the file.
+*/
+func (k *Keyring) OpenEncrypted(fullPath string) (*os.File, error) {
+	encrypted, err := k.encryptedCopy(fullPath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Copies are only removed under the lock, so this one is still there
+	// unless the file changed in the meantime
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	return os.Open(encrypted.path)
+}
+
+/*
+encryptedCopy returns the encrypted copy of the current version of a
+file, making it when there is none yet or the file has changed.
+*/
+func (k *Keyring) encryptedCopy(fullPath string) (*encryptedCopy, error) {
+	info, err := os.Stat(fullPath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if cached := k.cachedCopy(fullPath, info); cached != nil {
+		return cached, nil
+	}
+
+	file, err := k.encryptFile(fullPath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	copyInfo, err := file.Stat()
+	file.Close()
+
+	if err != nil {
+		os.Remove(file.Name())
+		return nil, err
+	}
+
+	result := &encryptedCopy{
+		path:          file.Name(),
+		size:          copyInfo.Size(),
+		sourceSize:    info.Size(),
+		sourceModTime: info.ModTime(),
+		used:          time.Now(),
+	}
+
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	// Another request may have made a copy of the same version meanwhile
+	if existing, ok := k.copies[fullPath]; ok {
+		if existing.matches(info) {
+			os.Remove(result.path)
+			return existing, nil
+		}
+
+		os.Remove(existing.path)
+	}
+
+	k.copies[fullPath] = result
+	return result, nil
+}
+
+/*
+cachedCopy returns the copy of a file if it was made from the given
+version, and removes copies that have been idle too long.
+*/
+func (k *Keyring) cachedCopy(fullPath string, info os.FileInfo) *encryptedCopy {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	now := time.Now()
+
+	if now.Sub(k.swept) >= time.Minute {
+		for name, encrypted := range k.copies {
+			if now.Sub(encrypted.used) >= copyMaxIdle {
+				os.Remove(encrypted.path)
+				delete(k.copies, name)
+			}
+		}
+
+		k.swept = now
+	}
+
+	cached, ok := k.copies[fullPath]
+
+	if !ok || !cached.matches(info) {
+		return nil
+	}
+
+	cached.used = now
+	return cached
+}
+
+func (c *encryptedCopy) matches(info os.FileInfo) bool {
+	return c.sourceSize == info.Size() && c.sourceModTime.Equal(info.ModTime())
+}
+
+/*
+encryptFile encrypts a file to the recipient into a temporary file in the
+system folder, and returns it open at the start. The caller closes and
+removes it.
+*/
+func (k *Keyring) encryptFile(fullPath string) (*os.File, error) {
+	src, err := os.Open(fullPath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer src.Close()
+
+	info, err := src.Stat()
+
+	if err != nil {
+		return nil, err
+	}
+
+	folder := readsFolder()
+
+	if err = os.MkdirAll(folder, 0755); err != nil {
+		return nil, err
+	}
+
+	dst, err := os.CreateTemp(folder, "read-*")
+
+	if err != nil {
+		return nil, err
+	}
+
+	fail := func(err error) (*os.File, error) {
+		dst.Close()
+		os.Remove(dst.Name())
+		return nil, err
+	}
+
+	hints := &openpgp.FileHints{
+		FileName: filepath.Base(fullPath),
+		ModTime:  info.ModTime(),
+	}
+
+	plaintext, err := openpgp.Encrypt(dst, []*openpgp.Entity{k.recipient}, nil, hints, nil)
+
+	if err != nil {
+		return fail(err)
+	}
+
+	if _, err = io.Copy(plaintext, src); err != nil {
+		return fail(err)
+	}
+
+	if err = plaintext.Close(); err != nil {
+		return fail(err)
+	}
+
+	if _, err = dst.Seek(0, io.SeekStart); err != nil {
+		return fail(err)
+	}
+
+	return dst, nil
+}
+
+// readsFolder returns where encrypted copies of files read over SFTP are made
+func readsFolder() string {
+	return configuration.UploadFullPath(path.Join(configuration.SystemFolderName, "pgp", "reads"))
+}
+
+// find returns the first key matching a key ID, fingerprint, or user ID
+func (k *Keyring) find(query string) *openpgp.Entity {
+	query = strings.TrimPrefix(strings.ToUpper(strings.ReplaceAll(query, " ", "")), "0X")
+
+	for _, entity := range k.entities {
+		fingerprint := fmt.Sprintf("%X", entity.PrimaryKey.Fingerprint)
+
+		if len(query) >= 8 && strings.HasSuffix(fingerprint, query) {
+			return entity
+		}
+
+		for name := range entity.Identities {
+			if strings.Contains(strings.ToUpper(name), query) {
+				return entity
+			}
+		}
+	}
+
+	return nil
+}
+
+/*
+readKeyring reads a binary keyring, or every armored key block in a text
+file.
+*/
+func readKeyring(fileName string) (openpgp.EntityList, error) {
+	b, err := os.ReadFile(fileName)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.Contains(b, []byte("-----BEGIN PGP")) {
+		return openpgp.ReadKeyRing(bytes.NewReader(b))
+	}
+
+	result := openpgp.EntityList{}
+	block := strings.Builder{}
+
+	for _, line := range strings.SplitAfter(string(b), "\n") {
+		if strings.HasPrefix(line, "-----BEGIN PGP") {
+			block.Reset()
+		}
+
+		block.WriteString(line)
+
+		if !strings.HasPrefix(line, "-----END PGP") {
+			continue
+		}
+
+		entities, err := openpgp.ReadArmoredKeyRing(strings.NewReader(block.String()))
+
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, entities...)
+		block.Reset()
+	}
+
+	return result, nil
+}
+
+/*
+unlock decrypts an entity's private keys with the passphrase, so they can
+be used without prompting.
+*/
+func unlock(entity *openpgp.Entity, passphrase string) error {
+	if entity.PrivateKey == nil || !entity.PrivateKey.Encrypted {
+		return nil
+	}
+
+	if passphrase == "" {
+		return fmt.Errorf("private key %s is protected by a passphrase, but none was given", KeyID(entity.PrimaryKey.KeyId))
+	}
+
+	if err := entity.DecryptPrivateKeys([]byte(passphrase)); err != nil {
+		return fmt.Errorf("unable to unlock private key %s: %w", KeyID(entity.PrimaryKey.KeyId), err)
+	}
+
+	return nil
+}
+
+// userID returns the primary user ID of a key, or its key ID if it has none
+func userID(entity *openpgp.Entity) string {
+	if identity := entity.PrimaryIdentity(); identity != nil {
+		return identity.Name
+	}
+
+	return KeyID(entity.PrimaryKey.KeyId)
+}
@@ -0,0 +1,108 @@
+package pgp
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+)
+
+func TestEncryptedCopy(t *testing.T) {
+	wd, err := os.Getwd()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		_ = os.Chdir(wd)
+	})
+
+	entity, err := openpgp.NewEntity("Partner", "", "partner@example.com", nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyring := &Keyring{recipient: entity, copies: map[string]*encryptedCopy{}}
+	fullPath := filepath.Join("uploads", "june.csv")
+
+	if err = os.MkdirAll("uploads", 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = os.WriteFile(fullPath, []byte("id,total\n1,10\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	size, err := keyring.EncryptedSize(fullPath)
+
+	if err != nil {
+		t.Fatalf("EncryptedSize error = %v", err)
+	}
+
+	first := readEncrypted(t, keyring, fullPath)
+
+	if int64(len(first)) != size {
+		t.Errorf("read %d bytes, EncryptedSize = %d", len(first), size)
+	}
+
+	if second := readEncrypted(t, keyring, fullPath); string(second) != string(first) {
+		t.Error("the same version was encrypted again")
+	}
+
+	if err = os.WriteFile(fullPath, []byte("id,total\n1,10\n2,20\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	later := time.Now().Add(time.Second)
+
+	if err = os.Chtimes(fullPath, later, later); err != nil {
+		t.Fatal(err)
+	}
+
+	changedSize, err := keyring.EncryptedSize(fullPath)
+
+	if err != nil {
+		t.Fatalf("EncryptedSize error = %v", err)
+	}
+
+	if changedSize <= size {
+		t.Errorf("EncryptedSize after a change = %d, want more than %d", changedSize, size)
+	}
+
+	if changed := readEncrypted(t, keyring, fullPath); int64(len(changed)) != changedSize {
+		t.Errorf("read %d bytes after a change, EncryptedSize = %d", len(changed), changedSize)
+	}
+
+	if entries, _ := os.ReadDir(readsFolder()); len(entries) != 1 {
+		t.Errorf("%d copies kept, want 1", len(entries))
+	}
+}
+
+func readEncrypted(t *testing.T, keyring *Keyring, fullPath string) []byte {
+	t.Helper()
+
+	file, err := keyring.OpenEncrypted(fullPath)
+
+	if err != nil {
+		t.Fatalf("OpenEncrypted error = %v", err)
+	}
+
+	defer file.Close()
+
+	result, err := io.ReadAll(file)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return result
+}
@@ -0,0 +1,491 @@
+package pgp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/clearsign"
+	pgperrors "github.com/ProtonMail/go-crypto/openpgp/errors"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+// Kinds of OpenPGP data
+const (
+	KindMessage     = "message"
+	KindClearsigned = "clearsigned message"
+	KindSignature   = "detached signature"
+	KindKey         = "key"
+)
+
+// Signature statuses
+const (
+	SignatureUnsigned   = "unsigned"
+	SignatureValid      = "valid"
+	SignatureInvalid    = "invalid"
+	SignatureUnknownKey = "unknown-key"
+)
+
+// Armor types of messages
+const (
+	messageType     = "PGP MESSAGE"
+	clearsignedType = "PGP SIGNED MESSAGE"
+)
+
+var (
+	ErrNoKey      = fmt.Errorf("no key in the keyring can decrypt this file")
+	ErrNotMessage = fmt.Errorf("this file is not an OpenPGP message")
+)
+
+/*
+Signature is the result of checking a signature. Signer is the signing
+key's user ID when it is in the keyring, and KeyID otherwise.
+*/
+type Signature struct {
+	Status string
+	Signer string
+	KeyID  string
+	Error  string
+}
+
+/*
+Details describe a file of OpenPGP data. Recipients are the IDs of the keys
+a message is encrypted to, and FileName is the name stored inside it.
+Signed is the file a detached signature is for.
+*/
+type Details struct {
+	Kind       string
+	Armored    bool
+	Encrypted  bool
+	Recipients []uint64
+	FileName   string
+	Signed     string
+	Keys       []string
+	Size       int64
+	Signature  Signature
+}
+
+/*
+Message is the content of an OpenPGP message as it is read. The signature
+can only be checked once the whole message has been read, so Signature
+is only set after Read returns io.EOF. Size counts the content read.
+*/
+type Message struct {
+	Details
+
+	file    *os.File
+	body    io.Reader
+	details *openpgp.MessageDetails
+	checked bool
+	done    bool
+}
+
+/*
+Open opens an encrypted or signed file to read its content. Decryption
+errors for files encrypted to keys we don't have return ErrNoKey, and
+signatures and keys return ErrNotMessage.
+*/
+func (k *Keyring) Open(fullPath string) (*Message, error) {
+	file, err := os.Open(fullPath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := k.open(file)
+
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Read implements io.Reader
+func (m *Message) Read(p []byte) (int, error) {
+	// Reading past the end of a decrypted message is an error, rather
+	// than another io.EOF
+	if m.done {
+		return 0, io.EOF
+	}
+
+	n, err := m.body.Read(p)
+	m.Size += int64(n)
+
+	if err == io.EOF {
+		m.done = true
+		m.check()
+	}
+
+	var signatureErr pgperrors.SignatureError
+
+	// A modified message fails its integrity check when the end is read,
+	// which isn't about a signature
+	if errors.As(err, &signatureErr) && !m.IsSigned() {
+		return n, fmt.Errorf("the file has been modified or is damaged: %w", err)
+	}
+
+	return n, err
+}
+
+// Close implements io.Closer
+func (m *Message) Close() error {
+	return m.file.Close()
+}
+
+// IsSigned returns true if the message carries a signature.
+func (m *Message) IsSigned() bool {
+	return m.details != nil && m.details.IsSigned || m.Kind == KindClearsigned
+}
+
+/*
+Inspect describes a file of OpenPGP data. Messages are read to the end to
+check their signature and measure their content. Detached signatures are
+checked against the file of the same name without the extension.
+*/
+func (k *Keyring) Inspect(fullPath string) (Details, error) {
+	file, err := os.Open(fullPath)
+
+	if err != nil {
+		return Details{}, err
+	}
+
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	blockType, err := armorType(reader)
+
+	if err != nil {
+		return Details{}, err
+	}
+
+	switch blockType {
+	case openpgp.SignatureType:
+		return k.inspectSignature(reader, fullPath)
+
+	case openpgp.PublicKeyType, openpgp.PrivateKeyType:
+		return inspectKeys(reader)
+	}
+
+	if _, err = file.Seek(0, io.SeekStart); err != nil {
+		return Details{}, err
+	}
+
+	message, err := k.open(file)
+
+	if errors.Is(err, ErrNoKey) {
+		result := Details{
+			Kind:      KindMessage,
+			Armored:   blockType != "",
+			Encrypted: true,
+		}
+
+		result.Recipients, _ = recipients(fullPath)
+		return result, err
+	}
+
+	if err != nil {
+		return Details{}, err
+	}
+
+	_, err = io.Copy(io.Discard, message)
+	return message.Details, err
+}
+
+func (k *Keyring) open(file *os.File) (*Message, error) {
+	var (
+		err     error
+		body    io.Reader
+		details *openpgp.MessageDetails
+	)
+
+	reader := bufio.NewReader(file)
+	blockType, err := armorType(reader)
+
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Message{
+		file: file,
+		Details: Details{
+			Kind:    KindMessage,
+			Armored: blockType != "",
+		},
+	}
+
+	switch blockType {
+	case "":
+		body = reader
+
+	case messageType:
+		block, err := armor.Decode(reader)
+
+		if err != nil {
+			return nil, err
+		}
+
+		body = block.Body
+
+	case clearsignedType:
+		return k.openClearsigned(result, reader)
+
+	default:
+		return nil, ErrNotMessage
+	}
+
+	details, err = openpgp.ReadMessage(body, k.entities, nil, nil)
+
+	if errors.Is(err, pgperrors.ErrKeyIncorrect) {
+		return nil, ErrNoKey
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	result.details = details
+	result.body = details.UnverifiedBody
+	result.Encrypted = details.IsEncrypted
+	result.Recipients = details.EncryptedToKeyIds
+
+	if details.LiteralData != nil && details.LiteralData.FileName != "" {
+		result.FileName = filepath.Base(details.LiteralData.FileName)
+	}
+
+	return result, nil
+}
+
+/*
+openClearsigned reads a clearsigned message, which is plain text with an
+armored signature after it. It is small enough to check up front.
+*/
+func (k *Keyring) openClearsigned(result *Message, reader io.Reader) (*Message, error) {
+	b, err := io.ReadAll(reader)
+
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := clearsign.Decode(b)
+
+	if block == nil {
+		return nil, fmt.Errorf("unable to read the clearsigned message")
+	}
+
+	result.Kind = KindClearsigned
+	result.body = bytes.NewReader(block.Bytes)
+
+	// Checking the signature reads it, so read its key ID first
+	keyID := signatureKeyID(block.ArmoredSignature.Body)
+	block, _ = clearsign.Decode(b)
+
+	signer, err := block.VerifySignature(k.entities, nil)
+	result.Signature = signatureResult(signer, keyID, err)
+	result.checked = true
+	return result, nil
+}
+
+// check sets the signature result once a message has been read
+func (m *Message) check() {
+	if m.checked || m.details == nil {
+		return
+	}
+
+	m.checked = true
+
+	if !m.details.IsSigned {
+		m.Signature = Signature{Status: SignatureUnsigned}
+		return
+	}
+
+	if m.details.SignedBy == nil {
+		m.Signature = Signature{Status: SignatureUnknownKey, KeyID: KeyID(m.details.SignedByKeyId)}
+		return
+	}
+
+	m.Signature = signatureResult(m.details.SignedBy.Entity, m.details.SignedByKeyId, m.details.SignatureError)
+}
+
+/*
+inspectSignature checks a detached signature against the file it signs,
+which is named like the signature without its extension.
+*/
+func (k *Keyring) inspectSignature(reader io.Reader, fullPath string) (Details, error) {
+	result := Details{
+		Kind:    KindSignature,
+		Armored: true,
+		Signed:  strings.TrimSuffix(filepath.Base(fullPath), filepath.Ext(fullPath)),
+	}
+
+	signature, err := io.ReadAll(reader)
+
+	if err != nil {
+		return result, err
+	}
+
+	signed, err := os.Open(strings.TrimSuffix(fullPath, filepath.Ext(fullPath)))
+
+	if err != nil {
+		return result, fmt.Errorf("unable to open the signed file %s: %w", result.Signed, err)
+	}
+
+	defer signed.Close()
+
+	block, err := armor.Decode(bytes.NewReader(signature))
+
+	if err != nil {
+		return result, err
+	}
+
+	keyID := signatureKeyID(block.Body)
+	signer, err := openpgp.CheckArmoredDetachedSignature(k.entities, signed, bytes.NewReader(signature), nil)
+	result.Signature = signatureResult(signer, keyID, err)
+	return result, nil
+}
+
+// inspectKeys lists the user IDs of the keys in an armored key block
+func inspectKeys(reader io.Reader) (Details, error) {
+	result := Details{
+		Kind:    KindKey,
+		Armored: true,
+		Keys:    []string{},
+	}
+
+	entities, err := openpgp.ReadArmoredKeyRing(reader)
+
+	if err != nil {
+		return result, err
+	}
+
+	for _, entity := range entities {
+		result.Keys = append(result.Keys, fmt.Sprintf("%s %s", KeyID(entity.PrimaryKey.KeyId), userID(entity)))
+	}
+
+	return result, nil
+}
+
+/*
+recipients reads the IDs of the keys a message is encrypted to from the
+packets before its content, without decrypting it.
+*/
+func recipients(fullPath string) ([]uint64, error) {
+	result := []uint64{}
+	file, err := os.Open(fullPath)
+
+	if err != nil {
+		return result, err
+	}
+
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	blockType, err := armorType(reader)
+
+	if err != nil || blockType == clearsignedType {
+		return result, err
+	}
+
+	var body io.Reader = reader
+
+	if blockType != "" {
+		block, err := armor.Decode(reader)
+
+		if err != nil {
+			return result, err
+		}
+
+		body = block.Body
+	}
+
+	packets := packet.NewReader(body)
+
+	for {
+		p, err := packets.Next()
+
+		if err != nil {
+			return result, nil
+		}
+
+		switch p := p.(type) {
+		case *packet.EncryptedKey:
+			result = append(result, p.KeyId)
+		case *packet.SymmetricKeyEncrypted:
+		default:
+			return result, nil
+		}
+	}
+}
+
+/*
+armorType returns the type of the armored block a file starts with, such
+as "PGP MESSAGE", or blank for binary data. It doesn't consume the reader.
+*/
+func armorType(reader *bufio.Reader) (string, error) {
+	b, err := reader.Peek(128)
+
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+
+	text := string(bytes.TrimLeft(b, " \t\r\n"))
+	rest, ok := strings.CutPrefix(text, "-----BEGIN ")
+
+	if !ok {
+		return "", nil
+	}
+
+	blockType, _, ok := strings.Cut(rest, "-----")
+
+	if !ok {
+		return "", nil
+	}
+
+	return blockType, nil
+}
+
+// signatureKeyID reads the issuer key ID from a signature packet
+func signatureKeyID(body io.Reader) uint64 {
+	p, err := packet.Read(body)
+
+	if err != nil {
+		return 0
+	}
+
+	if signature, ok := p.(*packet.Signature); ok && signature.IssuerKeyId != nil {
+		return *signature.IssuerKeyId
+	}
+
+	return 0
+}
+
+func signatureResult(signer *openpgp.Entity, keyID uint64, err error) Signature {
+	result := Signature{
+		Status: SignatureValid,
+		KeyID:  KeyID(keyID),
+	}
+
+	if errors.Is(err, pgperrors.ErrUnknownIssuer) {
+		result.Status = SignatureUnknownKey
+		return result
+	}
+
+	if err != nil {
+		result.Status = SignatureInvalid
+		result.Error = err.Error()
+	}
+
+	if signer != nil {
+		result.Signer = userID(signer)
+	}
+
+	return result
+}
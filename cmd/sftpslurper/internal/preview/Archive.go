@@ -0,0 +1,409 @@
+package preview
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bodgit/sevenzip"
+	"github.com/dustin/go-humanize"
+)
+
+const (
+	ArchiveZip   = "zip"
+	ArchiveTar   = "tar"
+	ArchiveTarGz = "tar.gz"
+	Archive7z    = "7z"
+	ArchiveGzip  = "gz"
+
+	// MaxArchiveEntries caps how many entries are listed. Every entry is
+	// still counted.
+	MaxArchiveEntries = 5000
+
+	// MaxEntryPreviewSize caps how much of an archive entry is held in
+	// memory for a text or hex preview.
+	MaxEntryPreviewSize = 16 * 1024 * 1024
+)
+
+var (
+	errStopWalk = errors.New("stop walking archive")
+
+	archiveSuffixes = []struct {
+		Suffix string
+		Format string
+	}{
+		// .tar.gz must come before .gz
+		{Suffix: ".tar.gz", Format: ArchiveTarGz},
+		{Suffix: ".tgz", Format: ArchiveTarGz},
+		{Suffix: ".tar", Format: ArchiveTar},
+		{Suffix: ".zip", Format: ArchiveZip},
+		{Suffix: ".7z", Format: Archive7z},
+		{Suffix: ".gz", Format: ArchiveGzip},
+	}
+
+	archiveTemplate = template.Must(template.New("archive").Parse(`<div id="archivePreview">
+   <p><small>{{.Summary}}</small></p>
+   {{if .Truncated}}<article class="warning">Only the first {{len .Entries}} of {{.Total}} entries are listed.</article>{{end}}
+   <table class="striped archive-entries">
+      <thead>
+         <tr>
+            <th>Name</th>
+            <th>Size</th>
+            <th>Modified</th>
+            <th></th>
+         </tr>
+      </thead>
+      <tbody>
+         {{range .Entries}}
+         <tr>
+            <td>{{.Name}}</td>
+            <td>{{if not .IsDir}}{{.SizeLabel}}{{end}}</td>
+            <td>{{if not .ModTime.IsZero}}{{.ModTime.Format "2006-01-02 15:04:05"}}{{end}}</td>
+            <td class="file-actions">
+               {{if not .IsDir}}
+               <a hx-get="{{$.EntryURL .Name ""}}" hx-target="#archivePreview" hx-swap="innerHTML" title="Preview {{.Name}}"><i class="icon icon-file"></i></a>
+               <a hx-get="{{$.EntryURL .Name "hex"}}" hx-target="#archivePreview" hx-swap="innerHTML" title="Inspect the bytes of {{.Name}}"><i class="icon icon-hex"></i></a>
+               <a href="{{$.DownloadURL .Name}}" download title="Download {{.Name}}"><i class="icon icon-download"></i></a>
+               {{end}}
+            </td>
+         </tr>
+         {{end}}
+      </tbody>
+   </table>
+</div>`))
+)
+
+/*
+ArchiveEntry is a file or folder inside an archive. Size is -1 when the
+archive doesn't record it.
+*/
+type ArchiveEntry struct {
+	Name    string
+	Size    int64
+	ModTime time.Time
+	IsDir   bool
+}
+
+func (e ArchiveEntry) SizeLabel() string {
+	if e.Size < 0 {
+		return "unknown"
+	}
+
+	return humanize.Bytes(uint64(e.Size))
+}
+
+/*
+ArchiveListing is the table of contents of an archive.
+*/
+type ArchiveListing struct {
+	Hidden    map[string]string
+	Format    string
+	Entries   []ArchiveEntry
+	Total     int
+	TotalSize int64
+	Truncated bool
+}
+
+func (a ArchiveListing) Summary() string {
+	return fmt.Sprintf("%s archive, %d entries, %s uncompressed", a.Format, a.Total, humanize.Bytes(uint64(a.TotalSize)))
+}
+
+// EntryURL returns the URL that previews one entry.
+func (a ArchiveListing) EntryURL(entry, view string) string {
+	values := a.values(entry)
+
+	if view != "" {
+		values.Set("view", view)
+	}
+
+	return "/preview?" + values.Encode()
+}
+
+// DownloadURL returns the URL that downloads one entry.
+func (a ArchiveListing) DownloadURL(entry string) string {
+	return "/archive/entry?" + a.values(entry).Encode()
+}
+
+func (a ArchiveListing) values(entry string) url.Values {
+	values := url.Values{}
+
+	for key, value := range a.Hidden {
+		values.Set(key, value)
+	}
+
+	values.Set("entry", entry)
+	return values
+}
+
+/*
+Render writes the listing as an HTML fragment. hidden holds the query
+values that identify the archive, so each entry can be previewed or
+downloaded.
+*/
+func (a ArchiveListing) Render(w io.Writer, hidden map[string]string) error {
+	a.Hidden = hidden
+	return archiveTemplate.Execute(w, a)
+}
+
+/*
+ArchiveFormat returns the archive format of a file from its name. The
+whole name is used, as .tar.gz has two extensions.
+*/
+func ArchiveFormat(fileName string) (string, bool) {
+	lower := strings.ToLower(fileName)
+
+	for _, s := range archiveSuffixes {
+		if strings.HasSuffix(lower, s.Suffix) {
+			return s.Format, true
+		}
+	}
+
+	return "", false
+}
+
+/*
+ListArchive reads the entries of an archive without extracting anything.
+*/
+func ListArchive(fileName string) (ArchiveListing, error) {
+	format, ok := ArchiveFormat(fileName)
+	result := ArchiveListing{Format: format}
+
+	if !ok {
+		return result, fmt.Errorf("%s is not a supported archive", filepath.Base(fileName))
+	}
+
+	err := walkArchive(fileName, format, func(entry ArchiveEntry, _ func() (io.ReadCloser, error)) error {
+		result.Total++
+
+		if entry.Size > 0 {
+			result.TotalSize += entry.Size
+		}
+
+		if len(result.Entries) < MaxArchiveEntries {
+			result.Entries = append(result.Entries, entry)
+		} else {
+			result.Truncated = true
+		}
+
+		return nil
+	})
+
+	return result, err
+}
+
+/*
+ReadArchiveEntry finds the file named entryName in an archive and calls
+fn with a reader over its decompressed content. The reader is only valid
+until fn returns. Nothing is written to disk.
+*/
+func ReadArchiveEntry(fileName, entryName string, fn func(entry ArchiveEntry, r io.Reader) error) error {
+	var (
+		found bool
+	)
+
+	format, ok := ArchiveFormat(fileName)
+
+	if !ok {
+		return fmt.Errorf("%s is not a supported archive", filepath.Base(fileName))
+	}
+
+	err := walkArchive(fileName, format, func(entry ArchiveEntry, open func() (io.ReadCloser, error)) error {
+		if entry.Name != entryName || entry.IsDir {
+			return nil
+		}
+
+		found = true
+		r, err := open()
+
+		if err != nil {
+			return err
+		}
+
+		defer r.Close()
+
+		if err = fn(entry, r); err != nil {
+			return err
+		}
+
+		return errStopWalk
+	})
+
+	if errors.Is(err, errStopWalk) {
+		return nil
+	}
+
+	if err == nil && !found {
+		return fmt.Errorf("%s not found in archive: %w", entryName, fs.ErrNotExist)
+	}
+
+	return err
+}
+
+/*
+walkArchive calls fn for every entry in an archive. open returns the
+entry's content and may only be called during fn.
+*/
+func walkArchive(fileName, format string, fn func(entry ArchiveEntry, open func() (io.ReadCloser, error)) error) error {
+	switch format {
+	case ArchiveZip:
+		return walkZip(fileName, fn)
+	case Archive7z:
+		return walk7z(fileName, fn)
+	case ArchiveGzip:
+		return walkGzip(fileName, fn)
+	default:
+		return walkTar(fileName, format == ArchiveTarGz, fn)
+	}
+}
+
+func walkZip(fileName string, fn func(entry ArchiveEntry, open func() (io.ReadCloser, error)) error) error {
+	zr, err := zip.OpenReader(fileName)
+
+	if err != nil {
+		return err
+	}
+
+	defer zr.Close()
+
+	for _, f := range zr.File {
+		info := f.FileInfo()
+		entry := ArchiveEntry{Name: f.Name, Size: info.Size(), ModTime: f.Modified, IsDir: info.IsDir()}
+
+		if err = fn(entry, f.Open); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func walk7z(fileName string, fn func(entry ArchiveEntry, open func() (io.ReadCloser, error)) error) error {
+	sr, err := sevenzip.OpenReader(fileName)
+
+	if err != nil {
+		return err
+	}
+
+	defer sr.Close()
+
+	for _, f := range sr.File {
+		info := f.FileInfo()
+		entry := ArchiveEntry{Name: f.Name, Size: info.Size(), ModTime: f.Modified, IsDir: info.IsDir()}
+
+		if err = fn(entry, f.Open); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func walkTar(fileName string, compressed bool, fn func(entry ArchiveEntry, open func() (io.ReadCloser, error)) error) error {
+	var (
+		source io.Reader
+	)
+
+	f, err := os.Open(fileName)
+
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+	source = f
+
+	if compressed {
+		gr, err := gzip.NewReader(f)
+
+		if err != nil {
+			return err
+		}
+
+		defer gr.Close()
+		source = gr
+	}
+
+	tr := tar.NewReader(source)
+
+	for {
+		header, err := tr.Next()
+
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		entry := ArchiveEntry{
+			Name:    header.Name,
+			Size:    header.Size,
+			ModTime: header.ModTime,
+			IsDir:   header.Typeflag == tar.TypeDir,
+		}
+
+		open := func() (io.ReadCloser, error) {
+			if header.Typeflag != tar.TypeReg {
+				return nil, fmt.Errorf("%s is not a regular file", header.Name)
+			}
+
+			return io.NopCloser(tr), nil
+		}
+
+		if err = fn(entry, open); err != nil {
+			return err
+		}
+	}
+}
+
+/*
+walkGzip treats a plain gzip file as an archive with one entry. The size
+comes from the gzip trailer, which only holds the size modulo 4 GiB.
+*/
+func walkGzip(fileName string, fn func(entry ArchiveEntry, open func() (io.ReadCloser, error)) error) error {
+	f, err := os.Open(fileName)
+
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	gr, err := gzip.NewReader(f)
+
+	if err != nil {
+		return err
+	}
+
+	defer gr.Close()
+
+	entry := ArchiveEntry{Name: gr.Name, Size: -1, ModTime: gr.ModTime}
+
+	if entry.Name == "" {
+		entry.Name = strings.TrimSuffix(filepath.Base(fileName), filepath.Ext(fileName))
+	}
+
+	if info, err := f.Stat(); err == nil && info.Size() >= 18 {
+		trailer := make([]byte, 4)
+
+		if _, err = f.ReadAt(trailer, info.Size()-4); err == nil {
+			entry.Size = int64(binary.LittleEndian.Uint32(trailer))
+		}
+	}
+
+	return fn(entry, func() (io.ReadCloser, error) {
+		return io.NopCloser(gr), nil
+	})
+}
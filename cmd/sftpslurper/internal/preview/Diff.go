@@ -0,0 +1,446 @@
+package preview
+
+import (
+	"bytes"
+	"errors"
+	"html/template"
+	"io"
+	"os"
+	"strings"
+)
+
+const (
+	DiffModeLines = "lines"
+	DiffModeTable = "table"
+	DiffModeBytes = "bytes"
+
+	// MaxDiffSize is the largest file compared line by line or cell by
+	// cell. Larger files are compared byte by byte.
+	MaxDiffSize = 8 * 1024 * 1024
+
+	// MaxDiffEdits caps the number of lines or rows that may differ.
+	// Finding the smallest diff gets slower the more two files differ.
+	MaxDiffEdits = 2000
+
+	// MaxDiffRows caps how many rows of a diff are shown
+	MaxDiffRows = 5000
+
+	// DiffContext is how many unchanged lines are kept around a change
+	DiffContext = 3
+)
+
+var (
+	ErrDiffTooLarge     = errors.New("file is too large to compare line by line")
+	ErrDiffTooDifferent = errors.New("files have too many differences to compare line by line")
+
+	diffTemplate = template.Must(template.New("diff").Parse(`<div id="diffPreview">
+   <form class="diff-options" hx-get="/compare" hx-target="#diffPreview" hx-swap="outerHTML" hx-trigger="change">
+      {{range $key, $value := .Hidden}}<input type="hidden" name="{{$key}}" value="{{$value}}" />{{end}}
+      <label>
+         Compare
+         <select name="mode">
+            <option value="lines" {{if eq .Mode "lines"}}selected{{end}}>lines</option>
+            <option value="table" {{if eq .Mode "table"}}selected{{end}}>cells</option>
+            <option value="bytes" {{if eq .Mode "bytes"}}selected{{end}}>bytes</option>
+         </select>
+      </label>
+      <small>{{.Summary}}</small>
+   </form>
+   {{if .Notice}}<article class="warning">{{.Notice}}</article>{{end}}
+   {{with .Text}}
+   <div class="diff-scroll">
+      <table class="diff-lines">
+         <colgroup><col class="diff-number" /><col /><col class="diff-number" /><col /></colgroup>
+         <thead>
+            <tr><th colspan="2" scope="col">{{$.Left}}</th><th colspan="2" scope="col">{{$.Right}}</th></tr>
+         </thead>
+         <tbody>
+            {{range .Rows}}
+            {{if eq .Kind "skip"}}
+            <tr class="diff-skip"><td colspan="4"><small>{{.Skipped}} unchanged lines</small></td></tr>
+            {{else}}
+            <tr class="diff-{{.Kind}}">
+               <td class="diff-number">{{if .LeftNumber}}{{.LeftNumber}}{{end}}</td>
+               <td class="diff-left">{{.Left}}</td>
+               <td class="diff-number">{{if .RightNumber}}{{.RightNumber}}{{end}}</td>
+               <td class="diff-right">{{.Right}}</td>
+            </tr>
+            {{end}}
+            {{end}}
+         </tbody>
+      </table>
+   </div>
+   {{end}}
+   {{with .Table}}
+   <div class="diff-scroll">
+      <table class="diff-cells">
+         <thead>
+            <tr>
+               <th scope="col">#</th>
+               <th scope="col">#</th>
+               {{range .Columns}}<th scope="col" class="diff-column-{{.Kind}}">{{.Name}}</th>{{end}}
+            </tr>
+         </thead>
+         <tbody>
+            {{range .Rows}}
+            {{if eq .Kind "skip"}}
+            <tr class="diff-skip"><td colspan="{{$.Table.Span}}"><small>{{.Skipped}} unchanged rows</small></td></tr>
+            {{else}}
+            <tr class="diff-{{.Kind}}">
+               <td class="diff-number">{{if .LeftNumber}}{{.LeftNumber}}{{end}}</td>
+               <td class="diff-number">{{if .RightNumber}}{{.RightNumber}}{{end}}</td>
+               {{range .Cells}}
+               {{if .Changed}}<td class="diff-cell-changed"><del>{{.Left}}</del> <ins>{{.Right}}</ins></td>{{else}}<td>{{.Value}}</td>{{end}}
+               {{end}}
+            </tr>
+            {{end}}
+            {{end}}
+         </tbody>
+      </table>
+   </div>
+   {{end}}
+   {{with .Bytes}}
+   <dl class="hex-summary">
+      <dt>{{$.Left}}</dt><dd>{{.LeftSize}} bytes</dd>
+      <dt>{{$.Right}}</dt><dd>{{.RightSize}} bytes</dd>
+      <dt>Differing bytes</dt><dd>{{.Differing}}{{if .Truncated}} in the first 100 MB{{end}}</dd>
+      <dt>First difference</dt><dd>{{if ge .FirstDifference 0}}{{printf "0x%08x" .FirstDifference}}{{else}}none{{end}}</dd>
+   </dl>
+   {{if .Ranges}}
+   <table class="striped diff-ranges">
+      <thead>
+         <tr><th scope="col">Offset</th><th scope="col">Length</th><th scope="col">{{$.Left}}</th><th scope="col">{{$.Right}}</th></tr>
+      </thead>
+      <tbody>
+         {{range .Ranges}}
+         <tr>
+            <td><code>{{printf "0x%08x" .Offset}}</code></td>
+            <td>{{.Length}}</td>
+            <td><code>{{.LeftHex}}</code></td>
+            <td><code>{{.RightHex}}</code></td>
+         </tr>
+         {{end}}
+      </tbody>
+   </table>
+   {{if gt .RangeCount (len .Ranges)}}<p><small>Showing the first {{len .Ranges}} of {{.RangeCount}} differing ranges</small></p>{{end}}
+   {{end}}
+   {{end}}
+</div>`))
+)
+
+/*
+Diff is a comparison of two files. Only one of Text, Table, or Bytes is
+set, depending on Mode.
+*/
+type Diff struct {
+	Hidden map[string]string
+	Mode   string
+	Left   string
+	Right  string
+	Notice string
+	Text   *TextDiff
+	Table  *TableDiff
+	Bytes  *ByteDiff
+}
+
+/*
+Summary describes the differences in a sentence.
+*/
+func (d Diff) Summary() string {
+	switch {
+	case d.Text != nil:
+		return d.Text.Summary()
+	case d.Table != nil:
+		return d.Table.Summary()
+	case d.Bytes != nil:
+		return d.Bytes.Summary()
+	}
+
+	return ""
+}
+
+/*
+Render writes the diff as an HTML fragment. hidden holds the query values
+that identify the two files, so changing the mode can reload the diff.
+*/
+func (d Diff) Render(w io.Writer, hidden map[string]string) error {
+	d.Hidden = hidden
+	return diffTemplate.Execute(w, d)
+}
+
+/*
+DiffMode picks how two files are compared. CSV and TSV files are compared
+cell by cell, other text line by line, and anything else byte by byte.
+leftType and rightType are the sniffed content types of the files.
+*/
+func DiffMode(leftExt, rightExt, leftType, rightType string) string {
+	isTable := func(ext string) bool {
+		ext = strings.ToLower(ext)
+		return ext == "csv" || ext == "tsv"
+	}
+
+	isText := func(ext, contentType string) bool {
+		_, ok := TextFormat(ext)
+		return ok || isTable(ext) || strings.HasPrefix(contentType, "text/")
+	}
+
+	switch {
+	case isTable(leftExt) && isTable(rightExt):
+		return DiffModeTable
+	case isText(leftExt, leftType) && isText(rightExt, rightType):
+		return DiffModeLines
+	default:
+		return DiffModeBytes
+	}
+}
+
+/*
+diffOp is one step of an edit script. A is the index in the left sequence
+and B the index in the right one, or -1 when the step doesn't use it.
+*/
+type diffOp struct {
+	Kind string
+	A    int
+	B    int
+}
+
+/*
+diffSequences finds the shortest edit script that turns a into b, using
+Myers' algorithm. It gives up once more than maxEdits lines would have to
+be inserted or deleted, returning false.
+*/
+func diffSequences(a, b []string, maxEdits int) ([]diffOp, bool) {
+	prefix := 0
+
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+
+	suffix := 0
+
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	middle, ok := myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix], maxEdits)
+
+	if !ok {
+		return nil, false
+	}
+
+	result := make([]diffOp, 0, prefix+len(middle)+suffix)
+
+	for index := 0; index < prefix; index++ {
+		result = append(result, diffOp{Kind: "equal", A: index, B: index})
+	}
+
+	for _, op := range middle {
+		if op.A >= 0 {
+			op.A += prefix
+		}
+
+		if op.B >= 0 {
+			op.B += prefix
+		}
+
+		result = append(result, op)
+	}
+
+	for index := suffix; index > 0; index-- {
+		result = append(result, diffOp{Kind: "equal", A: len(a) - index, B: len(b) - index})
+	}
+
+	return result, true
+}
+
+func myers(a, b []string, maxEdits int) ([]diffOp, bool) {
+	n, m := len(a), len(b)
+	limit := min(n+m, maxEdits)
+	offset := limit + 1
+	v := make([]int, 2*limit+3)
+
+	// trace[d] holds v for diagonals -d-1 through d+1 as it was before
+	// step d, which is what walking back from step d needs
+	trace := [][]int{}
+
+	for d := 0; d <= limit; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d-1:offset+d+2]...))
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+
+			y := x - k
+
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+
+			v[offset+k] = x
+
+			if x >= n && y >= m {
+				return backtrack(trace, n, m), true
+			}
+		}
+	}
+
+	return nil, false
+}
+
+func backtrack(trace [][]int, x, y int) []diffOp {
+	result := []diffOp{}
+
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		at := func(k int) int { return v[k+d+1] }
+		k := x - y
+
+		prevK := k - 1
+
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		}
+
+		prevX := at(prevK)
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			x--
+			y--
+			result = append(result, diffOp{Kind: "equal", A: x, B: y})
+		}
+
+		if d > 0 {
+			if x == prevX {
+				result = append(result, diffOp{Kind: "insert", A: -1, B: y - 1})
+			} else {
+				result = append(result, diffOp{Kind: "delete", A: x - 1, B: -1})
+			}
+		}
+
+		x, y = prevX, prevY
+	}
+
+	for left, right := 0, len(result)-1; left < right; left, right = left+1, right-1 {
+		result[left], result[right] = result[right], result[left]
+	}
+
+	return result
+}
+
+/*
+diffPair is one row of a side by side diff. Deletes and inserts next to
+each other are paired up as changes. A skip row stands in for Skipped
+unchanged rows.
+*/
+type diffPair struct {
+	Kind    string
+	A       int
+	B       int
+	Skipped int
+}
+
+/*
+pairRows turns an edit script into side by side rows, keeping context
+unchanged rows around each change and collapsing the rest.
+*/
+func pairRows(ops []diffOp, context int) []diffPair {
+	result := []diffPair{}
+	index := 0
+
+	for index < len(ops) {
+		if ops[index].Kind == "equal" {
+			end := index
+
+			for end < len(ops) && ops[end].Kind == "equal" {
+				end++
+			}
+
+			keepBefore, keepAfter := context, context
+
+			if index == 0 {
+				keepBefore = 0
+			}
+
+			if end == len(ops) {
+				keepAfter = 0
+			}
+
+			if end-index <= keepBefore+keepAfter+1 {
+				keepBefore, keepAfter = end-index, 0
+			}
+
+			for _, op := range ops[index : index+keepBefore] {
+				result = append(result, diffPair{Kind: "equal", A: op.A, B: op.B})
+			}
+
+			if skipped := end - index - keepBefore - keepAfter; skipped > 0 {
+				result = append(result, diffPair{Kind: "skip", A: -1, B: -1, Skipped: skipped})
+			}
+
+			for _, op := range ops[end-keepAfter : end] {
+				result = append(result, diffPair{Kind: "equal", A: op.A, B: op.B})
+			}
+
+			index = end
+			continue
+		}
+
+		deletes, inserts := []int{}, []int{}
+
+		for index < len(ops) && ops[index].Kind != "equal" {
+			if ops[index].Kind == "delete" {
+				deletes = append(deletes, ops[index].A)
+			} else {
+				inserts = append(inserts, ops[index].B)
+			}
+
+			index++
+		}
+
+		for i := 0; i < max(len(deletes), len(inserts)); i++ {
+			switch {
+			case i < len(deletes) && i < len(inserts):
+				result = append(result, diffPair{Kind: "change", A: deletes[i], B: inserts[i]})
+			case i < len(deletes):
+				result = append(result, diffPair{Kind: "delete", A: deletes[i], B: -1})
+			default:
+				result = append(result, diffPair{Kind: "insert", A: -1, B: inserts[i]})
+			}
+		}
+	}
+
+	return result
+}
+
+/*
+readForDiff reads a whole file for a line or cell diff, without a UTF-8
+byte order mark. Files over MaxDiffSize return ErrDiffTooLarge.
+*/
+func readForDiff(fileName string) ([]byte, error) {
+	f, err := os.Open(fileName)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	content, err := io.ReadAll(io.LimitReader(f, MaxDiffSize+1))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(content) > MaxDiffSize {
+		return nil, ErrDiffTooLarge
+	}
+
+	return bytes.TrimPrefix(content, []byte("\ufeff")), nil
+}
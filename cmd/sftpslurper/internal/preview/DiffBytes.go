@@ -0,0 +1,164 @@
+package preview
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const (
+	// MaxByteRanges caps how many differing ranges are listed
+	MaxByteRanges = 100
+
+	// byteRangePreview is how many bytes of each range are shown
+	byteRangePreview = 8
+)
+
+/*
+ByteDiff summarizes where two files differ byte by byte. Bytes past the
+end of the shorter file are not counted as differing, as the sizes
+already show them.
+*/
+type ByteDiff struct {
+	LeftSize        int64
+	RightSize       int64
+	Differing       int64
+	FirstDifference int64
+	Ranges          []ByteRange
+	RangeCount      int
+	Truncated       bool
+}
+
+/*
+ByteRange is a run of bytes that differ at the same offsets in both files.
+*/
+type ByteRange struct {
+	Offset   int64
+	Length   int64
+	LeftHex  string
+	RightHex string
+}
+
+func (b ByteDiff) Summary() string {
+	switch {
+	case b.Differing == 0 && b.LeftSize == b.RightSize && b.Truncated:
+		return "The first 100 MB of the files are identical"
+	case b.Differing == 0 && b.LeftSize == b.RightSize:
+		return "Files are identical"
+	case b.Differing == 0:
+		return fmt.Sprintf("Files match for the first %d bytes and then differ in size", min(b.LeftSize, b.RightSize))
+	}
+
+	result := fmt.Sprintf("%d bytes differ in %d ranges", b.Differing, b.RangeCount)
+
+	if b.LeftSize != b.RightSize {
+		result += fmt.Sprintf(", sizes differ by %d bytes", b.RightSize-b.LeftSize)
+	}
+
+	return result
+}
+
+/*
+DiffBytes compares two files byte by byte at the same offsets, up to the
+first 100 MB.
+*/
+func DiffBytes(leftFile, rightFile string) (ByteDiff, error) {
+	result := ByteDiff{FirstDifference: -1}
+
+	left, err := os.Open(leftFile)
+
+	if err != nil {
+		return result, err
+	}
+
+	defer left.Close()
+
+	right, err := os.Open(rightFile)
+
+	if err != nil {
+		return result, err
+	}
+
+	defer right.Close()
+
+	for _, side := range []struct {
+		File *os.File
+		Size *int64
+	}{{left, &result.LeftSize}, {right, &result.RightSize}} {
+		info, err := side.File.Stat()
+
+		if err != nil {
+			return result, err
+		}
+
+		*side.Size = info.Size()
+	}
+
+	length := min(result.LeftSize, result.RightSize)
+	result.Truncated = length > maxScanSize
+	length = min(length, maxScanSize)
+
+	leftReader := bufio.NewReaderSize(left, 64*1024)
+	rightReader := bufio.NewReaderSize(right, 64*1024)
+
+	var current *ByteRange
+
+	for offset := int64(0); offset < length; offset++ {
+		a, err := leftReader.ReadByte()
+
+		if err != nil {
+			return result, unexpectedEOF(err)
+		}
+
+		b, err := rightReader.ReadByte()
+
+		if err != nil {
+			return result, unexpectedEOF(err)
+		}
+
+		if a == b {
+			current = nil
+			continue
+		}
+
+		result.Differing++
+
+		if result.FirstDifference < 0 {
+			result.FirstDifference = offset
+		}
+
+		if current == nil {
+			result.RangeCount++
+
+			if len(result.Ranges) >= MaxByteRanges {
+				// Keep counting ranges without listing them
+				current = &ByteRange{}
+			} else {
+				result.Ranges = append(result.Ranges, ByteRange{Offset: offset})
+				current = &result.Ranges[len(result.Ranges)-1]
+			}
+		}
+
+		if current.Length < byteRangePreview {
+			current.LeftHex = strings.TrimSpace(current.LeftHex + fmt.Sprintf(" %02x", a))
+			current.RightHex = strings.TrimSpace(current.RightHex + fmt.Sprintf(" %02x", b))
+		}
+
+		current.Length++
+	}
+
+	return result, nil
+}
+
+/*
+unexpectedEOF reports a file that got shorter while it was being read.
+*/
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+
+	return err
+}
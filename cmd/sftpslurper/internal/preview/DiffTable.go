@@ -0,0 +1,328 @@
+package preview
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+/*
+TableDiff is a cell by cell comparison of two delimited files. When both
+files have a header row, columns are matched by name, so reordering
+columns is not reported as a change.
+*/
+type TableDiff struct {
+	Columns   []TableDiffColumn
+	Rows      []TableDiffRow
+	Changed   int
+	Deleted   int
+	Inserted  int
+	Truncated bool
+}
+
+/*
+TableDiffColumn is a column of either file. Kind is "equal" for columns in
+both, "delete" for columns only on the left, and "insert" for columns only
+on the right.
+*/
+type TableDiffColumn struct {
+	Name  string
+	Kind  string
+	Left  int
+	Right int
+}
+
+type TableDiffRow struct {
+	Kind        string
+	LeftNumber  int
+	RightNumber int
+	Cells       []TableDiffCell
+	Skipped     int
+}
+
+type TableDiffCell struct {
+	Value   string
+	Left    string
+	Right   string
+	Changed bool
+}
+
+// Span is the number of columns in the diff, including the row numbers.
+func (t TableDiff) Span() int {
+	return len(t.Columns) + 2
+}
+
+func (t TableDiff) Summary() string {
+	if t.Changed == 0 && t.Deleted == 0 && t.Inserted == 0 && !t.columnsDiffer() {
+		return "Tables are identical"
+	}
+
+	result := fmt.Sprintf("%d rows changed, %d removed, %d added", t.Changed, t.Deleted, t.Inserted)
+	added, removed := 0, 0
+
+	for _, column := range t.Columns {
+		switch column.Kind {
+		case "insert":
+			added++
+		case "delete":
+			removed++
+		}
+	}
+
+	if added > 0 || removed > 0 {
+		result += fmt.Sprintf(", %d columns removed, %d added", removed, added)
+	}
+
+	if t.Truncated {
+		result += fmt.Sprintf(", showing the first %d rows", MaxDiffRows)
+	}
+
+	return result
+}
+
+func (t TableDiff) columnsDiffer() bool {
+	for _, column := range t.Columns {
+		if column.Kind != "equal" {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+DiffTables compares two CSV or TSV files cell by cell. The delimiter and
+header row of each file are detected as they are for the table preview.
+Rows are matched with the same diff as lines of text, and a changed row
+shows which of its cells changed.
+*/
+func DiffTables(leftFile, rightFile, leftExt, rightExt string) (TableDiff, error) {
+	result := TableDiff{}
+	leftRecords, leftHeader, err := readDiffTable(leftFile, leftExt)
+
+	if err != nil {
+		return result, err
+	}
+
+	rightRecords, rightHeader, err := readDiffTable(rightFile, rightExt)
+
+	if err != nil {
+		return result, err
+	}
+
+	// Only match columns by name when both files have a header, otherwise
+	// a header would be compared against a row of data
+	if leftHeader != nil && rightHeader != nil {
+		result.Columns = matchColumns(leftHeader, rightHeader)
+		leftRecords = leftRecords[1:]
+		rightRecords = rightRecords[1:]
+	} else {
+		result.Columns = positionalColumns(leftRecords, rightRecords)
+	}
+
+	left := alignRecords(leftRecords, result.Columns, func(c TableDiffColumn) int { return c.Left })
+	right := alignRecords(rightRecords, result.Columns, func(c TableDiffColumn) int { return c.Right })
+
+	// The first row of data is line 2 when there is a header
+	firstRow := 1
+
+	if leftHeader != nil && rightHeader != nil {
+		firstRow = 2
+	}
+
+	ops, ok := diffSequences(recordKeys(left), recordKeys(right), MaxDiffEdits)
+
+	if !ok {
+		return result, ErrDiffTooDifferent
+	}
+
+	for _, pair := range pairRows(ops, DiffContext) {
+		switch pair.Kind {
+		case "change":
+			result.Changed++
+		case "delete":
+			result.Deleted++
+		case "insert":
+			result.Inserted++
+		}
+
+		if len(result.Rows) >= MaxDiffRows {
+			result.Truncated = true
+			continue
+		}
+
+		row := TableDiffRow{Kind: pair.Kind, Skipped: pair.Skipped}
+
+		if pair.A >= 0 {
+			row.LeftNumber = pair.A + firstRow
+		}
+
+		if pair.B >= 0 {
+			row.RightNumber = pair.B + firstRow
+		}
+
+		for index := range result.Columns {
+			cell := TableDiffCell{}
+
+			switch pair.Kind {
+			case "change":
+				cell.Left, cell.Right = left[pair.A][index], right[pair.B][index]
+				cell.Changed = cell.Left != cell.Right
+				cell.Value = cell.Left
+			case "insert":
+				cell.Value = right[pair.B][index]
+			case "equal", "delete":
+				cell.Value = left[pair.A][index]
+			}
+
+			row.Cells = append(row.Cells, cell)
+		}
+
+		result.Rows = append(result.Rows, row)
+	}
+
+	return result, nil
+}
+
+/*
+readDiffTable reads every record of a delimited file. The header is
+returned separately as well when one is detected.
+*/
+func readDiffTable(fileName, ext string) ([][]string, []string, error) {
+	content, err := readForDiff(fileName)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sample := content[:min(len(content), sniffSize)]
+	delimiter := Delimiters[sniffDelimiter(sample, ext)]
+	reader := newCSVReader(bytes.NewReader(content), delimiter)
+	records := [][]string{}
+
+	for {
+		record, err := reader.Read()
+
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return nil, nil, fmt.Errorf("error reading row %d: %w", len(records)+1, err)
+		}
+
+		records = append(records, record)
+	}
+
+	if len(records) > 0 && detectHeader(sampleRecords(sample, delimiter)) {
+		return records, records[0], nil
+	}
+
+	return records, nil, nil
+}
+
+/*
+matchColumns lines up columns by header name, in the left file's order
+with columns only on the right added at the end. A name used for more
+than one column is matched in order of appearance.
+*/
+func matchColumns(leftHeader, rightHeader []string) []TableDiffColumn {
+	result := []TableDiffColumn{}
+	rightIndexes := map[string][]int{}
+
+	for index, name := range rightHeader {
+		name = strings.TrimSpace(name)
+		rightIndexes[name] = append(rightIndexes[name], index)
+	}
+
+	used := map[int]bool{}
+
+	for index, name := range leftHeader {
+		name = strings.TrimSpace(name)
+		column := TableDiffColumn{Name: name, Kind: "delete", Left: index, Right: -1}
+
+		if indexes := rightIndexes[name]; len(indexes) > 0 {
+			column.Kind = "equal"
+			column.Right = indexes[0]
+			used[indexes[0]] = true
+			rightIndexes[name] = indexes[1:]
+		}
+
+		result = append(result, column)
+	}
+
+	for index, name := range rightHeader {
+		if !used[index] {
+			result = append(result, TableDiffColumn{Name: strings.TrimSpace(name), Kind: "insert", Left: -1, Right: index})
+		}
+	}
+
+	return result
+}
+
+/*
+positionalColumns matches columns by position for files without a header.
+*/
+func positionalColumns(leftRecords, rightRecords [][]string) []TableDiffColumn {
+	leftWidth, rightWidth := 0, 0
+
+	for _, record := range leftRecords {
+		leftWidth = max(leftWidth, len(record))
+	}
+
+	for _, record := range rightRecords {
+		rightWidth = max(rightWidth, len(record))
+	}
+
+	result := []TableDiffColumn{}
+
+	for index := 0; index < max(leftWidth, rightWidth); index++ {
+		column := TableDiffColumn{Name: fmt.Sprintf("%d", index+1), Kind: "equal", Left: index, Right: index}
+
+		switch {
+		case index >= leftWidth:
+			column.Kind, column.Left = "insert", -1
+		case index >= rightWidth:
+			column.Kind, column.Right = "delete", -1
+		}
+
+		result = append(result, column)
+	}
+
+	return result
+}
+
+/*
+alignRecords reorders each record's values to match columns. Columns the
+file doesn't have are left blank.
+*/
+func alignRecords(records [][]string, columns []TableDiffColumn, source func(TableDiffColumn) int) [][]string {
+	result := make([][]string, len(records))
+
+	for index, record := range records {
+		aligned := make([]string, len(columns))
+
+		for columnIndex, column := range columns {
+			if from := source(column); from >= 0 && from < len(record) {
+				aligned[columnIndex] = record[from]
+			}
+		}
+
+		result[index] = aligned
+	}
+
+	return result
+}
+
+// recordKeys joins each record into a string the diff can compare.
+func recordKeys(records [][]string) []string {
+	result := make([]string, len(records))
+
+	for index, record := range records {
+		result[index] = strings.Join(record, "\x1f")
+	}
+
+	return result
+}
@@ -0,0 +1,133 @@
+package preview
+
+import (
+	"fmt"
+	"strings"
+)
+
+/*
+TextDiff is a side by side, line by line comparison of two text files.
+*/
+type TextDiff struct {
+	Rows              []TextDiffRow
+	Changed           int
+	Deleted           int
+	Inserted          int
+	LineEndingsDiffer bool
+	Truncated         bool
+}
+
+type TextDiffRow struct {
+	Kind        string
+	LeftNumber  int
+	RightNumber int
+	Left        string
+	Right       string
+	Skipped     int
+}
+
+func (t TextDiff) Summary() string {
+	if t.Changed == 0 && t.Deleted == 0 && t.Inserted == 0 {
+		if t.LineEndingsDiffer {
+			return "Lines are identical apart from their line endings"
+		}
+
+		return "Files are identical"
+	}
+
+	result := fmt.Sprintf("%d lines changed, %d removed, %d added", t.Changed, t.Deleted, t.Inserted)
+
+	if t.LineEndingsDiffer {
+		result += ", line endings differ"
+	}
+
+	if t.Truncated {
+		result += fmt.Sprintf(", showing the first %d rows", MaxDiffRows)
+	}
+
+	return result
+}
+
+/*
+DiffText compares two text files line by line. Line endings are ignored
+when matching lines, so a file converted from CRLF to LF only reports
+that its line endings differ.
+*/
+func DiffText(leftFile, rightFile string) (TextDiff, error) {
+	result := TextDiff{}
+	leftContent, err := readForDiff(leftFile)
+
+	if err != nil {
+		return result, err
+	}
+
+	rightContent, err := readForDiff(rightFile)
+
+	if err != nil {
+		return result, err
+	}
+
+	left, leftCR := splitLines(string(leftContent))
+	right, rightCR := splitLines(string(rightContent))
+	result.LineEndingsDiffer = leftCR != rightCR
+
+	ops, ok := diffSequences(left, right, MaxDiffEdits)
+
+	if !ok {
+		return result, ErrDiffTooDifferent
+	}
+
+	for _, pair := range pairRows(ops, DiffContext) {
+		switch pair.Kind {
+		case "change":
+			result.Changed++
+		case "delete":
+			result.Deleted++
+		case "insert":
+			result.Inserted++
+		}
+
+		if len(result.Rows) >= MaxDiffRows {
+			result.Truncated = true
+			continue
+		}
+
+		row := TextDiffRow{Kind: pair.Kind, Skipped: pair.Skipped}
+
+		if pair.A >= 0 {
+			row.LeftNumber = pair.A + 1
+			row.Left = left[pair.A]
+		}
+
+		if pair.B >= 0 {
+			row.RightNumber = pair.B + 1
+			row.Right = right[pair.B]
+		}
+
+		result.Rows = append(result.Rows, row)
+	}
+
+	return result, nil
+}
+
+/*
+splitLines splits text into lines without their endings. The second
+return value is true when any line ended in CRLF.
+*/
+func splitLines(content string) ([]string, bool) {
+	if content == "" {
+		return []string{}, false
+	}
+
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	hasCR := false
+
+	for index, line := range lines {
+		if trimmed, ok := strings.CutSuffix(line, "\r"); ok {
+			lines[index] = trimmed
+			hasCR = true
+		}
+	}
+
+	return lines, hasCR
+}
@@ -0,0 +1,98 @@
+package preview
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiffSequences(t *testing.T) {
+	tests := []struct {
+		name      string
+		a         string
+		b         string
+		maxEdits  int
+		wantEdits int
+		wantOk    bool
+	}{
+		{name: "both empty", a: "", b: "", maxEdits: 10, wantEdits: 0, wantOk: true},
+		{name: "equal", a: "a b c", b: "a b c", maxEdits: 10, wantEdits: 0, wantOk: true},
+		{name: "all inserted", a: "", b: "a b c", maxEdits: 10, wantEdits: 3, wantOk: true},
+		{name: "all deleted", a: "a b c", b: "", maxEdits: 10, wantEdits: 3, wantOk: true},
+		{name: "one changed", a: "a b c", b: "a x c", maxEdits: 10, wantEdits: 2, wantOk: true},
+		{name: "inserted in the middle", a: "a c", b: "a b c", maxEdits: 10, wantEdits: 1, wantOk: true},
+		{name: "moved line", a: "a b c d", b: "b c d a", maxEdits: 10, wantEdits: 2, wantOk: true},
+		{name: "classic example", a: "a b c a b b a", b: "c b a b a c", maxEdits: 10, wantEdits: 5, wantOk: true},
+		{name: "repeated lines", a: "x x x y", b: "y x x x", maxEdits: 10, wantEdits: 2, wantOk: true},
+		{name: "at the edit limit", a: "a b c", b: "x y z", maxEdits: 6, wantEdits: 6, wantOk: true},
+		{name: "over the edit limit", a: "a b c", b: "x y z", maxEdits: 5, wantOk: false},
+		{name: "limit ignores the common ends", a: "s s s a s s s", b: "s s s b s s s", maxEdits: 2, wantEdits: 2, wantOk: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := strings.Fields(tt.a), strings.Fields(tt.b)
+			ops, ok := diffSequences(a, b, tt.maxEdits)
+
+			if ok != tt.wantOk {
+				t.Fatalf("diffSequences ok = %v, want %v", ok, tt.wantOk)
+			}
+
+			if !ok {
+				return
+			}
+
+			edits := checkScript(t, a, b, ops)
+
+			if edits != tt.wantEdits {
+				t.Errorf("diffSequences made %d edits, want %d", edits, tt.wantEdits)
+			}
+		})
+	}
+}
+
+/*
+checkScript checks an edit script walks both sequences in order, that
+equal steps really are equal, and returns the number of edits.
+*/
+func checkScript(t *testing.T, a, b []string, ops []diffOp) int {
+	t.Helper()
+
+	x, y, edits := 0, 0, 0
+
+	for _, op := range ops {
+		switch op.Kind {
+		case "equal":
+			if op.A != x || op.B != y || a[x] != b[y] {
+				t.Fatalf("bad equal step %+v at %d, %d", op, x, y)
+			}
+
+			x++
+			y++
+
+		case "delete":
+			if op.A != x || op.B != -1 {
+				t.Fatalf("bad delete step %+v at %d, %d", op, x, y)
+			}
+
+			x++
+			edits++
+
+		case "insert":
+			if op.B != y || op.A != -1 {
+				t.Fatalf("bad insert step %+v at %d, %d", op, x, y)
+			}
+
+			y++
+			edits++
+
+		default:
+			t.Fatalf("unknown step %+v", op)
+		}
+	}
+
+	if x != len(a) || y != len(b) {
+		t.Fatalf("script ends at %d, %d, want %d, %d", x, y, len(a), len(b))
+	}
+
+	return edits
+}
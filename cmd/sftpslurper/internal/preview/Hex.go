@@ -0,0 +1,473 @@
+package preview
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	HexBytesPerRow  = 16
+	HexBytesPerPage = 4096
+
+	// maxScanSize caps how much of a file is read for the encoding summary
+	maxScanSize = 100 * 1024 * 1024
+)
+
+var (
+	byteOrderMarks = []struct {
+		Name  string
+		Bytes []byte
+	}{
+		// UTF-32 must come before UTF-16, as UTF-32 LE starts with the UTF-16 LE mark
+		{Name: "UTF-32 LE", Bytes: []byte{0xFF, 0xFE, 0x00, 0x00}},
+		{Name: "UTF-32 BE", Bytes: []byte{0x00, 0x00, 0xFE, 0xFF}},
+		{Name: "UTF-8", Bytes: []byte{0xEF, 0xBB, 0xBF}},
+		{Name: "UTF-16 LE", Bytes: []byte{0xFF, 0xFE}},
+		{Name: "UTF-16 BE", Bytes: []byte{0xFE, 0xFF}},
+	}
+
+	hexTemplate = template.Must(template.New("hex").Parse(`<div id="hexPreview">
+   <dl class="hex-summary">
+      <dt>Detected type</dt><dd>{{.ContentType}}</dd>
+      <dt>Size</dt><dd>{{.Size}} bytes</dd>
+      <dt>Byte order mark</dt><dd>{{if .BOM}}{{.BOM}}{{else}}none{{end}}</dd>
+      <dt>Line endings</dt><dd>{{.CRLF}} CRLF, {{.LF}} LF, {{.CR}} CR</dd>
+      <dt>Invalid UTF-8</dt><dd>{{if .InvalidUTF8}}{{.InvalidUTF8}} bytes, first at offset {{printf "0x%08x" .FirstInvalid}}{{else}}none{{end}}</dd>
+      <dt>NUL bytes</dt><dd>{{.NUL}}</dd>
+      {{if .Truncated}}<dt>&nbsp;</dt><dd><small>Summary covers the first 100 MB</small></dd>{{end}}
+   </dl>
+   <pre class="hex-dump">{{range .Rows}}<span class="hex-offset">{{printf "%08x" .Offset}}</span>  {{range .Bytes}}<span class="{{.Class}}">{{.Hex}}</span> {{end}}{{.Padding}} <span class="hex-ascii">{{range .Bytes}}<span class="{{.Class}}">{{.Char}}</span>{{end}}</span>
+{{end}}</pre>
+   <nav class="pagination">
+      <small>Offset {{printf "0x%08x" .Offset}} of {{printf "0x%08x" .Size}}</small>
+      <form hx-get="/preview" hx-target="#hexPreview" hx-swap="outerHTML" class="hex-goto">
+         {{range $key, $value := .Hidden}}<input type="hidden" name="{{$key}}" value="{{$value}}" />{{end}}
+         <input type="text" name="offset" placeholder="Go to offset, e.g. 0x1f40" aria-label="Go to offset" />
+      </form>
+      <ul>
+         {{if gt .Offset 0}}<li><a hx-get="{{.OffsetURL .PreviousOffset}}" hx-target="#hexPreview" hx-swap="outerHTML">&laquo; Previous</a></li>{{end}}
+         {{if .HasNext}}<li><a hx-get="{{.OffsetURL .NextOffset}}" hx-target="#hexPreview" hx-swap="outerHTML">Next &raquo;</a></li>{{end}}
+      </ul>
+   </nav>
+</div>`))
+)
+
+/*
+HexDump is one page of a hex and ASCII dump, plus a summary of the file's
+encoding.
+*/
+type HexDump struct {
+	Hidden       map[string]string
+	ContentType  string
+	Size         int64
+	Offset       int64
+	Rows         []HexRow
+	BOM          string
+	CRLF         int
+	LF           int
+	CR           int
+	NUL          int
+	InvalidUTF8  int
+	FirstInvalid int64
+	Multibyte    int
+	Truncated    bool
+}
+
+type HexRow struct {
+	Offset  int64
+	Bytes   []HexByte
+	Padding string
+}
+
+type HexByte struct {
+	Hex   string
+	Char  string
+	Class string
+}
+
+func (h HexDump) HasNext() bool {
+	return h.Offset+HexBytesPerPage < h.Size
+}
+
+func (h HexDump) PreviousOffset() int64 {
+	return max(h.Offset-HexBytesPerPage, 0)
+}
+
+func (h HexDump) NextOffset() int64 {
+	return h.Offset + HexBytesPerPage
+}
+
+// OffsetURL returns the URL of the page starting at offset.
+func (h HexDump) OffsetURL(offset int64) string {
+	values := url.Values{}
+
+	for key, value := range h.Hidden {
+		values.Set(key, value)
+	}
+
+	values.Set("offset", strconv.FormatInt(offset, 10))
+	return "/preview?" + values.Encode()
+}
+
+/*
+Render writes the dump as an HTML fragment. hidden holds the query values
+that identify the file, so the paginator can load other pages.
+*/
+func (h HexDump) Render(w io.Writer, hidden map[string]string) error {
+	h.Hidden = hidden
+	return hexTemplate.Execute(w, h)
+}
+
+/*
+SniffContentType detects a file's type from its first bytes, ignoring the
+extension.
+*/
+func SniffContentType(fileName string) (string, error) {
+	f, err := os.Open(fileName)
+
+	if err != nil {
+		return "", err
+	}
+
+	defer f.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+
+	return http.DetectContentType(head[:n]), nil
+}
+
+/*
+SummarizeFile reads a file's type, byte order mark, line endings, and
+UTF-8 validity without building a dump.
+*/
+func SummarizeFile(fileName string) (HexDump, error) {
+	f, err := os.Open(fileName)
+
+	if err != nil {
+		return HexDump{}, err
+	}
+
+	defer f.Close()
+
+	info, err := f.Stat()
+
+	if err != nil {
+		return HexDump{}, err
+	}
+
+	result := HexDump{Size: info.Size()}
+	err = result.summarize(f)
+	return result, err
+}
+
+/*
+LineEndings names the line ending style, or lists the counts when a file
+mixes styles.
+*/
+func (h HexDump) LineEndings() string {
+	styles := []string{}
+
+	for _, style := range []struct {
+		Name  string
+		Count int
+	}{{"CRLF", h.CRLF}, {"LF", h.LF}, {"CR", h.CR}} {
+		if style.Count > 0 {
+			styles = append(styles, fmt.Sprintf("%d %s", style.Count, style.Name))
+		}
+	}
+
+	switch len(styles) {
+	case 0:
+		return "none"
+	case 1:
+		return strings.SplitN(styles[0], " ", 2)[1]
+	default:
+		return "mixed (" + strings.Join(styles, ", ") + ")"
+	}
+}
+
+/*
+Encoding guesses the character encoding. It can only tell UTF-8 and ASCII
+apart from everything else, so text that isn't valid UTF-8 is reported as
+a likely single byte encoding.
+*/
+func (h HexDump) Encoding() string {
+	switch {
+	case h.BOM != "":
+		return h.BOM + " with byte order mark"
+	case h.NUL > 0 && !strings.HasPrefix(h.ContentType, "text/"):
+		return "binary"
+	case h.InvalidUTF8 > 0:
+		return "not UTF-8, possibly Windows-1252 or ISO-8859-1"
+	case h.Multibyte == 0:
+		return "ASCII"
+	default:
+		return "UTF-8"
+	}
+}
+
+/*
+ParseOffset accepts decimal offsets and hex offsets starting with 0x.
+*/
+func ParseOffset(value string) int64 {
+	value = strings.ToLower(strings.TrimSpace(value))
+
+	if hexValue, ok := strings.CutPrefix(value, "0x"); ok {
+		result, _ := strconv.ParseInt(hexValue, 16, 64)
+		return max(result, 0)
+	}
+
+	result, _ := strconv.ParseInt(value, 10, 64)
+	return max(result, 0)
+}
+
+/*
+ReadHexDump reads the page of a file starting at offset, which is rounded
+down to a whole row. Byte order marks, line endings, and bytes that are
+not valid UTF-8 are given their own classes so they stand out.
+*/
+func ReadHexDump(fileName string, offset int64) (HexDump, error) {
+	f, err := os.Open(fileName)
+
+	if err != nil {
+		return HexDump{}, err
+	}
+
+	defer f.Close()
+
+	info, err := f.Stat()
+
+	if err != nil {
+		return HexDump{}, err
+	}
+
+	return ReadHexDumpAt(f, info.Size(), offset)
+}
+
+/*
+ReadHexDumpAt is ReadHexDump for content that isn't a file on disk, such
+as an entry buffered from an archive.
+*/
+func ReadHexDumpAt(f io.ReaderAt, size int64, offset int64) (HexDump, error) {
+	result := HexDump{Size: size}
+	result.Offset = min(offset, max(result.Size-1, 0))
+	result.Offset -= result.Offset % HexBytesPerRow
+
+	if err := result.summarize(f); err != nil {
+		return result, err
+	}
+
+	// Read a few bytes before the page so a UTF-8 sequence that starts on
+	// the previous page isn't flagged as invalid
+	lead := min(result.Offset, int64(utf8.UTFMax-1))
+	buffer := make([]byte, HexBytesPerPage+lead+utf8.UTFMax)
+	n, err := f.ReadAt(buffer, result.Offset-lead)
+
+	if err != nil && err != io.EOF {
+		return result, err
+	}
+
+	buffer = buffer[:n]
+	classes := classifyBytes(buffer, result.Offset-lead, result.BOM)
+	page := buffer[lead:min(int64(len(buffer)), lead+HexBytesPerPage)]
+	pageClasses := classes[lead:]
+
+	for start := 0; start < len(page); start += HexBytesPerRow {
+		row := HexRow{Offset: result.Offset + int64(start)}
+		end := min(start+HexBytesPerRow, len(page))
+
+		for index := start; index < end; index++ {
+			b := page[index]
+			char := "."
+
+			if b >= 0x20 && b < 0x7f {
+				char = string(rune(b))
+			}
+
+			row.Bytes = append(row.Bytes, HexByte{Hex: fmt.Sprintf("%02x", b), Char: char, Class: pageClasses[index]})
+		}
+
+		row.Padding = strings.Repeat("   ", HexBytesPerRow-(end-start))
+		result.Rows = append(result.Rows, row)
+	}
+
+	return result, nil
+}
+
+/*
+summarize scans the file for its byte order mark, line endings, NUL bytes,
+and invalid UTF-8.
+*/
+func (h *HexDump) summarize(f io.ReaderAt) error {
+	head := make([]byte, 512)
+	n, err := f.ReadAt(head, 0)
+
+	if err != nil && err != io.EOF {
+		return err
+	}
+
+	head = head[:n]
+	h.ContentType = http.DetectContentType(head)
+
+	for _, bom := range byteOrderMarks {
+		if bytes.HasPrefix(head, bom.Bytes) {
+			h.BOM = bom.Name
+			break
+		}
+	}
+
+	reader := io.NewSectionReader(f, 0, maxScanSize)
+	h.Truncated = h.Size > maxScanSize
+	h.FirstInvalid = -1
+
+	var (
+		base   int64
+		carry  int
+		prevCR bool
+	)
+
+	buffer := make([]byte, 64*1024)
+
+	for {
+		n, err := reader.Read(buffer[carry:])
+
+		if err != nil && err != io.EOF {
+			return err
+		}
+
+		data := buffer[:carry+n]
+		eof := err == io.EOF || n == 0
+		index := 0
+
+		for index < len(data) {
+			b := data[index]
+
+			if b < utf8.RuneSelf {
+				switch {
+				case b == '\n' && prevCR:
+					// the \r was counted alone until its \n turned up
+					h.CR--
+					h.CRLF++
+				case b == '\n':
+					h.LF++
+				case b == '\r':
+					h.CR++
+				case b == 0:
+					h.NUL++
+				}
+
+				prevCR = b == '\r'
+				index++
+				continue
+			}
+
+			prevCR = false
+
+			// Keep an incomplete sequence for the next read
+			if !eof && !utf8.FullRune(data[index:]) {
+				break
+			}
+
+			if r, size := utf8.DecodeRune(data[index:]); r == utf8.RuneError && size <= 1 {
+				h.InvalidUTF8++
+
+				if h.FirstInvalid < 0 {
+					h.FirstInvalid = base + int64(index)
+				}
+
+				index++
+			} else {
+				h.Multibyte++
+				index += size
+			}
+		}
+
+		base += int64(index)
+		carry = copy(buffer, data[index:])
+
+		if eof {
+			break
+		}
+	}
+
+	if h.BOM != "" && h.BOM != "UTF-8" {
+		// UTF-16 and UTF-32 text is never valid UTF-8, so the count is noise
+		h.InvalidUTF8 = 0
+		h.FirstInvalid = -1
+	}
+
+	return nil
+}
+
+/*
+classifyBytes returns a CSS class for each byte. start is the file offset
+of the first byte in buffer.
+*/
+func classifyBytes(buffer []byte, start int64, bomName string) []string {
+	result := make([]string, len(buffer))
+	bomLength := 0
+
+	for _, bom := range byteOrderMarks {
+		if bom.Name == bomName {
+			bomLength = len(bom.Bytes)
+		}
+	}
+
+	index := 0
+
+	// Skip continuation bytes left over from a sequence that began before
+	// the buffer
+	for index < len(buffer) && index < utf8.UTFMax-1 && start > 0 && !utf8.RuneStart(buffer[index]) {
+		result[index] = "hex-byte"
+		index++
+	}
+
+	for index < len(buffer) {
+		offset := start + int64(index)
+		b := buffer[index]
+
+		switch {
+		case offset < int64(bomLength):
+			result[index] = "hex-bom"
+			index++
+			continue
+		case b == '\r' || b == '\n':
+			result[index] = "hex-eol"
+			index++
+			continue
+		case b < utf8.RuneSelf:
+			result[index] = "hex-byte"
+			index++
+			continue
+		}
+
+		r, size := utf8.DecodeRune(buffer[index:])
+
+		// A sequence cut off by the end of the buffer is not an error
+		if r == utf8.RuneError && size <= 1 && utf8.FullRune(buffer[index:]) {
+			result[index] = "hex-invalid"
+			index++
+			continue
+		}
+
+		for i := 0; i < max(size, 1) && index < len(buffer); i++ {
+			result[index] = "hex-multibyte"
+			index++
+		}
+	}
+
+	return result
+}
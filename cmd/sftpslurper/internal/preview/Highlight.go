@@ -0,0 +1,329 @@
+package preview
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+var (
+	xmlTagPattern       = regexp.MustCompile(`^(<[/?!]?)([^\s/>?]*)(.*?)([/?]?>)$`)
+	xmlAttributePattern = regexp.MustCompile(`([^\s=]+)(\s*=\s*)("[^"]*"|'[^']*')`)
+	yamlKeyPattern      = regexp.MustCompile(`^(\s*(?:-\s+)?)([^\s#:'"][^#:]*?|"[^"]*"|'[^']*')(:)(\s|$)`)
+	logTimePattern      = regexp.MustCompile(`^\[?\d{4}[-/]\d{2}[-/]\d{2}[T ]\d{2}:\d{2}:\d{2}(?:[.,]\d+)?(?:Z|[+-]\d{2}:?\d{2})?\]?`)
+	logErrorPattern     = regexp.MustCompile(`(?i)\b(error|err|fatal|panic|critical|severe)\b`)
+	logWarnPattern      = regexp.MustCompile(`(?i)\b(warn|warning)\b`)
+	logInfoPattern      = regexp.MustCompile(`(?i)\b(info|notice)\b`)
+	logDebugPattern     = regexp.MustCompile(`(?i)\b(debug|trace)\b`)
+)
+
+/*
+Highlight escapes text and wraps the interesting parts of a format in
+spans with "hl-" classes. Every byte of the input is escaped, so the
+result is always safe to insert into the page.
+*/
+func Highlight(text, format string) string {
+	switch format {
+	case FormatJSON:
+		return highlightJSON(text)
+	case FormatXML:
+		return highlightXML(text)
+	case FormatYAML:
+		return highlightLines(text, highlightYAMLLine)
+	case FormatEDI:
+		element, _, _ := ediDelimiters(text)
+
+		return highlightLines(text, func(line string) string {
+			return highlightEDILine(line, element)
+		})
+	case FormatLog:
+		return highlightLines(text, highlightLogLine)
+	}
+
+	return html.EscapeString(text)
+}
+
+func span(class, text string) string {
+	return `<span class="hl-` + class + `">` + html.EscapeString(text) + `</span>`
+}
+
+func highlightLines(text string, fn func(line string) string) string {
+	lines := strings.Split(text, "\n")
+
+	for index, line := range lines {
+		lines[index] = fn(line)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func highlightJSON(text string) string {
+	sb := strings.Builder{}
+	index := 0
+
+	for index < len(text) {
+		ch := text[index]
+
+		switch {
+		case ch == '"':
+			end := index + 1
+
+			for end < len(text) && text[end] != '"' {
+				if text[end] == '\\' {
+					end++
+				}
+
+				end++
+			}
+
+			end = min(end+1, len(text))
+			class := "string"
+
+			if next := strings.TrimLeft(text[end:], " \t\r\n"); strings.HasPrefix(next, ":") {
+				class = "key"
+			}
+
+			sb.WriteString(span(class, text[index:end]))
+			index = end
+
+		case ch == '-' || (ch >= '0' && ch <= '9'):
+			end := index + 1
+
+			for end < len(text) && strings.IndexByte("0123456789.eE+-", text[end]) != -1 {
+				end++
+			}
+
+			sb.WriteString(span("number", text[index:end]))
+			index = end
+
+		case strings.HasPrefix(text[index:], "true") || strings.HasPrefix(text[index:], "false") || strings.HasPrefix(text[index:], "null"):
+			end := index + 4
+
+			if ch == 'f' {
+				end++
+			}
+
+			sb.WriteString(span("literal", text[index:end]))
+			index = end
+
+		default:
+			sb.WriteString(html.EscapeString(string(ch)))
+			index++
+		}
+	}
+
+	return sb.String()
+}
+
+func highlightXML(text string) string {
+	sb := strings.Builder{}
+
+	for len(text) > 0 {
+		start := strings.IndexByte(text, '<')
+
+		if start == -1 {
+			sb.WriteString(html.EscapeString(text))
+			break
+		}
+
+		sb.WriteString(html.EscapeString(text[:start]))
+		text = text[start:]
+
+		if strings.HasPrefix(text, "<!--") {
+			end := strings.Index(text, "-->")
+
+			if end == -1 {
+				end = len(text)
+			} else {
+				end += 3
+			}
+
+			sb.WriteString(span("comment", text[:end]))
+			text = text[end:]
+			continue
+		}
+
+		end := strings.IndexByte(text, '>')
+
+		if end == -1 {
+			sb.WriteString(html.EscapeString(text))
+			break
+		}
+
+		sb.WriteString(highlightXMLTag(text[:end+1]))
+		text = text[end+1:]
+	}
+
+	return sb.String()
+}
+
+func highlightXMLTag(tag string) string {
+	parts := xmlTagPattern.FindStringSubmatch(tag)
+
+	if parts == nil {
+		return html.EscapeString(tag)
+	}
+
+	sb := strings.Builder{}
+	sb.WriteString(span("punctuation", parts[1]))
+	sb.WriteString(span("tag", parts[2]))
+
+	attributes := parts[3]
+	last := 0
+
+	for _, match := range xmlAttributePattern.FindAllStringSubmatchIndex(attributes, -1) {
+		sb.WriteString(html.EscapeString(attributes[last:match[0]]))
+		sb.WriteString(span("attribute", attributes[match[2]:match[3]]))
+		sb.WriteString(html.EscapeString(attributes[match[4]:match[5]]))
+		sb.WriteString(span("string", attributes[match[6]:match[7]]))
+		last = match[1]
+	}
+
+	sb.WriteString(html.EscapeString(attributes[last:]))
+	sb.WriteString(span("punctuation", parts[4]))
+	return sb.String()
+}
+
+func highlightYAMLLine(line string) string {
+	trimmed := strings.TrimSpace(line)
+
+	if strings.HasPrefix(trimmed, "#") {
+		return span("comment", line)
+	}
+
+	if trimmed == "---" || trimmed == "..." {
+		return span("punctuation", line)
+	}
+
+	parts := yamlKeyPattern.FindStringSubmatchIndex(line)
+
+	if parts == nil {
+		return html.EscapeString(line)
+	}
+
+	return html.EscapeString(line[:parts[4]]) +
+		span("key", line[parts[4]:parts[5]]) +
+		span("punctuation", line[parts[6]:parts[7]]) +
+		highlightYAMLValue(line[parts[7]:])
+}
+
+func highlightYAMLValue(value string) string {
+	comment := ""
+
+	if index := strings.Index(value, " #"); index != -1 {
+		comment = span("comment", value[index:])
+		value = value[:index]
+	}
+
+	trimmed := strings.TrimSpace(value)
+
+	switch {
+	case trimmed == "":
+		return html.EscapeString(value) + comment
+	case trimmed == "true" || trimmed == "false" || trimmed == "null" || trimmed == "~":
+		return span("literal", value) + comment
+	case strings.HasPrefix(trimmed, `"`) || strings.HasPrefix(trimmed, "'"):
+		return span("string", value) + comment
+	}
+
+	return html.EscapeString(value) + comment
+}
+
+func highlightEDILine(line string, element byte) string {
+	if element == 0 || line == "" {
+		return html.EscapeString(line)
+	}
+
+	segments := strings.Split(line, string(element))
+	sb := strings.Builder{}
+	sb.WriteString(span("tag", segments[0]))
+
+	for _, value := range segments[1:] {
+		sb.WriteString(span("punctuation", string(element)))
+		sb.WriteString(html.EscapeString(value))
+	}
+
+	return sb.String()
+}
+
+func highlightLogLine(line string) string {
+	class := ""
+
+	switch {
+	case logErrorPattern.MatchString(line):
+		class = "log-error"
+	case logWarnPattern.MatchString(line):
+		class = "log-warn"
+	case logDebugPattern.MatchString(line):
+		class = "log-debug"
+	case logInfoPattern.MatchString(line):
+		class = "log-info"
+	}
+
+	markup := html.EscapeString(line)
+
+	if location := logTimePattern.FindStringIndex(line); location != nil {
+		markup = span("time", line[:location[1]]) + html.EscapeString(line[location[1]:])
+	}
+
+	if class == "" {
+		return markup
+	}
+
+	return `<span class="hl-` + class + `">` + markup + `</span>`
+}
+
+/*
+ediDelimiters finds the element separator and segment terminator of an
+X12 or EDIFACT document. X12 declares them in the fixed-width ISA segment
+and EDIFACT in the optional UNA segment. Chunks from the middle of a file
+have no header, so common delimiters are guessed.
+*/
+func ediDelimiters(text string) (element, segment byte, ok bool) {
+	trimmed := strings.TrimLeft(text, " \t\r\n")
+
+	switch {
+	case strings.HasPrefix(trimmed, "ISA") && len(trimmed) >= 106:
+		return trimmed[3], trimmed[105], true
+	case strings.HasPrefix(trimmed, "UNA") && len(trimmed) >= 9:
+		return trimmed[4], trimmed[8], true
+	case strings.HasPrefix(trimmed, "UNB"):
+		return '+', '\'', true
+	case strings.Contains(trimmed, "~") && strings.Contains(trimmed, "*"):
+		return '*', '~', true
+	case strings.Contains(trimmed, "'") && strings.Contains(trimmed, "+"):
+		return '+', '\'', true
+	}
+
+	return 0, 0, false
+}
+
+/*
+splitEDISegments puts each segment of an EDI document on its own line.
+Documents that already use line breaks as terminators are left alone.
+*/
+func splitEDISegments(text string) string {
+	_, segment, ok := ediDelimiters(text)
+
+	if !ok || segment == '\n' || segment == '\r' {
+		return text
+	}
+
+	sb := strings.Builder{}
+
+	for _, part := range strings.SplitAfter(text, string(segment)) {
+		part = strings.TrimLeft(part, "\r\n")
+
+		if part == "" {
+			continue
+		}
+
+		sb.WriteString(part)
+
+		if strings.HasSuffix(part, string(segment)) {
+			sb.WriteByte('\n')
+		}
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,378 @@
+package preview
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	TableRowsPerPage = 100
+
+	sniffSize    = 64 * 1024
+	sniffRecords = 20
+)
+
+var (
+	Delimiters = map[string]rune{
+		"comma":     ',',
+		"tab":       '\t',
+		"semicolon": ';',
+		"pipe":      '|',
+	}
+
+	tableTemplate = template.Must(template.New("table").Parse(`<div id="tablePreview">
+   <form class="table-options" hx-get="/preview" hx-target="#tablePreview" hx-swap="outerHTML" hx-trigger="change">
+      {{range $key, $value := .Hidden}}<input type="hidden" name="{{$key}}" value="{{$value}}" />{{end}}
+      {{if .Sheets}}
+      <label>
+         Sheet
+         <select name="sheet">
+            {{range .Sheets}}<option value="{{.}}" {{if eq . $.Sheet}}selected{{end}}>{{.}}</option>{{end}}
+         </select>
+      </label>
+      {{else}}
+      <label>
+         Delimiter
+         <select name="delimiter">
+            {{range $name, $value := .DelimiterNames}}<option value="{{$name}}" {{if eq $name $.Delimiter}}selected{{end}}>{{$name}}</option>{{end}}
+         </select>
+      </label>
+      {{end}}
+      <label>
+         Header row
+         <select name="header">
+            <option value="yes" {{if .HasHeader}}selected{{end}}>yes</option>
+            <option value="no" {{if not .HasHeader}}selected{{end}}>no</option>
+         </select>
+      </label>
+      <small>{{.RowCount}} rows, {{.ColumnCount}} columns</small>
+   </form>
+   <div class="table-preview">
+      <table class="striped">
+         {{if .HasHeader}}
+         <thead>
+            <tr><th>#</th>{{range .Header}}<th scope="col">{{.}}</th>{{end}}</tr>
+         </thead>
+         {{end}}
+         <tbody>
+            {{range .Rows}}
+            <tr><td><small>{{.Number}}</small></td>{{range .Cells}}<td>{{.}}</td>{{end}}</tr>
+            {{end}}
+         </tbody>
+      </table>
+   </div>
+   <nav class="pagination">
+      <small>Page {{.Page}} of {{.TotalPages}}</small>
+      <ul>
+         {{if gt .Page 1}}<li><a hx-get="{{.PageURL .PreviousPage}}" hx-target="#tablePreview" hx-swap="outerHTML">&laquo; Previous</a></li>{{end}}
+         {{if lt .Page .TotalPages}}<li><a hx-get="{{.PageURL .NextPage}}" hx-target="#tablePreview" hx-swap="outerHTML">Next &raquo;</a></li>{{end}}
+      </ul>
+   </nav>
+</div>`))
+)
+
+/*
+TableOptions are the choices made in the table preview. Blank values are
+detected from the file.
+*/
+type TableOptions struct {
+	Delimiter string
+	Header    string
+	Sheet     string
+	Page      int
+}
+
+/*
+Table is one page of a tabular preview.
+*/
+type Table struct {
+	Hidden      map[string]string
+	Delimiter   string
+	HasHeader   bool
+	Sheets      []string
+	Sheet       string
+	Header      []string
+	Rows        []TableRow
+	RowCount    int
+	ColumnCount int
+	Page        int
+	TotalPages  int
+}
+
+type TableRow struct {
+	Number int
+	Cells  []string
+}
+
+// DelimiterNames is used by the template to list delimiter choices.
+func (t Table) DelimiterNames() map[string]rune {
+	return Delimiters
+}
+
+func (t Table) PreviousPage() int {
+	return t.Page - 1
+}
+
+func (t Table) NextPage() int {
+	return t.Page + 1
+}
+
+// PageURL returns the URL of another page with the same options.
+func (t Table) PageURL(page int) string {
+	values := url.Values{}
+
+	for key, value := range t.Hidden {
+		values.Set(key, value)
+	}
+
+	if t.Sheet != "" {
+		values.Set("sheet", t.Sheet)
+	} else {
+		values.Set("delimiter", t.Delimiter)
+	}
+
+	values.Set("header", map[bool]string{true: "yes", false: "no"}[t.HasHeader])
+	values.Set("page", strconv.Itoa(page))
+	return "/preview?" + values.Encode()
+}
+
+/*
+Render writes the table as an HTML fragment. hidden holds the query
+values that identify the file, so paging and option changes can reload
+the preview.
+*/
+func (t Table) Render(w io.Writer, hidden map[string]string) error {
+	t.Hidden = hidden
+	return tableTemplate.Execute(w, t)
+}
+
+/*
+ReadDelimited reads one page of a CSV, TSV, or other delimited file. The
+delimiter and header row are detected unless set in options.
+*/
+func ReadDelimited(fileName, ext string, options TableOptions) (Table, error) {
+	result := Table{}
+	f, err := os.Open(fileName)
+
+	if err != nil {
+		return result, err
+	}
+
+	defer f.Close()
+
+	reader := bufio.NewReaderSize(f, sniffSize)
+	sample, _ := reader.Peek(sniffSize)
+	sample = []byte(strings.TrimPrefix(string(sample), "\ufeff"))
+
+	if _, ok := Delimiters[options.Delimiter]; ok {
+		result.Delimiter = options.Delimiter
+	} else {
+		result.Delimiter = sniffDelimiter(sample, ext)
+	}
+
+	// Skip a UTF-8 byte order mark so it doesn't end up in the first cell
+	if bom, _ := reader.Peek(3); string(bom) == "\ufeff" {
+		_, _ = reader.Discard(3)
+	}
+
+	csvReader := newCSVReader(reader, Delimiters[result.Delimiter])
+	records := recordSource(func() ([]string, error) {
+		return csvReader.Read()
+	})
+
+	return readTable(result, records, options, func() bool {
+		return detectHeader(sampleRecords(sample, Delimiters[result.Delimiter]))
+	})
+}
+
+/*
+recordSource returns the next record, or io.EOF when there are no more.
+*/
+type recordSource func() ([]string, error)
+
+/*
+readTable pages through records. The header is decided by options, or by
+detect when options don't say.
+*/
+func readTable(result Table, next recordSource, options TableOptions, detect func() bool) (Table, error) {
+	switch options.Header {
+	case "yes":
+		result.HasHeader = true
+	case "no":
+		result.HasHeader = false
+	default:
+		result.HasHeader = detect()
+	}
+
+	result.Page = max(options.Page, 1)
+	start := (result.Page - 1) * TableRowsPerPage
+	end := start + TableRowsPerPage
+	index := 0
+
+	for {
+		record, err := next()
+
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return result, fmt.Errorf("error reading row %d: %w", index+1, err)
+		}
+
+		result.ColumnCount = max(result.ColumnCount, len(record))
+
+		if index == 0 && result.HasHeader && result.Header == nil {
+			result.Header = record
+			continue
+		}
+
+		if index >= start && index < end {
+			result.Rows = append(result.Rows, TableRow{Number: index + 1, Cells: record})
+		}
+
+		index++
+	}
+
+	result.RowCount = index
+	result.TotalPages = max((index+TableRowsPerPage-1)/TableRowsPerPage, 1)
+
+	// Pad short rows so every column lines up under the header
+	for i := range result.Rows {
+		for len(result.Rows[i].Cells) < result.ColumnCount {
+			result.Rows[i].Cells = append(result.Rows[i].Cells, "")
+		}
+	}
+
+	for len(result.Header) > 0 && len(result.Header) < result.ColumnCount {
+		result.Header = append(result.Header, "")
+	}
+
+	return result, nil
+}
+
+func newCSVReader(r io.Reader, delimiter rune) *csv.Reader {
+	reader := csv.NewReader(r)
+	reader.Comma = delimiter
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.ReuseRecord = false
+	return reader
+}
+
+func sampleRecords(sample []byte, delimiter rune) [][]string {
+	reader := newCSVReader(strings.NewReader(string(sample)), delimiter)
+	result := [][]string{}
+
+	for len(result) < sniffRecords {
+		record, err := reader.Read()
+
+		if err != nil {
+			break
+		}
+
+		result = append(result, record)
+	}
+
+	// The last record may have been cut off by the end of the sample
+	if len(result) > 1 && len(sample) >= sniffSize {
+		result = result[:len(result)-1]
+	}
+
+	return result
+}
+
+/*
+sniffDelimiter picks the delimiter that splits the sample into the most
+consistent number of columns. TSV files prefer tabs.
+*/
+func sniffDelimiter(sample []byte, ext string) string {
+	best := "comma"
+	bestScore := 0.0
+
+	if strings.EqualFold(ext, "tsv") {
+		best = "tab"
+	}
+
+	for _, name := range []string{"comma", "tab", "semicolon", "pipe"} {
+		records := sampleRecords(sample, Delimiters[name])
+
+		if len(records) == 0 {
+			continue
+		}
+
+		counts := map[int]int{}
+
+		for _, record := range records {
+			counts[len(record)]++
+		}
+
+		mode, modeCount := 0, 0
+
+		for columns, count := range counts {
+			if count > modeCount || (count == modeCount && columns > mode) {
+				mode, modeCount = columns, count
+			}
+		}
+
+		if mode < 2 {
+			continue
+		}
+
+		// Consistency matters most, then more columns
+		score := float64(modeCount)/float64(len(records))*1000 + float64(mode)
+
+		if score > bestScore {
+			best, bestScore = name, score
+		}
+	}
+
+	return best
+}
+
+/*
+detectHeader guesses whether the first record is a header. It is when every
+value is filled in and not a number, and either a later row has a number
+in a column or the values are all different.
+*/
+func detectHeader(records [][]string) bool {
+	if len(records) == 0 {
+		return false
+	}
+
+	seen := map[string]struct{}{}
+
+	for _, value := range records[0] {
+		value = strings.TrimSpace(value)
+
+		if value == "" || isNumber(value) {
+			return false
+		}
+
+		seen[value] = struct{}{}
+	}
+
+	for _, record := range records[1:] {
+		for _, value := range record {
+			if isNumber(strings.TrimSpace(value)) {
+				return true
+			}
+		}
+	}
+
+	return len(seen) == len(records[0]) && len(records) > 1
+}
+
+func isNumber(value string) bool {
+	value = strings.NewReplacer(",", "", "$", "", "%", "").Replace(value)
+	_, err := strconv.ParseFloat(value, 64)
+	return err == nil
+}
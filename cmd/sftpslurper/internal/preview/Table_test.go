@@ -0,0 +1,54 @@
+package preview
+
+import "testing"
+
+func TestSniffDelimiter(t *testing.T) {
+	tests := []struct {
+		name   string
+		sample string
+		ext    string
+		want   string
+	}{
+		{name: "comma", sample: "id,name,qty\n1,apple,3\n2,pear,5\n", ext: "csv", want: "comma"},
+		{name: "semicolon with decimal commas", sample: "id;price;qty\n1;2,50;3\n2;1,25;5\n", ext: "csv", want: "semicolon"},
+		{name: "tab in a csv file", sample: "id\tname\tqty\n1\tapple\t3\n2\tpear\t5\n", ext: "csv", want: "tab"},
+		{name: "pipe", sample: "id|name|qty\n1|apple|3\n2|pear|5\n", ext: "txt", want: "pipe"},
+		{name: "quoted commas", sample: "id;note\n1;\"a, b, c\"\n2;\"d, e\"\n", ext: "csv", want: "semicolon"},
+		{name: "single column csv", sample: "name\napple\npear\n", ext: "csv", want: "comma"},
+		{name: "single column tsv", sample: "name\napple\npear\n", ext: "TSV", want: "tab"},
+		{name: "empty", sample: "", ext: "csv", want: "comma"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sniffDelimiter([]byte(tt.sample), tt.ext); got != tt.want {
+				t.Errorf("sniffDelimiter = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectHeader(t *testing.T) {
+	tests := []struct {
+		name    string
+		records [][]string
+		want    bool
+	}{
+		{name: "no records", records: nil, want: false},
+		{name: "names over numbers", records: [][]string{{"id", "qty"}, {"1", "3"}}, want: true},
+		{name: "names over text", records: [][]string{{"first", "last"}, {"Ada", "Lovelace"}}, want: true},
+		{name: "numbers in the first row", records: [][]string{{"1", "apple"}, {"2", "pear"}}, want: false},
+		{name: "money in the first row", records: [][]string{{"apple", "$1,250.00"}, {"pear", "$3.00"}}, want: false},
+		{name: "blank value in the first row", records: [][]string{{"id", ""}, {"1", "3"}}, want: false},
+		{name: "repeated text values", records: [][]string{{"yes", "yes"}, {"no", "no"}}, want: false},
+		{name: "single row", records: [][]string{{"first", "last"}}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := detectHeader(tt.records); got != tt.want {
+				t.Errorf("detectHeader(%v) = %v, want %v", tt.records, got, tt.want)
+			}
+		})
+	}
+}
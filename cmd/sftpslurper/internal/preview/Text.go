@@ -0,0 +1,209 @@
+package preview
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+)
+
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+	FormatXML  = "xml"
+	FormatYAML = "yaml"
+	FormatEDI  = "edi"
+	FormatLog  = "log"
+
+	// ChunkSize is how much of a text file is shown at once. Larger files
+	// are loaded a chunk at a time with a "load more" button.
+	ChunkSize = 256 * 1024
+)
+
+var (
+	textFormats = map[string]string{
+		"txt":     FormatText,
+		"text":    FormatText,
+		"md":      FormatText,
+		"json":    FormatJSON,
+		"geojson": FormatJSON,
+		"xml":     FormatXML,
+		"xsd":     FormatXML,
+		"svg":     FormatXML,
+		"yaml":    FormatYAML,
+		"yml":     FormatYAML,
+		"edi":     FormatEDI,
+		"x12":     FormatEDI,
+		"edifact": FormatEDI,
+		"log":     FormatLog,
+	}
+)
+
+/*
+TextFormat returns the text format used to preview files with the given
+extension, without the leading dot.
+*/
+func TextFormat(ext string) (string, bool) {
+	format, ok := textFormats[strings.ToLower(ext)]
+	return format, ok
+}
+
+/*
+TextChunk is one chunk of a text preview. Markup is escaped and
+highlighted HTML. Next is the offset of the following chunk, or 0 when
+the whole file has been read.
+*/
+type TextChunk struct {
+	Markup string
+	Offset int64
+	Next   int64
+	Size   int64
+}
+
+/*
+RenderText reads a chunk of a text file starting at offset and returns it
+escaped and highlighted for the format. A file small enough to fit in one
+chunk is pretty-printed first when the format allows it. Chunks end at a
+line break when possible, so lines are never split between chunks.
+*/
+func RenderText(fileName, format string, offset int64) (TextChunk, error) {
+	f, err := os.Open(fileName)
+
+	if err != nil {
+		return TextChunk{Offset: offset}, err
+	}
+
+	defer f.Close()
+
+	info, err := f.Stat()
+
+	if err != nil {
+		return TextChunk{Offset: offset}, err
+	}
+
+	return RenderTextAt(f, info.Size(), format, offset)
+}
+
+/*
+RenderTextAt is RenderText for content that isn't a file on disk, such as
+an entry buffered from an archive.
+*/
+func RenderTextAt(r io.ReaderAt, size int64, format string, offset int64) (TextChunk, error) {
+	result := TextChunk{Offset: offset, Size: size}
+
+	if offset < 0 || (offset > 0 && offset >= result.Size) {
+		return result, fmt.Errorf("offset %d is outside the file", offset)
+	}
+
+	buffer := make([]byte, ChunkSize)
+	n, err := r.ReadAt(buffer, offset)
+
+	if err != nil && err != io.EOF {
+		return result, err
+	}
+
+	content := buffer[:n]
+	end := offset + int64(n)
+
+	if end < result.Size {
+		if index := bytes.LastIndexByte(content, '\n'); index > 0 {
+			content = content[:index+1]
+			end = offset + int64(index) + 1
+		}
+
+		result.Next = end
+	}
+
+	text := string(content)
+
+	if offset == 0 && result.Next == 0 {
+		text = prettyPrint(text, format)
+	} else if format == FormatEDI {
+		text = splitEDISegments(text)
+	}
+
+	result.Markup = Highlight(text, format)
+	return result, nil
+}
+
+/*
+Header describes how much of the file has been shown so far.
+*/
+func (c TextChunk) Header() string {
+	shown := c.Size
+
+	if c.Next > 0 {
+		shown = c.Next
+	}
+
+	if shown >= c.Size {
+		return humanize.Bytes(uint64(c.Size))
+	}
+
+	return fmt.Sprintf("Showing %s of %s", humanize.Bytes(uint64(shown)), humanize.Bytes(uint64(c.Size)))
+}
+
+/*
+prettyPrint reformats JSON, XML and EDI documents. The original text is
+returned if it can't be parsed.
+*/
+func prettyPrint(text, format string) string {
+	switch format {
+	case FormatJSON:
+		buffer := &bytes.Buffer{}
+
+		if err := json.Indent(buffer, []byte(text), "", "  "); err == nil {
+			return buffer.String()
+		}
+
+	case FormatXML:
+		if pretty, err := indentXML(text); err == nil {
+			return pretty
+		}
+
+	case FormatEDI:
+		return splitEDISegments(text)
+	}
+
+	return text
+}
+
+func indentXML(text string) (string, error) {
+	buffer := &bytes.Buffer{}
+	decoder := xml.NewDecoder(strings.NewReader(text))
+	decoder.Strict = false
+	encoder := xml.NewEncoder(buffer)
+	encoder.Indent("", "  ")
+
+	for {
+		token, err := decoder.RawToken()
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return "", err
+		}
+
+		// Whitespace between elements is replaced by the encoder's indent
+		if data, ok := token.(xml.CharData); ok && len(bytes.TrimSpace(data)) == 0 {
+			continue
+		}
+
+		if err = encoder.EncodeToken(xml.CopyToken(token)); err != nil {
+			return "", err
+		}
+	}
+
+	if err := encoder.Flush(); err != nil {
+		return "", err
+	}
+
+	return buffer.String(), nil
+}
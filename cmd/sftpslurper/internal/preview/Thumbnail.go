@@ -0,0 +1,100 @@
+package preview
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"os"
+	"strings"
+
+	_ "golang.org/x/image/bmp"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	// ThumbnailSize is the longest side of a thumbnail in pixels. It is
+	// twice the displayed size so thumbnails stay sharp on high density
+	// screens.
+	ThumbnailSize = 96
+
+	// maxThumbnailPixels refuses images that would take too much memory
+	// to decode, such as decompression bombs
+	maxThumbnailPixels = 50 * 1000 * 1000
+)
+
+var (
+	thumbnailExtensions = map[string]struct{}{
+		"png":  {},
+		"jpg":  {},
+		"jpeg": {},
+		"gif":  {},
+		"bmp":  {},
+		"webp": {},
+	}
+)
+
+/*
+CanThumbnail returns true for image extensions, without the leading dot,
+that thumbnails can be made from.
+*/
+func CanThumbnail(ext string) bool {
+	_, ok := thumbnailExtensions[strings.ToLower(ext)]
+	return ok
+}
+
+/*
+RenderThumbnail writes a JPEG thumbnail of an image to w. The image is
+scaled to fit ThumbnailSize, keeping its aspect ratio, and never scaled
+up. Transparent areas become white. Only the first frame of an animated
+GIF is used.
+*/
+func RenderThumbnail(fileName string, w io.Writer) error {
+	f, err := os.Open(fileName)
+
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	config, _, err := image.DecodeConfig(f)
+
+	if err != nil {
+		return err
+	}
+
+	if config.Width*config.Height > maxThumbnailPixels {
+		return fmt.Errorf("image is too large to thumbnail (%dx%d)", config.Width, config.Height)
+	}
+
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	source, _, err := image.Decode(f)
+
+	if err != nil {
+		return err
+	}
+
+	bounds := source.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	if width == 0 || height == 0 {
+		return fmt.Errorf("image has no pixels")
+	}
+
+	scale := min(float64(ThumbnailSize)/float64(max(width, height)), 1)
+	target := image.Rect(0, 0, max(int(float64(width)*scale), 1), max(int(float64(height)*scale), 1))
+	thumbnail := image.NewRGBA(target)
+
+	draw.Draw(thumbnail, target, image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.BiLinear.Scale(thumbnail, target, source, bounds, draw.Over, nil)
+
+	return jpeg.Encode(w, thumbnail, &jpeg.Options{Quality: 80})
+}
@@ -0,0 +1,318 @@
+package preview
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+type xlsxWorkbook struct {
+	Sheets []struct {
+		Name string `xml:"name,attr"`
+		ID   string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+type xlsxRelationships struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+type xlsxText struct {
+	T    string `xml:"t"`
+	Runs []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t xlsxText) String() string {
+	if len(t.Runs) == 0 {
+		return t.T
+	}
+
+	sb := strings.Builder{}
+
+	for _, run := range t.Runs {
+		sb.WriteString(run.T)
+	}
+
+	return sb.String()
+}
+
+type xlsxRow struct {
+	Cells []struct {
+		Ref    string   `xml:"r,attr"`
+		Type   string   `xml:"t,attr"`
+		Value  string   `xml:"v"`
+		Inline xlsxText `xml:"is"`
+	} `xml:"c"`
+}
+
+/*
+ReadXlsx reads one page of a sheet in an Excel workbook. It reads the
+workbook's XML directly, so no spreadsheet library is needed. The first
+sheet is used when options don't name one. Formulas show their last
+calculated value and dates show Excel's serial number.
+*/
+func ReadXlsx(fileName string, options TableOptions) (Table, error) {
+	result := Table{}
+	archive, err := zip.OpenReader(fileName)
+
+	if err != nil {
+		return result, fmt.Errorf("not a valid xlsx file: %w", err)
+	}
+
+	defer archive.Close()
+
+	files := map[string]*zip.File{}
+
+	for _, f := range archive.File {
+		files[f.Name] = f
+	}
+
+	workbook := xlsxWorkbook{}
+	relationships := xlsxRelationships{}
+
+	if err = decodeZipXML(files, "xl/workbook.xml", &workbook); err != nil {
+		return result, err
+	}
+
+	if err = decodeZipXML(files, "xl/_rels/workbook.xml.rels", &relationships); err != nil {
+		return result, err
+	}
+
+	if len(workbook.Sheets) == 0 {
+		return result, fmt.Errorf("the workbook has no sheets")
+	}
+
+	sheetPath := ""
+	result.Sheet = workbook.Sheets[0].Name
+
+	for _, sheet := range workbook.Sheets {
+		result.Sheets = append(result.Sheets, sheet.Name)
+
+		if sheet.Name == options.Sheet {
+			result.Sheet = sheet.Name
+		}
+	}
+
+	for _, sheet := range workbook.Sheets {
+		if sheet.Name != result.Sheet {
+			continue
+		}
+
+		for _, rel := range relationships.Relationships {
+			if rel.ID == sheet.ID {
+				sheetPath = resolveXlsxTarget(rel.Target)
+			}
+		}
+	}
+
+	sheetFile, ok := files[sheetPath]
+
+	if !ok {
+		return result, fmt.Errorf("sheet %q not found in workbook", result.Sheet)
+	}
+
+	sharedStrings, err := readSharedStrings(files)
+
+	if err != nil {
+		return result, err
+	}
+
+	header, err := readXlsxRows(sheetFile, sharedStrings, sniffRecords)
+
+	if err != nil {
+		return result, err
+	}
+
+	rc, err := sheetFile.Open()
+
+	if err != nil {
+		return result, err
+	}
+
+	defer rc.Close()
+
+	return readTable(result, xlsxRowSource(xml.NewDecoder(rc), sharedStrings), options, func() bool {
+		return detectHeader(header)
+	})
+}
+
+/*
+resolveXlsxTarget turns a relationship target into a path inside the zip.
+Targets are relative to the xl folder unless they start with a slash.
+*/
+func resolveXlsxTarget(target string) string {
+	if strings.HasPrefix(target, "/") {
+		return strings.TrimPrefix(target, "/")
+	}
+
+	return path.Join("xl", target)
+}
+
+func decodeZipXML(files map[string]*zip.File, name string, v any) error {
+	f, ok := files[name]
+
+	if !ok {
+		return fmt.Errorf("%s is missing from the workbook", name)
+	}
+
+	rc, err := f.Open()
+
+	if err != nil {
+		return err
+	}
+
+	defer rc.Close()
+	return xml.NewDecoder(rc).Decode(v)
+}
+
+func readSharedStrings(files map[string]*zip.File) ([]string, error) {
+	var (
+		sst struct {
+			Items []xlsxText `xml:"si"`
+		}
+	)
+
+	result := []string{}
+
+	// Workbooks with only numbers may have no shared strings at all
+	if _, ok := files["xl/sharedStrings.xml"]; !ok {
+		return result, nil
+	}
+
+	if err := decodeZipXML(files, "xl/sharedStrings.xml", &sst); err != nil {
+		return result, err
+	}
+
+	for _, item := range sst.Items {
+		result = append(result, item.String())
+	}
+
+	return result, nil
+}
+
+func readXlsxRows(f *zip.File, sharedStrings []string, limit int) ([][]string, error) {
+	result := [][]string{}
+	rc, err := f.Open()
+
+	if err != nil {
+		return result, err
+	}
+
+	defer rc.Close()
+
+	next := xlsxRowSource(xml.NewDecoder(rc), sharedStrings)
+
+	for len(result) < limit {
+		row, err := next()
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return result, err
+		}
+
+		result = append(result, row)
+	}
+
+	return result, nil
+}
+
+/*
+xlsxRowSource streams rows from a sheet, so large sheets are never held in
+memory.
+*/
+func xlsxRowSource(decoder *xml.Decoder, sharedStrings []string) recordSource {
+	return func() ([]string, error) {
+		for {
+			token, err := decoder.Token()
+
+			if err != nil {
+				return nil, err
+			}
+
+			start, ok := token.(xml.StartElement)
+
+			if !ok || start.Name.Local != "row" {
+				continue
+			}
+
+			row := xlsxRow{}
+
+			if err = decoder.DecodeElement(&row, &start); err != nil {
+				return nil, err
+			}
+
+			result := []string{}
+
+			for index, cell := range row.Cells {
+				column := index
+
+				if cell.Ref != "" {
+					column = columnIndex(cell.Ref)
+				}
+
+				for len(result) <= column {
+					result = append(result, "")
+				}
+
+				result[column] = cellValue(cell.Type, cell.Value, cell.Inline, sharedStrings)
+			}
+
+			return result, nil
+		}
+	}
+}
+
+func cellValue(cellType, value string, inline xlsxText, sharedStrings []string) string {
+	switch cellType {
+	case "s":
+		index, err := strconv.Atoi(value)
+
+		if err != nil || index < 0 || index >= len(sharedStrings) {
+			return value
+		}
+
+		return sharedStrings[index]
+
+	case "inlineStr":
+		return inline.String()
+
+	case "b":
+		if value == "1" {
+			return "TRUE"
+		}
+
+		return "FALSE"
+	}
+
+	return value
+}
+
+/*
+columnIndex converts a cell reference such as "AB12" to a zero-based
+column number.
+*/
+func columnIndex(ref string) int {
+	result := 0
+
+	for _, ch := range strings.ToUpper(ref) {
+		if ch < 'A' || ch > 'Z' {
+			break
+		}
+
+		result = result*26 + int(ch-'A'+1)
+	}
+
+	return max(result-1, 0)
+}
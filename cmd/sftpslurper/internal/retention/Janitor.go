@@ -0,0 +1,343 @@
+package retention
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/audit"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/configuration"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/hooks"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/versioning"
+)
+
+const (
+	// JanitorUser is the user scheduled purges are audited as
+	JanitorUser = "janitor"
+)
+
+type JanitorConfig struct {
+	Config   *configuration.Config
+	AuditLog *audit.Logger
+	Versions *versioning.Store
+	Hooks    *hooks.Runner
+
+	// Interval is how often the rules are applied. Zero or less turns
+	// the schedule off, though purges can still be run by hand.
+	Interval time.Duration
+}
+
+/*
+Candidate is a file a retention rule would purge, and why.
+*/
+type Candidate struct {
+	Rule    string
+	Path    string
+	Size    int64
+	ModTime time.Time
+	Reason  string
+}
+
+/*
+Janitor purges uploaded files according to the retention rules. Plan is a
+dry run that lists what would be purged, and Purge deletes those files
+and writes each one to the audit log. Files are deleted outright rather
+than moved to the trash, as the point is to free up disk space, along with
+their old copies, last hooks run, and validation report. Folders in the
+upload folder are kept even when empty, as they may be a user's home or
+where a partner drops files.
+*/
+type Janitor struct {
+	mu       sync.Mutex
+	config   *configuration.Config
+	auditLog *audit.Logger
+	versions *versioning.Store
+	hooks    *hooks.Runner
+	interval time.Duration
+}
+
+func NewJanitor(config JanitorConfig) *Janitor {
+	return &Janitor{
+		config:   config.Config,
+		auditLog: config.AuditLog,
+		versions: config.Versions,
+		hooks:    config.Hooks,
+		interval: config.Interval,
+	}
+}
+
+// Rules returns the retention rules.
+func (j *Janitor) Rules() []configuration.RetentionRule {
+	return j.config.RetentionRules
+}
+
+// Interval returns how often the rules are applied, or zero if they
+// aren't applied on a schedule.
+func (j *Janitor) Interval() time.Duration {
+	if len(j.config.RetentionRules) == 0 {
+		return 0
+	}
+
+	return max(j.interval, 0)
+}
+
+/*
+Plan returns the files the rules would purge now, in the order of the
+rules. A file is only listed under the first rule that purges it, and
+files purged by one rule don't count toward the limits of later rules.
+*/
+func (j *Janitor) Plan() ([]Candidate, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.plan(time.Now())
+}
+
+/*
+Purge deletes the files the rules select, writing each to the audit log
+as done by user. It returns the files that were deleted.
+*/
+func (j *Janitor) Purge(user, protocol string) ([]Candidate, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	candidates, err := j.plan(time.Now())
+
+	if err != nil {
+		return nil, err
+	}
+
+	uploadFolderAbs, _ := filepath.Abs(configuration.UploadFolder)
+	result := make([]Candidate, 0, len(candidates))
+
+	for _, candidate := range candidates {
+		started := time.Now()
+		fullPath := filepath.Join(uploadFolderAbs, filepath.FromSlash(candidate.Path))
+		err := os.Remove(fullPath)
+
+		record := audit.Record{
+			Time:      started,
+			User:      user,
+			Protocol:  protocol,
+			Operation: "purge",
+			Path:      candidate.Path,
+			Bytes:     candidate.Size,
+		}
+
+		record.Finish(started, err)
+		j.auditLog.Log(record)
+
+		if err != nil {
+			slog.Error("error purging file", "error", err, "path", candidate.Path, "rule", candidate.Rule)
+			continue
+		}
+
+		j.removed(fullPath)
+		result = append(result, candidate)
+	}
+
+	return result, nil
+}
+
+// removed removes what is kept about a purged file in the system folder
+func (j *Janitor) removed(fullPath string) {
+	if err := j.versions.Removed(fullPath); err != nil {
+		slog.Error("error removing old copies of purged file", "error", err, "path", fullPath)
+	}
+
+	j.hooks.Removed(fullPath)
+}
+
+/*
+StartSchedule applies the rules every interval until the context is
+done. It does nothing when there are no rules or no interval.
+*/
+func (j *Janitor) StartSchedule(ctx context.Context) {
+	interval := j.Interval()
+
+	if interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			purged, err := j.Purge(JanitorUser, audit.ProtocolSystem)
+
+			if err != nil {
+				slog.Error("error applying retention rules", "error", err)
+			} else if len(purged) > 0 {
+				slog.Info("purged files by retention rules", "count", len(purged), "size", TotalSize(purged))
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// TotalSize adds up the size of the candidates.
+func TotalSize(candidates []Candidate) int64 {
+	var result int64
+
+	for _, candidate := range candidates {
+		result += candidate.Size
+	}
+
+	return result
+}
+
+/*
+uploadedFile is a file in the upload folder. Path is slash-separated and
+relative to the upload folder, with a leading slash.
+*/
+type uploadedFile struct {
+	Path    string
+	Size    int64
+	ModTime time.Time
+}
+
+func (j *Janitor) plan(now time.Time) ([]Candidate, error) {
+	result := []Candidate{}
+
+	if len(j.config.RetentionRules) == 0 {
+		return result, nil
+	}
+
+	files, err := uploadedFiles()
+
+	if err != nil {
+		return result, err
+	}
+
+	// Newest first, so limits on count and size keep the newest files
+	slices.SortFunc(files, func(a, b uploadedFile) int {
+		return b.ModTime.Compare(a.ModTime)
+	})
+
+	purged := map[string]bool{}
+
+	for _, rule := range j.config.RetentionRules {
+		home := j.home(rule)
+		kept := 0
+		var keptSize int64
+
+		for _, file := range files {
+			if purged[file.Path] || !ruleApplies(rule, home, file.Path) {
+				continue
+			}
+
+			reason := ""
+
+			switch {
+			case rule.MaxAgeDays > 0 && file.ModTime.Before(now.AddDate(0, 0, -rule.MaxAgeDays)):
+				reason = fmt.Sprintf("older than %d days", rule.MaxAgeDays)
+
+			case rule.KeepNewest > 0 && kept >= rule.KeepNewest:
+				reason = fmt.Sprintf("not one of the newest %d files", rule.KeepNewest)
+
+			case rule.MaxSizeMB > 0 && keptSize+file.Size > int64(rule.MaxSizeMB)*1024*1024:
+				reason = fmt.Sprintf("over the %d MB limit", rule.MaxSizeMB)
+			}
+
+			if reason == "" {
+				kept++
+				keptSize += file.Size
+				continue
+			}
+
+			purged[file.Path] = true
+
+			result = append(result, Candidate{
+				Rule:    rule.Name,
+				Path:    file.Path,
+				Size:    file.Size,
+				ModTime: file.ModTime,
+				Reason:  reason,
+			})
+		}
+	}
+
+	return result, nil
+}
+
+// home returns the home folder a rule is limited to, or blank for all
+func (j *Janitor) home(rule configuration.RetentionRule) string {
+	for _, user := range j.config.Users {
+		if rule.User != "" && user.Name == rule.User {
+			return user.Home
+		}
+	}
+
+	return ""
+}
+
+func ruleApplies(rule configuration.RetentionRule, home, filePath string) bool {
+	relativePath := strings.TrimPrefix(filePath, "/")
+
+	if home != "" && !strings.HasPrefix(relativePath, home+"/") {
+		return false
+	}
+
+	return rule.Path == "" || configuration.MatchGlob(rule.Path, relativePath)
+}
+
+/*
+uploadedFiles returns every file in the upload folder, leaving out the
+system folder.
+*/
+func uploadedFiles() ([]uploadedFile, error) {
+	result := []uploadedFile{}
+	uploadFolderAbs, _ := filepath.Abs(configuration.UploadFolder)
+
+	err := filepath.WalkDir(uploadFolderAbs, func(fullPath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Skip anything that can't be read, such as a file removed
+			// during the walk
+			return nil
+		}
+
+		relativePath, err := configuration.RelativeUploadPath(fullPath)
+
+		if err != nil {
+			// The upload folder itself
+			return nil
+		}
+
+		if configuration.IsSystemPath(relativePath) {
+			return filepath.SkipDir
+		}
+
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := d.Info()
+
+		if err != nil {
+			return nil
+		}
+
+		result = append(result, uploadedFile{
+			Path:    "/" + relativePath,
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		})
+
+		return nil
+	})
+
+	return result, err
+}
@@ -0,0 +1,196 @@
+package search
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/adampresley/adamgokit/httphelpers"
+	"github.com/adampresley/adamgokit/rendering"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/configuration"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/viewmodels"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/webauth"
+	"github.com/dustin/go-humanize"
+)
+
+const (
+	maxResults = 500
+)
+
+type SearchHandlers interface {
+	SearchPage(w http.ResponseWriter, r *http.Request)
+}
+
+type SearchControllerConfig struct {
+	Config   *configuration.Config
+	Renderer rendering.TemplateRenderer
+}
+
+type SearchController struct {
+	config   *configuration.Config
+	renderer rendering.TemplateRenderer
+}
+
+func NewSearchController(config SearchControllerConfig) SearchController {
+	return SearchController{
+		config:   config.Config,
+		renderer: config.Renderer,
+	}
+}
+
+/*
+GET /search?name={name}&ext={ext}&minsize={minsize}&maxsize={maxsize}&since={since}&until={until}&content={content}&regex={regex}&ignorecase={ignorecase}
+*/
+func (c SearchController) SearchPage(w http.ResponseWriter, r *http.Request) {
+	var (
+		err       error
+		criteria  Criteria
+		results   []Result
+		truncated bool
+	)
+
+	pageName := "pages/search"
+
+	viewData := viewmodels.SearchPage{
+		BaseViewModel: viewmodels.BaseViewModel{
+			Version:            c.config.Version,
+			Message:            "",
+			IsHtmx:             httphelpers.IsHtmx(r),
+			Viewer:             webauth.ViewerFromRequest(r),
+			JavascriptIncludes: []rendering.JavascriptInclude{},
+		},
+		Form: viewmodels.SearchForm{
+			Name:       strings.TrimSpace(httphelpers.GetFromRequest[string](r, "name")),
+			Extensions: strings.TrimSpace(httphelpers.GetFromRequest[string](r, "ext")),
+			MinSize:    strings.TrimSpace(httphelpers.GetFromRequest[string](r, "minsize")),
+			MaxSize:    strings.TrimSpace(httphelpers.GetFromRequest[string](r, "maxsize")),
+			Since:      strings.TrimSpace(httphelpers.GetFromRequest[string](r, "since")),
+			Until:      strings.TrimSpace(httphelpers.GetFromRequest[string](r, "until")),
+			Content:    httphelpers.GetFromRequest[string](r, "content"),
+			Regex:      httphelpers.GetFromRequest[bool](r, "regex"),
+			IgnoreCase: httphelpers.GetFromRequest[bool](r, "ignorecase"),
+		},
+		Results: []viewmodels.SearchResult{},
+	}
+
+	if criteria, err = getCriteria(viewData.Form); err != nil {
+		viewData.Message = err.Error()
+		viewData.IsError = true
+
+		c.renderer.Render(pageName, viewData, w)
+		return
+	}
+
+	if criteria.IsEmpty() {
+		c.renderer.Render(pageName, viewData, w)
+		return
+	}
+
+	started := time.Now()
+	viewData.Searched = true
+	criteria.Home = viewData.Viewer.Home
+
+	if results, truncated, err = Find(r.Context(), criteria); err != nil {
+		slog.Error("error searching uploads", "error", err)
+		viewData.Message = fmt.Sprintf("Search failed: %v", err)
+		viewData.IsError = true
+
+		c.renderer.Render(pageName, viewData, w)
+		return
+	}
+
+	for _, result := range results {
+		searchResult := viewmodels.NewSearchResult(result.Path, result.Dir, result.Name, result.IsDir, result.Size, result.ModTime)
+
+		for _, match := range result.Matches {
+			searchResult.Matches = append(searchResult.Matches, viewmodels.SearchMatch{Line: match.Line, Text: match.Text})
+		}
+
+		viewData.Results = append(viewData.Results, searchResult)
+	}
+
+	if truncated {
+		viewData.Message = fmt.Sprintf("Showing the first %d matches. Narrow the search to see more.", maxResults)
+		viewData.IsWarning = true
+	}
+
+	slog.Info("searched uploads", "results", len(results), "truncated", truncated, "elapsed", time.Since(started))
+	c.renderer.Render(pageName, viewData, w)
+}
+
+func getCriteria(form viewmodels.SearchForm) (Criteria, error) {
+	var (
+		err error
+	)
+
+	result := Criteria{
+		Name:       form.Name,
+		Content:    form.Content,
+		Regex:      form.Regex,
+		IgnoreCase: form.IgnoreCase,
+		MaxResults: maxResults,
+	}
+
+	for _, ext := range strings.Split(form.Extensions, ",") {
+		if ext = strings.TrimSpace(ext); ext != "" {
+			result.Extensions = append(result.Extensions, ext)
+		}
+	}
+
+	if result.MinSize, err = parseSize(form.MinSize); err != nil {
+		return result, err
+	}
+
+	if result.MaxSize, err = parseSize(form.MaxSize); err != nil {
+		return result, err
+	}
+
+	if result.Since, err = parseDate(form.Since); err != nil {
+		return result, err
+	}
+
+	if result.Until, err = parseDate(form.Until); err != nil {
+		return result, err
+	}
+
+	// until includes the whole day
+	if !result.Until.IsZero() {
+		result.Until = result.Until.AddDate(0, 0, 1)
+	}
+
+	return result, nil
+}
+
+/*
+parseSize accepts sizes such as "512", "10KB" or "1.5 MiB".
+*/
+func parseSize(value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	size, err := humanize.ParseBytes(value)
+
+	if err != nil {
+		return 0, fmt.Errorf("invalid size '%s'", value)
+	}
+
+	return int64(size), nil
+}
+
+func parseDate(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+
+	if err != nil {
+		return t, errors.New("dates must be in the form YYYY-MM-DD")
+	}
+
+	return t, nil
+}
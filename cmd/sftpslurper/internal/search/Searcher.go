@@ -0,0 +1,270 @@
+package search
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/configuration"
+)
+
+const (
+	// MaxContentSearchSize is the largest file whose content is searched.
+	MaxContentSearchSize = 10 * 1024 * 1024
+
+	maxLineMatches = 3
+	maxLineLength  = 200
+)
+
+/*
+Criteria describes what to look for. Blank or zero fields are ignored. Name
+is matched as a glob when it contains *, ? or [, otherwise as a substring.
+Content is a substring, or a regular expression when Regex is true. Home
+limits the search to a folder inside the upload folder, and results are
+relative to it.
+*/
+type Criteria struct {
+	Home       string
+	Name       string
+	Extensions []string
+	MinSize    int64
+	MaxSize    int64
+	Since      time.Time
+	Until      time.Time
+	Content    string
+	Regex      bool
+	IgnoreCase bool
+	MaxResults int
+}
+
+type Result struct {
+	Path    string
+	Dir     string
+	Name    string
+	IsDir   bool
+	Size    int64
+	ModTime time.Time
+	Matches []LineMatch
+}
+
+type LineMatch struct {
+	Line int
+	Text string
+}
+
+/*
+IsEmpty returns true when no criteria are set, in which case every file
+would match.
+*/
+func (c Criteria) IsEmpty() bool {
+	return c.Name == "" && len(c.Extensions) == 0 && c.MinSize == 0 && c.MaxSize == 0 &&
+		c.Since.IsZero() && c.Until.IsZero() && c.Content == ""
+}
+
+/*
+Find walks the home folder and returns entries that match the criteria,
+up to MaxResults. The second return value is true when the results were
+cut off. Folders are only returned when searching by name or date. The
+walk stops early if ctx is cancelled.
+*/
+func Find(ctx context.Context, criteria Criteria) ([]Result, bool, error) {
+	var (
+		contentPattern *regexp.Regexp
+	)
+
+	result := []Result{}
+	uploadFolderAbs, _ := filepath.Abs(configuration.UploadFolder)
+	homeAbs := filepath.Join(uploadFolderAbs, filepath.FromSlash(criteria.Home))
+	nameGlob := strings.ContainsAny(criteria.Name, "*?[")
+	name := strings.ToLower(criteria.Name)
+	dirsAllowed := len(criteria.Extensions) == 0 && criteria.MinSize == 0 && criteria.MaxSize == 0 && criteria.Content == ""
+
+	if nameGlob {
+		if _, err := path.Match(name, ""); err != nil {
+			return result, false, fmt.Errorf("invalid name pattern '%s'", criteria.Name)
+		}
+	}
+
+	if criteria.Content != "" {
+		expression := criteria.Content
+
+		if !criteria.Regex {
+			expression = regexp.QuoteMeta(expression)
+		}
+
+		if criteria.IgnoreCase {
+			expression = "(?i)" + expression
+		}
+
+		var err error
+
+		if contentPattern, err = regexp.Compile(expression); err != nil {
+			return result, false, fmt.Errorf("invalid content pattern: %w", err)
+		}
+	}
+
+	extensions := make([]string, 0, len(criteria.Extensions))
+
+	for _, ext := range criteria.Extensions {
+		extensions = append(extensions, "."+strings.TrimPrefix(strings.ToLower(ext), "."))
+	}
+
+	truncated := false
+
+	err := filepath.WalkDir(homeAbs, func(fullPath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Unreadable folders are skipped rather than ending the search
+			if d != nil && d.IsDir() {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+
+		relativePath, _ := filepath.Rel(homeAbs, fullPath)
+
+		if relativePath == "." {
+			return nil
+		}
+
+		if configuration.IsSystemPath(filepath.Join(criteria.Home, relativePath)) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		if d.IsDir() && !dirsAllowed {
+			return nil
+		}
+
+		if !d.IsDir() && !d.Type().IsRegular() {
+			return nil
+		}
+
+		lowerName := strings.ToLower(d.Name())
+
+		if name != "" {
+			if nameGlob {
+				if ok, _ := path.Match(name, lowerName); !ok {
+					return nil
+				}
+			} else if !strings.Contains(lowerName, name) {
+				return nil
+			}
+		}
+
+		if len(extensions) > 0 && !slices.Contains(extensions, filepath.Ext(lowerName)) {
+			return nil
+		}
+
+		info, err := d.Info()
+
+		if err != nil {
+			return nil
+		}
+
+		if (criteria.MinSize > 0 && info.Size() < criteria.MinSize) || (criteria.MaxSize > 0 && info.Size() > criteria.MaxSize) {
+			return nil
+		}
+
+		if (!criteria.Since.IsZero() && info.ModTime().Before(criteria.Since)) || (!criteria.Until.IsZero() && !info.ModTime().Before(criteria.Until)) {
+			return nil
+		}
+
+		match := Result{
+			Path:    filepath.ToSlash(relativePath),
+			Dir:     filepath.ToSlash(filepath.Dir(relativePath)),
+			Name:    d.Name(),
+			IsDir:   d.IsDir(),
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		}
+
+		if match.Dir == "." {
+			match.Dir = ""
+		}
+
+		if contentPattern != nil {
+			if info.Size() > MaxContentSearchSize {
+				return nil
+			}
+
+			if match.Matches = grepFile(fullPath, contentPattern); len(match.Matches) == 0 {
+				return nil
+			}
+		}
+
+		if criteria.MaxResults > 0 && len(result) >= criteria.MaxResults {
+			truncated = true
+			return filepath.SkipAll
+		}
+
+		result = append(result, match)
+		return nil
+	})
+
+	return result, truncated, err
+}
+
+/*
+grepFile returns the first few lines of a text file that match pattern.
+Files that look binary are skipped.
+*/
+func grepFile(fileName string, pattern *regexp.Regexp) []LineMatch {
+	result := []LineMatch{}
+	f, err := os.Open(fileName)
+
+	if err != nil {
+		return result
+	}
+
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	head, _ := reader.Peek(8000)
+
+	if bytes.IndexByte(head, 0) != -1 {
+		return result
+	}
+
+	scanner := bufio.NewScanner(io.LimitReader(reader, MaxContentSearchSize))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	lineNumber := 0
+
+	for scanner.Scan() {
+		lineNumber++
+		line := scanner.Text()
+
+		if !pattern.MatchString(line) {
+			continue
+		}
+
+		if len(line) > maxLineLength {
+			line = strings.ToValidUTF8(line[:maxLineLength], "") + "…"
+		}
+
+		result = append(result, LineMatch{Line: lineNumber, Text: line})
+
+		if len(result) >= maxLineMatches {
+			break
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,317 @@
+package sftp
+
+import (
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/configuration"
+)
+
+/*
+AlgorithmProfile is a named set of SSH algorithms the server will offer
+during key exchange. Profiles let us emulate the negotiation behavior of
+servers ranging from hardened modern setups to decade-old appliances.
+*/
+type AlgorithmProfile struct {
+	Ciphers           []string
+	KeyExchanges      []string
+	MACs              []string
+	HostKeyAlgorithms []string
+}
+
+const (
+	DefaultAlgorithmProfile = "compatible"
+)
+
+var (
+	AlgorithmProfiles = map[string]AlgorithmProfile{
+		// compatible is the list this server offered before profiles existed,
+		// less blowfish-cbc, aes192-cbc and aes256-cbc, which the SSH library
+		// can't negotiate and always dropped. The host key algorithms are the
+		// RSA ones the library offered by default for our RSA host key. It
+		// favors modern algorithms but still lets most old clients connect.
+		"compatible": {
+			Ciphers: []string{
+				"chacha20-poly1305@openssh.com",
+				"aes128-gcm@openssh.com",
+				"aes256-gcm@openssh.com",
+				"aes128-ctr",
+				"aes192-ctr",
+				"aes256-ctr",
+				"3des-cbc",
+				"aes128-cbc",
+			},
+			KeyExchanges: []string{
+				"curve25519-sha256@libssh.org",
+				"ecdh-sha2-nistp256",
+				"ecdh-sha2-nistp384",
+				"ecdh-sha2-nistp521",
+				"diffie-hellman-group14-sha1",
+				"diffie-hellman-group1-sha1",
+			},
+			MACs: []string{
+				"hmac-sha2-256-etm@openssh.com",
+				"hmac-sha2-256",
+				"hmac-sha1",
+				"hmac-sha1-96",
+			},
+			HostKeyAlgorithms: []string{
+				"rsa-sha2-256",
+				"rsa-sha2-512",
+				"ssh-rsa",
+			},
+		},
+
+		// modern only offers AEAD ciphers, curve25519 and ETM MACs.
+		"modern": {
+			Ciphers: []string{
+				"chacha20-poly1305@openssh.com",
+				"aes256-gcm@openssh.com",
+				"aes128-gcm@openssh.com",
+			},
+			KeyExchanges: []string{
+				"curve25519-sha256",
+				"curve25519-sha256@libssh.org",
+				"diffie-hellman-group16-sha512",
+			},
+			MACs: []string{
+				"hmac-sha2-512-etm@openssh.com",
+				"hmac-sha2-256-etm@openssh.com",
+			},
+			HostKeyAlgorithms: []string{
+				"ssh-ed25519",
+				"rsa-sha2-512",
+				"rsa-sha2-256",
+			},
+		},
+
+		// openssh-default approximates a stock OpenSSH 9.x sshd, limited to
+		// what golang.org/x/crypto/ssh can negotiate.
+		"openssh-default": {
+			Ciphers: []string{
+				"chacha20-poly1305@openssh.com",
+				"aes128-ctr",
+				"aes192-ctr",
+				"aes256-ctr",
+				"aes128-gcm@openssh.com",
+				"aes256-gcm@openssh.com",
+			},
+			KeyExchanges: []string{
+				"curve25519-sha256",
+				"curve25519-sha256@libssh.org",
+				"ecdh-sha2-nistp256",
+				"ecdh-sha2-nistp384",
+				"ecdh-sha2-nistp521",
+				"diffie-hellman-group16-sha512",
+				"diffie-hellman-group14-sha256",
+			},
+			MACs: []string{
+				"hmac-sha2-256-etm@openssh.com",
+				"hmac-sha2-512-etm@openssh.com",
+				"hmac-sha2-256",
+				"hmac-sha2-512",
+				"hmac-sha1",
+			},
+			HostKeyAlgorithms: []string{
+				"ssh-ed25519",
+				"ecdsa-sha2-nistp256",
+				"rsa-sha2-512",
+				"rsa-sha2-256",
+			},
+		},
+
+		// legacy-2010 emulates an OpenSSH 5.x era server: SHA-1 key exchange,
+		// CBC and arcfour ciphers, and ssh-rsa host keys only.
+		"legacy-2010": {
+			Ciphers: []string{
+				"aes128-ctr",
+				"aes192-ctr",
+				"aes256-ctr",
+				"arcfour256",
+				"arcfour128",
+				"aes128-cbc",
+				"3des-cbc",
+				"arcfour",
+			},
+			KeyExchanges: []string{
+				"diffie-hellman-group14-sha1",
+				"diffie-hellman-group1-sha1",
+			},
+			MACs: []string{
+				"hmac-sha1",
+				"hmac-sha1-96",
+			},
+			HostKeyAlgorithms: []string{
+				"ssh-rsa",
+			},
+		},
+
+		// fips-like restricts everything to NIST-approved primitives.
+		"fips-like": {
+			Ciphers: []string{
+				"aes256-gcm@openssh.com",
+				"aes128-gcm@openssh.com",
+				"aes256-ctr",
+				"aes192-ctr",
+				"aes128-ctr",
+			},
+			KeyExchanges: []string{
+				"ecdh-sha2-nistp256",
+				"ecdh-sha2-nistp384",
+				"ecdh-sha2-nistp521",
+				"diffie-hellman-group16-sha512",
+				"diffie-hellman-group14-sha256",
+			},
+			MACs: []string{
+				"hmac-sha2-256-etm@openssh.com",
+				"hmac-sha2-512-etm@openssh.com",
+				"hmac-sha2-256",
+				"hmac-sha2-512",
+			},
+			HostKeyAlgorithms: []string{
+				"ecdsa-sha2-nistp256",
+				"ecdsa-sha2-nistp384",
+				"rsa-sha2-512",
+				"rsa-sha2-256",
+			},
+		},
+	}
+
+	/*
+	 * These are the algorithms golang.org/x/crypto/ssh knows how to negotiate
+	 * on the server side. The library silently drops anything else, so we
+	 * check custom lists against these and warn instead.
+	 */
+	supportedCiphers = []string{
+		"chacha20-poly1305@openssh.com",
+		"aes128-gcm@openssh.com",
+		"aes256-gcm@openssh.com",
+		"aes128-ctr",
+		"aes192-ctr",
+		"aes256-ctr",
+		"aes128-cbc",
+		"3des-cbc",
+		"arcfour256",
+		"arcfour128",
+		"arcfour",
+	}
+
+	supportedKeyExchanges = []string{
+		"curve25519-sha256",
+		"curve25519-sha256@libssh.org",
+		"ecdh-sha2-nistp256",
+		"ecdh-sha2-nistp384",
+		"ecdh-sha2-nistp521",
+		"diffie-hellman-group16-sha512",
+		"diffie-hellman-group14-sha256",
+		"diffie-hellman-group14-sha1",
+		"diffie-hellman-group1-sha1",
+	}
+
+	supportedMACs = []string{
+		"hmac-sha2-512-etm@openssh.com",
+		"hmac-sha2-256-etm@openssh.com",
+		"hmac-sha2-512",
+		"hmac-sha2-256",
+		"hmac-sha1",
+		"hmac-sha1-96",
+	}
+
+	supportedHostKeyAlgorithms = []string{
+		"ssh-ed25519",
+		"ecdsa-sha2-nistp256",
+		"ecdsa-sha2-nistp384",
+		"ecdsa-sha2-nistp521",
+		"rsa-sha2-512",
+		"rsa-sha2-256",
+		"ssh-rsa",
+	}
+)
+
+/*
+ResolveAlgorithms returns the algorithm lists to offer based on the configured
+profile. Any custom list in the configuration replaces the matching list
+from the profile. Algorithms the SSH library cannot negotiate are dropped
+with a warning.
+*/
+func ResolveAlgorithms(config *configuration.Config) (AlgorithmProfile, error) {
+	profileName := strings.ToLower(strings.TrimSpace(config.SshProfile))
+
+	if profileName == "" {
+		profileName = DefaultAlgorithmProfile
+	}
+
+	profile, ok := AlgorithmProfiles[profileName]
+
+	if !ok {
+		return AlgorithmProfile{}, fmt.Errorf("unknown SSH algorithm profile '%s'. valid profiles are: %s", profileName, strings.Join(AlgorithmProfileNames(), ", "))
+	}
+
+	result := AlgorithmProfile{
+		Ciphers:           pickAlgorithms("cipher", profile.Ciphers, config.SshCiphers, supportedCiphers),
+		KeyExchanges:      pickAlgorithms("key exchange", profile.KeyExchanges, config.SshKeyExchanges, supportedKeyExchanges),
+		MACs:              pickAlgorithms("MAC", profile.MACs, config.SshMACs, supportedMACs),
+		HostKeyAlgorithms: pickAlgorithms("host key", profile.HostKeyAlgorithms, config.SshHostKeyAlgorithms, supportedHostKeyAlgorithms),
+	}
+
+	if len(result.Ciphers) == 0 || len(result.KeyExchanges) == 0 || len(result.MACs) == 0 || len(result.HostKeyAlgorithms) == 0 {
+		return result, fmt.Errorf("SSH algorithm configuration leaves no usable cipher, key exchange, MAC, or host key algorithm")
+	}
+
+	slog.Info("SSH algorithms configured",
+		"profile", profileName,
+		"ciphers", strings.Join(result.Ciphers, ","),
+		"kex", strings.Join(result.KeyExchanges, ","),
+		"macs", strings.Join(result.MACs, ","),
+		"hostkeys", strings.Join(result.HostKeyAlgorithms, ","),
+	)
+
+	return result, nil
+}
+
+// AlgorithmProfileNames returns the names of all built-in profiles, sorted.
+func AlgorithmProfileNames() []string {
+	result := make([]string, 0, len(AlgorithmProfiles))
+
+	for name := range AlgorithmProfiles {
+		result = append(result, name)
+	}
+
+	slices.Sort(result)
+	return result
+}
+
+func pickAlgorithms(kind string, fromProfile []string, custom string, supported []string) []string {
+	source := fromProfile
+
+	if strings.TrimSpace(custom) != "" {
+		source = splitList(custom)
+	}
+
+	result := make([]string, 0, len(source))
+
+	for _, algo := range source {
+		if !slices.Contains(supported, algo) {
+			slog.Warn("unsupported SSH algorithm ignored", "kind", kind, "algorithm", algo)
+			continue
+		}
+
+		result = append(result, algo)
+	}
+
+	return result
+}
+
+func splitList(value string) []string {
+	result := []string{}
+
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			result = append(result, part)
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,104 @@
+package sftp
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/configuration"
+)
+
+func TestResolveAlgorithms(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      configuration.Config
+		wantCiphers []string
+		wantMACs    []string
+		wantErr     bool
+	}{
+		{
+			name:        "blank profile is compatible",
+			config:      configuration.Config{},
+			wantCiphers: AlgorithmProfiles["compatible"].Ciphers,
+			wantMACs:    AlgorithmProfiles["compatible"].MACs,
+		},
+		{
+			name:        "profile name is trimmed and lowercased",
+			config:      configuration.Config{SshProfile: " Modern "},
+			wantCiphers: AlgorithmProfiles["modern"].Ciphers,
+			wantMACs:    AlgorithmProfiles["modern"].MACs,
+		},
+		{
+			name:        "custom list replaces the profile list",
+			config:      configuration.Config{SshProfile: "modern", SshCiphers: "aes128-ctr, aes256-ctr"},
+			wantCiphers: []string{"aes128-ctr", "aes256-ctr"},
+			wantMACs:    AlgorithmProfiles["modern"].MACs,
+		},
+		{
+			name:        "unsupported algorithms are dropped",
+			config:      configuration.Config{SshCiphers: "blowfish-cbc,aes128-ctr"},
+			wantCiphers: []string{"aes128-ctr"},
+			wantMACs:    AlgorithmProfiles["compatible"].MACs,
+		},
+		{
+			name:    "unknown profile",
+			config:  configuration.Config{SshProfile: "ancient"},
+			wantErr: true,
+		},
+		{
+			name:    "nothing usable left",
+			config:  configuration.Config{SshMACs: "hmac-md5"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ResolveAlgorithms(&tt.config)
+
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ResolveAlgorithms = %v, want an error", got)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("ResolveAlgorithms error = %v", err)
+			}
+
+			if !slices.Equal(got.Ciphers, tt.wantCiphers) {
+				t.Errorf("Ciphers = %v, want %v", got.Ciphers, tt.wantCiphers)
+			}
+
+			if !slices.Equal(got.MACs, tt.wantMACs) {
+				t.Errorf("MACs = %v, want %v", got.MACs, tt.wantMACs)
+			}
+		})
+	}
+}
+
+func TestAlgorithmProfilesAreSupported(t *testing.T) {
+	for _, name := range AlgorithmProfileNames() {
+		profile := AlgorithmProfiles[name]
+
+		lists := []struct {
+			kind      string
+			offered   []string
+			supported []string
+		}{
+			{kind: "cipher", offered: profile.Ciphers, supported: supportedCiphers},
+			{kind: "key exchange", offered: profile.KeyExchanges, supported: supportedKeyExchanges},
+			{kind: "MAC", offered: profile.MACs, supported: supportedMACs},
+			{kind: "host key", offered: profile.HostKeyAlgorithms, supported: supportedHostKeyAlgorithms},
+		}
+
+		for _, list := range lists {
+			for _, algo := range list.offered {
+				if !slices.Contains(list.supported, algo) {
+					t.Errorf("profile %s offers unsupported %s %s", name, list.kind, algo)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package sftp
+
+import (
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/audit"
+)
+
+/*
+auditedFile wraps a file handed to the SFTP server for reading or writing.
+It counts bytes transferred and writes an audit record when the transfer
+is closed. The SFTP server calls TransferError if a transfer fails.
+When set, closed is called once with the result of the transfer.
+*/
+type auditedFile struct {
+	file        *os.File
+	record      audit.Record
+	auditLog    *audit.Logger
+	started     time.Time
+	bytes       atomic.Int64
+	transferErr error
+	closeOnce   sync.Once
+	closed      func(err error)
+}
+
+func newAuditedFile(file *os.File, record audit.Record, auditLog *audit.Logger) *auditedFile {
+	return &auditedFile{
+		file:     file,
+		record:   record,
+		auditLog: auditLog,
+		started:  time.Now(),
+	}
+}
+
+// ReadAt implements io.ReaderAt
+func (f *auditedFile) ReadAt(p []byte, off int64) (int, error) {
+	n, err := f.file.ReadAt(p, off)
+	f.bytes.Add(int64(n))
+	return n, err
+}
+
+// WriteAt implements io.WriterAt
+func (f *auditedFile) WriteAt(p []byte, off int64) (int, error) {
+	n, err := f.file.WriteAt(p, off)
+	f.bytes.Add(int64(n))
+	return n, err
+}
+
+// TransferError implements sftp.TransferError
+func (f *auditedFile) TransferError(err error) {
+	f.transferErr = err
+}
+
+// Close implements io.Closer
+func (f *auditedFile) Close() error {
+	err := f.file.Close()
+
+	f.closeOnce.Do(func() {
+		resultErr := f.transferErr
+
+		if resultErr == nil {
+			resultErr = err
+		}
+
+		f.record.Bytes = f.bytes.Load()
+		f.record.Finish(f.started, resultErr)
+		f.auditLog.Log(f.record)
+
+		if f.closed != nil {
+			f.closed(resultErr)
+		}
+	})
+
+	return err
+}
@@ -0,0 +1,341 @@
+package sftp
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/authlog"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/configuration"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// keyRejectionMaxAge is how long a connection is remembered as having
+	// had a public key rejected. Logins take far less.
+	keyRejectionMaxAge = 10 * time.Minute
+)
+
+type AuthenticatorConfig struct {
+	Users   []configuration.User
+	AuthLog *authlog.AttemptLog
+	Guard   *authlog.Guard
+}
+
+/*
+Authenticator verifies SFTP logins against the configured users. It supports
+password, public key, and keyboard-interactive authentication. Users with an
+AuthChain must pass each method in order. Every step but the last answers
+with a partial success, which is how multi-factor servers behave.
+
+Every attempt is recorded in the auth log, and the guard may refuse attempts
+for locked accounts or addresses that exceed the rate limit.
+*/
+type Authenticator struct {
+	users      map[string]configuration.User
+	publicKeys map[string][]ssh.PublicKey
+	authLog    *authlog.AttemptLog
+	guard      *authlog.Guard
+
+	mu            sync.Mutex
+	keyRejections map[string]time.Time
+}
+
+func NewAuthenticator(config AuthenticatorConfig) *Authenticator {
+	result := &Authenticator{
+		users:         map[string]configuration.User{},
+		publicKeys:    map[string][]ssh.PublicKey{},
+		authLog:       config.AuthLog,
+		guard:         config.Guard,
+		keyRejections: map[string]time.Time{},
+	}
+
+	for _, u := range config.Users {
+		result.users[u.Name] = u
+
+		for _, line := range u.PublicKeys {
+			key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(line))
+
+			if err != nil {
+				slog.Error("ignoring invalid public key", "user", u.Name, "error", err)
+				continue
+			}
+
+			result.publicKeys[u.Name] = append(result.publicKeys[u.Name], key)
+		}
+	}
+
+	return result
+}
+
+/*
+Configure sets the authentication callbacks on an SSH server configuration.
+*/
+func (a *Authenticator) Configure(sshConfig *ssh.ServerConfig) {
+	sshConfig.PasswordCallback = func(c ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+		return a.authenticate(c, 0, configuration.AuthMethodPassword, func(user configuration.User) error {
+			return a.checkPassword(user, password)
+		})
+	}
+
+	sshConfig.PublicKeyCallback = func(c ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+		return a.authenticate(c, 0, configuration.AuthMethodPublicKey, func(user configuration.User) error {
+			return a.checkPublicKey(user, key)
+		})
+	}
+
+	sshConfig.KeyboardInteractiveCallback = func(c ssh.ConnMetadata, client ssh.KeyboardInteractiveChallenge) (*ssh.Permissions, error) {
+		return a.authenticate(c, 0, configuration.AuthMethodKeyboardInteractive, func(user configuration.User) error {
+			return a.checkKeyboardInteractive(user, client)
+		})
+	}
+
+	sshConfig.AuthLogCallback = a.logAttempt
+}
+
+/*
+logAttempt is called by the SSH library after every authentication request.
+The initial "none" request most clients send to discover the available
+methods is not recorded.
+
+Rejected public keys count towards a lockout once per connection. Clients
+offer each key in their agent in turn, often only asking whether a key
+would do, so counting every key would lock the account before the right
+one is reached. A client with no right key still counts a failure for
+each connection it makes.
+*/
+func (a *Authenticator) logAttempt(c ssh.ConnMetadata, method string, err error) {
+	var (
+		partialErr *ssh.PartialSuccessError
+	)
+
+	if method == "none" {
+		return
+	}
+
+	attempt := authlog.Attempt{
+		Time:          time.Now(),
+		User:          c.User(),
+		Method:        method,
+		RemoteIP:      remoteIP(c),
+		ClientVersion: string(c.ClientVersion()),
+		Result:        authlog.ResultSuccess,
+	}
+
+	switch {
+	case err == nil:
+		a.guard.RecordSuccess(attempt.User)
+
+	case errors.As(err, &partialErr):
+		attempt.Result = authlog.ResultPartial
+
+	case errors.Is(err, authlog.ErrLocked):
+		attempt.Result = authlog.ResultLocked
+		attempt.Reason = err.Error()
+
+	case errors.Is(err, authlog.ErrRateLimited):
+		attempt.Result = authlog.ResultRateLimited
+		attempt.Reason = err.Error()
+
+	default:
+		attempt.Result = authlog.ResultFailure
+		attempt.Reason = err.Error()
+
+		if method != configuration.AuthMethodPublicKey || a.firstKeyRejection(c) {
+			a.guard.RecordFailure(attempt.User)
+		}
+	}
+
+	a.authLog.Record(attempt)
+}
+
+/*
+firstKeyRejection returns true the first time a public key is rejected on
+a connection, and forgets connections that are long done.
+*/
+func (a *Authenticator) firstKeyRejection(c ssh.ConnMetadata) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := time.Now()
+
+	for id, rejected := range a.keyRejections {
+		if now.Sub(rejected) >= keyRejectionMaxAge {
+			delete(a.keyRejections, id)
+		}
+	}
+
+	id := string(c.SessionID())
+
+	if _, ok := a.keyRejections[id]; ok {
+		return false
+	}
+
+	a.keyRejections[id] = now
+	return true
+}
+
+func (a *Authenticator) authenticate(c ssh.ConnMetadata, step int, method string, check func(user configuration.User) error) (*ssh.Permissions, error) {
+	if err := a.guard.Check(c.User(), remoteIP(c)); err != nil {
+		return nil, err
+	}
+
+	user, ok := a.users[c.User()]
+
+	if !ok {
+		return nil, fmt.Errorf("unknown user %q", c.User())
+	}
+
+	slog.Debug("user is logging in...", "user", c.User(), "method", method, "step", step+1)
+
+	if len(user.AuthChain) > 0 && (step >= len(user.AuthChain) || user.AuthChain[step] != method) {
+		return nil, fmt.Errorf("%s is not accepted at step %d for %q", method, step+1, user.Name)
+	}
+
+	if err := check(user); err != nil {
+		return nil, err
+	}
+
+	if step+1 < len(user.AuthChain) {
+		slog.Info("partial authentication success", "user", user.Name, "method", method, "next", user.AuthChain[step+1])
+		return nil, &ssh.PartialSuccessError{Next: a.nextCallbacks(user, step+1)}
+	}
+
+	return &ssh.Permissions{
+		Extensions: map[string]string{
+			"user": user.Name,
+		},
+	}, nil
+}
+
+/*
+nextCallbacks returns callbacks that only offer the method required at
+the given step of the user's auth chain.
+*/
+func (a *Authenticator) nextCallbacks(user configuration.User, step int) ssh.ServerAuthCallbacks {
+	result := ssh.ServerAuthCallbacks{}
+
+	switch user.AuthChain[step] {
+	case configuration.AuthMethodPassword:
+		result.PasswordCallback = func(c ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			return a.authenticate(c, step, configuration.AuthMethodPassword, func(user configuration.User) error {
+				return a.checkPassword(user, password)
+			})
+		}
+
+	case configuration.AuthMethodPublicKey:
+		result.PublicKeyCallback = func(c ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			return a.authenticate(c, step, configuration.AuthMethodPublicKey, func(user configuration.User) error {
+				return a.checkPublicKey(user, key)
+			})
+		}
+
+	case configuration.AuthMethodKeyboardInteractive:
+		result.KeyboardInteractiveCallback = func(c ssh.ConnMetadata, client ssh.KeyboardInteractiveChallenge) (*ssh.Permissions, error) {
+			return a.authenticate(c, step, configuration.AuthMethodKeyboardInteractive, func(user configuration.User) error {
+				return a.checkKeyboardInteractive(user, client)
+			})
+		}
+	}
+
+	return result
+}
+
+func (a *Authenticator) checkPassword(user configuration.User, password []byte) error {
+	if user.Password == "" || subtle.ConstantTimeCompare([]byte(user.Password), password) != 1 {
+		return fmt.Errorf("password rejected for %q", user.Name)
+	}
+
+	return nil
+}
+
+func (a *Authenticator) checkPublicKey(user configuration.User, key ssh.PublicKey) error {
+	for _, authorized := range a.publicKeys[user.Name] {
+		if bytes.Equal(authorized.Marshal(), key.Marshal()) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("public key rejected for %q", user.Name)
+}
+
+func (a *Authenticator) checkKeyboardInteractive(user configuration.User, client ssh.KeyboardInteractiveChallenge) error {
+	prompts := a.prompts(user)
+
+	if len(prompts) == 0 {
+		return fmt.Errorf("keyboard-interactive is not configured for %q", user.Name)
+	}
+
+	questions := make([]string, 0, len(prompts))
+	echos := make([]bool, 0, len(prompts))
+
+	for _, p := range prompts {
+		questions = append(questions, p.Question)
+		echos = append(echos, p.Echo)
+	}
+
+	answers, err := client(user.Name, "", questions, echos)
+
+	if err != nil {
+		return fmt.Errorf("keyboard-interactive challenge failed for %q: %w", user.Name, err)
+	}
+
+	if len(answers) != len(prompts) {
+		return fmt.Errorf("keyboard-interactive expected %d answers from %q, got %d", len(prompts), user.Name, len(answers))
+	}
+
+	for index, p := range prompts {
+		if p.Totp {
+			if !validateTotp(user.TotpSecret, answers[index]) {
+				return fmt.Errorf("one-time code rejected for %q", user.Name)
+			}
+
+			continue
+		}
+
+		if subtle.ConstantTimeCompare([]byte(p.Answer), []byte(answers[index])) != 1 {
+			return fmt.Errorf("keyboard-interactive answer to %q rejected for %q", p.Question, user.Name)
+		}
+	}
+
+	return nil
+}
+
+/*
+prompts returns the keyboard-interactive questions for a user. If none are
+configured, the user is asked for their password (unless password is its
+own step in the chain) and, when a TOTP secret is set, a one-time code.
+*/
+func (a *Authenticator) prompts(user configuration.User) []configuration.Prompt {
+	if len(user.KeyboardInteractive) > 0 {
+		return user.KeyboardInteractive
+	}
+
+	result := []configuration.Prompt{}
+
+	if user.Password != "" && !slices.Contains(user.AuthChain, configuration.AuthMethodPassword) {
+		result = append(result, configuration.Prompt{Question: "Password: ", Answer: user.Password})
+	}
+
+	if user.TotpSecret != "" {
+		result = append(result, configuration.Prompt{Question: "Verification code: ", Totp: true})
+	}
+
+	return result
+}
+
+func remoteIP(c ssh.ConnMetadata) string {
+	host, _, err := net.SplitHostPort(c.RemoteAddr().String())
+
+	if err != nil {
+		return c.RemoteAddr().String()
+	}
+
+	return host
+}
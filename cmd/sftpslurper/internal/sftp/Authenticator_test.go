@@ -0,0 +1,49 @@
+package sftp
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/authlog"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/configuration"
+)
+
+// fakeConn is the metadata of an SSH connection
+type fakeConn struct {
+	sessionID string
+}
+
+func (f fakeConn) User() string          { return "alice" }
+func (f fakeConn) SessionID() []byte     { return []byte(f.sessionID) }
+func (f fakeConn) ClientVersion() []byte { return []byte("SSH-2.0-test") }
+func (f fakeConn) ServerVersion() []byte { return []byte("SSH-2.0-slurper") }
+func (f fakeConn) RemoteAddr() net.Addr  { return &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 50000} }
+func (f fakeConn) LocalAddr() net.Addr   { return &net.TCPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 2222} }
+
+func TestLogAttemptCountsKeyRejectionsOncePerConnection(t *testing.T) {
+	authLog, err := authlog.NewAttemptLog(authlog.AttemptLogConfig{Size: 10})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	guard := authlog.NewGuard(authlog.GuardConfig{LockoutThreshold: 2})
+	authenticator := NewAuthenticator(AuthenticatorConfig{AuthLog: authLog, Guard: guard})
+	rejected := errors.New("public key not accepted")
+
+	// A client offering three keys on one connection counts once
+	for index := 0; index < 3; index++ {
+		authenticator.logAttempt(fakeConn{sessionID: "first"}, configuration.AuthMethodPublicKey, rejected)
+	}
+
+	if locked := guard.LockedUsers(); len(locked) != 0 {
+		t.Fatalf("LockedUsers after one connection = %v, want none", locked)
+	}
+
+	authenticator.logAttempt(fakeConn{sessionID: "second"}, configuration.AuthMethodPublicKey, rejected)
+
+	if locked := guard.LockedUsers(); len(locked) != 1 || locked[0].Failures != 2 {
+		t.Errorf("LockedUsers after two connections = %v, want alice with 2 failures", locked)
+	}
+}
@@ -2,8 +2,12 @@ package sftp
 
 import (
 	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"log"
@@ -11,75 +15,77 @@ import (
 	"net"
 	"os"
 
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/audit"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/authlog"
 	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/configuration"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/hooks"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/pgp"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/trashbin"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/versioning"
 	"github.com/pkg/sftp"
 	"golang.org/x/crypto/ssh"
 )
 
-func StartServer(config *configuration.Config, shutdownCtx context.Context) {
+type ServerConfig struct {
+	Config   *configuration.Config
+	AuthLog  *authlog.AttemptLog
+	Guard    *authlog.Guard
+	AuditLog *audit.Logger
+	Trash    *trashbin.Bin
+	Versions *versioning.Store
+	Hooks    *hooks.Runner
+	Keyring  *pgp.Keyring
+}
+
+func StartServer(serverConfig ServerConfig, shutdownCtx context.Context) {
+	config := serverConfig.Config
+
 	go func() {
 		var (
-			err      error
-			hostKey  ssh.Signer
-			listener net.Listener
+			err        error
+			algorithms AlgorithmProfile
+			identity   ServerIdentity
+			hostKeys   []ssh.Signer
+			listener   net.Listener
 		)
 
-		// Generate an ephemeral host key.
-		if hostKey, err = generateHostKey(); err != nil {
-			slog.Error("Error generating host key", "error", err)
+		if algorithms, err = ResolveAlgorithms(config); err != nil {
+			slog.Error("Error configuring SSH algorithms", "error", err)
 			os.Exit(1)
 		}
 
-		// Create the SSH server configuration with a PasswordCallback.
-		sshConfig := &ssh.ServerConfig{
-			PasswordCallback: func(c ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
-				slog.Info("user is logging in...", "user", c.User())
-
-				if c.User() == configuration.SftpUserName && string(password) == configuration.SftpPassword {
-					return nil, nil
-				}
+		if identity, err = ResolveServerIdentity(config); err != nil {
+			slog.Error("Error configuring SSH server identity", "error", err)
+			os.Exit(1)
+		}
 
-				return nil, fmt.Errorf("password rejected for %q", c.User())
-			},
+		// Generate ephemeral host keys for the selected host key algorithms.
+		if hostKeys, err = generateHostKeys(algorithms.HostKeyAlgorithms); err != nil {
+			slog.Error("Error generating host key", "error", err)
+			os.Exit(1)
 		}
 
-		// Specify the allowed ciphers.
-		// TODO: This should probably be done a different way.
+		// Create the SSH server configuration with the configured users.
+		sshConfig := &ssh.ServerConfig{}
+
+		NewAuthenticator(AuthenticatorConfig{
+			Users:   config.Users,
+			AuthLog: serverConfig.AuthLog,
+			Guard:   serverConfig.Guard,
+		}).Configure(sshConfig)
 
 		sshConfig.Config = ssh.Config{
-			Ciphers: []string{ // Modern, secure ciphers
-				"chacha20-poly1305@openssh.com",
-				"aes128-gcm@openssh.com",
-				"aes256-gcm@openssh.com",
-				"aes128-ctr",
-				"aes192-ctr",
-				"aes256-ctr",
-
-				// Older ciphers kept for compatibility
-				"3des-cbc",
-				"blowfish-cbc",
-				"aes128-cbc",
-				"aes192-cbc",
-				"aes256-cbc",
-			},
-			KeyExchanges: []string{
-				"curve25519-sha256@libssh.org",
-				"ecdh-sha2-nistp256",
-				"ecdh-sha2-nistp384",
-				"ecdh-sha2-nistp521",
-				"diffie-hellman-group14-sha1",
-				"diffie-hellman-group1-sha1",
-			},
-			MACs: []string{
-				"hmac-sha2-256-etm@openssh.com",
-				"hmac-sha2-256",
-				"hmac-sha1",
-				"hmac-sha1-96",
-			},
+			Ciphers:      algorithms.Ciphers,
+			KeyExchanges: algorithms.KeyExchanges,
+			MACs:         algorithms.MACs,
 		}
 
-		// Add the generated host key to the server configuration.
-		sshConfig.AddHostKey(hostKey)
+		identity.Apply(sshConfig)
+
+		// Add the generated host keys to the server configuration.
+		for _, hostKey := range hostKeys {
+			sshConfig.AddHostKey(hostKey)
+		}
 
 		if listener, err = net.Listen("tcp", config.SftpHost); err != nil {
 			slog.Error("failed to start SFTP server", "host", config.SftpHost, "error", err)
@@ -103,7 +109,7 @@ func StartServer(config *configuration.Config, shutdownCtx context.Context) {
 				}
 
 				// Handle each connection in a separate goroutine
-				go handleConnection(nConn, sshConfig, configuration.UploadFolder)
+				go handleConnection(nConn, sshConfig, serverConfig)
 			}
 		}
 
@@ -111,7 +117,7 @@ func StartServer(config *configuration.Config, shutdownCtx context.Context) {
 	}()
 }
 
-func handleConnection(nConn net.Conn, sshConfig *ssh.ServerConfig, uploadFolder string) {
+func handleConnection(nConn net.Conn, sshConfig *ssh.ServerConfig, serverConfig ServerConfig) {
 	// Perform SSH handshake
 	sshConn, chans, reqs, err := ssh.NewServerConn(nConn, sshConfig)
 
@@ -121,16 +127,52 @@ func handleConnection(nConn net.Conn, sshConfig *ssh.ServerConfig, uploadFolder
 		return
 	}
 
-	slog.Info("new SSH connection", "remote_addr", sshConn.RemoteAddr(), "client_version", sshConn.ClientVersion())
+	sessionID := hex.EncodeToString(sshConn.SessionID())[:12]
+	slog.Info("new SSH connection", "remote_addr", sshConn.RemoteAddr(), "client_version", sshConn.ClientVersion(), "session", sessionID)
+
+	// The user is placed in their home folder, which is made on first login
+	user := userByName(serverConfig.Config.Users, sshConn.User())
+	rootPath, err := serverConfig.Config.SanitizeHomePath(user.Home, "")
+
+	if err != nil {
+		slog.Error("failed to prepare home folder", "error", err, "user", user.Name, "home", user.Home)
+		sshConn.Close()
+		return
+	}
+
+	// Every SFTP subsystem on this connection shares the session details
+	handler := Handler{
+		RootPath:    rootPath,
+		Home:        user.Home,
+		Permissions: user.EffectivePermissions(),
+		SessionID:   sessionID,
+		User:        sshConn.User(),
+		RemoteAddr:  sshConn.RemoteAddr().String(),
+		AuditLog:    serverConfig.AuditLog,
+		Trash:       serverConfig.Trash,
+		Versions:    serverConfig.Versions,
+		Hooks:       serverConfig.Hooks,
+		Keyring:     serverConfig.Keyring,
+	}
 
 	// Discard all global requests
 	go ssh.DiscardRequests(reqs)
 
 	// Handle all channels
-	go handleChannels(chans, uploadFolder)
+	go handleChannels(chans, handler)
+}
+
+func userByName(users []configuration.User, name string) configuration.User {
+	for _, u := range users {
+		if u.Name == name {
+			return u
+		}
+	}
+
+	return configuration.User{Name: name}
 }
 
-func handleChannels(chans <-chan ssh.NewChannel, uploadFolder string) {
+func handleChannels(chans <-chan ssh.NewChannel, handler Handler) {
 	for newChannel := range chans {
 		// Only accept session channels.
 		if newChannel.ChannelType() != "session" {
@@ -146,11 +188,11 @@ func handleChannels(chans <-chan ssh.NewChannel, uploadFolder string) {
 		}
 
 		// Handle session requests in a separate goroutine
-		go handleSessionRequests(channel, requests, uploadFolder)
+		go handleSessionRequests(channel, requests, handler)
 	}
 }
 
-func handleSessionRequests(channel ssh.Channel, requests <-chan *ssh.Request, uploadFolder string) {
+func handleSessionRequests(channel ssh.Channel, requests <-chan *ssh.Request, handler Handler) {
 	defer channel.Close()
 
 	for req := range requests {
@@ -166,14 +208,14 @@ func handleSessionRequests(channel ssh.Channel, requests <-chan *ssh.Request, up
 					req.Reply(true, nil)
 				}
 
-				handler := &Handler{RootPath: uploadFolder}
+				h := &handler
 
 				// Create SFTP server
 				server := sftp.NewRequestServer(channel, sftp.Handlers{
-					FilePut:  handler,
-					FileGet:  handler,
-					FileCmd:  handler,
-					FileList: handler,
+					FilePut:  h,
+					FileGet:  h,
+					FileCmd:  h,
+					FileList: h,
 				})
 
 				slog.Info("starting SFTP server")
@@ -203,8 +245,73 @@ func handleSessionRequests(channel ssh.Channel, requests <-chan *ssh.Request, up
 	}
 }
 
-// generateHostKey creates an ephemeral RSA host key.
-func generateHostKey() (ssh.Signer, error) {
+/*
+generateHostKeys creates an ephemeral host key for each key type needed by
+the requested host key algorithms. RSA keys are restricted to the requested
+signature algorithms so that, for example, a server offering only "ssh-rsa"
+really refuses rsa-sha2-256.
+*/
+func generateHostKeys(algorithms []string) ([]ssh.Signer, error) {
+	var (
+		err    error
+		signer ssh.Signer
+	)
+
+	result := []ssh.Signer{}
+	rsaAlgorithms := []string{}
+
+	for _, algo := range algorithms {
+		switch algo {
+		case ssh.KeyAlgoRSA, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSASHA512:
+			rsaAlgorithms = append(rsaAlgorithms, algo)
+			continue
+
+		case ssh.KeyAlgoED25519:
+			_, key, keyErr := ed25519.GenerateKey(rand.Reader)
+			if keyErr != nil {
+				return nil, fmt.Errorf("failed to generate ed25519 host key: %v", keyErr)
+			}
+
+			signer, err = ssh.NewSignerFromKey(key)
+
+		case ssh.KeyAlgoECDSA256, ssh.KeyAlgoECDSA384, ssh.KeyAlgoECDSA521:
+			curves := map[string]elliptic.Curve{
+				ssh.KeyAlgoECDSA256: elliptic.P256(),
+				ssh.KeyAlgoECDSA384: elliptic.P384(),
+				ssh.KeyAlgoECDSA521: elliptic.P521(),
+			}
+
+			key, keyErr := ecdsa.GenerateKey(curves[algo], rand.Reader)
+			if keyErr != nil {
+				return nil, fmt.Errorf("failed to generate %s host key: %v", algo, keyErr)
+			}
+
+			signer, err = ssh.NewSignerFromKey(key)
+
+		default:
+			return nil, fmt.Errorf("unsupported host key algorithm: %s", algo)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to create signer: %v", err)
+		}
+
+		result = append(result, signer)
+	}
+
+	if len(rsaAlgorithms) > 0 {
+		if signer, err = generateRSAHostKey(rsaAlgorithms); err != nil {
+			return nil, err
+		}
+
+		result = append(result, signer)
+	}
+
+	return result, nil
+}
+
+// generateRSAHostKey creates an ephemeral RSA host key limited to the given signature algorithms.
+func generateRSAHostKey(algorithms []string) (ssh.Signer, error) {
 	key, err := rsa.GenerateKey(rand.Reader, 2048)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate host key: %v", err)
@@ -213,5 +320,9 @@ func generateHostKey() (ssh.Signer, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to create signer: %v", err)
 	}
-	return signer, nil
+	algorithmSigner, ok := signer.(ssh.AlgorithmSigner)
+	if !ok {
+		return signer, nil
+	}
+	return ssh.NewSignerWithAlgorithms(algorithmSigner, algorithms)
 }
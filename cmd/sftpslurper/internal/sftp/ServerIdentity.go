@@ -0,0 +1,134 @@
+package sftp
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/configuration"
+	"golang.org/x/crypto/ssh"
+)
+
+/*
+ServerIdentityPreset mimics how a particular vendor's SFTP server
+identifies itself. Some client libraries branch on the identification
+string, so these let us reproduce vendor-specific quirks.
+*/
+type ServerIdentityPreset struct {
+	Version string
+	Banner  string
+}
+
+var (
+	ServerIdentityPresets = map[string]ServerIdentityPreset{
+		"golang": {
+			Version: "SSH-2.0-Go",
+		},
+		"openssh-ubuntu": {
+			Version: "SSH-2.0-OpenSSH_8.9p1 Ubuntu-3ubuntu0.10",
+		},
+		"openssh-legacy": {
+			Version: "SSH-2.0-OpenSSH_5.3",
+		},
+		"proftpd": {
+			Version: "SSH-2.0-mod_sftp",
+		},
+		"serv-u": {
+			Version: "SSH-2.0-Serv-U_15.4.2.126",
+		},
+		"goanywhere": {
+			Version: "SSH-2.0-GoAnywhere7.4.1",
+			Banner:  "Authorized users only. All activity may be monitored and reported.\n",
+		},
+	}
+)
+
+/*
+ServerIdentity is the resolved version string and pre-authentication banner
+the SSH server presents to clients.
+*/
+type ServerIdentity struct {
+	Version string
+	Banner  string
+}
+
+/*
+ResolveServerIdentity builds the server identity from the configured preset,
+then applies any explicit version or banner overrides. A banner file takes
+precedence over a banner string.
+*/
+func ResolveServerIdentity(config *configuration.Config) (ServerIdentity, error) {
+	result := ServerIdentity{}
+	presetName := strings.ToLower(strings.TrimSpace(config.SshServerPreset))
+
+	if presetName != "" {
+		preset, ok := ServerIdentityPresets[presetName]
+
+		if !ok {
+			return result, fmt.Errorf("unknown SSH server preset '%s'. valid presets are: %s", presetName, strings.Join(ServerIdentityPresetNames(), ", "))
+		}
+
+		result.Version = preset.Version
+		result.Banner = preset.Banner
+	}
+
+	if version := strings.TrimSpace(config.SshServerVersion); version != "" {
+		result.Version = version
+	}
+
+	if result.Version != "" && !strings.HasPrefix(result.Version, "SSH-2.0-") {
+		return result, fmt.Errorf("SSH server version must start with 'SSH-2.0-': %s", result.Version)
+	}
+
+	if config.SshBanner != "" {
+		result.Banner = strings.ReplaceAll(config.SshBanner, `\n`, "\n")
+	}
+
+	if config.SshBannerFile != "" {
+		b, err := os.ReadFile(config.SshBannerFile)
+
+		if err != nil {
+			return result, fmt.Errorf("error reading SSH banner file: %w", err)
+		}
+
+		result.Banner = string(b)
+	}
+
+	if result.Banner != "" && !strings.HasSuffix(result.Banner, "\n") {
+		result.Banner += "\n"
+	}
+
+	slog.Info("SSH server identity configured", "preset", presetName, "version", result.Version, "hasBanner", result.Banner != "")
+	return result, nil
+}
+
+// ServerIdentityPresetNames returns the names of all built-in presets, sorted.
+func ServerIdentityPresetNames() []string {
+	result := make([]string, 0, len(ServerIdentityPresets))
+
+	for name := range ServerIdentityPresets {
+		result = append(result, name)
+	}
+
+	slices.Sort(result)
+	return result
+}
+
+/*
+Apply sets the version and banner callback on an SSH server configuration.
+An empty version leaves the library default in place.
+*/
+func (si ServerIdentity) Apply(sshConfig *ssh.ServerConfig) {
+	sshConfig.ServerVersion = si.Version
+
+	if si.Banner == "" {
+		return
+	}
+
+	sshConfig.BannerCallback = func(conn ssh.ConnMetadata) string {
+		slog.Debug("sending pre-auth banner", "user", conn.User(), "remote_addr", conn.RemoteAddr())
+		return si.Banner
+	}
+}
@@ -3,45 +3,99 @@ package sftp
 import (
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
+	"strings"
 	"time"
 
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/audit"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/configuration"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/hooks"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/pgp"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/trashbin"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/versioning"
 	"github.com/pkg/sftp"
 )
 
 /*
- * Handler implements all the required SFTP interfaces
- * for putting, listing, getting, and deleting files.
+ * Handler implements the SFTP interfaces for the user's
+ * home folder at RootPath, refusing requests the user
+ * lacks permission for. Closed uploads go to the hooks.
  */
 type Handler struct {
-	RootPath string
+	RootPath    string
+	Home        string
+	Permissions []string
+	SessionID   string
+	User        string
+	RemoteAddr  string
+	AuditLog    *audit.Logger
+	Trash       *trashbin.Bin
+	Versions    *versioning.Store
+	Hooks       *hooks.Runner
+	Keyring     *pgp.Keyring
 }
 
 // Fileread implements sftp.FileReader
 func (h *Handler) Fileread(r *sftp.Request) (io.ReaderAt, error) {
-	log.Printf("Read request for: %s", r.Filepath)
+	slog.Debug("read request", "path", r.Filepath, "session", h.SessionID)
 
 	// Construct the full path for the file
 	filePath := filepath.Join(h.RootPath, r.Filepath)
+	record := h.newRecord("read", r)
+
+	if err := h.check(r, configuration.PermissionRead); err != nil {
+		h.log(record, time.Now(), err)
+		return nil, err
+	}
+
+	if h.Keyring.EncryptsReads(filePath) {
+		return h.encryptedRead(filePath, record)
+	}
 
 	// Open the file for reading
 	file, err := os.Open(filePath)
 	if err != nil {
-		log.Printf("Failed to open file for reading: %v", err)
+		slog.Error("failed to open file for reading", "error", err, "path", filePath)
+		h.log(record, time.Now(), err)
 		return nil, err
 	}
 
-	return file, nil
+	return newAuditedFile(file, record, h.AuditLog), nil
+}
+
+/*
+encryptedRead serves a copy of the file encrypted to the keyring's
+recipient. It is the same copy Stat and List report the size of.
+*/
+func (h *Handler) encryptedRead(filePath string, record audit.Record) (io.ReaderAt, error) {
+	file, err := h.Keyring.OpenEncrypted(filePath)
+	if err != nil {
+		slog.Error("failed to encrypt file for reading", "error", err, "path", filePath)
+		h.log(record, time.Now(), err)
+		return nil, err
+	}
+
+	slog.Debug("serving encrypted copy", "path", filePath, "recipient", h.Keyring.Recipient(), "session", h.SessionID)
+	return newAuditedFile(file, record, h.AuditLog), nil
 }
 
 // Filewrite implements sftp.FileWriter
 func (h *Handler) Filewrite(r *sftp.Request) (io.WriterAt, error) {
-	log.Printf("Write request for: %s", r.Filepath)
+	slog.Debug("write request", "path", r.Filepath, "session", h.SessionID)
+	record := h.newRecord("write", r)
+
+	if err := h.check(r, configuration.PermissionWrite); err != nil {
+		h.log(record, time.Now(), err)
+		return nil, err
+	}
 
 	// Create the upload directory if it doesn't exist
 	if err := os.MkdirAll(h.RootPath, 0755); err != nil {
+		h.log(record, time.Now(), err)
 		return nil, err
 	}
 
@@ -51,24 +105,57 @@ func (h *Handler) Filewrite(r *sftp.Request) (io.WriterAt, error) {
 	// Create the directory structure if it doesn't exist
 	dirPath := filepath.Dir(filePath)
 	if err := os.MkdirAll(dirPath, 0755); err != nil {
+		h.log(record, time.Now(), err)
+		return nil, err
+	}
+
+	// Keep the old copy or pick a new name if the file exists
+	writePath, err := h.Versions.Prepare(filePath)
+	if err != nil {
+		slog.Error("failed to apply collision policy", "error", err, "path", filePath)
+		h.log(record, time.Now(), err)
 		return nil, err
 	}
 
-	log.Printf("Writing file to: %s", filePath)
+	if writePath != filePath {
+		record.Path = path.Join(path.Dir(record.Path), filepath.Base(writePath))
+		filePath = writePath
+	}
+
+	slog.Info("writing file", "path", filePath, "user", h.User)
 
 	// Create and return the file
 	file, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
 	if err != nil {
-		log.Printf("Failed to open file for writing: %v", err)
+		slog.Error("failed to open file for writing", "error", err, "path", filePath)
+		h.log(record, time.Now(), err)
 		return nil, err
 	}
 
-	return file, nil
+	result := newAuditedFile(file, record, h.AuditLog)
+	result.closed = func(err error) {
+		if err == nil {
+			h.Hooks.Uploaded(filePath, h.User)
+		}
+	}
+
+	return result, nil
 }
 
 // Filecmd implements sftp.FileCmder
-func (h *Handler) Filecmd(r *sftp.Request) error {
-	log.Printf("Command request: %s on %s", r.Method, r.Filepath)
+func (h *Handler) Filecmd(r *sftp.Request) (err error) {
+	slog.Debug("command request", "method", r.Method, "path", r.Filepath, "session", h.SessionID)
+
+	started := time.Now()
+	record := h.newRecord(r.Method, r)
+
+	defer func() {
+		h.log(record, started, err)
+	}()
+
+	if err = h.check(r, commandPermissions[r.Method]); err != nil {
+		return err
+	}
 
 	// Construct the full path
 	path := filepath.Join(h.RootPath, r.Filepath)
@@ -76,7 +163,7 @@ func (h *Handler) Filecmd(r *sftp.Request) error {
 	switch r.Method {
 	case "Setstat", "Setattr":
 		// Handle file attribute changes (we'll just log it for now)
-		log.Printf("Setstat/Setattr called on %s. This is not implemented", path)
+		slog.Info("Setstat/Setattr called. This is not implemented", "path", path)
 		return nil
 
 	case "Rename":
@@ -84,34 +171,46 @@ func (h *Handler) Filecmd(r *sftp.Request) error {
 		// Todo: ensure we don't rename things outside the root directory
 		oldPath := path
 		newPath := filepath.Join(h.RootPath, r.Target)
-		log.Printf("Renaming %s to %s", oldPath, newPath)
-		return os.Rename(oldPath, newPath)
+		slog.Info("renaming", "from", oldPath, "to", newPath)
+
+		if err = os.Rename(oldPath, newPath); err != nil {
+			return err
+		}
+
+		// Old copies, the last hooks run, and the validation report go
+		// with the file
+		if versionsErr := h.Versions.Moved(oldPath, newPath); versionsErr != nil {
+			slog.Error("error moving old copies", "error", versionsErr, "from", oldPath, "to", newPath)
+		}
+
+		h.Hooks.Moved(oldPath, newPath)
+		return nil
 
 	case "Rmdir":
-		// Handle remove directory.
+		// Handle remove directory. Only empty directories can be removed,
+		// so there is nothing to keep in the trash.
 		// Todo: ensure we don't remove the root directory or higher
 		// as a security measure.
-		log.Printf("Removing directory %s", path)
+		slog.Info("removing directory", "path", path)
 		return os.Remove(path)
 
 	case "Mkdir":
 		// Handle make directory
 		// Todo: ensure we don't make things outside the root directory
-		log.Printf("Creating directory %s", path)
+		slog.Info("creating directory", "path", path)
 		return os.MkdirAll(path, 0755)
 
 	case "Remove", "Rm":
-		// Handle remove file
-		// Todo: ensure we don't remove things outside the root directory
-		log.Printf("Removing file %s", path)
-		return os.Remove(path)
+		// Handle remove file by moving it to the trash
+		slog.Info("removing file", "path", path)
+		_, err = h.Trash.Move(path, filepath.Join(h.Home, r.Filepath), h.User, audit.ProtocolSftp)
+		return err
 
 	case "Symlink":
-		// Handle symlink creation
-		oldPath := path
-		newPath := filepath.Join(h.RootPath, r.Target)
-		log.Printf("Creating symlink from %s to %s", oldPath, newPath)
-		return os.Symlink(oldPath, newPath)
+		// Links could lead out of the home folder or into the system
+		// folder, so they can't be made
+		slog.Info("refusing to create symlink", "from", path, "to", filepath.Join(h.RootPath, r.Target))
+		return sftp.ErrSSHFxOpUnsupported
 
 	default:
 		return fmt.Errorf("unsupported command method: %s", r.Method)
@@ -119,8 +218,19 @@ func (h *Handler) Filecmd(r *sftp.Request) error {
 }
 
 // Filelist implements sftp.FileLister
-func (h *Handler) Filelist(r *sftp.Request) (sftp.ListerAt, error) {
-	log.Printf("List request for: %s", r.Filepath)
+func (h *Handler) Filelist(r *sftp.Request) (lister sftp.ListerAt, err error) {
+	slog.Debug("list request", "method", r.Method, "path", r.Filepath, "session", h.SessionID)
+
+	started := time.Now()
+	record := h.newRecord(r.Method, r)
+
+	defer func() {
+		h.log(record, started, err)
+	}()
+
+	if err = h.check(r, listPermissions[r.Method]); err != nil {
+		return nil, err
+	}
 
 	// Construct the full path
 	path := filepath.Join(h.RootPath, r.Filepath)
@@ -146,12 +256,16 @@ func (h *Handler) Filelist(r *sftp.Request) (sftp.ListerAt, error) {
 		// Convert to FileInfo slice
 		fileInfos := make([]os.FileInfo, 0, len(entries))
 		for _, entry := range entries {
+			if configuration.IsSystemPath(filepath.Join(h.Home, r.Filepath, entry.Name())) {
+				continue
+			}
+
 			info, err := entry.Info()
 			if err != nil {
-				log.Printf("Error getting info for %s: %v", entry.Name(), err)
+				slog.Error("error getting file info", "name", entry.Name(), "error", err)
 				continue
 			}
-			fileInfos = append(fileInfos, info)
+			fileInfos = append(fileInfos, h.listedInfo(filepath.Join(path, entry.Name()), info))
 		}
 
 		return ListerAt(fileInfos), nil
@@ -163,7 +277,7 @@ func (h *Handler) Filelist(r *sftp.Request) (sftp.ListerAt, error) {
 			return nil, err
 		}
 
-		return ListerAt([]os.FileInfo{fi}), nil
+		return ListerAt([]os.FileInfo{h.listedInfo(path, fi)}), nil
 
 	case "Readlink":
 		// Read the target of a symlink
@@ -188,6 +302,108 @@ func (h *Handler) Filelist(r *sftp.Request) (sftp.ListerAt, error) {
 	}
 }
 
+var (
+	// commandPermissions are the permissions needed for each file command
+	commandPermissions = map[string]string{
+		"Setstat": configuration.PermissionWrite,
+		"Setattr": configuration.PermissionWrite,
+		"Rename":  configuration.PermissionRename,
+		"Rmdir":   configuration.PermissionDelete,
+		"Mkdir":   configuration.PermissionWrite,
+		"Remove":  configuration.PermissionDelete,
+		"Rm":      configuration.PermissionDelete,
+		"Symlink": configuration.PermissionWrite,
+	}
+
+	// listPermissions are the permissions needed for each list method.
+	// Stat is always allowed, as clients stat paths before doing anything.
+	listPermissions = map[string]string{
+		"List":     configuration.PermissionList,
+		"Readlink": configuration.PermissionList,
+	}
+)
+
+/*
+check refuses any request that touches the server's system folder, that
+follows a link out of the home folder, or that needs a permission the user
+doesn't have.
+*/
+func (h *Handler) check(r *sftp.Request, permission string) error {
+	if configuration.IsSystemPath(path.Join(h.Home, r.Filepath)) || (r.Target != "" && configuration.IsSystemPath(path.Join(h.Home, r.Target))) {
+		return os.ErrPermission
+	}
+
+	for _, requested := range []string{r.Filepath, r.Target} {
+		if requested == "" {
+			continue
+		}
+
+		if err := configuration.CheckRealPath(h.RootPath, filepath.Join(h.RootPath, requested)); err != nil {
+			slog.Warn("sftp request denied", "user", h.User, "method", r.Method, "path", requested, "error", err, "session", h.SessionID)
+			return os.ErrPermission
+		}
+	}
+
+	if permission != "" && !slices.Contains(h.Permissions, permission) {
+		slog.Info("sftp request denied", "user", h.User, "method", r.Method, "path", r.Filepath, "permission", permission, "session", h.SessionID)
+		return os.ErrPermission
+	}
+
+	return nil
+}
+
+func (h *Handler) newRecord(operation string, r *sftp.Request) audit.Record {
+	result := audit.Record{
+		Time:       time.Now(),
+		SessionID:  h.SessionID,
+		User:       h.User,
+		RemoteAddr: h.RemoteAddr,
+		Protocol:   audit.ProtocolSftp,
+		Operation:  strings.ToLower(operation),
+		Path:       path.Join("/", h.Home, r.Filepath),
+		Target:     r.Target,
+	}
+
+	if r.Target != "" {
+		result.Target = path.Join("/", h.Home, r.Target)
+	}
+
+	return result
+}
+
+func (h *Handler) log(record audit.Record, started time.Time, err error) {
+	record.Finish(started, err)
+	h.AuditLog.Log(record)
+}
+
+/*
+listedInfo returns the file info a client is shown. Files read encrypted
+report the size of the encrypted copy they are read as, so clients that
+check the size of a download don't fail.
+*/
+func (h *Handler) listedInfo(fullPath string, info os.FileInfo) os.FileInfo {
+	if !info.Mode().IsRegular() || !h.Keyring.EncryptsReads(fullPath) || !slices.Contains(h.Permissions, configuration.PermissionRead) {
+		return info
+	}
+
+	size, err := h.Keyring.EncryptedSize(fullPath)
+
+	if err != nil {
+		slog.Error("failed to encrypt file for listing", "error", err, "path", fullPath, "session", h.SessionID)
+		return info
+	}
+
+	return sizedFileInfo{FileInfo: info, size: size}
+}
+
+// sizedFileInfo reports a different size for a file
+type sizedFileInfo struct {
+	os.FileInfo
+	size int64
+}
+
+func (s sizedFileInfo) Size() int64 { return s.size }
+
 // virtualFileInfo implements os.FileInfo for virtual files
 type virtualFileInfo struct {
 	name    string
@@ -0,0 +1,67 @@
+package sftp
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	totpPeriod = 30
+	totpDigits = 6
+)
+
+/*
+totpCode generates an RFC 6238 time-based one-time password for the given
+base32 secret and time. It uses HMAC-SHA1, 30 second steps and 6 digits,
+which is what authenticator apps expect.
+*/
+func totpCode(secret string, t time.Time) (string, error) {
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(normalizeTotpSecret(secret))
+	if err != nil {
+		return "", fmt.Errorf("invalid TOTP secret: %w", err)
+	}
+
+	counter := make([]byte, 8)
+	binary.BigEndian.PutUint64(counter, uint64(t.Unix()/totpPeriod))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000), nil
+}
+
+/*
+validateTotp returns true if code matches the secret at the current time
+step, or one step either side to allow for clock drift.
+*/
+func validateTotp(secret, code string) bool {
+	now := time.Now()
+	code = strings.TrimSpace(code)
+
+	for _, skew := range []int{0, -1, 1} {
+		expected, err := totpCode(secret, now.Add(time.Duration(skew*totpPeriod)*time.Second))
+		if err != nil {
+			return false
+		}
+
+		if hmac.Equal([]byte(expected), []byte(code)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func normalizeTotpSecret(secret string) string {
+	secret = strings.ToUpper(strings.ReplaceAll(secret, " ", ""))
+	return strings.TrimRight(secret, "=")
+}
@@ -0,0 +1,95 @@
+package sftp
+
+import (
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 secret from the RFC 6238 test vectors, in base32
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTotpCode(t *testing.T) {
+	// The RFC's 8 digit codes, cut to the last 6
+	tests := []struct {
+		name   string
+		secret string
+		unix   int64
+		want   string
+	}{
+		{name: "first vector", secret: rfcSecret, unix: 59, want: "287082"},
+		{name: "leading zero", secret: rfcSecret, unix: 1111111109, want: "081804"},
+		{name: "later step", secret: rfcSecret, unix: 1234567890, want: "005924"},
+		{name: "far future", secret: rfcSecret, unix: 20000000000, want: "353130"},
+		{name: "lower case with spaces and padding", secret: "gezd gnbv gy3t qojq gezd gnbv gy3t qojq====", unix: 59, want: "287082"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := totpCode(tt.secret, time.Unix(tt.unix, 0))
+
+			if err != nil || got != tt.want {
+				t.Errorf("totpCode(%q, %d) = %q, %v, want %q", tt.secret, tt.unix, got, err, tt.want)
+			}
+		})
+	}
+
+	if _, err := totpCode("not base32!", time.Now()); err == nil {
+		t.Error("totpCode with an invalid secret returned no error")
+	}
+}
+
+func TestValidateTotp(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps int
+		want  bool
+	}{
+		{name: "current step", steps: 0, want: true},
+		{name: "one step behind", steps: -1, want: true},
+		{name: "one step ahead", steps: 1, want: true},
+		{name: "two steps behind", steps: -2, want: false},
+		{name: "two steps ahead", steps: 2, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// A code only stays in the window for its step, so try again if
+			// the step changed while checking
+			for try := 0; try < 3; try++ {
+				step := time.Now().Unix() / totpPeriod
+				code, err := totpCode(rfcSecret, time.Unix((step+int64(tt.steps))*totpPeriod, 0))
+
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				got := validateTotp(rfcSecret, " "+code+" ")
+
+				if time.Now().Unix()/totpPeriod != step {
+					continue
+				}
+
+				if got != tt.want && !(got && collides(code, step)) {
+					t.Errorf("validateTotp for a code %d steps away = %v, want %v", tt.steps, got, tt.want)
+				}
+
+				return
+			}
+		})
+	}
+
+	if validateTotp(rfcSecret, "") {
+		t.Error("validateTotp accepted a blank code")
+	}
+}
+
+// collides returns true if a code outside the window happens to equal one inside it
+func collides(code string, step int64) bool {
+	for skew := int64(-1); skew <= 1; skew++ {
+		if inside, _ := totpCode(rfcSecret, time.Unix((step+skew)*totpPeriod, 0)); inside == code {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,164 @@
+package trash
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/adampresley/adamgokit/httphelpers"
+	"github.com/adampresley/adamgokit/rendering"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/audit"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/configuration"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/trashbin"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/viewmodels"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/webauth"
+)
+
+type TrashHandlers interface {
+	TrashPage(w http.ResponseWriter, r *http.Request)
+	RestoreItem(w http.ResponseWriter, r *http.Request)
+	PurgeItems(w http.ResponseWriter, r *http.Request)
+}
+
+type TrashControllerConfig struct {
+	Config   *configuration.Config
+	Renderer rendering.TemplateRenderer
+	AuditLog *audit.Logger
+	Trash    *trashbin.Bin
+}
+
+type TrashController struct {
+	config   *configuration.Config
+	renderer rendering.TemplateRenderer
+	auditLog *audit.Logger
+	trash    *trashbin.Bin
+}
+
+func NewTrashController(config TrashControllerConfig) TrashController {
+	return TrashController{
+		config:   config.Config,
+		renderer: config.Renderer,
+		auditLog: config.AuditLog,
+		trash:    config.Trash,
+	}
+}
+
+/*
+GET /trash
+*/
+func (c TrashController) TrashPage(w http.ResponseWriter, r *http.Request) {
+	c.renderTrashPage(w, r, "", false)
+}
+
+/*
+POST /trash/restore?id={id}
+*/
+func (c TrashController) RestoreItem(w http.ResponseWriter, r *http.Request) {
+	started := time.Now()
+	id := strings.TrimSpace(httphelpers.GetFromRequest[string](r, "id"))
+	item, err := c.trash.Restore(id)
+
+	c.audit(r, "restore", item.Path, started, err)
+
+	switch {
+	case errors.Is(err, trashbin.ErrRestoreExists):
+		c.renderTrashPage(w, r, fmt.Sprintf("Can't restore %s, as something else is there now. Move it out of the way first.", item.Path), true)
+
+	case err != nil:
+		slog.Error("error restoring from trash", "error", err, "id", id)
+		c.renderTrashPage(w, r, fmt.Sprintf("Unable to restore: %v", err), true)
+
+	default:
+		c.renderTrashPage(w, r, fmt.Sprintf("Restored %s", item.Path), false)
+	}
+}
+
+/*
+DELETE /trash?id={id}&all={all}
+
+Purges one item, or everything in the trash when all is true.
+*/
+func (c TrashController) PurgeItems(w http.ResponseWriter, r *http.Request) {
+	started := time.Now()
+	id := strings.TrimSpace(httphelpers.GetFromRequest[string](r, "id"))
+
+	if httphelpers.GetFromRequest[bool](r, "all") {
+		purged, err := c.trash.PurgeOlderThan(time.Time{})
+		c.audit(r, "purge", "/", started, err)
+
+		if err != nil {
+			slog.Error("error emptying trash", "error", err)
+			c.renderTrashPage(w, r, fmt.Sprintf("Unable to empty the trash: %v", err), true)
+			return
+		}
+
+		c.renderTrashPage(w, r, fmt.Sprintf("Purged %d items", purged), false)
+		return
+	}
+
+	item, err := c.trash.Purge(id)
+	c.audit(r, "purge", item.Path, started, err)
+
+	if err != nil {
+		slog.Error("error purging from trash", "error", err, "id", id)
+		c.renderTrashPage(w, r, fmt.Sprintf("Unable to purge: %v", err), true)
+		return
+	}
+
+	c.renderTrashPage(w, r, fmt.Sprintf("Purged %s", item.Path), false)
+}
+
+func (c TrashController) renderTrashPage(w http.ResponseWriter, r *http.Request, message string, isError bool) {
+	pageName := "pages/trash"
+
+	viewData := viewmodels.TrashPage{
+		BaseViewModel: viewmodels.BaseViewModel{
+			Version:            c.config.Version,
+			Message:            message,
+			IsError:            isError,
+			IsHtmx:             httphelpers.IsHtmx(r),
+			Viewer:             webauth.ViewerFromRequest(r),
+			JavascriptIncludes: []rendering.JavascriptInclude{},
+		},
+		Items: []viewmodels.TrashItem{},
+	}
+
+	if c.config.TrashMaxAgeDays > 0 {
+		viewData.MaxAge = fmt.Sprintf("%d days", c.config.TrashMaxAgeDays)
+	}
+
+	items, err := c.trash.List()
+
+	if err != nil {
+		slog.Error("error listing trash", "error", err)
+		viewData.Message = "Unexpected error reading the trash"
+		viewData.IsError = true
+	}
+
+	for _, item := range items {
+		viewData.Items = append(viewData.Items, viewmodels.NewTrashItem(item, c.config.TrashMaxAgeDays))
+	}
+
+	c.renderer.Render(pageName, viewData, w)
+}
+
+/*
+audit records restoring or purging an item. Paths are already relative to
+the root of the upload folder.
+*/
+func (c TrashController) audit(r *http.Request, operation, path string, started time.Time, err error) {
+	record := audit.Record{
+		Time:       started,
+		RemoteAddr: r.RemoteAddr,
+		User:       webauth.ViewerFromRequest(r).Name,
+		Protocol:   audit.ProtocolHttp,
+		Operation:  operation,
+		Path:       path,
+	}
+
+	record.Finish(started, err)
+	c.auditLog.Log(record)
+}
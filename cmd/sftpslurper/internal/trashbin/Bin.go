@@ -0,0 +1,380 @@
+package trashbin
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/configuration"
+)
+
+var (
+	ErrNotFound      = errors.New("item is not in the trash")
+	ErrRestoreExists = errors.New("something already exists at the original path")
+)
+
+const (
+	// purgeInterval is how often items past their age are purged
+	purgeInterval = time.Hour
+)
+
+type BinConfig struct {
+	Config *configuration.Config
+
+	// MaxAge is how long items stay in the trash. Zero keeps them until
+	// they are purged by hand.
+	MaxAge time.Duration
+}
+
+/*
+Item is something that was deleted, with where it came from, who deleted
+it, and when. Path is relative to the root of the upload folder.
+*/
+type Item struct {
+	ID        string    `json:"id"`
+	Path      string    `json:"path"`
+	IsDir     bool      `json:"isDir"`
+	Size      int64     `json:"size"`
+	DeletedBy string    `json:"deletedBy"`
+	Protocol  string    `json:"protocol"`
+	DeletedAt time.Time `json:"deletedAt"`
+}
+
+/*
+Bin keeps deleted files and folders in the system folder, so they can be
+restored. Each item is moved to trash/{id} with its details beside it in
+trash/{id}.json. Moving is a rename, as the system folder is inside the
+upload folder, so deleting a large folder is as quick as before.
+*/
+type Bin struct {
+	mu     sync.Mutex
+	config *configuration.Config
+	maxAge time.Duration
+}
+
+func NewBin(config BinConfig) *Bin {
+	return &Bin{
+		config: config.Config,
+		maxAge: config.MaxAge,
+	}
+}
+
+// MaxAge returns how long items stay in the trash, or zero for ever.
+func (b *Bin) MaxAge() time.Duration {
+	return b.maxAge
+}
+
+/*
+Move puts the file or folder at fullPath in the trash. uploadPath is the
+same path relative to the upload folder, which is where it is restored.
+*/
+func (b *Bin) Move(fullPath, uploadPath, user, protocol string) (Item, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	info, err := os.Lstat(fullPath)
+
+	if err != nil {
+		return Item{}, err
+	}
+
+	id, err := newID()
+
+	if err != nil {
+		return Item{}, err
+	}
+
+	item := Item{
+		ID:        id,
+		Path:      path.Join("/", filepath.ToSlash(uploadPath)),
+		IsDir:     info.IsDir(),
+		Size:      totalSize(fullPath, info),
+		DeletedBy: user,
+		Protocol:  protocol,
+		DeletedAt: time.Now(),
+	}
+
+	itemPath, err := configuration.SystemPath("trash", id)
+
+	if err != nil {
+		return Item{}, err
+	}
+
+	if err = writeItem(itemPath+".json", item); err != nil {
+		return Item{}, err
+	}
+
+	if err = os.Rename(fullPath, itemPath); err != nil {
+		_ = os.Remove(itemPath + ".json")
+		return Item{}, err
+	}
+
+	slog.Info("moved to trash", "path", item.Path, "id", id, "user", user)
+	return item, nil
+}
+
+/*
+List returns everything in the trash, most recently deleted first.
+*/
+func (b *Bin) List() ([]Item, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.list()
+}
+
+func (b *Bin) list() ([]Item, error) {
+	result := []Item{}
+	trashPath, err := configuration.SystemPath("trash", "")
+
+	if err != nil {
+		return result, err
+	}
+
+	entries, err := os.ReadDir(trashPath)
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return result, nil
+	}
+
+	if err != nil {
+		return result, err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+
+		item, err := readItem(filepath.Join(trashPath, entry.Name()))
+
+		if err != nil {
+			slog.Error("error reading trash item", "error", err, "file", entry.Name())
+			continue
+		}
+
+		result = append(result, item)
+	}
+
+	slices.SortFunc(result, func(a, b Item) int {
+		return b.DeletedAt.Compare(a.DeletedAt)
+	})
+
+	return result, nil
+}
+
+/*
+Restore puts an item back where it was deleted from, making any parent
+folders that have since been removed. Nothing is overwritten.
+*/
+func (b *Bin) Restore(id string) (Item, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	itemPath, item, err := b.find(id)
+
+	if err != nil {
+		return item, err
+	}
+
+	destination, err := b.config.SanitizePath(item.Path)
+
+	if err != nil {
+		return item, err
+	}
+
+	if _, err = os.Lstat(destination); err == nil {
+		return item, ErrRestoreExists
+	}
+
+	if err = os.MkdirAll(filepath.Dir(destination), 0755); err != nil {
+		return item, err
+	}
+
+	if err = os.Rename(itemPath, destination); err != nil {
+		return item, err
+	}
+
+	slog.Info("restored from trash", "path", item.Path, "id", id)
+	return item, os.Remove(itemPath + ".json")
+}
+
+/*
+Purge deletes an item from the trash for good.
+*/
+func (b *Bin) Purge(id string) (Item, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	itemPath, item, err := b.find(id)
+
+	if err != nil {
+		return item, err
+	}
+
+	return item, purge(itemPath)
+}
+
+/*
+PurgeOlderThan deletes items that were deleted before the given time, and
+returns how many were purged. A zero time purges everything.
+*/
+func (b *Bin) PurgeOlderThan(before time.Time) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	items, err := b.list()
+
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+
+	for _, item := range items {
+		if !before.IsZero() && !item.DeletedAt.Before(before) {
+			continue
+		}
+
+		itemPath, err := configuration.SystemPath("trash", item.ID)
+
+		if err == nil {
+			err = purge(itemPath)
+		}
+
+		if err != nil {
+			return purged, err
+		}
+
+		purged++
+	}
+
+	return purged, nil
+}
+
+/*
+StartPurger purges items older than the maximum age every hour, until ctx
+is cancelled. It does nothing when items are kept for ever.
+*/
+func (b *Bin) StartPurger(ctx context.Context) {
+	if b.maxAge <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(purgeInterval)
+		defer ticker.Stop()
+
+		for {
+			purged, err := b.PurgeOlderThan(time.Now().Add(-b.maxAge))
+
+			if err != nil {
+				slog.Error("error purging trash", "error", err)
+			} else if purged > 0 {
+				slog.Info("purged old items from trash", "count", purged, "maxAge", b.maxAge)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (b *Bin) find(id string) (string, Item, error) {
+	if id == "" || strings.ContainsAny(id, `/\.`) {
+		return "", Item{}, ErrNotFound
+	}
+
+	itemPath, err := configuration.SystemPath("trash", id)
+
+	if err != nil {
+		return "", Item{}, err
+	}
+
+	item, err := readItem(itemPath + ".json")
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", item, ErrNotFound
+	}
+
+	return itemPath, item, err
+}
+
+func purge(itemPath string) error {
+	if err := os.RemoveAll(itemPath); err != nil {
+		return err
+	}
+
+	return os.Remove(itemPath + ".json")
+}
+
+func readItem(fileName string) (Item, error) {
+	result := Item{}
+	b, err := os.ReadFile(fileName)
+
+	if err != nil {
+		return result, err
+	}
+
+	err = json.Unmarshal(b, &result)
+	return result, err
+}
+
+func writeItem(fileName string, item Item) error {
+	b, err := json.Marshal(item)
+
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(fileName, b, 0644)
+}
+
+func newID() (string, error) {
+	b := make([]byte, 4)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating trash id: %w", err)
+	}
+
+	return fmt.Sprintf("%d-%s", time.Now().UnixNano(), hex.EncodeToString(b)), nil
+}
+
+/*
+totalSize adds up the size of every file in a folder, or returns the size
+of a file.
+*/
+func totalSize(fullPath string, info fs.FileInfo) int64 {
+	if !info.IsDir() {
+		return info.Size()
+	}
+
+	var result int64
+
+	_ = filepath.WalkDir(fullPath, func(_ string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			if info, err := d.Info(); err == nil {
+				result += info.Size()
+			}
+		}
+
+		return nil
+	})
+
+	return result
+}
@@ -0,0 +1,338 @@
+package validation
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/dustin/go-humanize"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+const (
+	// maxErrors is how many errors a check keeps before it only counts them
+	maxErrors = 10
+
+	// maxJsonSize is the largest file checked against a JSON Schema, which
+	// has to be read into memory
+	maxJsonSize int64 = 256 * 1024 * 1024
+)
+
+/*
+check runs every check in a rule on a file. Content checks are skipped
+when the file is over the size limit.
+*/
+func (r rule) check(fullPath string) []Result {
+	result := []Result{}
+	info, err := os.Stat(fullPath)
+
+	if err != nil {
+		return append(result, Result{Rule: r.Name, Check: CheckSize, Errors: []string{err.Error()}})
+	}
+
+	if r.fileName != nil {
+		errs := []string{}
+
+		if !r.fileName.MatchString(info.Name()) {
+			errs = append(errs, fmt.Sprintf("%s doesn't match %s", info.Name(), r.FileName))
+		}
+
+		result = append(result, Result{Rule: r.Name, Check: CheckFileName, Errors: errs})
+	}
+
+	if r.MaxSizeMB > 0 {
+		limit := int64(r.MaxSizeMB) * 1024 * 1024
+
+		if info.Size() > limit {
+			message := fmt.Sprintf("%s is over the limit of %s", humanize.IBytes(uint64(info.Size())), humanize.IBytes(uint64(limit)))
+
+			if r.Csv != nil || r.schema != nil || r.Xml {
+				message += ", so its content wasn't checked"
+			}
+
+			return append(result, Result{Rule: r.Name, Check: CheckSize, Errors: []string{message}})
+		}
+
+		result = append(result, Result{Rule: r.Name, Check: CheckSize})
+	}
+
+	if r.Csv != nil {
+		result = append(result, r.checkFile(fullPath, CheckCsv, r.checkCsv))
+	}
+
+	if r.schema != nil {
+		result = append(result, r.checkFile(fullPath, CheckJsonSchema, r.checkJsonSchema))
+	}
+
+	if r.Xml {
+		result = append(result, r.checkFile(fullPath, CheckXml, checkXml))
+	}
+
+	return result
+}
+
+// checkFile runs a content check on a file, keeping the first maxErrors errors
+func (r rule) checkFile(fullPath, check string, fn func(io.Reader, *errorList)) Result {
+	result := Result{Rule: r.Name, Check: check}
+	errs := &errorList{}
+	file, err := os.Open(fullPath)
+
+	if err != nil {
+		errs.add(err.Error())
+	} else {
+		fn(bufio.NewReader(file), errs)
+		file.Close()
+	}
+
+	result.Errors = errs.list()
+	return result
+}
+
+/*
+checkCsv checks every row has the expected number of columns, and that
+the first row is the expected header. When no column count is given,
+every row has to have as many as the first.
+*/
+func (r rule) checkCsv(file io.Reader, errs *errorList) {
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = r.Csv.Columns
+	reader.ReuseRecord = true
+
+	if r.Csv.Delimiter != "" {
+		reader.Comma, _ = utf8.DecodeRuneInString(r.Csv.Delimiter)
+	}
+
+	for row := 1; ; row++ {
+		record, err := reader.Read()
+
+		if err == io.EOF {
+			if row == 1 {
+				errs.add("the file is empty")
+			}
+
+			return
+		}
+
+		var parseErr *csv.ParseError
+
+		if errors.As(err, &parseErr) && errors.Is(parseErr.Err, csv.ErrFieldCount) {
+			errs.add(fmt.Sprintf("line %d has %d columns, expected %d", parseErr.StartLine, len(record), reader.FieldsPerRecord))
+		} else if err != nil {
+			errs.add(err.Error())
+			return
+		}
+
+		if row == 1 && len(r.Csv.Header) > 0 {
+			checkHeader(record, r.Csv.Header, errs)
+		}
+	}
+}
+
+// checkHeader compares the first row of a CSV file to the expected header
+func checkHeader(record, header []string, errs *errorList) {
+	for index, expected := range header {
+		if index >= len(record) {
+			errs.add(fmt.Sprintf("header is missing column %d, %q", index+1, expected))
+			continue
+		}
+
+		got := strings.TrimSpace(record[index])
+
+		if index == 0 {
+			got = strings.TrimPrefix(got, "\ufeff")
+		}
+
+		if !strings.EqualFold(got, strings.TrimSpace(expected)) {
+			errs.add(fmt.Sprintf("header column %d is %q, expected %q", index+1, got, expected))
+		}
+	}
+}
+
+// checkJsonSchema checks a file is JSON that is valid against the rule's schema
+func (r rule) checkJsonSchema(file io.Reader, errs *errorList) {
+	var (
+		document any
+	)
+
+	decoder := json.NewDecoder(io.LimitReader(file, maxJsonSize+1))
+	decoder.UseNumber()
+
+	if err := decoder.Decode(&document); err != nil {
+		var syntaxErr *json.SyntaxError
+
+		switch {
+		case decoder.InputOffset() > maxJsonSize:
+			errs.add(fmt.Sprintf("the file is over %s, too large to check against the schema", humanize.IBytes(uint64(maxJsonSize))))
+		case errors.As(err, &syntaxErr):
+			errs.add(fmt.Sprintf("invalid JSON at byte %d: %v", syntaxErr.Offset, err))
+		case err == io.EOF:
+			errs.add("the file is empty")
+		default:
+			errs.add(fmt.Sprintf("invalid JSON: %v", err))
+		}
+
+		return
+	}
+
+	if _, err := decoder.Token(); err != io.EOF {
+		errs.add("invalid JSON: there is more after the first value")
+		return
+	}
+
+	err := r.schema.Validate(document)
+
+	var validationErr *jsonschema.ValidationError
+
+	if errors.As(err, &validationErr) {
+		addSchemaErrors(validationErr, errs)
+		return
+	}
+
+	if err != nil {
+		errs.add(err.Error())
+	}
+}
+
+/*
+addSchemaErrors adds the innermost causes of a schema validation error,
+which say what is wrong and where, without the errors that only say a
+subschema failed.
+*/
+func addSchemaErrors(err *jsonschema.ValidationError, errs *errorList) {
+	if len(err.Causes) > 0 {
+		for _, cause := range err.Causes {
+			addSchemaErrors(cause, errs)
+		}
+
+		return
+	}
+
+	location := err.InstanceLocation
+
+	if location == "" {
+		location = "/"
+	}
+
+	errs.add(fmt.Sprintf("%s: %s", location, err.Message))
+}
+
+/*
+checkXml checks a file is well-formed XML, with a single root element and
+no text outside it. Files declaring an encoding other than UTF-8 are read
+as Latin-1.
+*/
+func checkXml(file io.Reader, errs *errorList) {
+	decoder := xml.NewDecoder(file)
+	decoder.CharsetReader = charsetReader
+	depth := 0
+	roots := 0
+
+	for {
+		token, err := decoder.Token()
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			errs.add(err.Error())
+			return
+		}
+
+		switch token := token.(type) {
+		case xml.StartElement:
+			if depth == 0 {
+				roots++
+			}
+
+			depth++
+
+		case xml.EndElement:
+			depth--
+
+		case xml.CharData:
+			if depth == 0 && len(strings.TrimSpace(string(token))) > 0 {
+				errs.add("the file has text outside the root element")
+				return
+			}
+		}
+	}
+
+	switch {
+	case roots == 0:
+		errs.add("the file has no root element")
+	case roots > 1:
+		errs.add(fmt.Sprintf("the file has %d root elements, expected 1", roots))
+	}
+}
+
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	switch strings.ToLower(charset) {
+	case "utf-8", "us-ascii", "ascii":
+		return input, nil
+	}
+
+	return &latin1Reader{input: bufio.NewReader(input)}, nil
+}
+
+// latin1Reader reads Latin-1 text as UTF-8
+type latin1Reader struct {
+	input *bufio.Reader
+}
+
+func (r *latin1Reader) Read(p []byte) (int, error) {
+	if len(p) < utf8.UTFMax {
+		return 0, io.ErrShortBuffer
+	}
+
+	n := 0
+
+	for n+utf8.UTFMax <= len(p) {
+		b, err := r.input.ReadByte()
+
+		if err != nil {
+			if n > 0 {
+				return n, nil
+			}
+
+			return 0, err
+		}
+
+		n += utf8.EncodeRune(p[n:], rune(b))
+	}
+
+	return n, nil
+}
+
+/*
+errorList keeps the first maxErrors errors of a check, and counts the
+rest.
+*/
+type errorList struct {
+	errors []string
+	more   int
+}
+
+func (l *errorList) add(message string) {
+	if len(l.errors) >= maxErrors {
+		l.more++
+		return
+	}
+
+	l.errors = append(l.errors, message)
+}
+
+func (l *errorList) list() []string {
+	if l.more > 0 {
+		return append(l.errors, fmt.Sprintf("and %d more", l.more))
+	}
+
+	return l.errors
+}
@@ -0,0 +1,100 @@
+package validation
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/configuration"
+)
+
+func TestCheckCsv(t *testing.T) {
+	tests := []struct {
+		name   string
+		format configuration.CsvFormat
+		file   string
+		want   []string
+	}{
+		{name: "any columns", format: configuration.CsvFormat{}, file: "a,b\n1,2\n3,4\n"},
+		{name: "expected columns", format: configuration.CsvFormat{Columns: 2}, file: "a,b\n1,2\n"},
+		{name: "row with too many columns", format: configuration.CsvFormat{Columns: 2}, file: "a,b\n1,2,3\n", want: []string{"line 2 has 3 columns, expected 2"}},
+		{name: "rows must match the first", format: configuration.CsvFormat{}, file: "a,b,c\n1,2\n", want: []string{"line 2 has 2 columns, expected 3"}},
+		{name: "header matches without case", format: configuration.CsvFormat{Header: []string{"ID", "Name"}}, file: "id, name \n1,apple\n"},
+		{name: "header with a byte order mark", format: configuration.CsvFormat{Header: []string{"id"}}, file: "\ufeffid\n1\n"},
+		{name: "wrong header", format: configuration.CsvFormat{Header: []string{"id", "name"}}, file: "id,title\n1,apple\n", want: []string{`header column 2 is "title", expected "name"`}},
+		{name: "short header", format: configuration.CsvFormat{Header: []string{"id", "name"}}, file: "id\n1\n", want: []string{`header is missing column 2, "name"`}},
+		{name: "delimiter", format: configuration.CsvFormat{Columns: 2, Delimiter: ";"}, file: "a;b\n1;2,5\n"},
+		{name: "empty", format: configuration.CsvFormat{}, file: "", want: []string{"the file is empty"}},
+		{name: "bad quoting", format: configuration.CsvFormat{}, file: "a,b\n1,\"2\n", want: []string{`extraneous or missing " in quoted-field`}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			format := tt.format
+			r := rule{ValidationRule: configuration.ValidationRule{Csv: &format}}
+			errs := &errorList{}
+			r.checkCsv(strings.NewReader(tt.file), errs)
+
+			if got := errs.list(); !matchErrors(got, tt.want) {
+				t.Errorf("checkCsv errors = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckCsvKeepsFirstErrors(t *testing.T) {
+	file := "a,b\n" + strings.Repeat("1\n", maxErrors+5)
+	r := rule{ValidationRule: configuration.ValidationRule{Csv: &configuration.CsvFormat{Columns: 2}}}
+	errs := &errorList{}
+	r.checkCsv(strings.NewReader(file), errs)
+	got := errs.list()
+
+	if len(got) != maxErrors+1 || got[maxErrors] != "and 5 more" {
+		t.Errorf("checkCsv kept %d errors ending %q, want %d ending \"and 5 more\"", len(got), got[len(got)-1], maxErrors+1)
+	}
+}
+
+func TestCheckXml(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		want []string
+	}{
+		{name: "well-formed", file: `<?xml version="1.0"?><orders><order id="1"/></orders>`},
+		{name: "comments and whitespace outside the root", file: "<!-- export -->\n<orders/>\n"},
+		{name: "latin-1", file: "<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?><name>Jos\xe9</name>"},
+		{name: "empty", file: "", want: []string{"the file has no root element"}},
+		{name: "two roots", file: "<a/><b/>", want: []string{"the file has 2 root elements, expected 1"}},
+		{name: "text outside the root", file: "<a/>trailing", want: []string{"the file has text outside the root element"}},
+		{name: "unclosed element", file: "<a><b></a>", want: []string{"element <b> closed by </a>"}},
+		{name: "unexpected end", file: "<a><b>", want: []string{"unexpected EOF"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := &errorList{}
+			checkXml(strings.NewReader(tt.file), errs)
+
+			if got := errs.list(); !matchErrors(got, tt.want) {
+				t.Errorf("checkXml errors = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+/*
+matchErrors returns true if each error contains the wanted text, as errors
+from the standard library parsers add where they happened.
+*/
+func matchErrors(got, want []string) bool {
+	if len(got) != len(want) {
+		return false
+	}
+
+	for index := range got {
+		if !strings.Contains(got[index], want[index]) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,251 @@
+package validation
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"time"
+
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/audit"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/configuration"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// Report statuses
+const (
+	StatusPassed = "passed"
+	StatusFailed = "failed"
+)
+
+// statusFolder is where reports are kept in the system folder
+const statusFolder = "validation"
+
+// Checks
+const (
+	CheckFileName   = "file name"
+	CheckSize       = "size"
+	CheckCsv        = "csv"
+	CheckJsonSchema = "json schema"
+	CheckXml        = "xml"
+)
+
+type ValidatorConfig struct {
+	Config   *configuration.Config
+	AuditLog *audit.Logger
+}
+
+/*
+Report is the result of checking one upload against the validation rules
+that match it. Path is where the file was when it was checked, relative
+to the upload folder.
+*/
+type Report struct {
+	Path    string    `json:"path"`
+	User    string    `json:"user"`
+	Status  string    `json:"status"`
+	Checked time.Time `json:"checked"`
+	Results []Result  `json:"results"`
+}
+
+/*
+Result is the outcome of one check of a rule. A check passed when it has
+no errors.
+*/
+type Result struct {
+	Rule   string   `json:"rule"`
+	Check  string   `json:"check"`
+	Errors []string `json:"errors,omitempty"`
+}
+
+/*
+Validator checks files against the configured validation rules once their
+upload completes. The hooks runner calls it in the background before the
+upload's hooks run, so the checks see the file as it was written. The
+last report for each file is kept in the system folder at
+validation/{path}.json, so it can be shown next to the file.
+*/
+type Validator struct {
+	auditLog *audit.Logger
+	rules    []rule
+}
+
+// rule is a validation rule with its file name pattern and schema compiled
+type rule struct {
+	configuration.ValidationRule
+
+	fileName *regexp.Regexp
+	schema   *jsonschema.Schema
+}
+
+/*
+NewValidator compiles the validation rules. It fails when a JSON Schema
+can't be read or isn't valid.
+*/
+func NewValidator(config ValidatorConfig) (*Validator, error) {
+	var (
+		err error
+	)
+
+	result := &Validator{
+		auditLog: config.AuditLog,
+		rules:    make([]rule, 0, len(config.Config.Validation)),
+	}
+
+	for _, validationRule := range config.Config.Validation {
+		compiled := rule{ValidationRule: validationRule}
+
+		if validationRule.FileName != "" {
+			if compiled.fileName, err = regexp.Compile(validationRule.FileName); err != nil {
+				return nil, fmt.Errorf("validation rule '%s' has an invalid file name pattern: %w", validationRule.Name, err)
+			}
+		}
+
+		if validationRule.JsonSchema != "" {
+			if compiled.schema, err = jsonschema.Compile(validationRule.JsonSchema); err != nil {
+				return nil, fmt.Errorf("validation rule '%s' has an invalid JSON Schema: %w", validationRule.Name, err)
+			}
+		}
+
+		result.rules = append(result.rules, compiled)
+	}
+
+	return result, nil
+}
+
+/*
+Uploaded checks a file whose upload just completed against the rules that
+match it, keeps the report, and returns it. When no rules match, a report
+left from an earlier upload to the same name is removed, and it returns
+nil.
+*/
+func (v *Validator) Uploaded(fullPath, user string) *Report {
+	relativePath, err := configuration.RelativeUploadPath(fullPath)
+
+	if err != nil {
+		slog.Error("upload is outside the upload folder", "error", err, "path", fullPath)
+		return nil
+	}
+
+	rules := v.matching(relativePath)
+
+	if len(rules) == 0 {
+		if err = configuration.RemoveStatus(statusFolder, relativePath); err != nil {
+			slog.Error("error removing validation report", "error", err, "path", relativePath)
+		}
+
+		return nil
+	}
+
+	started := time.Now()
+	report := Report{
+		Path:    relativePath,
+		User:    user,
+		Status:  StatusPassed,
+		Checked: started,
+		Results: []Result{},
+	}
+
+	failed := 0
+
+	for _, rule := range rules {
+		for _, result := range rule.check(fullPath) {
+			if len(result.Errors) > 0 {
+				report.Status = StatusFailed
+				failed++
+			}
+
+			report.Results = append(report.Results, result)
+		}
+	}
+
+	record := audit.Record{
+		Time:      started,
+		User:      user,
+		Protocol:  audit.ProtocolSystem,
+		Operation: "validate",
+		Path:      "/" + relativePath,
+	}
+
+	if failed > 0 {
+		err = fmt.Errorf("failed %d of %d checks", failed, len(report.Results))
+	}
+
+	record.Finish(started, err)
+	v.auditLog.Log(record)
+
+	if err = configuration.SaveStatus(statusFolder, relativePath, report); err != nil {
+		slog.Error("error saving validation report", "error", err, "path", relativePath)
+	}
+
+	slog.Info("upload validated", "path", relativePath, "status", report.Status, "checks", len(report.Results), "failed", failed)
+	return &report
+}
+
+/*
+Status returns the last validation report of the file at fullPath, or nil
+if it hasn't been checked.
+*/
+func (v *Validator) Status(fullPath string) (*Report, error) {
+	relativePath, err := configuration.RelativeUploadPath(fullPath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Report{}
+	found, err := configuration.LoadStatus(statusFolder, relativePath, result)
+
+	if !found {
+		return nil, err
+	}
+
+	return result, err
+}
+
+/*
+Moved moves the report of a file that was moved, or the reports of every
+file in a moved folder, so they stay next to the files.
+*/
+func (v *Validator) Moved(fromPath, toPath string) {
+	from, err := configuration.RelativeUploadPath(fromPath)
+
+	if err != nil {
+		return
+	}
+
+	to, err := configuration.RelativeUploadPath(toPath)
+
+	if err != nil {
+		return
+	}
+
+	if err = configuration.MoveStatus(statusFolder, from, to); err != nil {
+		slog.Error("error moving validation report", "error", err, "path", from, "target", to)
+	}
+}
+
+// Removed removes the report of a file that was deleted
+func (v *Validator) Removed(fullPath string) {
+	relativePath, err := configuration.RelativeUploadPath(fullPath)
+
+	if err != nil {
+		return
+	}
+
+	if err = configuration.RemoveStatus(statusFolder, relativePath); err != nil {
+		slog.Error("error removing validation report", "error", err, "path", relativePath)
+	}
+}
+
+// matching returns the rules whose path matches an upload
+func (v *Validator) matching(relativePath string) []rule {
+	result := []rule{}
+
+	for _, rule := range v.rules {
+		if rule.Path == "" || configuration.MatchGlob(rule.Path, relativePath) {
+			result = append(result, rule)
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,421 @@
+package versioning
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/configuration"
+)
+
+const (
+	// PolicyOverwrite replaces the existing file
+	PolicyOverwrite = "overwrite"
+
+	// PolicyVersion replaces the existing file, keeping the old copy
+	PolicyVersion = "version"
+
+	// PolicyTimestamp saves the new upload with a timestamp suffix
+	PolicyTimestamp = "timestamp"
+
+	// PolicyCounter saves the new upload with a counter suffix
+	PolicyCounter = "counter"
+
+	// timestampFormat is the suffix added by PolicyTimestamp
+	timestampFormat = "20060102-150405"
+)
+
+var (
+	ErrNotFound = errors.New("version not found")
+
+	policies = []string{PolicyOverwrite, PolicyVersion, PolicyTimestamp, PolicyCounter}
+)
+
+type StoreConfig struct {
+	// Policy says what happens when an upload's name is already taken
+	Policy string
+
+	// Keep is how many old copies of each file PolicyVersion keeps
+	Keep int
+}
+
+/*
+Version is an old copy of a file, kept when a newer upload replaced it.
+ModTime is when the old copy was written, and SavedAt when it was
+replaced.
+*/
+type Version struct {
+	ID      string
+	Size    int64
+	ModTime time.Time
+	SavedAt time.Time
+}
+
+/*
+Store decides what happens when an upload's name is already taken, and
+keeps the old copies of replaced files. Old copies of a file are kept in
+the system folder at versions/{path}/{id}, where path is the file's path
+relative to the upload folder and id is when it was replaced. Saving a
+copy is a rename, as the system folder is inside the upload folder.
+*/
+type Store struct {
+	mu     sync.Mutex
+	policy string
+	keep   int
+}
+
+func NewStore(config StoreConfig) (*Store, error) {
+	policy := strings.ToLower(strings.TrimSpace(config.Policy))
+
+	if policy == "" {
+		policy = PolicyOverwrite
+	}
+
+	if !slices.Contains(policies, policy) {
+		return nil, fmt.Errorf("unknown collision policy '%s'", config.Policy)
+	}
+
+	return &Store{
+		policy: policy,
+		keep:   max(config.Keep, 1),
+	}, nil
+}
+
+// Policy returns the collision policy.
+func (s *Store) Policy() string {
+	return s.policy
+}
+
+// Renames returns true if the policy saves new uploads under a new name
+// rather than replacing an existing file.
+func (s *Store) Renames() bool {
+	return s.policy == PolicyTimestamp || s.policy == PolicyCounter
+}
+
+/*
+Prepare applies the collision policy before an upload is written to
+fullPath, and returns the path to write to. Policies that rename return a
+free name beside fullPath when it is taken, and PolicyVersion saves the
+existing file as an old copy.
+*/
+func (s *Store) Prepare(fullPath string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.Renames() {
+		return s.freeName(fullPath), nil
+	}
+
+	return fullPath, s.save(fullPath)
+}
+
+/*
+SaveVersion keeps the existing file at fullPath as an old copy when the
+policy is PolicyVersion. It is for uploads that were asked to replace a
+file, whatever the policy.
+*/
+func (s *Store) SaveVersion(fullPath string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.save(fullPath)
+}
+
+/*
+Moved moves the old copies of a file that was moved to toPath, or those of
+every file in a moved folder, so they stay with the files. A file's copies
+share a folder with the copies of files in a folder of the same name, so
+only the ones that belong to what was moved are taken.
+*/
+func (s *Store) Moved(fromPath, toPath string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	info, err := os.Stat(toPath)
+
+	if err != nil {
+		return err
+	}
+
+	fromDir, err := versionsDir(fromPath)
+
+	if err != nil {
+		return err
+	}
+
+	toDir, err := versionsDir(toPath)
+
+	if err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(fromDir)
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() != info.IsDir() {
+			continue
+		}
+
+		if err = os.MkdirAll(toDir, 0755); err != nil {
+			return err
+		}
+
+		target := filepath.Join(toDir, entry.Name())
+
+		// Copies left at the new path by a folder that was deleted are
+		// out of date
+		if entry.IsDir() {
+			if err = os.RemoveAll(target); err != nil {
+				return err
+			}
+		}
+
+		if err = os.Rename(filepath.Join(fromDir, entry.Name()), target); err != nil {
+			return err
+		}
+	}
+
+	if !info.IsDir() {
+		return s.prune(toPath)
+	}
+
+	return nil
+}
+
+/*
+Removed removes the old copies of a file that was deleted, and the folders
+that leaves empty. Copies of files in a folder of the same name are kept.
+*/
+func (s *Store) Removed(fullPath string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	dir, err := versionsDir(fullPath)
+
+	if err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(dir)
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		if err = os.Remove(filepath.Join(dir, entry.Name())); err != nil {
+			return err
+		}
+	}
+
+	configuration.RemoveEmptyFolders(dir, configuration.UploadFullPath(configuration.SystemFolderName))
+	return nil
+}
+
+/*
+List returns the old copies of the file at fullPath, newest first.
+*/
+func (s *Store) List(fullPath string) ([]Version, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.list(fullPath)
+}
+
+/*
+Path returns where the old copy of fullPath with the given id is kept.
+*/
+func (s *Store) Path(fullPath, id string) (string, Version, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	versions, err := s.list(fullPath)
+
+	if err != nil {
+		return "", Version{}, err
+	}
+
+	for _, version := range versions {
+		if version.ID == id {
+			dir, err := versionsDir(fullPath)
+			return filepath.Join(dir, id), version, err
+		}
+	}
+
+	return "", Version{}, ErrNotFound
+}
+
+func (s *Store) save(fullPath string) error {
+	if s.policy != PolicyVersion {
+		return nil
+	}
+
+	info, err := os.Stat(fullPath)
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil || !info.Mode().IsRegular() {
+		return err
+	}
+
+	dir, err := versionsDir(fullPath)
+
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	id := strconv.FormatInt(time.Now().UnixNano(), 10)
+
+	if err = os.Rename(fullPath, filepath.Join(dir, id)); err != nil {
+		return err
+	}
+
+	return s.prune(fullPath)
+}
+
+// prune removes the oldest copies of a file beyond the number kept
+func (s *Store) prune(fullPath string) error {
+	versions, err := s.list(fullPath)
+
+	if err != nil || len(versions) <= s.keep {
+		return err
+	}
+
+	dir, err := versionsDir(fullPath)
+
+	if err != nil {
+		return err
+	}
+
+	for _, version := range versions[s.keep:] {
+		if err = os.Remove(filepath.Join(dir, version.ID)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Store) list(fullPath string) ([]Version, error) {
+	result := []Version{}
+	dir, err := versionsDir(fullPath)
+
+	if err != nil {
+		return result, err
+	}
+
+	entries, err := os.ReadDir(dir)
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return result, nil
+	}
+
+	if err != nil {
+		return result, err
+	}
+
+	for _, entry := range entries {
+		// Folders hold the copies of files inside a folder of the same name
+		if !entry.Type().IsRegular() {
+			continue
+		}
+
+		savedAt, err := strconv.ParseInt(entry.Name(), 10, 64)
+
+		if err != nil {
+			continue
+		}
+
+		info, err := entry.Info()
+
+		if err != nil {
+			continue
+		}
+
+		result = append(result, Version{
+			ID:      entry.Name(),
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+			SavedAt: time.Unix(0, savedAt),
+		})
+	}
+
+	slices.SortFunc(result, func(a, b Version) int {
+		return b.SavedAt.Compare(a.SavedAt)
+	})
+
+	return result, nil
+}
+
+/*
+freeName returns fullPath if nothing is there, or else the first name
+beside it with a free suffix, such as report-20250101-120000.csv or
+report-1.csv.
+*/
+func (s *Store) freeName(fullPath string) string {
+	if _, err := os.Lstat(fullPath); errors.Is(err, fs.ErrNotExist) {
+		return fullPath
+	}
+
+	ext := filepath.Ext(fullPath)
+	base := strings.TrimSuffix(fullPath, ext)
+
+	if s.policy == PolicyTimestamp {
+		base += "-" + time.Now().Format(timestampFormat)
+
+		if _, err := os.Lstat(base + ext); errors.Is(err, fs.ErrNotExist) {
+			return base + ext
+		}
+	}
+
+	for counter := 1; ; counter++ {
+		result := fmt.Sprintf("%s-%d%s", base, counter, ext)
+
+		if _, err := os.Lstat(result); errors.Is(err, fs.ErrNotExist) {
+			return result
+		}
+	}
+}
+
+/*
+versionsDir returns the folder that holds the old copies of the file at
+fullPath.
+*/
+func versionsDir(fullPath string) (string, error) {
+	relativePath, err := configuration.RelativeUploadPath(fullPath)
+
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(configuration.UploadFullPath(configuration.SystemFolderName), "versions", filepath.FromSlash(relativePath)), nil
+}
@@ -0,0 +1,148 @@
+package versioning
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+func TestFreeName(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   string
+		existing []string
+		file     string
+		want     string
+	}{
+		{name: "free", policy: PolicyCounter, file: "report.csv", want: `^report\.csv$`},
+		{name: "counter", policy: PolicyCounter, existing: []string{"report.csv"}, file: "report.csv", want: `^report-1\.csv$`},
+		{name: "next counter", policy: PolicyCounter, existing: []string{"report.csv", "report-1.csv", "report-2.csv"}, file: "report.csv", want: `^report-3\.csv$`},
+		{name: "no extension", policy: PolicyCounter, existing: []string{"README"}, file: "README", want: `^README-1$`},
+		{name: "only the last extension", policy: PolicyCounter, existing: []string{"logs.tar.gz"}, file: "logs.tar.gz", want: `^logs\.tar-1\.gz$`},
+		{name: "taken by a folder", policy: PolicyCounter, existing: []string{"reports/"}, file: "reports", want: `^reports-1$`},
+		{name: "timestamp", policy: PolicyTimestamp, existing: []string{"report.csv"}, file: "report.csv", want: `^report-\d{8}-\d{6}\.csv$`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			for _, name := range tt.existing {
+				var err error
+
+				if name[len(name)-1] == '/' {
+					err = os.Mkdir(filepath.Join(dir, name), 0755)
+				} else {
+					err = os.WriteFile(filepath.Join(dir, name), nil, 0644)
+				}
+
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			store, err := NewStore(StoreConfig{Policy: tt.policy})
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := store.freeName(filepath.Join(dir, tt.file))
+
+			if filepath.Dir(got) != dir || !regexp.MustCompile(tt.want).MatchString(filepath.Base(got)) {
+				t.Errorf("freeName(%q) = %q, want a name matching %s", tt.file, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFreeNameTimestampTaken(t *testing.T) {
+	dir := t.TempDir()
+	store, _ := NewStore(StoreConfig{Policy: PolicyTimestamp})
+	first := store.freeName(filepath.Join(dir, "report.csv"))
+
+	if err := os.WriteFile(first, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stamped := store.freeName(first)
+
+	if err := os.WriteFile(stamped, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another upload in the same second gets a counter after the timestamp
+	if got := store.freeName(first); got == stamped || !regexp.MustCompile(`^report-\d{8}-\d{6}(-1)?\.csv$`).MatchString(filepath.Base(got)) {
+		t.Errorf("freeName = %q, want a free name beside %q", got, stamped)
+	}
+}
+
+func TestRemoved(t *testing.T) {
+	wd, err := os.Getwd()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		_ = os.Chdir(wd)
+	})
+
+	store, err := NewStore(StoreConfig{Policy: PolicyVersion, Keep: 5})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fullPath, _ := filepath.Abs(filepath.Join("uploads", "partner", "june"))
+	nested := filepath.Join(fullPath, "totals.csv")
+
+	if err = os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = os.WriteFile(fullPath, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = store.SaveVersion(fullPath); err != nil {
+		t.Fatal(err)
+	}
+
+	// Copies of a file in a folder that was once named june share the
+	// versions folder of june
+	nestedCopy := filepath.Join("uploads", ".slurper", "versions", "partner", "june", "totals.csv", "1")
+
+	if err = os.MkdirAll(filepath.Dir(nestedCopy), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = os.WriteFile(nestedCopy, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = store.Removed(fullPath); err != nil {
+		t.Fatalf("Removed error = %v", err)
+	}
+
+	if versions, _ := store.List(fullPath); len(versions) != 0 {
+		t.Errorf("%d old copies of the removed file kept, want none", len(versions))
+	}
+
+	if versions, _ := store.List(nested); len(versions) != 1 {
+		t.Errorf("%d old copies of the file in the folder of the same name, want 1", len(versions))
+	}
+
+	if err = store.Removed(nested); err != nil {
+		t.Fatalf("Removed error = %v", err)
+	}
+
+	if _, err = os.Stat(filepath.Join("uploads", ".slurper", "versions", "partner")); !os.IsNotExist(err) {
+		t.Errorf("empty versions folder was kept: %v", err)
+	}
+}
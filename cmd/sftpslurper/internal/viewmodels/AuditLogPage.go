@@ -0,0 +1,74 @@
+package viewmodels
+
+import (
+	"html/template"
+
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/audit"
+	"github.com/dustin/go-humanize"
+)
+
+type AuditLogPage struct {
+	BaseViewModel
+
+	Enabled      bool
+	Records      []AuditRecord
+	Filter       AuditFilter
+	TotalMatches int
+	DownloadURL  template.URL
+}
+
+type AuditFilter struct {
+	User      string
+	Operation string
+	Path      string
+	Protocol  string
+	Result    string
+	Since     string
+	Until     string
+}
+
+type AuditRecord struct {
+	Time       string
+	SessionID  string
+	User       string
+	RemoteAddr string
+	Protocol   string
+	Operation  string
+	Path       string
+	Target     string
+	Bytes      string
+	Duration   string
+	Result     string
+	Error      string
+}
+
+func NewAuditRecord(r audit.Record) AuditRecord {
+	result := AuditRecord{
+		Time:       r.Time.Format("2006-01-02 15:04:05"),
+		SessionID:  r.SessionID,
+		User:       r.User,
+		RemoteAddr: r.RemoteAddr,
+		Protocol:   r.Protocol,
+		Operation:  r.Operation,
+		Path:       r.Path,
+		Target:     r.Target,
+		Bytes:      "",
+		Duration:   humanizeMs(r.DurationMs),
+		Result:     r.Result,
+		Error:      r.Error,
+	}
+
+	if r.Bytes > 0 {
+		result.Bytes = humanize.Bytes(uint64(r.Bytes))
+	}
+
+	return result
+}
+
+func humanizeMs(ms int64) string {
+	if ms < 1000 {
+		return humanize.Comma(ms) + " ms"
+	}
+
+	return humanize.FtoaWithDigits(float64(ms)/1000, 2) + " s"
+}
@@ -0,0 +1,51 @@
+package viewmodels
+
+import (
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/authlog"
+)
+
+type AuthAttemptsPage struct {
+	BaseViewModel
+
+	Attempts     []AuthAttempt
+	LockedUsers  []LockedUser
+	FilterUser   string
+	FilterResult string
+	Results      []string
+}
+
+type AuthAttempt struct {
+	Time          string
+	User          string
+	Method        string
+	RemoteIP      string
+	ClientVersion string
+	Result        string
+	Reason        string
+}
+
+type LockedUser struct {
+	User        string
+	Failures    int
+	LockedUntil string
+}
+
+func NewAuthAttempt(a authlog.Attempt) AuthAttempt {
+	return AuthAttempt{
+		Time:          a.Time.Format("2006-01-02 15:04:05"),
+		User:          a.User,
+		Method:        a.Method,
+		RemoteIP:      a.RemoteIP,
+		ClientVersion: a.ClientVersion,
+		Result:        a.Result,
+		Reason:        a.Reason,
+	}
+}
+
+func NewLockedUser(l authlog.LockedUser) LockedUser {
+	return LockedUser{
+		User:        l.User,
+		Failures:    l.Failures,
+		LockedUntil: l.LockedUntil.Format("2006-01-02 15:04:05"),
+	}
+}
@@ -1,6 +1,8 @@
 package viewmodels
 
 import (
+	"slices"
+
 	"github.com/adampresley/adamgokit/rendering"
 )
 
@@ -11,4 +13,26 @@ type BaseViewModel struct {
 	IsHtmx             bool
 	JavascriptIncludes []rendering.JavascriptInclude
 	Version            string
+	Viewer             Viewer
+}
+
+/*
+Viewer is the person using the web interface. When no login is required
+everyone is an anonymous admin. Home is the folder inside the upload
+folder they see, and Permissions what they may do there. Admins may
+switch to the view of one of the SFTP users listed in Views, in which
+case ViewingAs is that user.
+*/
+type Viewer struct {
+	Name        string
+	IsAdmin     bool
+	Home        string
+	Permissions []string
+	ViewingAs   string
+	Views       []string
+}
+
+// Can returns true when the viewer has the given permission.
+func (v Viewer) Can(permission string) bool {
+	return slices.Contains(v.Permissions, permission)
 }
@@ -0,0 +1,23 @@
+package viewmodels
+
+import "github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/configuration"
+
+type CleanupPage struct {
+	BaseViewModel
+
+	Rules      []configuration.RetentionRule
+	Candidates []CleanupCandidate
+	TotalSize  string
+
+	// Interval describes how often the rules are applied, such as "60 minutes".
+	// It is blank when they are only applied by hand.
+	Interval string
+}
+
+type CleanupCandidate struct {
+	Rule    string
+	Path    string
+	Size    string
+	ModTime string
+	Reason  string
+}
@@ -0,0 +1,152 @@
+package viewmodels
+
+import (
+	"net/url"
+	"time"
+)
+
+type FileDetails struct {
+	BaseViewModel
+
+	Path          string
+	Name          string
+	IsDir         bool
+	Size          int64
+	SizeLabel     string
+	ModTime       time.Time
+	Permissions   string
+	ContentType   string
+	ExtensionType string
+	LineEndings   string
+	Encoding      string
+	Truncated     bool
+	AuditEnabled  bool
+	Origin        *FileOrigin
+	Versions      []FileVersion
+	Hooks         *HookRun
+	IsPgp         bool
+}
+
+/*
+FileOrigin is the audit record of the operation that last wrote a file,
+such as an SFTP upload or a copy in the web interface.
+*/
+type FileOrigin struct {
+	Operation  string
+	Protocol   string
+	User       string
+	SessionID  string
+	RemoteAddr string
+	Time       time.Time
+	Source     string
+}
+
+/*
+FileVersion is an old copy of a file, kept when a newer upload replaced
+it.
+*/
+type FileVersion struct {
+	Path    string
+	ID      string
+	Size    string
+	ModTime time.Time
+	SavedAt time.Time
+}
+
+/*
+HookRun is the last run of the upload hooks on a file.
+*/
+type HookRun struct {
+	Status   string
+	User     string
+	Started  time.Time
+	Finished time.Time
+	Results  []HookResult
+}
+
+type HookResult struct {
+	Hook     string
+	Action   string
+	Path     string
+	ExitCode int
+	Output   string
+	Error    string
+	Duration string
+}
+
+/*
+FilePgp describes a file of OpenPGP data: who a message is encrypted to,
+its signature, and the keys in a key block.
+*/
+type FilePgp struct {
+	BaseViewModel
+
+	Path       string
+	Kind       string
+	Armored    bool
+	Encrypted  bool
+	Recipients []PgpRecipient
+	FileName   string
+	Size       string
+	Signed     string
+	Keys       []string
+	Signature  PgpSignature
+	CanDecrypt bool
+}
+
+type PgpRecipient struct {
+	KeyID     string
+	InKeyring bool
+}
+
+type PgpSignature struct {
+	Status string
+	Signer string
+	KeyID  string
+	Error  string
+}
+
+type FileChecksums struct {
+	BaseViewModel
+
+	MD5    string
+	SHA1   string
+	SHA256 string
+	Cached bool
+}
+
+// ChecksumsURL returns the URL that computes the file's checksums.
+func (d FileDetails) ChecksumsURL() string {
+	values := url.Values{}
+	values.Set("path", d.Path)
+	return "/files/checksums?" + values.Encode()
+}
+
+// PgpURL returns the URL that describes the file's OpenPGP data.
+func (d FileDetails) PgpURL() string {
+	values := url.Values{}
+	values.Set("path", d.Path)
+	return "/files/pgp?" + values.Encode()
+}
+
+// DownloadURL returns the URL that downloads the file.
+func (d FileDetails) DownloadURL() string {
+	values := url.Values{}
+	values.Set("path", d.Path)
+	return "/uploads?" + values.Encode()
+}
+
+// DownloadURL returns the URL that downloads the old copy.
+func (v FileVersion) DownloadURL() string {
+	values := url.Values{}
+	values.Set("path", v.Path)
+	values.Set("id", v.ID)
+	return "/versions?" + values.Encode()
+}
+
+// DecryptURL returns the URL that downloads the decrypted content.
+func (p FilePgp) DecryptURL() string {
+	values := url.Values{}
+	values.Set("path", p.Path)
+	return "/decrypt?" + values.Encode()
+}
@@ -1,13 +1,15 @@
 package viewmodels
 
 import (
-	"fmt"
-	"html/template"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/filetypes"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/preview"
 	"github.com/dustin/go-humanize"
 )
 
@@ -17,6 +19,102 @@ type Home struct {
 	Files  []File
 	Root   string
 	Parent string
+
+	Query      ListingQuery
+	TotalFiles int
+	TotalPages int
+}
+
+/*
+ListingQuery holds the sort, filter, and paging options of the directory
+listing as they appear in the query string.
+*/
+type ListingQuery struct {
+	Sort      string
+	Direction string
+	Filter    string
+	Since     string
+	Until     string
+	Page      int
+	PageSize  int
+}
+
+/*
+URL returns the home page URL for the current folder with these options.
+*/
+func (h Home) URL(q ListingQuery) string {
+	values := url.Values{}
+	values.Set("root", h.Root)
+
+	for key, value := range map[string]string{"sort": q.Sort, "dir": q.Direction, "filter": q.Filter, "since": q.Since, "until": q.Until} {
+		if value != "" {
+			values.Set(key, value)
+		}
+	}
+
+	if q.Page > 1 {
+		values.Set("page", strconv.Itoa(q.Page))
+	}
+
+	if q.PageSize > 0 {
+		values.Set("pagesize", strconv.Itoa(q.PageSize))
+	}
+
+	return "/?" + values.Encode()
+}
+
+/*
+SortURL returns the URL that sorts by column. Choosing the current sort
+column again flips the direction.
+*/
+func (h Home) SortURL(column string) string {
+	q := h.Query
+	q.Page = 1
+
+	if q.Sort == column && q.Direction == "asc" {
+		q.Direction = "desc"
+	} else {
+		q.Direction = "asc"
+	}
+
+	q.Sort = column
+	return h.URL(q)
+}
+
+// SortIndicator returns an arrow when the listing is sorted by column.
+func (h Home) SortIndicator(column string) string {
+	if h.Query.Sort != column {
+		return ""
+	}
+
+	if h.Query.Direction == "desc" {
+		return "▼"
+	}
+
+	return "▲"
+}
+
+// PageURL returns the URL of another page of the listing.
+func (h Home) PageURL(page int) string {
+	q := h.Query
+	q.Page = page
+	return h.URL(q)
+}
+
+func (h Home) HasPreviousPage() bool {
+	return h.Query.Page > 1
+}
+
+func (h Home) HasNextPage() bool {
+	return h.Query.Page < h.TotalPages
+}
+
+func (h Home) PreviousPage() int {
+	return h.Query.Page - 1
+}
+
+func (h Home) NextPage() int {
+	return h.Query.Page + 1
 }
 
 type File struct {
@@ -25,17 +123,32 @@ type File struct {
 	CanBePreviewed bool
 	Ext            string
 	DirPath        string
-	Name           template.HTML
+	Name           string
 	Date           string
 	Size           string
+	Thumbnail      string
+	DetailsURL     string
+
+	// HookStatus is the status of the last hooks run on the file, or blank
+	HookStatus string
+
+	// Validation is the last validation report of the file, or nil
+	Validation *FileValidation
 }
 
-func NewFileFromOS(f os.DirEntry, root string) (File, error) {
-	var (
-		err      error
-		fileInfo os.FileInfo
-	)
+/*
+FileValidation is the result of checking a file against the validation
+rules. Errors are those of the checks that failed, each prefixed with
+its rule and check.
+*/
+type FileValidation struct {
+	Status  string
+	Checked time.Time
+	Checks  int
+	Errors  []string
+}
 
+func NewFileFromInfo(f os.FileInfo, root string) File {
 	ext := filepath.Ext(f.Name())
 	result := File{
 		Icon:           "icon " + getIcon(ext, f.IsDir()),
@@ -43,15 +156,22 @@ func NewFileFromOS(f os.DirEntry, root string) (File, error) {
 		Ext:            strings.TrimPrefix(ext, "."),
 		CanBePreviewed: isPreviewable(ext),
 		DirPath:        "",
-		Name:           template.HTML(f.Name()),
+		Name:           f.Name(),
 	}
 
-	if fileInfo, err = f.Info(); err != nil {
-		return result, fmt.Errorf("failed to get file info: %w", err)
+	details := url.Values{}
+	details.Set("path", filepath.ToSlash(filepath.Join(root, f.Name())))
+	result.DetailsURL = "/files/details?" + details.Encode()
+
+	if !f.IsDir() && preview.CanThumbnail(result.Ext) {
+		values := url.Values{}
+		values.Set("path", filepath.ToSlash(filepath.Join(root, f.Name())))
+		values.Set("v", strconv.FormatInt(f.ModTime().Unix(), 10))
+		result.Thumbnail = "/thumbnails?" + values.Encode()
 	}
 
-	result.Date = fileInfo.ModTime().Format("2006-01-02 15:04:05")
-	result.Size = humanize.Bytes(uint64(fileInfo.Size()))
+	result.Date = f.ModTime().Format("2006-01-02 15:04:05")
+	result.Size = humanize.Bytes(uint64(f.Size()))
 
 	if result.IsDirectory {
 		result.Size = ""
@@ -65,7 +185,7 @@ func NewFileFromOS(f os.DirEntry, root string) (File, error) {
 		result.DirPath = filepath.ToSlash(result.DirPath)
 	}
 
-	return result, nil
+	return result
 }
 
 func getIcon(ext string, isDir bool) string {
@@ -81,17 +201,32 @@ func getIcon(ext string, isDir bool) string {
 }
 
 func isPreviewable(ext string) bool {
+	if _, ok := preview.TextFormat(strings.TrimPrefix(ext, ".")); ok {
+		return true
+	}
+
+	if _, ok := preview.ArchiveFormat(ext); ok {
+		return true
+	}
+
 	previewable := map[string]struct{}{
-		".txt":  {},
+		".csv":  {},
+		".tsv":  {},
+		".xls":  {},
+		".xlsx": {},
 		".jpg":  {},
 		".jpeg": {},
 		".png":  {},
 		".webp": {},
+		".gif":  {},
+		".bmp":  {},
 		".mp3":  {},
 		".m4a":  {},
 		".wav":  {},
 		".mp4":  {},
 		".mov":  {},
+		".m4v":  {},
+		".webm": {},
 	}
 
 	if _, ok := previewable[ext]; ok {
@@ -0,0 +1,8 @@
+package viewmodels
+
+type LoginPage struct {
+	BaseViewModel
+
+	UserName string
+	Next     string
+}
@@ -0,0 +1,69 @@
+package viewmodels
+
+import (
+	"path/filepath"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+type SearchPage struct {
+	BaseViewModel
+
+	Form     SearchForm
+	Searched bool
+	Results  []SearchResult
+}
+
+type SearchForm struct {
+	Name       string
+	Extensions string
+	MinSize    string
+	MaxSize    string
+	Since      string
+	Until      string
+	Content    string
+	Regex      bool
+	IgnoreCase bool
+}
+
+type SearchResult struct {
+	Path    string
+	Root    string
+	Name    string
+	Icon    string
+	IsDir   bool
+	Size    string
+	Date    string
+	Matches []SearchMatch
+}
+
+type SearchMatch struct {
+	Line int
+	Text string
+}
+
+/*
+NewSearchResult builds a search result. Root is the folder to open in the
+file browser: the folder itself for folders, or the containing folder for
+files.
+*/
+func NewSearchResult(path, dir, name string, isDir bool, size int64, modTime time.Time) SearchResult {
+	result := SearchResult{
+		Path:    path,
+		Root:    dir,
+		Name:    name,
+		IsDir:   isDir,
+		Icon:    "icon " + getIcon(filepath.Ext(name), isDir),
+		Size:    humanize.Bytes(uint64(size)),
+		Date:    modTime.Format("2006-01-02 15:04:05"),
+		Matches: []SearchMatch{},
+	}
+
+	if isDir {
+		result.Root = path
+		result.Size = ""
+	}
+
+	return result
+}
@@ -0,0 +1,49 @@
+package viewmodels
+
+import (
+	"path"
+
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/trashbin"
+	"github.com/dustin/go-humanize"
+)
+
+type TrashPage struct {
+	BaseViewModel
+
+	Items []TrashItem
+
+	// MaxAge describes how long items are kept, such as "30 days". It is
+	// blank when they are kept until purged by hand.
+	MaxAge string
+}
+
+type TrashItem struct {
+	ID        string
+	Icon      string
+	Path      string
+	IsDir     bool
+	Size      string
+	DeletedBy string
+	Protocol  string
+	DeletedAt string
+	PurgedIn  string
+}
+
+func NewTrashItem(item trashbin.Item, maxAgeDays int) TrashItem {
+	result := TrashItem{
+		ID:        item.ID,
+		Icon:      "icon " + getIcon(path.Ext(item.Path), item.IsDir),
+		Path:      item.Path,
+		IsDir:     item.IsDir,
+		Size:      humanize.Bytes(uint64(item.Size)),
+		DeletedBy: item.DeletedBy,
+		Protocol:  item.Protocol,
+		DeletedAt: item.DeletedAt.Format("2006-01-02 15:04:05"),
+	}
+
+	if maxAgeDays > 0 {
+		result.PurgedIn = humanize.Time(item.DeletedAt.AddDate(0, 0, maxAgeDays))
+	}
+
+	return result
+}
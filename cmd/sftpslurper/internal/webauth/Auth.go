@@ -0,0 +1,154 @@
+package webauth
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/authlog"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/configuration"
+)
+
+const (
+	// AuthMethodWeb is the method recorded in the auth log for logins to
+	// the web interface, so they can be told apart from SFTP logins
+	AuthMethodWeb string = "web"
+)
+
+type AuthConfig struct {
+	Config  *configuration.Config
+	AuthLog *authlog.AttemptLog
+	Guard   *authlog.Guard
+
+	// Secure marks session cookies as HTTPS only
+	Secure bool
+}
+
+/*
+Auth logs people into the web interface and checks their session on every
+request. Logins go through the same guard as SFTP logins, so lockouts and
+rate limits apply to both, and every attempt is recorded in the auth log.
+When no login is configured Auth lets every request through as an admin.
+Admins may switch to the view of any SFTP user.
+*/
+type Auth struct {
+	users     map[string]configuration.WebUser
+	sftpUsers map[string]configuration.User
+	views     []string
+	authLog   *authlog.AttemptLog
+	guard     *authlog.Guard
+	sessions  sessions
+	secure    bool
+}
+
+func NewAuth(config AuthConfig) (*Auth, error) {
+	result := &Auth{
+		users:     map[string]configuration.WebUser{},
+		sftpUsers: map[string]configuration.User{},
+		authLog:   config.AuthLog,
+		guard:     config.Guard,
+		secure:    config.Secure,
+	}
+
+	for _, u := range config.Config.WebUsers {
+		result.users[u.Name] = u
+	}
+
+	for _, u := range config.Config.Users {
+		result.sftpUsers[u.Name] = u
+		result.views = append(result.views, u.Name)
+	}
+
+	if !result.Enabled() {
+		return result, nil
+	}
+
+	secret, err := sessionSecret(config.Config)
+
+	if err != nil {
+		return nil, fmt.Errorf("error loading session secret: %w", err)
+	}
+
+	result.sessions = sessions{
+		secret:   secret,
+		lifetime: time.Duration(max(config.Config.WebSessionHours, 1)) * time.Hour,
+		secure:   config.Secure,
+	}
+
+	return result, nil
+}
+
+// Enabled returns true when the web interface requires a login.
+func (a *Auth) Enabled() bool {
+	return len(a.users) > 0
+}
+
+/*
+Login checks a user name and password, recording the attempt. remoteAddr
+is the request's remote address.
+*/
+func (a *Auth) Login(name, password, remoteAddr, userAgent string) (configuration.WebUser, error) {
+	attempt := authlog.Attempt{
+		Time:          time.Now(),
+		User:          name,
+		Method:        AuthMethodWeb,
+		RemoteIP:      remoteIP(remoteAddr),
+		ClientVersion: userAgent,
+		Result:        authlog.ResultSuccess,
+	}
+
+	user, err := a.checkLogin(name, password, attempt.RemoteIP)
+
+	switch {
+	case err == nil:
+		a.guard.RecordSuccess(name)
+
+	case errors.Is(err, authlog.ErrLocked):
+		attempt.Result = authlog.ResultLocked
+		attempt.Reason = err.Error()
+
+	case errors.Is(err, authlog.ErrRateLimited):
+		attempt.Result = authlog.ResultRateLimited
+		attempt.Reason = err.Error()
+
+	default:
+		attempt.Result = authlog.ResultFailure
+		attempt.Reason = err.Error()
+		a.guard.RecordFailure(name)
+	}
+
+	a.authLog.Record(attempt)
+	return user, err
+}
+
+func (a *Auth) checkLogin(name, password, ip string) (configuration.WebUser, error) {
+	if err := a.guard.Check(name, ip); err != nil {
+		return configuration.WebUser{}, err
+	}
+
+	user, ok := a.users[name]
+
+	// Compare even for unknown users, so the time taken doesn't tell
+	// which user names exist
+	matches := subtle.ConstantTimeCompare([]byte(user.Password), []byte(password)) == 1
+
+	if !ok {
+		return user, fmt.Errorf("unknown user %q", name)
+	}
+
+	if !matches {
+		return user, fmt.Errorf("password rejected for %q", name)
+	}
+
+	return user, nil
+}
+
+func remoteIP(remoteAddr string) string {
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		return host
+	}
+
+	return remoteAddr
+}
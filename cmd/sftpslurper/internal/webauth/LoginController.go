@@ -0,0 +1,158 @@
+package webauth
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/adampresley/adamgokit/httphelpers"
+	"github.com/adampresley/adamgokit/rendering"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/authlog"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/configuration"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/viewmodels"
+)
+
+type LoginHandlers interface {
+	LoginPage(w http.ResponseWriter, r *http.Request)
+	Login(w http.ResponseWriter, r *http.Request)
+	Logout(w http.ResponseWriter, r *http.Request)
+	ViewAs(w http.ResponseWriter, r *http.Request)
+}
+
+type LoginControllerConfig struct {
+	Config   *configuration.Config
+	Renderer rendering.TemplateRenderer
+	Auth     *Auth
+}
+
+type LoginController struct {
+	config   *configuration.Config
+	renderer rendering.TemplateRenderer
+	auth     *Auth
+}
+
+func NewLoginController(config LoginControllerConfig) LoginController {
+	return LoginController{
+		config:   config.Config,
+		renderer: config.Renderer,
+		auth:     config.Auth,
+	}
+}
+
+/*
+GET /login?next={next}
+*/
+func (c LoginController) LoginPage(w http.ResponseWriter, r *http.Request) {
+	if !c.auth.Enabled() {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	c.renderLoginPage(w, r, "", "")
+}
+
+/*
+POST /login
+
+Checks the name and password from the login form, then starts a session
+and returns to the page that asked for the login.
+*/
+func (c LoginController) Login(w http.ResponseWriter, r *http.Request) {
+	if !c.auth.Enabled() {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	name := strings.TrimSpace(r.PostFormValue("name"))
+	password := r.PostFormValue("password")
+
+	user, err := c.auth.Login(name, password, r.RemoteAddr, r.UserAgent())
+
+	switch {
+	case errors.Is(err, authlog.ErrLocked):
+		c.renderLoginPage(w, r, name, "This account is locked. Try again later.")
+		return
+
+	case errors.Is(err, authlog.ErrRateLimited):
+		c.renderLoginPage(w, r, name, "Too many attempts. Try again in a minute.")
+		return
+
+	case err != nil:
+		c.renderLoginPage(w, r, name, "Invalid user name or password")
+		return
+	}
+
+	if err = c.auth.sessions.start(w, user.Name); err != nil {
+		slog.Error("error starting web session", "error", err, "user", user.Name)
+		c.renderLoginPage(w, r, name, "Unable to log in. Please try again.")
+		return
+	}
+
+	slog.Info("web login", "user", user.Name, "role", user.Role, "remoteAddr", r.RemoteAddr)
+	http.Redirect(w, r, safeNext(r.PostFormValue("next")), http.StatusSeeOther)
+}
+
+/*
+POST /logout
+*/
+func (c LoginController) Logout(w http.ResponseWriter, r *http.Request) {
+	if c.auth.Enabled() {
+		c.auth.sessions.end(w)
+	}
+
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
+
+/*
+POST /view-as
+
+Switches an admin to the view of the SFTP user named in the form, or back
+to the whole upload folder when the name is blank.
+*/
+func (c LoginController) ViewAs(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimSpace(r.PostFormValue("user"))
+
+	if _, ok := c.auth.sftpUsers[name]; name != "" && !ok {
+		http.Error(w, "Unknown user", http.StatusBadRequest)
+		return
+	}
+
+	slog.Info("switching web view", "user", ViewerFromRequest(r).Name, "viewAs", name)
+	c.auth.setView(w, name)
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+func (c LoginController) renderLoginPage(w http.ResponseWriter, r *http.Request, name, message string) {
+	pageName := "pages/login"
+
+	viewData := viewmodels.LoginPage{
+		BaseViewModel: viewmodels.BaseViewModel{
+			Version:            c.config.Version,
+			Message:            message,
+			IsError:            message != "",
+			IsHtmx:             httphelpers.IsHtmx(r),
+			JavascriptIncludes: []rendering.JavascriptInclude{},
+		},
+		UserName: name,
+		Next:     safeNext(r.FormValue("next")),
+	}
+
+	if message != "" {
+		w.WriteHeader(http.StatusUnauthorized)
+	}
+
+	c.renderer.Render(pageName, viewData, w)
+}
+
+/*
+safeNext only allows returning to a page on this site, so the login page
+can't be used to send people elsewhere.
+*/
+func safeNext(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+
+	return next
+}
@@ -0,0 +1,28 @@
+package webauth
+
+import "testing"
+
+func TestSafeNext(t *testing.T) {
+	tests := []struct {
+		name string
+		next string
+		want string
+	}{
+		{name: "page", next: "/trash", want: "/trash"},
+		{name: "page with a query", next: "/?root=%2Freports", want: "/?root=%2Freports"},
+		{name: "blank", next: "", want: "/"},
+		{name: "relative", next: "trash", want: "/"},
+		{name: "absolute url", next: "https://example.com/", want: "/"},
+		{name: "protocol relative", next: "//example.com/", want: "/"},
+		{name: "backslash", next: `/\example.com`, want: "/"},
+		{name: "javascript", next: "javascript:alert(1)", want: "/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := safeNext(tt.next); got != tt.want {
+				t.Errorf("safeNext(%q) = %q, want %q", tt.next, got, tt.want)
+			}
+		})
+	}
+}
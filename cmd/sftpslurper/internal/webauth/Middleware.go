@@ -0,0 +1,191 @@
+package webauth
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/adampresley/adamgokit/httphelpers"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/configuration"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/viewmodels"
+)
+
+type contextKey struct{}
+
+var (
+	// publicPaths are served without a login
+	publicPaths = []string{"/login", "/logout", "/heartbeat"}
+
+	// adminPaths are pages only admins may see
+	adminPaths = []string{"/audit-log", "/auth-attempts", "/view-as", "/trash", "/cleanup"}
+
+	// routePermissions are the permissions needed for each file route.
+	// Any other request that isn't a GET needs an admin.
+	routePermissions = map[string][]string{
+		"GET /":                {configuration.PermissionList},
+		"GET /search":          {configuration.PermissionList},
+		"GET /files/details":   {configuration.PermissionList},
+		"GET /uploads":         {configuration.PermissionRead},
+		"GET /preview":         {configuration.PermissionRead},
+		"GET /compare":         {configuration.PermissionRead},
+		"GET /archive":         {configuration.PermissionRead},
+		"GET /archive/entry":   {configuration.PermissionRead},
+		"GET /thumbnails":      {configuration.PermissionRead},
+		"GET /files/checksums": {configuration.PermissionRead},
+		"GET /versions":        {configuration.PermissionRead},
+		"GET /decrypt":         {configuration.PermissionRead},
+		"GET /files/pgp":       {configuration.PermissionRead},
+		"DELETE /uploads":      {configuration.PermissionDelete},
+		"POST /uploads":        {configuration.PermissionWrite},
+		"POST /uploads/chunk":  {configuration.PermissionWrite},
+		"POST /folders":        {configuration.PermissionWrite},
+		"POST /files/copy":     {configuration.PermissionRead, configuration.PermissionWrite},
+		"POST /files/move":     {configuration.PermissionRename},
+	}
+
+	// queryPermissions are needed on top of a route's permissions when the
+	// query parameter is set. Content search shows lines from inside files.
+	queryPermissions = map[string]map[string][]string{
+		"GET /search": {"content": {configuration.PermissionRead}},
+	}
+)
+
+/*
+Middleware requires a valid session for every route but the login page,
+the admin role for admin pages, and the viewer's permissions for file
+routes. Pages are redirected to the login page, while htmx and script
+requests get a 401 so they don't swap a login form into the page.
+*/
+func (a *Auth) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isPublicPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		viewer := viewmodels.Viewer{IsAdmin: true}
+
+		if a.Enabled() {
+			current, err := a.sessions.read(r)
+			user, ok := a.users[current.User]
+
+			if err != nil || !ok {
+				if err != http.ErrNoCookie {
+					slog.Info("rejecting web session", "error", err, "user", current.User, "path", r.URL.Path)
+				}
+
+				a.requireLogin(w, r)
+				return
+			}
+
+			viewer = viewmodels.Viewer{
+				Name:        user.Name,
+				IsAdmin:     user.Role == configuration.RoleAdmin,
+				Home:        user.Home,
+				Permissions: user.Permissions,
+			}
+		}
+
+		if viewer.IsAdmin {
+			a.applyView(&viewer, viewFromRequest(r))
+		}
+
+		if err := authorize(r, viewer); err != nil {
+			slog.Warn("web request denied", "user", viewer.Name, "viewingAs", viewer.ViewingAs, "method", r.Method, "path", r.URL.Path, "reason", err)
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKey{}, viewer)))
+	})
+}
+
+func (a *Auth) requireLogin(w http.ResponseWriter, r *http.Request) {
+	loginURL := "/login"
+
+	if r.URL.Path != "/" || r.URL.RawQuery != "" {
+		loginURL += "?" + url.Values{"next": {r.URL.RequestURI()}}.Encode()
+	}
+
+	if httphelpers.IsHtmx(r) {
+		w.Header().Set("HX-Redirect", loginURL)
+		http.Error(w, "Please log in", http.StatusUnauthorized)
+		return
+	}
+
+	if r.Method == http.MethodGet && strings.Contains(r.Header.Get("Accept"), "text/html") {
+		http.Redirect(w, r, loginURL, http.StatusSeeOther)
+		return
+	}
+
+	http.Error(w, "Please log in", http.StatusUnauthorized)
+}
+
+/*
+ViewerFromRequest returns who is making a request. When no login is
+required this is an anonymous admin.
+*/
+func ViewerFromRequest(r *http.Request) viewmodels.Viewer {
+	if viewer, ok := r.Context().Value(contextKey{}).(viewmodels.Viewer); ok {
+		return viewer
+	}
+
+	return viewmodels.Viewer{IsAdmin: true, Permissions: configuration.AllPermissions}
+}
+
+func isPublicPath(path string) bool {
+	for _, public := range publicPaths {
+		if path == public {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+authorize returns an error explaining why the viewer may not make a
+request, or nil when they may.
+*/
+func authorize(r *http.Request, viewer viewmodels.Viewer) error {
+	for _, adminPath := range adminPaths {
+		if (r.URL.Path == adminPath || strings.HasPrefix(r.URL.Path, adminPath+"/")) && !viewer.IsAdmin {
+			return fmt.Errorf("Only admins may do this")
+		}
+	}
+
+	method := r.Method
+
+	if method == http.MethodHead {
+		method = http.MethodGet
+	}
+
+	route := method + " " + r.URL.Path
+	permissions, ok := routePermissions[route]
+
+	for parameter, needed := range queryPermissions[route] {
+		if r.URL.Query().Get(parameter) != "" {
+			permissions = append(slices.Clone(permissions), needed...)
+		}
+	}
+
+	if !ok {
+		if method != http.MethodGet && !viewer.IsAdmin {
+			return fmt.Errorf("Only admins may do this")
+		}
+
+		return nil
+	}
+
+	for _, permission := range permissions {
+		if !viewer.Can(permission) {
+			return fmt.Errorf("You don't have the %s permission", permission)
+		}
+	}
+
+	return nil
+}
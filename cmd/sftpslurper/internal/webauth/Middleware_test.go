@@ -0,0 +1,45 @@
+package webauth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/configuration"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/viewmodels"
+)
+
+func TestAuthorize(t *testing.T) {
+	listOnly := viewmodels.Viewer{Name: "partner", Permissions: []string{configuration.PermissionList}}
+	reader := viewmodels.Viewer{Name: "partner", Permissions: []string{configuration.PermissionList, configuration.PermissionRead}}
+	admin := viewmodels.Viewer{Name: "admin", IsAdmin: true, Permissions: configuration.AllPermissions}
+
+	tests := []struct {
+		name    string
+		method  string
+		target  string
+		viewer  viewmodels.Viewer
+		wantErr bool
+	}{
+		{name: "listing", method: http.MethodGet, target: "/", viewer: listOnly},
+		{name: "name search", method: http.MethodGet, target: "/search?name=june", viewer: listOnly},
+		{name: "content search without read", method: http.MethodGet, target: "/search?name=june&content=secret", viewer: listOnly, wantErr: true},
+		{name: "content search with read", method: http.MethodGet, target: "/search?content=secret", viewer: reader},
+		{name: "blank content search", method: http.MethodGet, target: "/search?content=", viewer: listOnly},
+		{name: "download without read", method: http.MethodGet, target: "/uploads?name=june.csv", viewer: listOnly, wantErr: true},
+		{name: "head is checked as get", method: http.MethodHead, target: "/uploads?name=june.csv", viewer: listOnly, wantErr: true},
+		{name: "admin page", method: http.MethodGet, target: "/audit-log", viewer: reader, wantErr: true},
+		{name: "admin page for an admin", method: http.MethodGet, target: "/audit-log", viewer: admin},
+		{name: "unlisted change", method: http.MethodPost, target: "/trash/restore", viewer: reader, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := authorize(httptest.NewRequest(tt.method, tt.target, nil), tt.viewer)
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("authorize(%s %s) = %v, want error %v", tt.method, tt.target, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package webauth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/configuration"
+)
+
+const (
+	SessionCookieName = "slurper_session"
+)
+
+/*
+session is what the session cookie holds. The role isn't kept in the
+cookie, so a user's current role always applies.
+*/
+type session struct {
+	User    string    `json:"user"`
+	Expires time.Time `json:"expires"`
+}
+
+/*
+sessions issues and reads session cookies. Cookies are signed with an
+HMAC rather than stored on the server, so logins survive a restart as
+long as the secret does.
+*/
+type sessions struct {
+	secret   []byte
+	lifetime time.Duration
+	secure   bool
+}
+
+func (s sessions) start(w http.ResponseWriter, user string) error {
+	value := session{
+		User:    user,
+		Expires: time.Now().Add(s.lifetime),
+	}
+
+	b, err := json.Marshal(value)
+
+	if err != nil {
+		return err
+	}
+
+	payload := base64.RawURLEncoding.EncodeToString(b)
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookieName,
+		Value:    payload + "." + s.sign(payload),
+		Path:     "/",
+		Expires:  value.Expires,
+		HttpOnly: true,
+		Secure:   s.secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	return nil
+}
+
+func (s sessions) end(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   s.secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func (s sessions) read(r *http.Request) (session, error) {
+	result := session{}
+	cookie, err := r.Cookie(SessionCookieName)
+
+	if err != nil {
+		return result, err
+	}
+
+	payload, signature, ok := strings.Cut(cookie.Value, ".")
+
+	if !ok || !hmac.Equal([]byte(signature), []byte(s.sign(payload))) {
+		return result, errors.New("session cookie has a bad signature")
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(payload)
+
+	if err != nil {
+		return result, err
+	}
+
+	if err = json.Unmarshal(b, &result); err != nil {
+		return result, err
+	}
+
+	if time.Now().After(result.Expires) {
+		return result, errors.New("session has expired")
+	}
+
+	return result, nil
+}
+
+func (s sessions) sign(payload string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+/*
+sessionSecret returns the configured secret, or one kept in the secrets
+folder so logins survive a restart. The file is made on first use.
+*/
+func sessionSecret(config *configuration.Config) ([]byte, error) {
+	if config.WebSessionSecret != "" {
+		return []byte(config.WebSessionSecret), nil
+	}
+
+	secretPath, err := config.SecretPath("web-session.key")
+
+	if err != nil {
+		return nil, err
+	}
+
+	if b, err := os.ReadFile(secretPath); err == nil {
+		if secret, err := hex.DecodeString(strings.TrimSpace(string(b))); err == nil && len(secret) >= 32 {
+			return secret, nil
+		}
+	}
+
+	secret := make([]byte, 32)
+
+	if _, err = rand.Read(secret); err != nil {
+		return nil, err
+	}
+
+	if err = os.WriteFile(secretPath, []byte(hex.EncodeToString(secret)), 0600); err != nil {
+		return nil, fmt.Errorf("error saving session secret: %w", err)
+	}
+
+	return secret, nil
+}
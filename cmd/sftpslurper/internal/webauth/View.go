@@ -0,0 +1,73 @@
+package webauth
+
+import (
+	"net/http"
+	"path"
+	"path/filepath"
+
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/configuration"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/viewmodels"
+)
+
+const (
+	// ViewCookieName holds the SFTP user whose view an admin has switched to
+	ViewCookieName = "slurper_view"
+)
+
+/*
+applyView narrows an admin to the home folder and permissions of the SFTP
+user they switched to, so they see what that user sees.
+*/
+func (a *Auth) applyView(viewer *viewmodels.Viewer, name string) {
+	viewer.Home = ""
+	viewer.Permissions = configuration.AllPermissions
+	viewer.ViewingAs = ""
+	viewer.Views = a.views
+
+	if user, ok := a.sftpUsers[name]; ok {
+		viewer.Home = user.Home
+		viewer.Permissions = user.EffectivePermissions()
+		viewer.ViewingAs = user.Name
+	}
+}
+
+func (a *Auth) setView(w http.ResponseWriter, name string) {
+	cookie := &http.Cookie{
+		Name:     ViewCookieName,
+		Value:    name,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   a.secure,
+		SameSite: http.SameSiteLaxMode,
+	}
+
+	if name == "" {
+		cookie.MaxAge = -1
+	}
+
+	http.SetCookie(w, cookie)
+}
+
+func viewFromRequest(r *http.Request) string {
+	if cookie, err := r.Cookie(ViewCookieName); err == nil {
+		return cookie.Value
+	}
+
+	return ""
+}
+
+/*
+SanitizePath resolves a path from the web interface inside the viewer's
+home folder. See configuration.Config.SanitizeHomePath.
+*/
+func SanitizePath(r *http.Request, config *configuration.Config, requestedPath string) (string, error) {
+	return config.SanitizeHomePath(ViewerFromRequest(r).Home, requestedPath)
+}
+
+/*
+UploadPath turns a path in the viewer's home folder into a slash-separated
+path from the root of the upload folder, as recorded in the audit log.
+*/
+func UploadPath(r *http.Request, homePath string) string {
+	return path.Join("/", ViewerFromRequest(r).Home, filepath.ToSlash(homePath))
+}
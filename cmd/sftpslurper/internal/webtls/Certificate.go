@@ -0,0 +1,195 @@
+package webtls
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/configuration"
+)
+
+const (
+	// SelfSignedLifetime is how long a generated certificate is valid for
+	SelfSignedLifetime = 365 * 24 * time.Hour
+
+	// renewBefore is how close to expiring a generated certificate may get
+	// before it is replaced on startup
+	renewBefore = 7 * 24 * time.Hour
+)
+
+/*
+LoadCertificate returns the certificate to serve the web interface with,
+or nil when it should be served over plain HTTP. A configured certificate
+and key are used when set. Otherwise, when self-signed certificates are
+turned on, one is generated and kept in the secrets folder, so browsers
+that have accepted it keep doing so after a restart. It is replaced when
+it nears expiry or no longer covers the configured host names.
+*/
+func LoadCertificate(config *configuration.Config) (*tls.Certificate, error) {
+	switch {
+	case config.TlsCertFile != "" && config.TlsKeyFile != "":
+		certificate, err := tls.LoadX509KeyPair(config.TlsCertFile, config.TlsKeyFile)
+
+		if err != nil {
+			return nil, fmt.Errorf("error loading TLS certificate: %w", err)
+		}
+
+		return &certificate, nil
+
+	case config.TlsCertFile != "" || config.TlsKeyFile != "":
+		return nil, fmt.Errorf("tlscert and tlskey must be set together")
+
+	case !config.TlsSelfSigned:
+		return nil, nil
+	}
+
+	hosts := certificateHosts(config)
+	certPath, err := config.SecretPath("tls", "self-signed.crt")
+
+	if err != nil {
+		return nil, err
+	}
+
+	keyPath, err := config.SecretPath("tls", "self-signed.key")
+
+	if err != nil {
+		return nil, err
+	}
+
+	if certificate, err := tls.LoadX509KeyPair(certPath, keyPath); err == nil && stillValid(certificate, hosts) {
+		logFingerprint(certificate, certPath)
+		return &certificate, nil
+	}
+
+	if err = generateSelfSigned(certPath, keyPath, hosts); err != nil {
+		return nil, fmt.Errorf("error generating self-signed certificate: %w", err)
+	}
+
+	certificate, err := tls.LoadX509KeyPair(certPath, keyPath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info("generated self-signed certificate", "hosts", hosts, "path", certPath)
+	logFingerprint(certificate, certPath)
+	return &certificate, nil
+}
+
+/*
+certificateHosts lists the names a self-signed certificate covers: the
+host the web server listens on, this machine's name, localhost, and any
+configured extras.
+*/
+func certificateHosts(config *configuration.Config) []string {
+	result := []string{"localhost", "127.0.0.1", "::1"}
+
+	if host, _, err := net.SplitHostPort(config.Host); err == nil && host != "" && host != "0.0.0.0" && host != "::" {
+		result = append(result, host)
+	}
+
+	if hostName, err := os.Hostname(); err == nil && hostName != "" {
+		result = append(result, hostName)
+	}
+
+	for _, host := range strings.Split(config.TlsHosts, ",") {
+		if host = strings.TrimSpace(host); host != "" {
+			result = append(result, host)
+		}
+	}
+
+	slices.Sort(result)
+	return slices.Compact(result)
+}
+
+func stillValid(certificate tls.Certificate, hosts []string) bool {
+	leaf, err := x509.ParseCertificate(certificate.Certificate[0])
+
+	if err != nil || time.Now().Add(renewBefore).After(leaf.NotAfter) {
+		return false
+	}
+
+	for _, host := range hosts {
+		if leaf.VerifyHostname(host) != nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+func generateSelfSigned(certPath, keyPath string, hosts []string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	if err != nil {
+		return err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	template := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "SFTP Slurper", Organization: []string{"SFTP Slurper"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(SelfSignedLifetime),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+
+	if err != nil {
+		return err
+	}
+
+	keyDer, err := x509.MarshalPKCS8PrivateKey(key)
+
+	if err != nil {
+		return err
+	}
+
+	if err = os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		return err
+	}
+
+	return os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+}
+
+/*
+logFingerprint logs the certificate's SHA-256 fingerprint, so it can be
+compared with what a browser shows before trusting it.
+*/
+func logFingerprint(certificate tls.Certificate, certPath string) {
+	sum := sha256.Sum256(certificate.Certificate[0])
+	fingerprint := strings.ReplaceAll(fmt.Sprintf("% X", sum), " ", ":")
+
+	slog.Info("using self-signed certificate", "path", certPath, "sha256", fingerprint)
+}
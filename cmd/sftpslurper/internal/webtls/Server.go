@@ -0,0 +1,67 @@
+package webtls
+
+import (
+	"crypto/tls"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+const (
+	// readHeaderTimeout is how long a client has to send its request headers
+	readHeaderTimeout = 30 * time.Second
+
+	// idleTimeout is how long a keep-alive connection waits for the next request
+	idleTimeout = 120 * time.Second
+)
+
+/*
+SetupServer starts the web server, over HTTPS when a certificate is given
+and plain HTTP otherwise. It replaces mux.SetupServer, and returns the
+server and a channel that receives the shutdown signal, so the server is
+stopped the same way. Both get the same timeouts. There is no write or
+read timeout, as downloads of large files and zips, and slow uploads,
+take as long as they take. Only the request headers have to arrive in
+time. Unlike mux.SetupServer no CORS headers are added, as the pages and
+their scripts are served from the same origin.
+*/
+func SetupServer(address string, handler http.Handler, certificate *tls.Certificate) (*http.Server, chan os.Signal) {
+	server := &http.Server{
+		Addr:              address,
+		Handler:           handler,
+		ReadHeaderTimeout: readHeaderTimeout,
+		IdleTimeout:       idleTimeout,
+	}
+
+	if certificate != nil {
+		server.TLSConfig = &tls.Config{
+			Certificates: []tls.Certificate{*certificate},
+			MinVersion:   tls.VersionTLS12,
+		}
+	}
+
+	go func() {
+		var err error
+
+		if certificate != nil {
+			slog.Info("starting HTTPS server", slog.String("address", address))
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			slog.Info("starting HTTP server", slog.String("address", address))
+			err = server.ListenAndServe()
+		}
+
+		if err != nil && err != http.ErrServerClosed {
+			slog.Error("error starting web server", slog.Any("error", err))
+			os.Exit(-1)
+		}
+	}()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
+
+	return server, quit
+}
@@ -2,16 +2,35 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"embed"
 	"log/slog"
 	"net/http"
+	"os"
+	"time"
 
 	"github.com/adampresley/adamgokit/httphelpers"
 	"github.com/adampresley/adamgokit/mux"
 	"github.com/adampresley/adamgokit/rendering"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/attempts"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/audit"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/auditlog"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/authlog"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/cleanup"
 	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/configuration"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/details"
 	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/home"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/hooks"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/pgp"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/retention"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/search"
 	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/sftp"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/trash"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/trashbin"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/validation"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/versioning"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/webauth"
+	"github.com/adampresley/sftpslurper/cmd/sftpslurper/internal/webtls"
 )
 
 var (
@@ -22,13 +41,37 @@ var (
 	appFS embed.FS
 
 	/* Services */
-	renderer rendering.TemplateRenderer
+	renderer   rendering.TemplateRenderer
+	authLog    *authlog.AttemptLog
+	guard      *authlog.Guard
+	auditLog   *audit.Logger
+	webAuth    *webauth.Auth
+	trashBin   *trashbin.Bin
+	versions   *versioning.Store
+	janitor    *retention.Janitor
+	hookRunner *hooks.Runner
+	keyring    *pgp.Keyring
+	validator  *validation.Validator
 
 	/* Controllers */
-	homeController home.HomeHandlers
+	homeController     home.HomeHandlers
+	attemptsController attempts.AttemptsHandlers
+	auditLogController auditlog.AuditLogHandlers
+	searchController   search.SearchHandlers
+	detailsController  details.DetailsHandlers
+	loginController    webauth.LoginHandlers
+	trashController    trash.TrashHandlers
+	cleanupController  cleanup.CleanupHandlers
 )
 
 func main() {
+	var (
+		err         error
+		certificate *tls.Certificate
+		httpServer  *http.Server
+		quit        chan os.Signal
+	)
+
 	config := configuration.LoadConfig(Version)
 	setupLogger(&config, Version)
 
@@ -37,6 +80,8 @@ func main() {
 		slog.String("version", Version),
 		slog.String("loglevel", config.LogLevel),
 		slog.String("host", config.Host),
+		slog.String("webauth", config.WebAuth),
+		slog.String("collisionpolicy", config.CollisionPolicy),
 	)
 
 	slog.Debug("setting up...")
@@ -52,12 +97,152 @@ func main() {
 		ComponentsDir:     "components",
 	})
 
+	if authLog, err = authlog.NewAttemptLog(authlog.AttemptLogConfig{
+		Size:     config.AuthLogSize,
+		FileName: config.AuthLogFile,
+	}); err != nil {
+		slog.Error("error setting up auth log", "error", err)
+		os.Exit(1)
+	}
+
+	guard = authlog.NewGuard(authlog.GuardConfig{
+		LockoutThreshold: config.AuthLockoutThreshold,
+		LockoutDuration:  time.Duration(config.AuthLockoutMinutes) * time.Minute,
+		RateLimit:        config.AuthRateLimit,
+	})
+
+	if auditLog, err = audit.NewLogger(audit.LoggerConfig{
+		FileName:  config.AuditLogFile,
+		MaxSizeMB: config.AuditLogMaxSizeMB,
+		MaxFiles:  config.AuditLogMaxFiles,
+	}); err != nil {
+		slog.Error("error setting up audit log", "error", err)
+		os.Exit(1)
+	}
+
+	trashBin = trashbin.NewBin(trashbin.BinConfig{
+		Config: &config,
+		MaxAge: time.Duration(config.TrashMaxAgeDays) * 24 * time.Hour,
+	})
+
+	if versions, err = versioning.NewStore(versioning.StoreConfig{
+		Policy: config.CollisionPolicy,
+		Keep:   config.VersionsToKeep,
+	}); err != nil {
+		slog.Error("error setting up file versions", "error", err)
+		os.Exit(1)
+	}
+
+	if validator, err = validation.NewValidator(validation.ValidatorConfig{
+		Config:   &config,
+		AuditLog: auditLog,
+	}); err != nil {
+		slog.Error("error setting up validation rules", "error", err)
+		os.Exit(1)
+	}
+
+	if keyring, err = pgp.NewKeyring(pgp.KeyringConfig{
+		FileName:   config.PgpKeyring,
+		Passphrase: config.PgpPassphrase,
+		EncryptTo:  config.PgpEncryptTo,
+	}); err != nil {
+		slog.Error("error setting up PGP keyring", "error", err)
+		os.Exit(1)
+	}
+
+	if keyring.Count() > 0 {
+		slog.Info("PGP keyring loaded", "keys", keyring.Count(), "encryptto", keyring.Recipient())
+	}
+
+	hookRunner = hooks.NewRunner(hooks.RunnerConfig{
+		Config:    &config,
+		AuditLog:  auditLog,
+		Versions:  versions,
+		Validator: validator,
+		Keyring:   keyring,
+	})
+
+	janitor = retention.NewJanitor(retention.JanitorConfig{
+		Config:   &config,
+		AuditLog: auditLog,
+		Versions: versions,
+		Hooks:    hookRunner,
+		Interval: time.Duration(config.RetentionIntervalMinutes) * time.Minute,
+	})
+
+	if certificate, err = webtls.LoadCertificate(&config); err != nil {
+		slog.Error("error setting up TLS", "error", err)
+		os.Exit(1)
+	}
+
+	if webAuth, err = webauth.NewAuth(webauth.AuthConfig{
+		Config:  &config,
+		AuthLog: authLog,
+		Guard:   guard,
+		Secure:  certificate != nil,
+	}); err != nil {
+		slog.Error("error setting up web authentication", "error", err)
+		os.Exit(1)
+	}
+
 	/*
 	 * Setup controllers
 	 */
 	homeController = home.NewHomeController(home.HomeControllerConfig{
+		Config:    &config,
+		Renderer:  renderer,
+		AuditLog:  auditLog,
+		Trash:     trashBin,
+		Versions:  versions,
+		Hooks:     hookRunner,
+		Keyring:   keyring,
+		Validator: validator,
+	})
+
+	attemptsController = attempts.NewAttemptsController(attempts.AttemptsControllerConfig{
+		Config:   &config,
+		Renderer: renderer,
+		AuthLog:  authLog,
+		Guard:    guard,
+	})
+
+	auditLogController = auditlog.NewAuditLogController(auditlog.AuditLogControllerConfig{
+		Config:   &config,
+		Renderer: renderer,
+		AuditLog: auditLog,
+	})
+
+	searchController = search.NewSearchController(search.SearchControllerConfig{
+		Config:   &config,
+		Renderer: renderer,
+	})
+
+	detailsController = details.NewDetailsController(details.DetailsControllerConfig{
+		Config:   &config,
+		Renderer: renderer,
+		AuditLog: auditLog,
+		Versions: versions,
+		Hooks:    hookRunner,
+		Keyring:  keyring,
+	})
+
+	loginController = webauth.NewLoginController(webauth.LoginControllerConfig{
+		Config:   &config,
+		Renderer: renderer,
+		Auth:     webAuth,
+	})
+
+	trashController = trash.NewTrashController(trash.TrashControllerConfig{
 		Config:   &config,
 		Renderer: renderer,
+		AuditLog: auditLog,
+		Trash:    trashBin,
+	})
+
+	cleanupController = cleanup.NewCleanupController(cleanup.CleanupControllerConfig{
+		Config:   &config,
+		Renderer: renderer,
+		Janitor:  janitor,
 	})
 
 	/*
@@ -69,9 +254,37 @@ func main() {
 		{Path: "GET /heartbeat", HandlerFunc: heartbeat},
 		{Path: "GET /", HandlerFunc: homeController.HomePage},
 		{Path: "GET /about", HandlerFunc: homeController.AboutPage},
+		{Path: "GET /login", HandlerFunc: loginController.LoginPage},
+		{Path: "POST /login", HandlerFunc: loginController.Login},
+		{Path: "POST /logout", HandlerFunc: loginController.Logout},
+		{Path: "POST /view-as", HandlerFunc: loginController.ViewAs},
 		{Path: "GET /uploads", HandlerFunc: homeController.ServeFile},
 		{Path: "GET /preview", HandlerFunc: homeController.PreviewContent},
+		{Path: "GET /compare", HandlerFunc: homeController.CompareFiles},
 		{Path: "DELETE /uploads", HandlerFunc: homeController.DeleteFile},
+		{Path: "POST /uploads", HandlerFunc: homeController.UploadFile},
+		{Path: "POST /uploads/chunk", HandlerFunc: homeController.UploadChunk},
+		{Path: "POST /files/move", HandlerFunc: homeController.MoveFile},
+		{Path: "POST /files/copy", HandlerFunc: homeController.CopyFile},
+		{Path: "POST /folders", HandlerFunc: homeController.CreateFolder},
+		{Path: "GET /archive", HandlerFunc: homeController.DownloadArchive},
+		{Path: "GET /archive/entry", HandlerFunc: homeController.DownloadArchiveEntry},
+		{Path: "GET /thumbnails", HandlerFunc: homeController.ServeThumbnail},
+		{Path: "GET /versions", HandlerFunc: homeController.DownloadVersion},
+		{Path: "GET /decrypt", HandlerFunc: homeController.DownloadDecrypted},
+		{Path: "GET /auth-attempts", HandlerFunc: attemptsController.AttemptsPage},
+		{Path: "DELETE /auth-attempts/lockouts", HandlerFunc: attemptsController.UnlockUser},
+		{Path: "GET /audit-log", HandlerFunc: auditLogController.AuditLogPage},
+		{Path: "GET /audit-log/download", HandlerFunc: auditLogController.DownloadAuditLog},
+		{Path: "GET /search", HandlerFunc: searchController.SearchPage},
+		{Path: "GET /files/details", HandlerFunc: detailsController.FileDetails},
+		{Path: "GET /files/checksums", HandlerFunc: detailsController.FileChecksums},
+		{Path: "GET /files/pgp", HandlerFunc: detailsController.FilePgp},
+		{Path: "GET /trash", HandlerFunc: trashController.TrashPage},
+		{Path: "POST /trash/restore", HandlerFunc: trashController.RestoreItem},
+		{Path: "DELETE /trash", HandlerFunc: trashController.PurgeItems},
+		{Path: "GET /cleanup", HandlerFunc: cleanupController.CleanupPage},
+		{Path: "POST /cleanup", HandlerFunc: cleanupController.RunCleanup},
 	}
 
 	routerConfig := mux.RouterConfig{
@@ -81,16 +294,32 @@ func main() {
 		StaticContentRootDir: "app",
 		StaticContentPrefix:  "/static/",
 		StaticFS:             appFS,
+		Middlewares:          []mux.MiddlewareFunc{webAuth.Middleware},
 	}
 
 	m := mux.SetupRouter(routerConfig, routes)
-	httpServer, quit := mux.SetupServer(routerConfig, m)
+
+	httpServer, quit = webtls.SetupServer(routerConfig.Address, m, certificate)
 
 	/*
-	 * Start up the SFTP server
+	 * Start up the SFTP server, the trash and partial upload purgers, and
+	 * the retention janitor
 	 */
-	sftpShutdownCtx, sftpCancel := context.WithCancel(context.Background())
-	sftp.StartServer(&config, sftpShutdownCtx)
+	shutdownCtx, shutdownCancel := context.WithCancel(context.Background())
+	sftp.StartServer(sftp.ServerConfig{
+		Config:   &config,
+		AuthLog:  authLog,
+		Guard:    guard,
+		AuditLog: auditLog,
+		Trash:    trashBin,
+		Versions: versions,
+		Hooks:    hookRunner,
+		Keyring:  keyring,
+	}, shutdownCtx)
+
+	trashBin.StartPurger(shutdownCtx)
+	home.StartPartialPurger(shutdownCtx)
+	janitor.StartSchedule(shutdownCtx)
 
 	/*
 	 * Wait for graceful shutdown
@@ -98,8 +327,10 @@ func main() {
 	slog.Info("server started")
 
 	<-quit
-	sftpCancel()
+	shutdownCancel()
 	mux.Shutdown(httpServer)
+	_ = authLog.Close()
+	_ = auditLog.Close()
 	slog.Info("server stopped")
 }
 